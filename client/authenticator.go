@@ -131,7 +131,7 @@ func (a *authenticator) generateToken(d *authData) (*authData, error) {
 	v.Set("code", d.Code)
 	v.Set("redirect_uri", a.c.getRedirectURL())
 	v.Set("grant_type", "authorization_code")
-	res, err := http.PostForm(tokenEndpoint, v)
+	res, err := a.c.c.PostForm(tokenEndpoint, v)
 	if err != nil {
 		return d, fmt.Errorf("generateToken: create request: %w", err)
 	}
@@ -0,0 +1,178 @@
+package bandwidth
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/time/rate"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Unlimited is the rate used when the limiter is off
+	Unlimited int64 = 0
+
+	minBurst = 64 * 1024
+)
+
+// Slot is a bandwidth limit starting at a time of the day
+type Slot struct {
+	// Start is the offset from midnight
+	Start time.Duration
+	// Rate is the limit in bytes per second (Unlimited to turn it off)
+	Rate int64
+}
+
+// Schedule is a list of slots sorted by start time.
+// The last slot of the day wraps around midnight.
+type Schedule []Slot
+
+// ParseSchedule parses a schedule like "08:00,512k 19:00,off".
+// A single rate without time (like "1M") is a constant limit.
+// Rates use binary suffixes (b, k, M, G) and "off" disables the limit.
+func ParseSchedule(s string) (Schedule, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	fields := strings.Fields(s)
+	if len(fields) == 1 && !strings.Contains(fields[0], ",") {
+		r, err := ParseRate(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		return Schedule{{Start: 0, Rate: r}}, nil
+	}
+
+	var sched Schedule
+	for _, f := range fields {
+		tm, rt, ok := strings.Cut(f, ",")
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule entry %q: expected HH:MM,rate", f)
+		}
+		start, err := time.Parse("15:04", tm)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule time %q: %w", tm, err)
+		}
+		r, err := ParseRate(rt)
+		if err != nil {
+			return nil, err
+		}
+		sched = append(sched, Slot{
+			Start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+			Rate:  r,
+		})
+	}
+	sort.Slice(sched, func(i, j int) bool {
+		return sched[i].Start < sched[j].Start
+	})
+	return sched, nil
+}
+
+// ParseRate parses a rate like "512k" into bytes per second,
+// the rates under 1 B/s are invalid
+func ParseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	in := s
+	if s == "" || strings.EqualFold(s, "off") || s == "0" {
+		return Unlimited, nil
+	}
+	mult := int64(1)
+	switch s[len(s)-1] {
+	case 'b', 'B':
+		s = s[:len(s)-1]
+	case 'k', 'K':
+		mult, s = 1024, s[:len(s)-1]
+	case 'm', 'M':
+		mult, s = 1024*1024, s[:len(s)-1]
+	case 'g', 'G':
+		mult, s = 1024*1024*1024, s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+		return 0, fmt.Errorf("invalid rate %q", in)
+	}
+	r := v * float64(mult)
+	if r < 1 || r >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid rate %q: expected at least 1 B/s (or off)", in)
+	}
+	return int64(r), nil
+}
+
+// RateAt returns the limit active at t
+func (s Schedule) RateAt(t time.Time) int64 {
+	if len(s) == 0 {
+		return Unlimited
+	}
+	y, m, d := t.Date()
+	offset := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	active := s[len(s)-1]
+	for _, slot := range s {
+		if slot.Start > offset {
+			break
+		}
+		active = slot
+	}
+	return active.Rate
+}
+
+// Limiter is a token bucket shared by all the transfers,
+// its rate follows the configured schedule
+type Limiter struct {
+	mu      sync.Mutex
+	sched   Schedule
+	current int64
+	l       *rate.Limiter
+	now     func() time.Time
+}
+
+// NewLimiter creates a limiter following sched
+func NewLimiter(sched Schedule) *Limiter {
+	return &Limiter{
+		sched:   sched,
+		current: Unlimited,
+		l:       rate.NewLimiter(rate.Inf, 0),
+		now:     time.Now,
+	}
+}
+
+// WaitN blocks until n bytes can be transferred
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	lim, burst := l.limiter()
+	if lim == nil {
+		return nil
+	}
+	for n > 0 {
+		chunk := min(n, burst)
+		if err := lim.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+func (l *Limiter) limiter() (*rate.Limiter, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := l.sched.RateAt(l.now())
+	if r == Unlimited {
+		l.current = Unlimited
+		return nil, 0
+	}
+	if r != l.current {
+		burst := int(max(r, minBurst))
+		if burst > math.MaxInt32 {
+			burst = math.MaxInt32
+		}
+		l.l.SetLimit(rate.Limit(r))
+		l.l.SetBurst(burst)
+		l.current = r
+	}
+	return l.l, l.l.Burst()
+}
@@ -0,0 +1,122 @@
+package bandwidth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "", want: Unlimited},
+		{in: "off", want: Unlimited},
+		{in: "OFF", want: Unlimited},
+		{in: "0", want: Unlimited},
+		{in: "100", want: 100},
+		{in: "100b", want: 100},
+		{in: "512k", want: 512 * 1024},
+		{in: "1.5M", want: 1536 * 1024},
+		{in: "2G", want: 2 * 1024 * 1024 * 1024},
+		{in: "fast", wantErr: true},
+		{in: "k", wantErr: true},
+		{in: "-1M", wantErr: true},
+		{in: "0.5", wantErr: true},
+		{in: "0.0001k", wantErr: true},
+		{in: "0.5k", want: 512},
+		{in: "1e30G", wantErr: true},
+		{in: "inf", wantErr: true},
+		{in: "+Inf", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "nanM", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRate(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Schedule
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "constant", in: " 1M ", want: Schedule{{Start: 0, Rate: 1024 * 1024}}},
+		{
+			name: "slots",
+			in:   "08:00,512k 19:30,off",
+			want: Schedule{
+				{Start: 8 * time.Hour, Rate: 512 * 1024},
+				{Start: 19*time.Hour + 30*time.Minute, Rate: Unlimited},
+			},
+		},
+		{
+			name: "unsorted",
+			in:   "19:00,off 08:00,1M",
+			want: Schedule{
+				{Start: 8 * time.Hour, Rate: 1024 * 1024},
+				{Start: 19 * time.Hour, Rate: Unlimited},
+			},
+		},
+		{name: "single slot", in: "08:00,1M", want: Schedule{{Start: 8 * time.Hour, Rate: 1024 * 1024}}},
+		{name: "slot without rate", in: "08:00,1M 19:00", wantErr: true},
+		{name: "invalid time", in: "25:00,1M", wantErr: true},
+		{name: "invalid rate", in: "08:00,fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSchedule(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateAt(t *testing.T) {
+	sched, err := ParseSchedule("08:00,512k 12:00,1M 19:00,off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 10, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		name  string
+		sched Schedule
+		t     time.Time
+		want  int64
+	}{
+		{name: "no schedule", t: at(10, 0), want: Unlimited},
+		{name: "slot start", sched: sched, t: at(8, 0), want: 512 * 1024},
+		{name: "inside a slot", sched: sched, t: at(11, 59), want: 512 * 1024},
+		{name: "next slot", sched: sched, t: at(12, 0), want: 1024 * 1024},
+		{name: "last slot", sched: sched, t: at(23, 59), want: Unlimited},
+		// the last slot of the day goes on after midnight
+		{name: "wraps around midnight", sched: sched[:2], t: at(3, 0), want: 1024 * 1024},
+		{name: "constant", sched: Schedule{{Rate: 100}}, t: at(0, 0), want: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sched.RateAt(tt.t); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	graphBatchEndpoint = "https://graph.microsoft.com/v1.0/$batch"
+
+	// maxBatchSize is the number of requests Graph accepts in a batch
+	maxBatchSize = 20
+	// maxBatchRetries is how many times the throttled requests are sent again
+	maxBatchRetries = 5
+	// batchRetryDelay is the wait before sending the throttled
+	// requests again when the responses don't tell it
+	batchRetryDelay = 5 * time.Second
+	// maxBatchRetryDelay caps the wait asked by the responses
+	maxBatchRetryDelay = 2 * time.Minute
+)
+
+// BatchRequest is a request sent packed with others in a JSON batch
+type BatchRequest struct {
+	// ID identifies the request in the batch, assigned when empty
+	ID     string
+	Method string
+	// URL is relative to the API version, like "/drives/{drive}/items/{item}"
+	URL     string
+	Headers map[string]string
+	// Body is sent as JSON
+	Body any
+	// DependsOn has the IDs of the requests that must succeed before
+	// this one runs, they're always sent in the same batch
+	DependsOn []string
+	// Result, when set, receives the decoded body of a 2xx response
+	Result types.APIResponse
+}
+
+// BatchResponse is the outcome of a BatchRequest
+type BatchResponse struct {
+	ID         string
+	StatusCode int
+	// Err is a *types.GraphError for the non 2xx responses
+	Err error
+}
+
+// DeleteItemRequest is the batch request to delete an item
+func DeleteItemRequest(driveID, itemID string) BatchRequest {
+	return BatchRequest{
+		Method: http.MethodDelete,
+		URL:    fmt.Sprintf("/drives/%s/items/%s", driveID, itemID),
+	}
+}
+
+// MoveItemRequest is the batch request to move (and rename) an
+// item, the moved item is decoded to res when it isn't nil
+func MoveItemRequest(driveID, itemID, parentID, name string, res *types.Item) BatchRequest {
+	payload := itemUpdate{Name: name}
+	if parentID != "" {
+		payload.ParentReference = &itemParentRef{ID: parentID}
+	}
+	r := BatchRequest{
+		Method:  http.MethodPatch,
+		URL:     fmt.Sprintf("/drives/%s/items/%s", driveID, itemID),
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    payload,
+	}
+	if res != nil {
+		r.Result = res
+	}
+	return r
+}
+
+// PermanentDeleteItemRequest is the batch request to delete an
+// item without moving it to the recycle bin
+func PermanentDeleteItemRequest(driveID, itemID string) BatchRequest {
+	return BatchRequest{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("/drives/%s/items/%s/permanentDelete", driveID, itemID),
+	}
+}
+
+// RestoreItemRequest is the batch request to restore a deleted item, the
+// restored item is decoded to res when it isn't nil
+func RestoreItemRequest(driveID, itemID, parentID, name string, res *types.Item) BatchRequest {
+	r := BatchRequest{
+		Method:  http.MethodPost,
+		URL:     fmt.Sprintf("/drives/%s/items/%s/restore", driveID, itemID),
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    newRestorePayload(parentID, name),
+	}
+	if res != nil {
+		r.Result = res
+	}
+	return r
+}
+
+// DeletePermissionRequest is the batch request to remove a sharing permission
+func DeletePermissionRequest(driveID, itemID, permissionID string) BatchRequest {
+	return BatchRequest{
+		Method: http.MethodDelete,
+		URL:    fmt.Sprintf("/drives/%s/items/%s/permissions/%s", driveID, itemID, url.PathEscape(permissionID)),
+	}
+}
+
+// Batch sends the requests packed in JSON batches of up to 20 requests,
+// the requests linked by DependsOn are kept in the same batch. Only the
+// throttled requests are sent again, once the wait asked by the API is
+// over. The responses are returned in the requests order, the
+// error is only set when the batches couldn't be sent.
+func (c *client) Batch(ctx context.Context, reqs []BatchRequest) ([]BatchResponse, error) {
+	reqs = append([]BatchRequest(nil), reqs...)
+	index := make(map[string]int, len(reqs))
+	for i := range reqs {
+		if reqs[i].ID == "" {
+			reqs[i].ID = strconv.Itoa(i + 1)
+		}
+		if _, ok := index[reqs[i].ID]; ok {
+			return nil, fmt.Errorf("duplicated batch request id %q", reqs[i].ID)
+		}
+		index[reqs[i].ID] = i
+	}
+	for _, r := range reqs {
+		for _, d := range r.DependsOn {
+			if _, ok := index[d]; !ok {
+				return nil, fmt.Errorf("batch request %q depends on the unknown request %q", r.ID, d)
+			}
+		}
+	}
+
+	responses := make([]BatchResponse, len(reqs))
+	pending := make([]int, len(reqs))
+	for i := range reqs {
+		pending[i] = i
+	}
+	for attempt := 0; len(pending) > 0; attempt++ {
+		batches, err := packBatches(reqs, pending, index)
+		if err != nil {
+			return nil, err
+		}
+		sendCtx := ctx
+		if attempt > 0 {
+			sendCtx = withRetry(ctx)
+		}
+		var throttled []int
+		var wait time.Duration
+		for _, b := range batches {
+			retry, after, err := c.sendBatch(sendCtx, reqs, b, responses)
+			if err != nil {
+				return nil, err
+			}
+			throttled = append(throttled, retry...)
+			wait = max(wait, after)
+		}
+		if len(throttled) == 0 || attempt == maxBatchRetries {
+			break
+		}
+		slog.With(
+			slog.Int("requests", len(throttled)),
+			slog.Duration("wait", wait),
+		).WarnContext(ctx, "batch requests throttled")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		pending = throttled
+	}
+	return responses, nil
+}
+
+// sendBatch sends the requests at indexes, their responses are set in
+// responses. It returns the requests to send again (the throttled ones
+// and those depending on them) and how long to wait before that.
+func (c *client) sendBatch(ctx context.Context, reqs []BatchRequest, indexes []int, responses []BatchResponse) ([]int, time.Duration, error) {
+	sent := make(map[string]int, len(indexes))
+	for _, i := range indexes {
+		responses[i] = BatchResponse{}
+	}
+	payload := types.BatchRequests{Requests: make([]types.BatchSubRequest, 0, len(indexes))}
+	for _, i := range indexes {
+		r := reqs[i]
+		sent[r.ID] = i
+		payload.Requests = append(payload.Requests, types.BatchSubRequest{
+			ID:        r.ID,
+			Method:    r.Method,
+			URL:       r.URL,
+			Headers:   r.Headers,
+			Body:      r.Body,
+			DependsOn: r.DependsOn,
+		})
+	}
+	// the dependencies already succeeded on a previous attempt
+	for k := range payload.Requests {
+		var deps []string
+		for _, d := range payload.Requests[k].DependsOn {
+			if _, ok := sent[d]; ok {
+				deps = append(deps, d)
+			}
+		}
+		payload.Requests[k].DependsOn = deps
+	}
+
+	var res types.BatchResponses
+	if err := c.postJSON(ctx, graphBatchEndpoint, payload, &res); err != nil {
+		var gErr *types.GraphError
+		if errors.As(err, &gErr) && isThrottled(gErr.StatusCode) {
+			for _, i := range indexes {
+				responses[i] = BatchResponse{ID: reqs[i].ID, StatusCode: gErr.StatusCode, Err: gErr}
+			}
+			return indexes, batchRetryDelay, nil
+		}
+		return nil, 0, fmt.Errorf("send batch: %w", err)
+	}
+
+	var wait time.Duration
+	retry := map[int]bool{}
+	for _, sr := range res.Responses {
+		i, ok := sent[sr.ID]
+		if !ok {
+			continue
+		}
+		responses[i] = newBatchResponse(reqs[i], sr)
+		c.errors.record(reqs[i].Method, reqs[i].URL, responses[i].Err)
+		c.metrics.batchResponse(reqs[i].Method, reqs[i].URL, sr.Status)
+		if isThrottled(sr.Status) {
+			retry[i] = true
+			wait = max(wait, retryAfter(sr.Headers))
+		}
+	}
+	for _, i := range indexes {
+		if responses[i].ID == "" {
+			responses[i] = BatchResponse{ID: reqs[i].ID, Err: fmt.Errorf("no response to batch request %q", reqs[i].ID)}
+		}
+	}
+	// the failed dependencies of the throttled requests
+	for changed := true; changed; {
+		changed = false
+		for _, i := range indexes {
+			if retry[i] || responses[i].StatusCode != http.StatusFailedDependency {
+				continue
+			}
+			for _, d := range reqs[i].DependsOn {
+				if j, ok := sent[d]; ok && retry[j] {
+					retry[i], changed = true, true
+					break
+				}
+			}
+		}
+	}
+
+	var throttled []int
+	for _, i := range indexes {
+		if retry[i] {
+			throttled = append(throttled, i)
+		}
+	}
+	return throttled, wait, nil
+}
+
+// newBatchResponse decodes the response of r
+func newBatchResponse(r BatchRequest, sr types.BatchSubResponse) BatchResponse {
+	resp := BatchResponse{ID: r.ID, StatusCode: sr.Status}
+	if sr.Status/100 != 2 {
+		resp.Err = newGraphError(sr.Status, sr.Body)
+		return resp
+	}
+	if r.Result == nil || len(sr.Body) == 0 {
+		return resp
+	}
+	if err := json.Unmarshal(sr.Body, r.Result); err != nil {
+		resp.Err = fmt.Errorf("decode response: %w", err)
+		return resp
+	}
+	r.Result.SetRawBody(string(sr.Body))
+	r.Result.SetStatusCode(sr.Status)
+	return resp
+}
+
+// packBatches groups the requests at indexes in batches of up to
+// maxBatchSize requests, keeping the dependent requests together
+func packBatches(reqs []BatchRequest, indexes []int, index map[string]int) ([][]int, error) {
+	parent := make(map[int]int, len(indexes))
+	for _, i := range indexes {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for _, i := range indexes {
+		for _, d := range reqs[i].DependsOn {
+			if j, ok := parent[index[d]]; ok {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	var order []int
+	groups := map[int][]int{}
+	for _, i := range indexes {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			order = append(order, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+
+	var batches [][]int
+	var current []int
+	for _, root := range order {
+		g := groups[root]
+		if len(g) > maxBatchSize {
+			return nil, fmt.Errorf("batch request %q has more than %d linked requests", reqs[g[0]].ID, maxBatchSize)
+		}
+		if len(current)+len(g) > maxBatchSize {
+			batches = append(batches, current)
+			current = nil
+		}
+		current = append(current, g...)
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches, nil
+}
+
+// IsThrottled tells if err is a Graph API response
+// asking to slow down the requests
+func IsThrottled(err error) bool {
+	var gErr *types.GraphError
+	if errors.As(err, &gErr) {
+		return isThrottled(gErr.StatusCode)
+	}
+	return false
+}
+
+func isThrottled(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// retryAfter is the wait asked by the Retry-After header
+func retryAfter(headers map[string]string) time.Duration {
+	for k, v := range headers {
+		if !strings.EqualFold(k, "Retry-After") {
+			continue
+		}
+		if s, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && s >= 0 {
+			return min(time.Duration(s)*time.Second, maxBatchRetryDelay)
+		}
+	}
+	return batchRetryDelay
+}
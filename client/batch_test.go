@@ -0,0 +1,223 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/eldius/onedrive-client/client/types"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// batchRequests builds n requests, the n-th one depends on the
+// requests listed in deps[n] (by position)
+func batchRequests(n int, deps map[int][]int) []BatchRequest {
+	reqs := make([]BatchRequest, n)
+	for i := range reqs {
+		reqs[i] = DeleteItemRequest("drive", strconv.Itoa(i))
+		reqs[i].ID = strconv.Itoa(i)
+		for _, d := range deps[i] {
+			reqs[i].DependsOn = append(reqs[i].DependsOn, strconv.Itoa(d))
+		}
+	}
+	return reqs
+}
+
+func TestPackBatches(t *testing.T) {
+	seq := func(from, to int) []int {
+		var s []int
+		for i := from; i < to; i++ {
+			s = append(s, i)
+		}
+		return s
+	}
+	tests := []struct {
+		name    string
+		reqs    []BatchRequest
+		indexes []int
+		want    [][]int
+		wantErr bool
+	}{
+		{
+			name:    "independent",
+			reqs:    batchRequests(45, nil),
+			indexes: seq(0, 45),
+			want:    [][]int{seq(0, 20), seq(20, 40), seq(40, 45)},
+		},
+		{
+			name: "dependent requests kept together",
+			// 21 depends on 18, it's packed next to it
+			reqs:    batchRequests(25, map[int][]int{21: {18}}),
+			indexes: seq(0, 25),
+			want:    [][]int{append(seq(0, 19), 21), {19, 20, 22, 23, 24}},
+		},
+		{
+			name: "linked requests moved to the next batch",
+			// 19 and 21 don't fit in the first batch
+			reqs:    batchRequests(25, map[int][]int{21: {19}}),
+			indexes: seq(0, 25),
+			want:    [][]int{seq(0, 19), {19, 21, 20, 22, 23, 24}},
+		},
+		{
+			name:    "chain",
+			reqs:    batchRequests(4, map[int][]int{1: {0}, 2: {1}, 3: {0}}),
+			indexes: seq(0, 4),
+			want:    [][]int{seq(0, 4)},
+		},
+		{
+			name: "dependency already sent",
+			// 2 isn't pending, 3 doesn't need to follow it
+			reqs:    batchRequests(23, map[int][]int{22: {2}}),
+			indexes: append([]int{0, 1}, seq(3, 23)...),
+			want:    [][]int{append([]int{0, 1}, seq(3, 21)...), {21, 22}},
+		},
+		{
+			name: "too many linked requests",
+			reqs: batchRequests(21, map[int][]int{
+				1: {0}, 2: {0}, 3: {0}, 4: {0}, 5: {0}, 6: {0}, 7: {0}, 8: {0}, 9: {0}, 10: {0},
+				11: {0}, 12: {0}, 13: {0}, 14: {0}, 15: {0}, 16: {0}, 17: {0}, 18: {0}, 19: {0}, 20: {0},
+			}),
+			indexes: seq(0, 21),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := make(map[string]int, len(tt.reqs))
+			for i, r := range tt.reqs {
+				index[r.ID] = i
+			}
+			got, err := packBatches(tt.reqs, tt.indexes, index)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchRetries(t *testing.T) {
+	ok := func(int) int { return http.StatusOK }
+	tests := []struct {
+		name string
+		reqs []BatchRequest
+		// status answers the requests by id and attempt
+		status map[string]func(attempt int) int
+		// wantSent has the requests sent on each attempt,
+		// as "id" or "id:dependencies"
+		wantSent   [][]string
+		wantStatus []int
+	}{
+		{
+			name: "throttled dependency",
+			reqs: batchRequests(3, map[int][]int{1: {0}}),
+			status: map[string]func(int) int{
+				"0": func(attempt int) int {
+					if attempt == 0 {
+						return http.StatusTooManyRequests
+					}
+					return http.StatusOK
+				},
+				"1": func(attempt int) int {
+					if attempt == 0 {
+						return http.StatusFailedDependency
+					}
+					return http.StatusOK
+				},
+				"2": ok,
+			},
+			wantSent:   [][]string{{"0", "1:0", "2"}, {"0", "1:0"}},
+			wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+		{
+			name: "dependency already succeeded",
+			reqs: batchRequests(2, map[int][]int{1: {0}}),
+			status: map[string]func(int) int{
+				"0": ok,
+				"1": func(attempt int) int {
+					if attempt == 0 {
+						return http.StatusServiceUnavailable
+					}
+					return http.StatusOK
+				},
+			},
+			wantSent:   [][]string{{"0", "1:0"}, {"1"}},
+			wantStatus: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name: "failed dependency",
+			reqs: batchRequests(3, map[int][]int{1: {0}}),
+			status: map[string]func(int) int{
+				"0": func(int) int { return http.StatusNotFound },
+				"1": func(int) int { return http.StatusFailedDependency },
+				"2": ok,
+			},
+			wantSent:   [][]string{{"0", "1:0", "2"}},
+			wantStatus: []int{http.StatusNotFound, http.StatusFailedDependency, http.StatusOK},
+		},
+		{
+			name: "always throttled",
+			reqs: batchRequests(2, nil),
+			status: map[string]func(int) int{
+				"0": func(int) int { return http.StatusTooManyRequests },
+				"1": ok,
+			},
+			wantSent:   [][]string{{"0", "1"}, {"0"}, {"0"}, {"0"}, {"0"}, {"0"}},
+			wantStatus: []int{http.StatusTooManyRequests, http.StatusOK},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent [][]string
+			base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				var payload types.BatchRequests
+				if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+					return nil, err
+				}
+				attempt := len(sent)
+				var ids []string
+				var res types.BatchResponses
+				for _, r := range payload.Requests {
+					id := r.ID
+					if len(r.DependsOn) > 0 {
+						id += ":" + strings.Join(r.DependsOn, ",")
+					}
+					ids = append(ids, id)
+					sr := types.BatchSubResponse{ID: r.ID, Status: tt.status[r.ID](attempt)}
+					if isThrottled(sr.Status) {
+						sr.Headers = map[string]string{"Retry-After": "0"}
+						sr.Body = json.RawMessage(`{"error":{"code":"TooManyRequests"}}`)
+					}
+					res.Responses = append(res.Responses, sr)
+				}
+				sent = append(sent, ids)
+				b, _ := json.Marshal(res)
+				return respond(req, http.StatusOK, string(b)), nil
+			})
+			c := New(
+				WithHttpClient(&http.Client{Transport: base}),
+				WithAuthenticationTokenData(&types.TokenData{AccessToken: "token"}),
+			)
+
+			responses, err := c.Batch(context.Background(), tt.reqs)
+			if err != nil {
+				t.Fatalf("batch: %v", err)
+			}
+			if !reflect.DeepEqual(sent, tt.wantSent) {
+				t.Errorf("sent %v, want %v", sent, tt.wantSent)
+			}
+			for i, r := range responses {
+				if r.ID != tt.reqs[i].ID || r.StatusCode != tt.wantStatus[i] {
+					t.Errorf("response %d = %s %d, want %s %d", i, r.ID, r.StatusCode, tt.reqs[i].ID, tt.wantStatus[i])
+				}
+				if (r.Err != nil) != (r.StatusCode/100 != 2) {
+					t.Errorf("response %s error = %v", r.ID, r.Err)
+				}
+			}
+		})
+	}
+}
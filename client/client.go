@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/eldius/onedrive-client/client/types"
 	"github.com/eldius/onedrive-client/internal/configs"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -22,7 +26,15 @@ type Client interface {
 	Authenticate(ctx context.Context) (*types.TokenData, error)
 	AuthenticatedUser(ctx context.Context) (*types.CurrentUser, error)
 	GetAppDriveInfo(ctx context.Context) (*types.AppFolderInfo, error)
-	ListFiles(ctx context.Context, driveID, itemID string) (*types.ListFiles, error)
+	ListFiles(ctx context.Context, driveID, itemID string, opts ...QueryOption) (*types.ListFiles, error)
+	GetItemByPath(ctx context.Context, driveID, itemID, path string) (*types.Item, error)
+	GetItem(ctx context.Context, driveID, itemID string, opts ...QueryOption) (*types.Item, error)
+	Search(ctx context.Context, driveID, query string, opts ...QueryOption) (*types.ListFiles, error)
+	MoveItem(ctx context.Context, driveID, itemID, parentID, name string) (*types.Item, error)
+	DeleteItem(ctx context.Context, driveID, itemID string) error
+	PermanentDeleteItem(ctx context.Context, driveID, itemID string) error
+	ListDeletedItems(ctx context.Context, driveID, itemID string, opts ...QueryOption) (*types.ListFiles, error)
+	RestoreItem(ctx context.Context, driveID, itemID, parentID, name string) (*types.Item, error)
 
 	CreateFolder(
 		ctx context.Context,
@@ -33,28 +45,124 @@ type Client interface {
 
 	UploadFile(
 		ctx context.Context,
-		dirName,
+		driveID,
 		parentID,
-		driveID string,
+		fileName string,
+		r io.ReaderAt,
+		size int64,
+		opts ...TransferOption,
 	) (*types.CreateFile, error)
 
 	CreateUploadSession(
+		ctx context.Context,
+		driveID,
+		parentID,
+		fileName string,
+		opts ...TransferOption,
+	) (*types.UploadSession, error)
+
+	UploadToSession(
+		ctx context.Context,
+		session *types.UploadSession,
+		r io.ReaderAt,
+		size int64,
+		opts ...TransferOption,
+	) (*types.CreateFile, error)
+
+	CancelUploadSession(ctx context.Context, session *types.UploadSession) error
+
+	Download(
+		ctx context.Context,
+		driveID,
+		itemID string,
+		w io.Writer,
+		opts ...TransferOption,
+	) (int64, error)
+
+	ListVersions(ctx context.Context, driveID, itemID string) (*types.ListVersions, error)
+
+	DownloadVersion(
 		ctx context.Context,
 		driveID,
 		itemID,
-		inputFile,
-		outputFile string,
-	) (*types.ListFiles, error)
+		versionID string,
+		w io.Writer,
+		opts ...TransferOption,
+	) (int64, error)
+
+	RestoreVersion(ctx context.Context, driveID, itemID, versionID string) error
+
+	GetThumbnails(ctx context.Context, driveID, itemID, size string) (*types.ListThumbnails, error)
+
+	DownloadThumbnail(
+		ctx context.Context,
+		driveID,
+		itemID,
+		setID,
+		size string,
+		w io.Writer,
+	) (int64, error)
+
+	CreateLink(
+		ctx context.Context,
+		driveID,
+		itemID,
+		linkType,
+		scope string,
+		opts ...ShareOption,
+	) (*types.Permission, error)
+
+	Invite(
+		ctx context.Context,
+		driveID,
+		itemID string,
+		recipients,
+		roles []string,
+		opts ...ShareOption,
+	) (*types.ListPermissions, error)
+
+	ListPermissions(ctx context.Context, driveID, itemID string) (*types.ListPermissions, error)
+	DeletePermission(ctx context.Context, driveID, itemID, permissionID string) error
+
+	Batch(ctx context.Context, reqs []BatchRequest) ([]BatchResponse, error)
+
+	GetDrive(ctx context.Context, driveID string) (*types.Drive, error)
+
+	CreateSubscription(
+		ctx context.Context,
+		driveID,
+		notificationURL,
+		clientState string,
+		expiration time.Time,
+	) (*types.Subscription, error)
+
+	RenewSubscription(ctx context.Context, subscriptionID string, expiration time.Time) (*types.Subscription, error)
+	DeleteSubscription(ctx context.Context, subscriptionID string) error
 }
 
 type client struct {
-	c     *http.Client
-	creds struct {
+	c       *http.Client
+	limiter BandwidthLimiter
+	errors  *ErrorLog
+	metrics *Metrics
+	tracer  trace.Tracer
+	// middlewares are the ones given with WithMiddleware
+	// and outerMiddlewares the ones of WithOuterMiddleware
+	middlewares      []Middleware
+	outerMiddlewares []Middleware
+	maxRetries       int
+	creds            struct {
 		id          string
 		secret      string
-		token       *types.TokenData
 		scopes      []string
 		redirectURL string
+
+		// token is replaced (never changed in place) on refresh
+		mu    sync.Mutex
+		token *types.TokenData
+		// refreshes collapses the refreshes of concurrent 401 responses
+		refreshes        singleflight.Group
+		onTokenRefreshed func(*types.TokenData)
 	}
 }
 
@@ -118,6 +226,14 @@ func WithAuthenticationTokenData(token *types.TokenData) Option {
 	}
 }
 
+// WithTokenRefreshed sets a function called with the new token every
+// time the client refreshes it, to store it for the next clients
+func WithTokenRefreshed(fn func(token *types.TokenData)) Option {
+	return func(c *client) {
+		c.creds.onTokenRefreshed = fn
+	}
+}
+
 // WithHttpClient is to define a custom http.Client
 func WithHttpClient(hc *http.Client) Option {
 	return func(c *client) {
@@ -138,6 +254,17 @@ func WithScopes(scopes ...string) Option {
 	}
 }
 
+// WithBandwidthLimiter sets up a limiter shared by every
+// request made by the client, uploads and downloads included
+func WithBandwidthLimiter(l BandwidthLimiter) Option {
+	return func(c *client) {
+		if l == nil {
+			return
+		}
+		c.limiter = l
+	}
+}
+
 func WithRedirectURL(redirectURL string) Option {
 	return func(c *client) {
 		if redirectURL == "" {
@@ -148,7 +275,7 @@ func WithRedirectURL(redirectURL string) Option {
 }
 
 func New(opts ...Option) Client {
-	c := &client{}
+	c := &client{maxRetries: defaultMaxRetries}
 	for _, opt := range opts {
 		opt(c)
 	}
@@ -156,6 +283,31 @@ func New(opts ...Option) Client {
 	if c.c == nil {
 		c.c = &http.Client{}
 	}
+	if c.errors == nil {
+		c.errors = DefaultErrorLog
+	}
+	if c.metrics == nil {
+		c.metrics = DefaultMetrics
+	}
+	if c.tracer == nil {
+		c.tracer = defaultTracer()
+	}
+	// the given http.Client is left as is
+	hc := *c.c
+	base := hc.Transport
+	if base == nil {
+		base = defaultTransport
+	}
+	mws := []Middleware{
+		c.authMiddleware,
+		RetryMiddleware(c.maxRetries),
+		tracingMiddleware(c.tracer),
+		c.metrics.RoundTripper,
+		loggingMiddleware,
+		bandwidthMiddleware(c.limiter),
+	}
+	hc.Transport = chain(base, slices.Concat(c.outerMiddlewares, mws, c.middlewares)...)
+	c.c = &hc
 
 	return c
 }
@@ -165,10 +317,23 @@ func (c *client) Authenticate(ctx context.Context) (*types.TokenData, error) {
 	if err != nil {
 		return nil, err
 	}
-	c.creds.token = td.TokenData
+	c.setToken(td.TokenData)
 	return td.TokenData, err
 }
 
+// token returns the current access token
+func (c *client) token() *types.TokenData {
+	c.creds.mu.Lock()
+	defer c.creds.mu.Unlock()
+	return c.creds.token
+}
+
+func (c *client) setToken(token *types.TokenData) {
+	c.creds.mu.Lock()
+	defer c.creds.mu.Unlock()
+	c.creds.token = token
+}
+
 func (c *client) AuthenticatedUser(ctx context.Context) (*types.CurrentUser, error) {
 	req, err := http.NewRequest(http.MethodGet, graphApiEndpoint, nil)
 	if err != nil {
@@ -179,7 +344,7 @@ func (c *client) AuthenticatedUser(ctx context.Context) (*types.CurrentUser, err
 	req.Header.Set("Accept", "application/json")
 
 	var resp types.CurrentUser
-	if err := c.doWithRefreshTokenIfUnauthorized(ctx, req, &resp, true, true); err != nil {
+	if err := c.do(req, &resp); err != nil {
 		return nil, fmt.Errorf("executing request: %w", err)
 	}
 
@@ -196,12 +361,28 @@ func (c *client) GetAppDriveInfo(ctx context.Context) (*types.AppFolderInfo, err
 	req.Header.Set("Accept", "application/json")
 
 	var res types.AppFolderInfo
-	if err := c.doWithRefreshTokenIfUnauthorized(ctx, req, &res, true, true); err != nil {
+	if err := c.do(req, &res); err != nil {
 		return nil, fmt.Errorf("executing request: %w", err)
 	}
 	return &res, nil
 }
 
+// GetDrive returns the drive, with its storage quota
+func (c *client) GetDrive(ctx context.Context, driveID string) (*types.Drive, error) {
+	req, err := http.NewRequest(http.MethodGet, graphApiEndpoint+fmt.Sprintf("/drives/%s", driveID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	var res types.Drive
+	if err := c.do(req, &res); err != nil {
+		return nil, fmt.Errorf("get drive: %w", err)
+	}
+	return &res, nil
+}
+
 func (c *client) CreateFolder(ctx context.Context, dirName, parentID, driveID string) (*types.CreateFile, error) {
 	b, err := json.Marshal(folderPayload{
 		Name:              dirName,
@@ -221,14 +402,35 @@ func (c *client) CreateFolder(ctx context.Context, dirName, parentID, driveID st
 	req.Header.Set("Accept", "application/json")
 
 	var res types.CreateFile
-	if err := c.doWithRefreshTokenIfUnauthorized(ctx, req, &res, true, true); err != nil {
+	if err := c.do(req, &res); err != nil {
 		return nil, fmt.Errorf("executing request: %w", err)
 	}
 	return &res, nil
 }
 
-func (c *client) ListFiles(ctx context.Context, driveID, itemID string) (*types.ListFiles, error) {
-	req, err := http.NewRequest(http.MethodGet, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/children", driveID, itemID), nil)
+// ListFiles lists the itemID children, following
+// the pagination links until the last page
+func (c *client) ListFiles(ctx context.Context, driveID, itemID string, opts ...QueryOption) (*types.ListFiles, error) {
+	var files *types.ListFiles
+	next := withQuery(graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/children", driveID, itemID), opts)
+	for next != "" {
+		page, err := c.listPage(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		if files == nil {
+			files = page
+		} else {
+			files.Value = append(files.Value, page.Value...)
+		}
+		next = page.OdataNextLink
+	}
+	files.OdataNextLink = ""
+	return files, nil
+}
+
+func (c *client) listPage(ctx context.Context, u string) (*types.ListFiles, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
 		return nil, fmt.Errorf("new request: %w", err)
 	}
@@ -238,18 +440,37 @@ func (c *client) ListFiles(ctx context.Context, driveID, itemID string) (*types.
 	req.Header.Set("Accept", "application/json")
 
 	var resp types.ListFiles
-	if err := c.doWithRefreshTokenIfUnauthorized(ctx, req, &resp, true, true); err != nil {
+	if err := c.do(req, &resp); err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
+	}
+	return &resp, nil
+}
+
+func (c *client) GetItemByPath(ctx context.Context, driveID, itemID, path string) (*types.Item, error) {
+	req, err := http.NewRequest(http.MethodGet, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s:/%s:", driveID, itemID, escapePath(path)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	var resp types.Item
+	if err := c.do(req, &resp); err != nil {
 		return nil, fmt.Errorf("executing request: %w", err)
 	}
 	return &resp, nil
 }
 
-func (c *client) CreateUploadSession(ctx context.Context, driveID, itemID, inputFile, outputFile string) (*types.ListFiles, error) {
+func (c *client) CreateUploadSession(ctx context.Context, driveID, parentID, fileName string, opts ...TransferOption) (*types.UploadSession, error) {
+	o := newTransferOptions(opts...)
 	b, err := json.Marshal(createUploadSession{
-		MicrosoftGraphConflictBehavior: "rename",
-		Description:                    "",
-		FileSystemInfo:                 createUploadSessionFileSystemInfo{},
-		Name:                           outputFile,
+		Item: createUploadSessionItem{
+			MicrosoftGraphConflictBehavior: o.conflictBehavior,
+			Name:                           fileName,
+			FileSystemInfo:                 o.fileSystemInfo,
+		},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("marshal json: %w", err)
@@ -257,7 +478,7 @@ func (c *client) CreateUploadSession(ctx context.Context, driveID, itemID, input
 
 	req, err := http.NewRequest(
 		http.MethodPost,
-		graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/createUploadSession", driveID, itemID),
+		graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s:/%s:/createUploadSession", driveID, parentID, url.PathEscape(fileName)),
 		bytes.NewBuffer(b),
 	)
 	if err != nil {
@@ -268,57 +489,101 @@ func (c *client) CreateUploadSession(ctx context.Context, driveID, itemID, input
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
 
-	var resp types.ListFiles
-	if err := c.doWithRefreshTokenIfUnauthorized(ctx, req, &resp, true, true); err != nil {
+	var resp types.UploadSession
+	if err := c.do(req, &resp); err != nil {
 		return nil, fmt.Errorf("executing request: %w", err)
 	}
 	return &resp, nil
 }
 
-func (c *client) addAuthHeaders(r *http.Request) error {
-	if c.creds.token == nil {
-		return errors.New("no token")
+// MoveItem moves (and renames) an item, the
+// item keeps its ID and content
+func (c *client) MoveItem(ctx context.Context, driveID, itemID, parentID, name string) (*types.Item, error) {
+	var res types.Item
+	payload := itemUpdate{Name: name}
+	if parentID != "" {
+		payload.ParentReference = &itemParentRef{ID: parentID}
+	}
+	if err := c.updateItem(ctx, driveID, itemID, payload, &res); err != nil {
+		return nil, fmt.Errorf("move item: %w", err)
+	}
+	return &res, nil
+}
+
+// DeleteItem deletes an item (a folder with all its content),
+// the item is moved to the recycle bin
+func (c *client) DeleteItem(ctx context.Context, driveID, itemID string) error {
+	req, err := http.NewRequest(http.MethodDelete, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s", driveID, itemID), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+
+	if err := c.do(req, nil); err != nil {
+		return fmt.Errorf("delete item: %w", err)
 	}
-	r.Header.Set("Authorization", "Bearer "+c.creds.token.AccessToken)
 	return nil
 }
 
-func (c *client) do(ctx context.Context, req *http.Request, resp types.APIResponse, authenticated bool) error {
-	return c.doWithRefreshTokenIfUnauthorized(ctx, req, resp, authenticated, false)
+// updateItem patches the item properties present in payload
+func (c *client) updateItem(ctx context.Context, driveID, itemID string, payload itemUpdate, resp types.APIResponse) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal json: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s", driveID, itemID), bytes.NewBuffer(b))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	if err := c.do(req, resp); err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	return nil
 }
 
-func (c *client) doWithRefreshTokenIfUnauthorized(ctx context.Context, req *http.Request, resp types.APIResponse, authenticated, refresh bool) error {
-	reqB := make([]byte, 0)
-	if req.Body != nil {
-		var err error
-		reqB, err = io.ReadAll(req.Body)
+// do sends req and decodes its JSON response into resp, the
+// responses other than 2xx are returned as a types.GraphError
+func (c *client) do(req *http.Request, resp types.APIResponse) error {
+	if req.Body != nil && req.GetBody == nil {
+		// the body is kept to be sent again after a token refresh
+		reqB, err := io.ReadAll(req.Body)
 		if err != nil {
 			return fmt.Errorf("read body: %w", err)
 		}
-	}
-
-	req.Body = io.NopCloser(bytes.NewBuffer(reqB))
-
-	if authenticated {
-		if err := c.addAuthHeaders(req); err != nil {
-			return fmt.Errorf("add auth headers: %w", err)
+		req.Body = io.NopCloser(bytes.NewReader(reqB))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(reqB)), nil
 		}
 	}
 
 	res, err := c.c.Do(req)
 	if err != nil {
+		c.errors.record(req.Method, redactedURL(req.URL), err)
 		return fmt.Errorf("do request: %w", err)
 	}
 	defer func() {
 		_ = res.Body.Close()
 	}()
 
-	debugResponse(ctx, res, reqB)
-
 	b, err := io.ReadAll(res.Body)
 	if err != nil {
 		return fmt.Errorf("read response: %w", err)
 	}
+
+	if res.StatusCode/100 != 2 {
+		err := newGraphError(res.StatusCode, b)
+		c.errors.record(req.Method, redactedURL(req.URL), err)
+		return err
+	}
+
+	if resp == nil || len(b) == 0 {
+		return nil
+	}
 	if err := json.NewDecoder(bytes.NewReader(b)).Decode(&resp); err != nil {
 		return fmt.Errorf("decode response: %w", err)
 	}
@@ -326,41 +591,66 @@ func (c *client) doWithRefreshTokenIfUnauthorized(ctx context.Context, req *http
 	resp.SetRawBody(string(b))
 	resp.SetStatusCode(res.StatusCode)
 
-	if res.StatusCode == http.StatusUnauthorized && refresh {
-		if err := c.refreshToken(ctx); err != nil {
-			return fmt.Errorf("refresh token: %w", err)
-		}
-		return c.doWithRefreshTokenIfUnauthorized(ctx, req, resp, authenticated, false)
-	}
-	if res.StatusCode/100 != 2 {
-		return fmt.Errorf("unexpected status code: %d (%d)", res.StatusCode, res.StatusCode/100)
-	}
-
 	return nil
 }
 
-func (c *client) refreshToken(ctx context.Context) error {
+func newGraphError(statusCode int, body []byte) error {
+	var gErr types.GraphError
+	_ = json.Unmarshal(body, &gErr)
+	gErr.SetRawBody(string(body))
+	gErr.SetStatusCode(statusCode)
+	return &gErr
+}
+
+// refreshToken replaces stale, the token answered with 401, with a new
+// one. Concurrent calls share the same refresh and the ones made after
+// the token was already replaced return without refreshing it again.
+func (c *client) refreshToken(ctx context.Context, stale *types.TokenData) error {
+	// the refresh isn't canceled with the request that started it,
+	// the other requests waiting for it would fail too
+	ctx = context.WithoutCancel(ctx)
+	_, err, _ := c.creds.refreshes.Do("refresh", func() (any, error) {
+		current := c.token()
+		if current != stale {
+			return nil, nil
+		}
+		token, err := c.requestToken(ctx, current.RefreshToken)
+		c.metrics.tokenRefreshed(err)
+		if err != nil {
+			return nil, err
+		}
+		if token.RefreshToken == "" {
+			token.RefreshToken = current.RefreshToken
+		}
+		c.setToken(token)
+		if c.creds.onTokenRefreshed != nil {
+			c.creds.onTokenRefreshed(token)
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func (c *client) requestToken(ctx context.Context, refreshToken string) (*types.TokenData, error) {
 	v := url.Values{}
 	v.Set("client_id", configs.GetSecretID())
 	v.Set("scope", strings.Join(c.getScopes(), " "))
-	v.Set("refresh_token", c.creds.token.RefreshToken)
+	v.Set("refresh_token", refreshToken)
 	v.Set("redirect_uri", c.getRedirectURL())
 	v.Set("grant_type", "refresh_token")
 	req, err := http.NewRequest(http.MethodPost, tokenEndpoint, strings.NewReader(v.Encode()))
 	if err != nil {
-		return fmt.Errorf("new request: %w", err)
+		return nil, fmt.Errorf("new request: %w", err)
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Accept", "application/json")
 
-	if err := c.do(ctx, req, c.creds.token, false); err != nil {
-		return fmt.Errorf("executing request: %w", err)
+	var token types.TokenData
+	if err := c.do(req, &token); err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
 	}
-	return nil
-}
-
-func (c *client) UploadFile(ctx context.Context, dirName, parentID, driveID string) (*types.CreateFile, error) {
-	return nil, nil
+	return &token, nil
 }
 
 type folderPayload struct {
@@ -372,12 +662,26 @@ type folderPayload struct {
 type folder struct{}
 
 type createUploadSession struct {
-	MicrosoftGraphConflictBehavior string                            `json:"@microsoft.graph.conflictBehavior"`
-	Description                    string                            `json:"description"`
-	FileSystemInfo                 createUploadSessionFileSystemInfo `json:"fileSystemInfo"`
-	Name                           string                            `json:"name"`
+	Item createUploadSessionItem `json:"item"`
+}
+
+type createUploadSessionItem struct {
+	MicrosoftGraphConflictBehavior string          `json:"@microsoft.graph.conflictBehavior"`
+	Name                           string          `json:"name,omitempty"`
+	FileSystemInfo                 *fileSystemInfo `json:"fileSystemInfo,omitempty"`
+}
+
+type fileSystemInfo struct {
+	CreatedDateTime      string `json:"createdDateTime,omitempty"`
+	LastModifiedDateTime string `json:"lastModifiedDateTime,omitempty"`
+}
+
+type itemUpdate struct {
+	Name            string          `json:"name,omitempty"`
+	ParentReference *itemParentRef  `json:"parentReference,omitempty"`
+	FileSystemInfo  *fileSystemInfo `json:"fileSystemInfo,omitempty"`
 }
 
-type createUploadSessionFileSystemInfo struct {
-	OdataType string `json:"@odata.type"`
+type itemParentRef struct {
+	ID string `json:"id"`
 }
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"errors"
+	"github.com/eldius/onedrive-client/client/types"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultErrorLog keeps the errors of the clients
+// created without WithErrorLog
+var DefaultErrorLog = NewErrorLog(100)
+
+// ErrorRecord is a failed API request
+type ErrorRecord struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	// URL is the request URL without its query, which may carry credentials
+	URL string `json:"url"`
+	// StatusCode is zero when the request couldn't be sent
+	StatusCode int    `json:"statusCode,omitempty"`
+	Code       string `json:"code,omitempty"`
+	Message    string `json:"message"`
+}
+
+// ErrorLog keeps the latest failed requests of the clients using it
+type ErrorLog struct {
+	mu      sync.Mutex
+	records []ErrorRecord
+	// next is where the next record goes once records is full
+	next int
+}
+
+// NewErrorLog returns a log keeping the latest size errors
+func NewErrorLog(size int) *ErrorLog {
+	return &ErrorLog{records: make([]ErrorRecord, 0, max(size, 1))}
+}
+
+// Records returns the kept errors, newest first
+func (l *ErrorLog) Records() []ErrorRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	res := make([]ErrorRecord, 0, len(l.records))
+	for i := range l.records {
+		res = append(res, l.records[(l.next-1-i+2*len(l.records))%len(l.records)])
+	}
+	return res
+}
+
+func (l *ErrorLog) add(r ErrorRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.records) < cap(l.records) {
+		l.records = append(l.records, r)
+		l.next = len(l.records) % cap(l.records)
+		return
+	}
+	l.records[l.next] = r
+	l.next = (l.next + 1) % len(l.records)
+}
+
+// record adds the error of a request to the log
+func (l *ErrorLog) record(method, rawURL string, err error) {
+	if l == nil || err == nil {
+		return
+	}
+	r := ErrorRecord{
+		Time:    time.Now(),
+		Method:  method,
+		URL:     rawURL,
+		Message: err.Error(),
+	}
+	var gErr *types.GraphError
+	if errors.As(err, &gErr) {
+		r.StatusCode = gErr.StatusCode
+		r.Code = gErr.Detail.Code
+		if gErr.Detail.Message != "" {
+			r.Message = gErr.Detail.Message
+		} else {
+			r.Message = http.StatusText(gErr.StatusCode)
+		}
+	}
+	l.add(r)
+}
+
+// redactedURL is u without its query and credentials
+func redactedURL(u *url.URL) string {
+	r := *u
+	r.User, r.RawQuery, r.Fragment = nil, "", ""
+	return r.String()
+}
+
+// WithErrorLog sets the log keeping the failed requests
+// of the client, DefaultErrorLog by default
+func WithErrorLog(l *ErrorLog) Option {
+	return func(c *client) {
+		if l == nil {
+			return
+		}
+		c.errors = l
+	}
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"context"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const metricsNamespace = "onedrive_client"
+
+// DefaultMetrics collects the requests of the clients
+// created without WithMetrics, register it to expose them
+var DefaultMetrics = NewMetrics()
+
+// idCollections are the path segments followed by an
+// ID, which is replaced in the endpoint templates
+var idCollections = map[string]bool{
+	"drives":        true,
+	"items":         true,
+	"permissions":   true,
+	"versions":      true,
+	"thumbnails":    true,
+	"subscriptions": true,
+	"users":         true,
+}
+
+// itemPath matches the path based addressing of the items (items/{id}:/a/b:)
+var itemPath = regexp.MustCompile(`:/[^:]*:?`)
+
+// functionArg matches the arguments of the function segments, like
+// search(q='term') or delta(token=abc), quoted ones included
+var functionArg = regexp.MustCompile(`([(,])(\w+)=('(?:[^']|'')*'|[^,)]*)`)
+
+// Metrics collects the requests sent by the clients using it: their
+// count, duration and size, the retries, the throttled ones and the
+// token refreshes, plus the drive quotas set with SetQuota. It's a
+// prometheus.Collector.
+type Metrics struct {
+	requests       *prometheus.CounterVec
+	durations      *prometheus.HistogramVec
+	retries        *prometheus.CounterVec
+	throttles      *prometheus.CounterVec
+	sentBytes      *prometheus.CounterVec
+	receivedBytes  *prometheus.CounterVec
+	tokenRefreshes *prometheus.CounterVec
+	quota          *prometheus.GaugeVec
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Requests sent, by method, endpoint template and response status (error when no response was received).",
+		}, []string{"method", "endpoint", "status"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Time until the response headers were received.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+		}, []string{"method", "endpoint"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "retries_total",
+			Help:      "Requests sent again, after a token refresh or when throttled.",
+		}, []string{"method", "endpoint"}),
+		throttles: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "throttled_total",
+			Help:      "Requests (batch requests included) answered with 429 or 503.",
+		}, []string{"method", "endpoint"}),
+		sentBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "sent_bytes_total",
+			Help:      "Bytes of the request bodies.",
+		}, []string{"method", "endpoint"}),
+		receivedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "received_bytes_total",
+			Help:      "Bytes of the response bodies read.",
+		}, []string{"method", "endpoint"}),
+		tokenRefreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "token_refreshes_total",
+			Help:      "Access token refreshes, by result (success or failure).",
+		}, []string{"result"}),
+		quota: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "quota_bytes",
+			Help:      "Drive quota of the accounts, by kind (total, used, remaining or deleted).",
+		}, []string{"account", "kind"}),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.requests, m.durations, m.retries, m.throttles,
+		m.sentBytes, m.receivedBytes, m.tokenRefreshes, m.quota,
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// SetQuota sets the quota gauges of the account
+func (m *Metrics) SetQuota(account string, q *types.Quota) {
+	if m == nil || q == nil {
+		return
+	}
+	m.quota.WithLabelValues(account, "total").Set(float64(q.Total))
+	m.quota.WithLabelValues(account, "used").Set(float64(q.Used))
+	m.quota.WithLabelValues(account, "remaining").Set(float64(q.Remaining))
+	m.quota.WithLabelValues(account, "deleted").Set(float64(q.Deleted))
+}
+
+// RoundTripper instruments next, http.DefaultTransport when nil
+func (m *Metrics) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	return &metricsTransport{m: m, next: next}
+}
+
+func (m *Metrics) tokenRefreshed(err error) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.tokenRefreshes.WithLabelValues(result).Inc()
+}
+
+// batchResponse counts the throttled batch requests, the
+// batch itself is counted by the round tripper
+func (m *Metrics) batchResponse(method, rawURL string, status int) {
+	if m == nil || !isThrottled(status) {
+		return
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+	m.throttles.WithLabelValues(method, endpointTemplate(u)).Inc()
+}
+
+type metricsTransport struct {
+	m    *Metrics
+	next http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	endpoint := endpointTemplate(req.URL)
+	if isRetry(req.Context()) {
+		t.m.retries.WithLabelValues(req.Method, endpoint).Inc()
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		// the request must not be changed, a copy carries the counted body
+		r := *req
+		r.Body = &countingBody{ReadCloser: req.Body, c: t.m.sentBytes.WithLabelValues(req.Method, endpoint)}
+		req = &r
+	}
+
+	start := time.Now()
+	res, err := next.RoundTrip(req)
+	t.m.durations.WithLabelValues(req.Method, endpoint).Observe(time.Since(start).Seconds())
+	if err != nil {
+		t.m.requests.WithLabelValues(req.Method, endpoint, "error").Inc()
+		return nil, err
+	}
+	t.m.requests.WithLabelValues(req.Method, endpoint, strconv.Itoa(res.StatusCode)).Inc()
+	if isThrottled(res.StatusCode) {
+		t.m.throttles.WithLabelValues(req.Method, endpoint).Inc()
+	}
+	res.Body = &countingBody{ReadCloser: res.Body, c: t.m.receivedBytes.WithLabelValues(req.Method, endpoint)}
+	return res, nil
+}
+
+type countingBody struct {
+	io.ReadCloser
+	c prometheus.Counter
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.c.Add(float64(n))
+	}
+	return n, err
+}
+
+// endpointTemplate is the path of u without its IDs, item paths and
+// function arguments (/me/drives/{id}/items/{id}:{path}:/content,
+// /me/drives/{id}/root/search(q={q})), the requests to the
+// pre-authenticated upload and download URLs are grouped together
+func endpointTemplate(u *url.URL) string {
+	switch {
+	case u.Host == "" || strings.HasSuffix(u.Host, "graph.microsoft.com"):
+		// the batch requests have no host
+	case strings.HasPrefix(u.Host, "login."):
+		return "token"
+	default:
+		return "transfer"
+	}
+	p := functionArg.ReplaceAllString(u.EscapedPath(), "$1$2={$2}")
+	p = path.Clean("/" + itemPath.ReplaceAllString(p, ":{path}:"))
+	p = strings.TrimPrefix(p, "/v1.0")
+	segments := strings.Split(p, "/")
+	for i := 1; i < len(segments); i++ {
+		name, _, _ := strings.Cut(segments[i-1], ":")
+		if idCollections[name] && segments[i] != "" {
+			id, rest, found := strings.Cut(segments[i], ":")
+			if id != "" {
+				segments[i] = "{id}"
+				if found {
+					segments[i] += ":" + rest
+				}
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+type retryKey struct{}
+
+// withRetry marks the requests sent with ctx as retries
+func withRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+func isRetry(ctx context.Context) bool {
+	retry, _ := ctx.Value(retryKey{}).(bool)
+	return retry
+}
+
+// WithMetrics sets the metrics collecting the requests
+// of the client, DefaultMetrics by default
+func WithMetrics(m *Metrics) Option {
+	return func(c *client) {
+		if m == nil {
+			return
+		}
+		c.metrics = m
+	}
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestEndpointTemplate(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://graph.microsoft.com/v1.0/me/", want: "/me"},
+		{url: "https://graph.microsoft.com/v1.0/me/drive/special/approot", want: "/me/drive/special/approot"},
+		{url: "https://graph.microsoft.com/v1.0/me//drives/b!abc/items/01ABC/children?$select=id", want: "/me/drives/{id}/items/{id}/children"},
+		{url: "https://graph.microsoft.com/v1.0/me/drives/d1/items/01ABC:/Backup/2023/photo.jpg:/content", want: "/me/drives/{id}/items/{id}:{path}:/content"},
+		{url: "https://graph.microsoft.com/v1.0/me/drives/d1/items/01ABC:/a%20b.txt:", want: "/me/drives/{id}/items/{id}:{path}:"},
+		{url: "https://graph.microsoft.com/v1.0/me/drives/d1/items/01ABC:/new.txt:/createUploadSession", want: "/me/drives/{id}/items/{id}:{path}:/createUploadSession"},
+		{url: "https://graph.microsoft.com/v1.0/me/drives/d1/items/i1/versions/3.0/content", want: "/me/drives/{id}/items/{id}/versions/{id}/content"},
+		{url: "https://graph.microsoft.com/v1.0/me/drives/d1/items/i1/permissions/p1", want: "/me/drives/{id}/items/{id}/permissions/{id}"},
+		{url: "https://graph.microsoft.com/v1.0/subscriptions/s1", want: "/subscriptions/{id}"},
+		{url: "https://graph.microsoft.com/v1.0/me/drives/d1/root/search(q='holiday')", want: "/me/drives/{id}/root/search(q={q})"},
+		{url: "https://graph.microsoft.com/v1.0/me/drives/d1/root/search(q='it''s%20(a)%2Fb,c')?$top=10", want: "/me/drives/{id}/root/search(q={q})"},
+		{url: "https://graph.microsoft.com/v1.0/me/drives/d1/root/search(q='')", want: "/me/drives/{id}/root/search(q={q})"},
+		{url: "https://graph.microsoft.com/v1.0/me/drives/d1/items/i1/delta", want: "/me/drives/{id}/items/{id}/delta"},
+		{url: "https://graph.microsoft.com/v1.0/me/drives/d1/items/i1/delta(token='aTE09NjM1')", want: "/me/drives/{id}/items/{id}/delta(token={token})"},
+		{url: "https://graph.microsoft.com/v1.0/me/drives/d1/root/delta(token=latest)", want: "/me/drives/{id}/root/delta(token={token})"},
+		{url: "/me/drives/d1/items/i1", want: "/me/drives/{id}/items/{id}"},
+		{url: "https://login.microsoftonline.com/common/oauth2/v2.0/token", want: "token"},
+		{url: "https://my.microsoftpersonalcontent.com/personal/abc/_layouts/15/download.aspx?UniqueId=1", want: "transfer"},
+		{url: "https://api.onedrive.com/rup/abc123", want: "transfer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := endpointTemplate(u); got != tt.want {
+				t.Errorf("endpointTemplate(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
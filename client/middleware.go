@@ -0,0 +1,148 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"io"
+	"net/http"
+)
+
+// graphHost is the host of the requests sent with the access token
+const graphHost = "graph.microsoft.com"
+
+// Middleware wraps the transport sending the requests of the client, to
+// change the requests or their responses (custom headers, recording,
+// fault injection) or to send them again
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is a function used as an http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithMiddleware adds middlewares to the transport of the client, the
+// first one given is the outermost. They wrap the transport of the
+// http.Client (see WithHttpClient) and are wrapped by the ones of the
+// client, in this order:
+//
+//	auth: sets the access token, refreshes it on 401 and sends again
+//	retry: sends again the throttled requests, see RetryMiddleware
+//	tracing: a span per request
+//	metrics: see WithMetrics
+//	logging: the requests and responses at debug level
+//	bandwidth: see WithBandwidthLimiter
+//
+// So they see every request as it's sent, with its auth header, and
+// their responses go through the token refresh, the retries, the
+// tracing and the metrics like the ones of the API. See
+// WithOuterMiddleware for the ones wrapping the client ones.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(c *client) {
+		c.middlewares = appendMiddlewares(c.middlewares, mws)
+	}
+}
+
+// WithOuterMiddleware adds middlewares wrapping the ones of the client
+// (see WithMiddleware), the first one given is the outermost. They see
+// the requests as the client makes them, without the auth header, and
+// only the last response, after the token refresh and the retries.
+func WithOuterMiddleware(mws ...Middleware) Option {
+	return func(c *client) {
+		c.outerMiddlewares = appendMiddlewares(c.outerMiddlewares, mws)
+	}
+}
+
+func appendMiddlewares(to, mws []Middleware) []Middleware {
+	for _, mw := range mws {
+		if mw != nil {
+			to = append(to, mw)
+		}
+	}
+	return to
+}
+
+// chain wraps next with the middlewares, the first one is the outermost
+func chain(next http.RoundTripper, mws ...Middleware) http.RoundTripper {
+	for i := len(mws) - 1; i >= 0; i-- {
+		next = mws[i](next)
+	}
+	return next
+}
+
+// defaultTransport sends the requests with http.DefaultTransport,
+// taken on every request like the http.Client does
+var defaultTransport = RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+	return http.DefaultTransport.RoundTrip(req)
+})
+
+// authMiddleware sets the access token on the Graph API requests and,
+// when one is answered with 401, refreshes the token and sends it again.
+// The other requests (token endpoint, pre-authenticated upload and
+// download URLs) and the ones with their own auth header are sent as is.
+func (c *client) authMiddleware(next http.RoundTripper) http.RoundTripper {
+	return &authTransport{c: c, next: next}
+}
+
+type authTransport struct {
+	c    *client
+	next http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != graphHost || req.Header.Get("Authorization") != "" {
+		return t.next.RoundTrip(req)
+	}
+	token := t.c.token()
+	res, err := t.send(req, token)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+	body, ok := replayBody(req)
+	if !ok {
+		return res, nil
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+
+	if err := t.c.refreshToken(req.Context(), token); err != nil {
+		if body != nil {
+			_ = body.Close()
+		}
+		return nil, fmt.Errorf("refresh token: %w", err)
+	}
+	retry := req.Clone(withRetry(req.Context()))
+	retry.Body = body
+	return t.send(retry, t.c.token())
+}
+
+// send sends a copy of req with the access token
+func (t *authTransport) send(req *http.Request, token *types.TokenData) (*http.Response, error) {
+	if token == nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, errors.New("add auth header: no token")
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	return t.next.RoundTrip(req)
+}
+
+// replayBody returns a new body for sending req again,
+// false when its body can't be read once more
+func replayBody(req *http.Request) (io.ReadCloser, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req.Body, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	return body, true
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"github.com/eldius/onedrive-client/client/types"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// respond builds a JSON response for the fake transports
+func respond(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func TestRefreshTokenConcurrent(t *testing.T) {
+	var refreshes, stored atomic.Int32
+	var gotRefreshToken atomic.Value
+	base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() == tokenEndpoint {
+			refreshes.Add(1)
+			b, _ := io.ReadAll(req.Body)
+			gotRefreshToken.Store(string(b))
+			// the other requests get their 401 while it's refreshed
+			time.Sleep(20 * time.Millisecond)
+			return respond(req, http.StatusOK, `{"access_token":"new","expires_in":3600}`), nil
+		}
+		if req.Header.Get("Authorization") != "Bearer new" {
+			return respond(req, http.StatusUnauthorized, `{"error":{"code":"InvalidAuthenticationToken"}}`), nil
+		}
+		return respond(req, http.StatusOK, `{"id":"item"}`), nil
+	})
+	var refreshed *types.TokenData
+	c := New(
+		WithHttpClient(&http.Client{Transport: base}),
+		WithAuthenticationTokenData(&types.TokenData{AccessToken: "old", RefreshToken: "refresh"}),
+		WithTokenRefreshed(func(token *types.TokenData) {
+			stored.Add(1)
+			refreshed = token
+		}),
+		WithMetrics(NewMetrics()),
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.GetItem(context.Background(), "drive", "item")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("get item: %v", err)
+		}
+	}
+
+	if n := refreshes.Load(); n != 1 {
+		t.Errorf("refreshes = %d, want 1", n)
+	}
+	if n := stored.Load(); n != 1 {
+		t.Errorf("stored tokens = %d, want 1", n)
+	}
+	if !strings.Contains(gotRefreshToken.Load().(string), "refresh_token=refresh") {
+		t.Errorf("refresh request = %q", gotRefreshToken.Load())
+	}
+	// the refresh token is kept when the response has none
+	if refreshed == nil || refreshed.AccessToken != "new" || refreshed.RefreshToken != "refresh" {
+		t.Errorf("refreshed token = %+v", refreshed)
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name+" "+req.Header.Get("Authorization"))
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	sent := 0
+	base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent++
+		if sent == 1 {
+			res := respond(req, http.StatusTooManyRequests, "{}")
+			res.Header.Set("Retry-After", "0")
+			return res, nil
+		}
+		return respond(req, http.StatusOK, `{"id":"item"}`), nil
+	})
+	c := New(
+		WithHttpClient(&http.Client{Transport: base}),
+		WithAuthenticationTokenData(&types.TokenData{AccessToken: "token"}),
+		WithMiddleware(record("inner")),
+		WithOuterMiddleware(record("outer")),
+		WithMetrics(NewMetrics()),
+	)
+	if _, err := c.GetItem(context.Background(), "drive", "item"); err != nil {
+		t.Fatalf("get item: %v", err)
+	}
+	want := []string{"outer ", "inner Bearer token", "inner Bearer token"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+}
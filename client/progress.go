@@ -0,0 +1,148 @@
+package client
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	progressInterval  = 500 * time.Millisecond
+	progressSmoothing = 0.3
+)
+
+// Progress is a snapshot of a running transfer
+type Progress struct {
+	// Done is how many bytes were already transferred
+	Done int64
+	// Total is the transfer size (0 when unknown)
+	Total int64
+	// Rate is the transfer speed in bytes per second
+	Rate float64
+	// ETA is the estimated time to finish (0 when unknown)
+	ETA time.Duration
+	// Finished is set on the last report of the transfer
+	Finished bool
+}
+
+// ProgressFunc receives transfer progress reports,
+// it's called from the transfer goroutines
+type ProgressFunc func(Progress)
+
+// WithProgress sets up a callback to report
+// the transfer progress
+func WithProgress(fn ProgressFunc) TransferOption {
+	return func(o *transferOptions) {
+		o.progress = fn
+	}
+}
+
+type progressTracker struct {
+	mu       sync.Mutex
+	fn       ProgressFunc
+	total    int64
+	done     int64
+	rate     float64
+	lastDone int64
+	lastTime time.Time
+	now      func() time.Time
+}
+
+func newProgressTracker(fn ProgressFunc, total int64) *progressTracker {
+	if fn == nil {
+		return nil
+	}
+	t := &progressTracker{
+		fn:    fn,
+		total: total,
+		now:   time.Now,
+	}
+	t.lastTime = t.now()
+	return t
+}
+
+func (t *progressTracker) add(n int64) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	t.done += n
+	now := t.now()
+	elapsed := now.Sub(t.lastTime)
+	if elapsed < progressInterval {
+		t.mu.Unlock()
+		return
+	}
+	p := t.sample(now, elapsed)
+	t.mu.Unlock()
+
+	t.fn(p)
+}
+
+// restart discards the bytes counted so far, for a content sent again
+// restart goes back to done bytes, when the content
+// from there is sent again
+func (t *progressTracker) restart(done int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.done, t.lastDone = done, min(t.lastDone, done)
+	t.mu.Unlock()
+}
+
+func (t *progressTracker) finish() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	now := t.now()
+	p := t.sample(now, now.Sub(t.lastTime))
+	p.Finished = true
+	p.ETA = 0
+	t.mu.Unlock()
+
+	t.fn(p)
+}
+
+// sample updates the smoothed rate, the lock must be held
+func (t *progressTracker) sample(now time.Time, elapsed time.Duration) Progress {
+	if elapsed > 0 {
+		current := float64(t.done-t.lastDone) / elapsed.Seconds()
+		if t.rate == 0 {
+			t.rate = current
+		} else {
+			t.rate = progressSmoothing*current + (1-progressSmoothing)*t.rate
+		}
+	}
+	t.lastDone = t.done
+	t.lastTime = now
+
+	p := Progress{
+		Done:  t.done,
+		Total: t.total,
+		Rate:  t.rate,
+	}
+	if t.total > 0 && t.rate > 0 && t.done < t.total {
+		p.ETA = time.Duration(float64(t.total-t.done) / t.rate * float64(time.Second))
+	}
+	return p
+}
+
+func (t *progressTracker) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &progressReader{r: r, t: t}
+}
+
+type progressReader struct {
+	r io.Reader
+	t *progressTracker
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.t.add(int64(n))
+	return n, err
+}
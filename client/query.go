@@ -0,0 +1,142 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Expand is a relationship of the items that can be returned inline
+type Expand string
+
+const (
+	ExpandThumbnails  Expand = "thumbnails"
+	ExpandChildren    Expand = "children"
+	ExpandPermissions Expand = "permissions"
+)
+
+// QueryOption sets an OData query option ($select, $expand, $filter,
+// $orderby or $top) of the item and listing requests
+type QueryOption func(*queryOptions)
+
+type queryOptions struct {
+	fields  []string
+	expand  []Expand
+	filter  string
+	orderBy []string
+	top     int
+}
+
+// WithSelect returns only the given item properties ("name", "size"),
+// the properties not selected are left empty
+func WithSelect(fields ...string) QueryOption {
+	return func(o *queryOptions) {
+		o.fields = append(o.fields, fields...)
+	}
+}
+
+// WithExpand returns the given relationships inline
+func WithExpand(relations ...Expand) QueryOption {
+	return func(o *queryOptions) {
+		o.expand = append(o.expand, relations...)
+	}
+}
+
+// WithFilter returns only the items matching the OData
+// filter expression ("file ne null"), not every endpoint
+// supports filtering
+func WithFilter(expr string) QueryOption {
+	return func(o *queryOptions) {
+		o.filter = expr
+	}
+}
+
+// WithOrderBy sorts the items by field, the options
+// given first take precedence
+func WithOrderBy(field string, descending bool) QueryOption {
+	return func(o *queryOptions) {
+		if descending {
+			field += " desc"
+		}
+		o.orderBy = append(o.orderBy, field)
+	}
+}
+
+// WithTop sets how many items each page of a listing has,
+// the listings still follow the pages until the last one
+func WithTop(n int) QueryOption {
+	return func(o *queryOptions) {
+		o.top = n
+	}
+}
+
+func newQueryOptions(opts ...QueryOption) queryOptions {
+	var o queryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// encode returns the query string of the options, the
+// "$" of the option names is kept as OData expects it
+func (o queryOptions) encode() string {
+	var params []string
+	add := func(name, value string) {
+		params = append(params, name+"="+escapeQueryValue(value))
+	}
+	if len(o.fields) > 0 {
+		add("$select", strings.Join(dedup(o.fields), ","))
+	}
+	if len(o.expand) > 0 {
+		relations := make([]string, len(o.expand))
+		for i, e := range o.expand {
+			relations[i] = string(e)
+		}
+		add("$expand", strings.Join(dedup(relations), ","))
+	}
+	if o.filter != "" {
+		add("$filter", o.filter)
+	}
+	if len(o.orderBy) > 0 {
+		add("$orderby", strings.Join(o.orderBy, ","))
+	}
+	if o.top > 0 {
+		add("$top", strconv.Itoa(o.top))
+	}
+	return strings.Join(params, "&")
+}
+
+// withQuery appends the query options to the request URL u
+func withQuery(u string, opts []QueryOption) string {
+	q := newQueryOptions(opts...).encode()
+	if q == "" {
+		return u
+	}
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s%s", u, sep, q)
+}
+
+// escapeQueryValue escapes an option value, spaces are
+// sent as %20 since OData doesn't read "+" as a space
+func escapeQueryValue(v string) string {
+	v = url.QueryEscape(v)
+	v = strings.ReplaceAll(v, "+", "%20")
+	return strings.NewReplacer("%2C", ",", "%27", "'", "%28", "(", "%29", ")").Replace(v)
+}
+
+func dedup(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	res := values[:0:0]
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+	return res
+}
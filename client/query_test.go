@@ -0,0 +1,68 @@
+package client
+
+import "testing"
+
+func TestQueryOptionsEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []QueryOption
+		want string
+	}{
+		{name: "none", want: ""},
+		{name: "select", opts: []QueryOption{WithSelect("id", "name"), WithSelect("name", "size")}, want: "$select=id,name,size"},
+		{name: "expand", opts: []QueryOption{WithExpand(ExpandThumbnails, ExpandChildren, ExpandThumbnails)}, want: "$expand=thumbnails,children"},
+		{name: "filter", opts: []QueryOption{WithFilter("file ne null")}, want: "$filter=file%20ne%20null"},
+		{
+			name: "filter function",
+			opts: []QueryOption{WithFilter("startswith(name,'a+b & c')")},
+			want: "$filter=startswith(name,'a%2Bb%20%26%20c')",
+		},
+		{name: "last filter", opts: []QueryOption{WithFilter("folder ne null"), WithFilter("file ne null")}, want: "$filter=file%20ne%20null"},
+		{
+			name: "order by",
+			opts: []QueryOption{WithOrderBy("name", false), WithOrderBy("lastModifiedDateTime", true)},
+			want: "$orderby=name,lastModifiedDateTime%20desc",
+		},
+		{name: "top", opts: []QueryOption{WithTop(50)}, want: "$top=50"},
+		{name: "no top", opts: []QueryOption{WithTop(0)}, want: ""},
+		{
+			name: "all",
+			opts: []QueryOption{WithTop(10), WithOrderBy("size", true), WithFilter("size gt 0"), WithExpand(ExpandPermissions), WithSelect("id")},
+			want: "$select=id&$expand=permissions&$filter=size%20gt%200&$orderby=size%20desc&$top=10",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newQueryOptions(tt.opts...).encode(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithQuery(t *testing.T) {
+	tests := []struct {
+		url  string
+		opts []QueryOption
+		want string
+	}{
+		{url: "https://graph.microsoft.com/v1.0/me/drive/root/children", want: "https://graph.microsoft.com/v1.0/me/drive/root/children"},
+		{
+			url:  "https://graph.microsoft.com/v1.0/me/drive/root/children",
+			opts: []QueryOption{WithTop(5)},
+			want: "https://graph.microsoft.com/v1.0/me/drive/root/children?$top=5",
+		},
+		{
+			url:  "https://graph.microsoft.com/v1.0/me/drive/root/delta?token=abc",
+			opts: []QueryOption{WithSelect("id")},
+			want: "https://graph.microsoft.com/v1.0/me/drive/root/delta?token=abc&$select=id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := withQuery(tt.url, tt.opts); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Package quickxorhash implements the QuickXorHash algorithm used by
+// OneDrive to report file content hashes (hashes.quickXorHash).
+package quickxorhash
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"hash"
+	"io"
+)
+
+const (
+	// Size is the size of the hash in bytes
+	Size = 20
+	// BlockSize is the hash block size
+	BlockSize = 64
+
+	widthInBits = Size * 8
+	shift       = 11
+)
+
+type digest struct {
+	data   [Size]byte
+	length uint64
+	pos    int
+}
+
+// New returns a new hash.Hash computing the QuickXorHash
+func New() hash.Hash {
+	return &digest{}
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	for _, b := range p {
+		byteIdx, bitOff := d.pos/8, d.pos%8
+		d.data[byteIdx] ^= b << bitOff
+		if bitOff > 0 {
+			d.data[(byteIdx+1)%Size] ^= b >> (8 - bitOff)
+		}
+		d.pos = (d.pos + shift) % widthInBits
+	}
+	d.length += uint64(len(p))
+	return len(p), nil
+}
+
+func (d *digest) Sum(in []byte) []byte {
+	sum := d.data
+	var l [8]byte
+	binary.LittleEndian.PutUint64(l[:], d.length)
+	for i, b := range l {
+		sum[Size-len(l)+i] ^= b
+	}
+	return append(in, sum[:]...)
+}
+
+func (d *digest) Reset() {
+	*d = digest{}
+}
+
+func (d *digest) Size() int {
+	return Size
+}
+
+func (d *digest) BlockSize() int {
+	return BlockSize
+}
+
+// Sum returns the base64 encoded hash of r,
+// the same format reported by the Graph API
+func Sum(r io.Reader) (string, error) {
+	h := New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
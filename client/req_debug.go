@@ -8,31 +8,89 @@ import (
 	"io"
 	"log/slog"
 	"maps"
+	"mime"
 	"net/http"
-	"reflect"
+	"net/url"
 	"slices"
 	"strings"
 )
 
+// loggingMiddleware logs the requests and their responses at debug
+// level, with their JSON and form bodies (the content isn't logged)
+func loggingMiddleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+			return next.RoundTrip(req)
+		}
+		reqB := requestBody(req)
+		res, err := next.RoundTrip(req)
+		if err != nil {
+			slog.With("error", err, "method", req.Method, "url", req.URL.String()).DebugContext(ctx, "externalRequest")
+			return nil, err
+		}
+		debugResponse(ctx, res, reqB)
+		return res, nil
+	})
+}
+
+// requestBody is a copy of the request body, when it's logged
+func requestBody(req *http.Request) []byte {
+	if req.GetBody == nil || !isLoggedBody(req.Header) {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+	b, _ := io.ReadAll(body)
+	return b
+}
+
 func debugResponse(ctx context.Context, res *http.Response, reqBody []byte) {
-	resBody, _ := io.ReadAll(res.Body)
+	var resBody []byte
+	if isLoggedBody(res.Header) {
+		resBody, _ = io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(resBody))
+	}
 	slog.With("request", map[string]any{
 		"status_code": res.StatusCode,
-		"body":        string(parseBody(reqBody)),
+		"body":        string(parseBody(reqBody, res.Request.Header)),
 		"headers":     headerToMap(res.Request.Header),
 		"method":      res.Request.Method,
 		"url":         res.Request.URL.String(),
 		"response": map[string]any{
-			"body":    string(parseBody(resBody)),
+			"body":    string(parseBody(resBody, res.Header)),
 			"headers": headerToMap(res.Header),
 		},
 	}).DebugContext(ctx, "externalRequest")
-	res.Body = io.NopCloser(bytes.NewReader(resBody))
 }
 
-func parseBody(b []byte) []byte {
+// isLoggedBody tells if the body with these headers is logged
+func isLoggedBody(h http.Header) bool {
+	mt, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return strings.HasSuffix(mt, "json") || mt == "application/x-www-form-urlencoded" || strings.HasPrefix(mt, "text/")
+}
+
+// parseBody redacts the secrets of a JSON or form body, the
+// form values are logged as a JSON object
+func parseBody(b []byte, h http.Header) []byte {
 	var bodyMap map[string]any
-	if err := json.Unmarshal(b, &bodyMap); err != nil {
+	if mt, _, _ := mime.ParseMediaType(h.Get("Content-Type")); mt == "application/x-www-form-urlencoded" {
+		form, err := url.ParseQuery(string(b))
+		if err != nil {
+			// it may hold secrets that can't be redacted
+			return nil
+		}
+		bodyMap = make(map[string]any, len(form))
+		for k, v := range form {
+			bodyMap[k] = strings.Join(v, ",")
+		}
+	} else if err := json.Unmarshal(b, &bodyMap); err != nil {
 		return b
 	}
 	bodyMap = parseMap(bodyMap)
@@ -45,12 +103,13 @@ func parseBody(b []byte) []byte {
 
 func parseMap(v map[string]any) map[string]any {
 	v = maps.Clone(v)
-	for k := range maps.Keys(v) {
+	for k, val := range v {
 		if slices.Contains(configs.RedactedKeyList, strings.ToLower(k)) {
-			if reflect.TypeOf(v[k]).Kind() == reflect.Map {
-				v[k] = parseMap(v[k].(map[string]any))
-			}
 			v[k] = "***"
+			continue
+		}
+		if m, ok := val.(map[string]any); ok {
+			v[k] = parseMap(m)
 		}
 	}
 	return v
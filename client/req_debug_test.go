@@ -0,0 +1,53 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseBody(t *testing.T) {
+	formHeader := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	jsonHeader := http.Header{"Content-Type": {"application/json; charset=utf-8"}}
+	tests := []struct {
+		name   string
+		body   string
+		header http.Header
+		want   string
+	}{
+		{
+			name:   "token request",
+			body:   "client_id=app&grant_type=refresh_token&refresh_token=r1&client_secret=s3cr3t",
+			header: formHeader,
+			want:   `{"client_id":"app","client_secret":"***","grant_type":"refresh_token","refresh_token":"***"}`,
+		},
+		{name: "invalid form", body: "refresh_token=%zz", header: formHeader, want: ""},
+		{
+			name:   "token response",
+			body:   `{"access_token":"a1","refresh_token":"r1","id_token":"i1","expires_in":3600}`,
+			header: jsonHeader,
+			want:   `{"access_token":"***","expires_in":3600,"id_token":"***","refresh_token":"***"}`,
+		},
+		{name: "null secret", body: `{"access_token":null}`, header: jsonHeader, want: `{"access_token":"***"}`},
+		{
+			name:   "nested",
+			body:   `{"session":{"refresh_token":"r1","user":"me"}}`,
+			header: jsonHeader,
+			want:   `{"session":{"refresh_token":"***","user":"me"}}`,
+		},
+		{name: "not json", body: "plain text", header: http.Header{"Content-Type": {"text/plain"}}, want: "plain text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(parseBody([]byte(tt.body), tt.header))
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			for _, secret := range []string{"s3cr3t", "r1", "a1", "i1"} {
+				if strings.Contains(got, secret) {
+					t.Errorf("%s isn't redacted in %s", secret, got)
+				}
+			}
+		})
+	}
+}
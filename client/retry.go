@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMaxRetries is how many times a throttled request is sent again
+	defaultMaxRetries = 5
+	// retryDelay is the first wait before sending a throttled request
+	// again when the response doesn't tell it, doubled on every retry
+	retryDelay = time.Second
+	// maxRetryDelay caps the wait asked by the responses
+	maxRetryDelay = 2 * time.Minute
+)
+
+// WithRetries sets how many times the requests answered with 429 (Too
+// Many Requests) or 503 (Service Unavailable) are sent again, 5 by
+// default and 0 disables it (see RetryMiddleware)
+func WithRetries(n int) Option {
+	return func(c *client) {
+		c.maxRetries = max(n, 0)
+	}
+}
+
+// RetryMiddleware sends again, up to maxRetries times, the requests
+// answered with 429 (Too Many Requests) or 503 (Service Unavailable),
+// after the wait asked by the Retry-After header or, when there's none,
+// a wait starting at one second and doubled on every retry. The
+// requests with a body that can't be read again are sent once.
+func RetryMiddleware(maxRetries int) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			res, err := next.RoundTrip(req)
+			for attempt := 0; attempt < maxRetries && err == nil && isThrottled(res.StatusCode); attempt++ {
+				body, ok := replayBody(req)
+				if !ok {
+					break
+				}
+				wait := retryAfterHeader(res.Header.Get("Retry-After"), retryDelay<<attempt)
+				_, _ = io.Copy(io.Discard, res.Body)
+				_ = res.Body.Close()
+				if err := sleep(req.Context(), wait); err != nil {
+					if body != nil {
+						_ = body.Close()
+					}
+					return nil, err
+				}
+				retry := req.Clone(withRetry(req.Context()))
+				retry.Body = body
+				res, err = next.RoundTrip(retry)
+			}
+			return res, err
+		})
+	}
+}
+
+// retryAfterHeader is the wait asked by a Retry-After header value,
+// in seconds or an HTTP date, def when it has none
+func retryAfterHeader(v string, def time.Duration) time.Duration {
+	v = strings.TrimSpace(v)
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return min(time.Duration(s)*time.Second, maxRetryDelay)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return min(max(time.Until(t), 0), maxRetryDelay)
+	}
+	return min(def, maxRetryDelay)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
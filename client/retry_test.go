@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		body       func() io.Reader
+		maxRetries int
+		wantStatus int
+		wantSent   int
+	}{
+		{name: "not throttled", statuses: []int{200}, maxRetries: 3, wantStatus: 200, wantSent: 1},
+		{name: "too many requests", statuses: []int{429, 429, 200}, retryAfter: "0", maxRetries: 3, wantStatus: 200, wantSent: 3},
+		{name: "service unavailable", statuses: []int{503, 200}, retryAfter: "0", maxRetries: 3, wantStatus: 200, wantSent: 2},
+		{name: "other errors", statuses: []int{500, 200}, maxRetries: 3, wantStatus: 500, wantSent: 1},
+		{name: "retries exhausted", statuses: []int{429, 429, 429, 200}, retryAfter: "0", maxRetries: 2, wantStatus: 429, wantSent: 3},
+		{name: "disabled", statuses: []int{429, 200}, retryAfter: "0", wantStatus: 429, wantSent: 1},
+		{name: "body replayed", statuses: []int{429, 200}, retryAfter: "0", body: func() io.Reader { return strings.NewReader("content") }, maxRetries: 3, wantStatus: 200, wantSent: 2},
+		{name: "body not replayable", statuses: []int{429, 200}, retryAfter: "0", body: func() io.Reader { return io.MultiReader(strings.NewReader("content")) }, maxRetries: 3, wantStatus: 429, wantSent: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent int
+			next := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				if req.Body != nil {
+					if b, _ := io.ReadAll(req.Body); string(b) != "content" {
+						t.Errorf("attempt %d body = %q", sent, b)
+					}
+				}
+				if retry := isRetry(req.Context()); retry != (sent > 0) {
+					t.Errorf("attempt %d marked as retry = %v", sent, retry)
+				}
+				res := respond(req, tt.statuses[sent], "{}")
+				if tt.retryAfter != "" {
+					res.Header.Set("Retry-After", tt.retryAfter)
+				}
+				sent++
+				return res, nil
+			})
+			var body io.Reader
+			if tt.body != nil {
+				body = tt.body()
+			}
+			req, err := http.NewRequest(http.MethodPut, "https://graph.microsoft.com/v1.0/me/drive", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := RetryMiddleware(tt.maxRetries)(next).RoundTrip(req)
+			if err != nil {
+				t.Fatalf("round trip: %v", err)
+			}
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+			if sent != tt.wantSent {
+				t.Errorf("sent %d times, want %d", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestRetryMiddlewareCanceled(t *testing.T) {
+	next := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		res := respond(req, http.StatusTooManyRequests, "{}")
+		res.Header.Set("Retry-After", "60")
+		return res, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "https://graph.microsoft.com/v1.0/$batch", bytes.NewReader([]byte("{}")))
+	if _, err := RetryMiddleware(3)(next).RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 4 * time.Second},
+		{value: "0", want: 0},
+		{value: " 7 ", want: 7 * time.Second},
+		{value: "3600", want: maxRetryDelay},
+		{value: "-1", want: 4 * time.Second},
+		{value: "soon", want: 4 * time.Second},
+		{value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), want: 0},
+		{value: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), want: maxRetryDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := retryAfterHeader(tt.value, 4*time.Second); got != tt.want {
+				t.Errorf("retryAfterHeader(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+	if got := retryAfterHeader("", time.Hour); got != maxRetryDelay {
+		t.Errorf("default wait = %v, want it capped to %v", got, maxRetryDelay)
+	}
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Search searches the whole drive for items matching query, the server
+// matches it against the item names, metadata and content. Search
+// results carry the parent ID but usually not the parent path.
+func (c *client) Search(ctx context.Context, driveID, query string, opts ...QueryOption) (*types.ListFiles, error) {
+	q := url.PathEscape(strings.ReplaceAll(query, "'", "''"))
+	var files *types.ListFiles
+	next := withQuery(graphApiEndpoint+fmt.Sprintf("/drives/%s/root/search(q='%s')", driveID, q), opts)
+	for next != "" {
+		page, err := c.listPage(ctx, next)
+		if err != nil {
+			return nil, fmt.Errorf("search: %w", err)
+		}
+		if files == nil {
+			files = page
+		} else {
+			files.Value = append(files.Value, page.Value...)
+		}
+		next = page.OdataNextLink
+	}
+	files.OdataNextLink = ""
+	return files, nil
+}
+
+// GetItem returns the item with the given ID
+func (c *client) GetItem(ctx context.Context, driveID, itemID string, opts ...QueryOption) (*types.Item, error) {
+	req, err := http.NewRequest(http.MethodGet, withQuery(graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s", driveID, itemID), opts), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	var resp types.Item
+	if err := c.do(req, &resp); err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
+	}
+	return &resp, nil
+}
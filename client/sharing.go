@@ -0,0 +1,199 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	LinkTypeView  = "view"
+	LinkTypeEdit  = "edit"
+	LinkTypeEmbed = "embed"
+
+	LinkScopeAnonymous    = "anonymous"
+	LinkScopeOrganization = "organization"
+
+	RoleRead  = "read"
+	RoleWrite = "write"
+)
+
+// ShareOption configures a sharing link or an invitation
+type ShareOption func(*shareOptions)
+
+type shareOptions struct {
+	expiration     time.Time
+	password       string
+	message        string
+	requireSignIn  bool
+	sendInvitation bool
+}
+
+// WithExpiration sets when the link (or invitation) expires
+func WithExpiration(t time.Time) ShareOption {
+	return func(o *shareOptions) {
+		o.expiration = t
+	}
+}
+
+// WithPassword protects the link (or invitation) with a password,
+// only available to personal OneDrive accounts
+func WithPassword(password string) ShareOption {
+	return func(o *shareOptions) {
+		o.password = password
+	}
+}
+
+// WithInvitationMessage sets the message sent to the invited recipients
+func WithInvitationMessage(message string) ShareOption {
+	return func(o *shareOptions) {
+		o.message = message
+		o.sendInvitation = true
+	}
+}
+
+// WithRequireSignIn requires the invited recipients to sign in
+func WithRequireSignIn(required bool) ShareOption {
+	return func(o *shareOptions) {
+		o.requireSignIn = required
+	}
+}
+
+// WithSendInvitation sends an email to the invited recipients
+func WithSendInvitation(send bool) ShareOption {
+	return func(o *shareOptions) {
+		o.sendInvitation = send
+	}
+}
+
+func newShareOptions(opts ...ShareOption) shareOptions {
+	o := shareOptions{
+		requireSignIn: true,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o shareOptions) expirationDateTime() string {
+	if o.expiration.IsZero() {
+		return ""
+	}
+	return o.expiration.UTC().Format(time.RFC3339)
+}
+
+type createLinkRequest struct {
+	Type               string `json:"type"`
+	Scope              string `json:"scope,omitempty"`
+	ExpirationDateTime string `json:"expirationDateTime,omitempty"`
+	Password           string `json:"password,omitempty"`
+}
+
+type inviteRequest struct {
+	Recipients         []inviteRecipient `json:"recipients"`
+	Message            string            `json:"message,omitempty"`
+	RequireSignIn      bool              `json:"requireSignIn"`
+	SendInvitation     bool              `json:"sendInvitation"`
+	Roles              []string          `json:"roles"`
+	ExpirationDateTime string            `json:"expirationDateTime,omitempty"`
+	Password           string            `json:"password,omitempty"`
+}
+
+type inviteRecipient struct {
+	Email string `json:"email"`
+}
+
+// CreateLink creates a sharing link (view, edit or embed) for an item,
+// the existing link is returned when one with the same type and scope exists
+func (c *client) CreateLink(ctx context.Context, driveID, itemID, linkType, scope string, opts ...ShareOption) (*types.Permission, error) {
+	o := newShareOptions(opts...)
+	var res types.Permission
+	err := c.postJSON(ctx, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/createLink", driveID, itemID), createLinkRequest{
+		Type:               linkType,
+		Scope:              scope,
+		ExpirationDateTime: o.expirationDateTime(),
+		Password:           o.password,
+	}, &res)
+	if err != nil {
+		return nil, fmt.Errorf("create link: %w", err)
+	}
+	return &res, nil
+}
+
+// Invite grants roles (read or write) on an item to the recipients
+func (c *client) Invite(ctx context.Context, driveID, itemID string, recipients, roles []string, opts ...ShareOption) (*types.ListPermissions, error) {
+	o := newShareOptions(opts...)
+	req := inviteRequest{
+		Message:            o.message,
+		RequireSignIn:      o.requireSignIn,
+		SendInvitation:     o.sendInvitation,
+		Roles:              roles,
+		ExpirationDateTime: o.expirationDateTime(),
+		Password:           o.password,
+	}
+	for _, r := range recipients {
+		req.Recipients = append(req.Recipients, inviteRecipient{Email: r})
+	}
+
+	var res types.ListPermissions
+	if err := c.postJSON(ctx, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/invite", driveID, itemID), req, &res); err != nil {
+		return nil, fmt.Errorf("invite: %w", err)
+	}
+	return &res, nil
+}
+
+// ListPermissions lists the sharing permissions of an item
+func (c *client) ListPermissions(ctx context.Context, driveID, itemID string) (*types.ListPermissions, error) {
+	req, err := http.NewRequest(http.MethodGet, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/permissions", driveID, itemID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	var res types.ListPermissions
+	if err := c.do(req, &res); err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
+	}
+	return &res, nil
+}
+
+// DeletePermission removes a sharing permission, only
+// permissions that aren't inherited can be removed
+func (c *client) DeletePermission(ctx context.Context, driveID, itemID, permissionID string) error {
+	req, err := http.NewRequest(http.MethodDelete, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/permissions/%s", driveID, itemID, url.PathEscape(permissionID)), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+
+	if err := c.do(req, nil); err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	return nil
+}
+
+func (c *client) postJSON(ctx context.Context, u string, payload any, resp types.APIResponse) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal json: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewBuffer(b))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	if err := c.do(req, resp); err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	return nil
+}
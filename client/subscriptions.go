@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	graphSubscriptionsEndpoint = "https://graph.microsoft.com/v1.0/subscriptions"
+
+	// MaxSubscriptionLifetime is the longest a drive
+	// subscription lasts before it must be renewed
+	MaxSubscriptionLifetime = 42300 * time.Minute
+)
+
+// CreateSubscription subscribes to the changes of the drive, the
+// notifications are posted to notificationURL with clientState (so the
+// receiver can tell they're genuine) until expiration. The API validates
+// notificationURL before answering, the receiver must be up already.
+// Drives only support subscriptions on their root folder.
+func (c *client) CreateSubscription(ctx context.Context, driveID, notificationURL, clientState string, expiration time.Time) (*types.Subscription, error) {
+	payload := subscriptionPayload{
+		ChangeType:         "updated",
+		NotificationURL:    notificationURL,
+		Resource:           fmt.Sprintf("/drives/%s/root", driveID),
+		ExpirationDateTime: expiration.UTC(),
+		ClientState:        clientState,
+	}
+	var res types.Subscription
+	if err := c.postJSON(ctx, graphSubscriptionsEndpoint, payload, &res); err != nil {
+		return nil, fmt.Errorf("create subscription: %w", err)
+	}
+	return &res, nil
+}
+
+// RenewSubscription extends the subscription until expiration
+func (c *client) RenewSubscription(ctx context.Context, subscriptionID string, expiration time.Time) (*types.Subscription, error) {
+	b, err := json.Marshal(subscriptionPayload{ExpirationDateTime: expiration.UTC()})
+	if err != nil {
+		return nil, fmt.Errorf("marshal json: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPatch, graphSubscriptionsEndpoint+"/"+url.PathEscape(subscriptionID), bytes.NewBuffer(b))
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	var res types.Subscription
+	if err := c.do(req, &res); err != nil {
+		return nil, fmt.Errorf("renew subscription: %w", err)
+	}
+	return &res, nil
+}
+
+// DeleteSubscription stops the notifications of the subscription
+func (c *client) DeleteSubscription(ctx context.Context, subscriptionID string) error {
+	req, err := http.NewRequest(http.MethodDelete, graphSubscriptionsEndpoint+"/"+url.PathEscape(subscriptionID), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+
+	if err := c.do(req, nil); err != nil {
+		return fmt.Errorf("delete subscription: %w", err)
+	}
+	return nil
+}
+
+type subscriptionPayload struct {
+	ChangeType         string    `json:"changeType,omitempty"`
+	NotificationURL    string    `json:"notificationUrl,omitempty"`
+	Resource           string    `json:"resource,omitempty"`
+	ExpirationDateTime time.Time `json:"expirationDateTime"`
+	ClientState        string    `json:"clientState,omitempty"`
+}
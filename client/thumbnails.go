@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+)
+
+const (
+	ThumbnailSmall  = "small"
+	ThumbnailMedium = "medium"
+	ThumbnailLarge  = "large"
+)
+
+// customThumbnailSize matches the custom sizes, "c{width}x{height}" scales
+// the image to fit the size and the "_crop" suffix crops it to fill it
+var customThumbnailSize = regexp.MustCompile(`^c[1-9][0-9]*x[1-9][0-9]*(_crop)?$`)
+
+// IsThumbnailSize tells if size is a standard thumbnail
+// size or a custom one (like "c300x300_crop")
+func IsThumbnailSize(size string) bool {
+	switch size {
+	case ThumbnailSmall, ThumbnailMedium, ThumbnailLarge:
+		return true
+	}
+	return customThumbnailSize.MatchString(size)
+}
+
+// GetThumbnails returns the thumbnail sets of an item, with the
+// standard sizes or, when size is set, only with that size (custom
+// sizes are only returned when asked). Items that can't be rendered
+// (like encrypted files) have no sets.
+func (c *client) GetThumbnails(ctx context.Context, driveID, itemID, size string) (*types.ListThumbnails, error) {
+	u := graphApiEndpoint + fmt.Sprintf("/drives/%s/items/%s/thumbnails", driveID, itemID)
+	if size != "" {
+		if !IsThumbnailSize(size) {
+			return nil, fmt.Errorf("invalid thumbnail size %q", size)
+		}
+		u += "?select=" + url.QueryEscape(size)
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	var resp types.ListThumbnails
+	if err := c.do(req, &resp); err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
+	}
+	return &resp, nil
+}
+
+// DownloadThumbnail writes the image of the thumbnail of the given
+// set and size into w
+func (c *client) DownloadThumbnail(ctx context.Context, driveID, itemID, setID, size string, w io.Writer) (int64, error) {
+	if !IsThumbnailSize(size) {
+		return 0, fmt.Errorf("invalid thumbnail size %q", size)
+	}
+	return c.download(ctx, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/thumbnails/%s/%s/content", driveID, itemID, url.PathEscape(setID), size), w)
+}
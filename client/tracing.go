@@ -0,0 +1,128 @@
+package client
+
+import (
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"net/http"
+	"sync"
+)
+
+const tracerName = "github.com/eldius/onedrive-client/client"
+
+const (
+	// ClientRequestIDHeader identifies a request on the API logs, it's
+	// set on the requests that don't carry one
+	ClientRequestIDHeader = "client-request-id"
+	// RequestIDHeader is the ID the API gives to the request
+	RequestIDHeader = "request-id"
+)
+
+var (
+	clientRequestIDKey = attribute.Key("onedrive.client_request_id")
+	requestIDKey       = attribute.Key("onedrive.request_id")
+	retryKeyAttr       = attribute.Key("onedrive.retry")
+)
+
+// WithTracerProvider sets the provider of the request
+// spans, the global one (otel.GetTracerProvider) by default
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *client) {
+		if tp == nil {
+			return
+		}
+		c.tracer = tp.Tracer(tracerName)
+	}
+}
+
+func defaultTracer() trace.Tracer {
+	// the global provider delegates to the one set later
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
+
+func tracingMiddleware(tracer trace.Tracer) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &tracingTransport{tracer: tracer, next: next}
+	}
+}
+
+// tracingTransport sends every request in a span, which ends once the
+// response body is read or closed. The client-request-id header is set
+// on the requests, both IDs are kept as span attributes.
+type tracingTransport struct {
+	tracer trace.Tracer
+	next   http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	endpoint := endpointTemplate(req.URL)
+	ctx, span := t.tracer.Start(req.Context(), req.Method+" "+endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLTemplate(endpoint),
+			semconv.ServerAddress(req.URL.Hostname()),
+			retryKeyAttr.Bool(isRetry(req.Context())),
+		),
+	)
+
+	// the request must not be changed, the clone carries the header
+	req = req.Clone(ctx)
+	id := req.Header.Get(ClientRequestIDHeader)
+	if id == "" {
+		id = uuid.NewString()
+		req.Header.Set(ClientRequestIDHeader, id)
+	}
+	span.SetAttributes(clientRequestIDKey.String(id))
+
+	res, err := next.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+	if rid := res.Header.Get(RequestIDHeader); rid != "" {
+		span.SetAttributes(requestIDKey.String(rid))
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+	}
+	res.Body = &spanBody{ReadCloser: res.Body, span: span}
+	return res, nil
+}
+
+// spanBody ends the span once the body is read or closed
+type spanBody struct {
+	io.ReadCloser
+	span trace.Span
+	once sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.end()
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	b.end()
+	return b.ReadCloser.Close()
+}
+
+func (b *spanBody) end() {
+	b.once.Do(func() {
+		b.span.End()
+	})
+}
@@ -0,0 +1,478 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// uploadFragmentSize is the size every upload session
+	// fragment must be a multiple of (320 KiB)
+	uploadFragmentSize = 320 * 1024
+
+	// DefaultChunkSize is the upload session chunk size
+	// used when none is configured (10 MiB)
+	DefaultChunkSize = 32 * uploadFragmentSize
+
+	// SimpleUploadMaxSize is the biggest file uploaded
+	// with a single request instead of an upload session
+	SimpleUploadMaxSize = 4 * 1024 * 1024
+
+	ConflictBehaviorRename  = "rename"
+	ConflictBehaviorReplace = "replace"
+	ConflictBehaviorFail    = "fail"
+
+	maxLimiterWait = 32 * 1024
+)
+
+// BandwidthLimiter throttles the bytes sent and
+// received by uploads and downloads
+type BandwidthLimiter interface {
+	WaitN(ctx context.Context, n int) error
+}
+
+// TransferOption is used to configure a
+// single upload or download call
+type TransferOption func(*transferOptions)
+
+type transferOptions struct {
+	chunkSize        int64
+	chunkConcurrency int
+	conflictBehavior string
+	progress         ProgressFunc
+	fileSystemInfo   *fileSystemInfo
+	offset           int64
+}
+
+func newTransferOptions(opts ...TransferOption) transferOptions {
+	o := transferOptions{
+		chunkSize:        DefaultChunkSize,
+		chunkConcurrency: 1,
+		conflictBehavior: ConflictBehaviorRename,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithChunkSize defines the upload session chunk size,
+// it's rounded down to a multiple of 320 KiB
+func WithChunkSize(size int64) TransferOption {
+	return func(o *transferOptions) {
+		size = size - size%uploadFragmentSize
+		if size <= 0 {
+			return
+		}
+		o.chunkSize = size
+	}
+}
+
+// WithChunkConcurrency defines how many chunks of the same upload
+// session are read at the same time. They're still sent one at a
+// time, the API requires the byte ranges in order.
+func WithChunkConcurrency(n int) TransferOption {
+	return func(o *transferOptions) {
+		if n <= 0 {
+			return
+		}
+		o.chunkConcurrency = n
+	}
+}
+
+// WithConflictBehavior defines what happens when the
+// uploaded file already exists (rename, replace or fail)
+func WithConflictBehavior(behavior string) TransferOption {
+	return func(o *transferOptions) {
+		if behavior == "" {
+			return
+		}
+		o.conflictBehavior = behavior
+	}
+}
+
+// WithFileSystemInfo sets the local file timestamps
+// on the uploaded item (zero values are ignored)
+func WithFileSystemInfo(created, modified time.Time) TransferOption {
+	return func(o *transferOptions) {
+		fsi := &fileSystemInfo{}
+		if !created.IsZero() {
+			fsi.CreatedDateTime = created.UTC().Format(time.RFC3339)
+		}
+		if !modified.IsZero() {
+			fsi.LastModifiedDateTime = modified.UTC().Format(time.RFC3339)
+		}
+		o.fileSystemInfo = fsi
+	}
+}
+
+// WithOffset starts the download offset bytes into the content
+func WithOffset(offset int64) TransferOption {
+	return func(o *transferOptions) {
+		o.offset = max(offset, 0)
+	}
+}
+
+// UploadFile uploads size bytes read from r as fileName inside
+// the parentID folder. Small files are sent in a single request,
+// bigger ones through an upload session.
+func (c *client) UploadFile(ctx context.Context, driveID, parentID, fileName string, r io.ReaderAt, size int64, opts ...TransferOption) (*types.CreateFile, error) {
+	o := newTransferOptions(opts...)
+	tracker := newProgressTracker(o.progress, size)
+	if size <= SimpleUploadMaxSize {
+		res, err := c.simpleUpload(ctx, driveID, parentID, fileName, r, size, o, tracker)
+		if err != nil {
+			return nil, err
+		}
+		if o.fileSystemInfo != nil {
+			// simple uploads can't carry metadata, it's set afterward
+			if err := c.updateItem(ctx, driveID, res.ID, itemUpdate{FileSystemInfo: o.fileSystemInfo}, res); err != nil {
+				return nil, fmt.Errorf("set file system info: %w", err)
+			}
+		}
+		tracker.finish()
+		return res, nil
+	}
+
+	session, err := c.CreateUploadSession(ctx, driveID, parentID, fileName, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create upload session: %w", err)
+	}
+
+	res, err := c.uploadSessionChunks(ctx, session, r, size, o, tracker)
+	if err != nil {
+		c.cancelUploadSession(session)
+		return nil, fmt.Errorf("upload chunks: %w", err)
+	}
+	tracker.finish()
+	return res, nil
+}
+
+func (c *client) simpleUpload(ctx context.Context, driveID, parentID, fileName string, r io.ReaderAt, size int64, o transferOptions, tracker *progressTracker) (*types.CreateFile, error) {
+	u := graphApiEndpoint + fmt.Sprintf(
+		"/drives/%s/items/%s:/%s:/content?@microsoft.graph.conflictBehavior=%s",
+		driveID,
+		parentID,
+		url.PathEscape(fileName),
+		url.QueryEscape(o.conflictBehavior),
+	)
+	req, err := http.NewRequest(http.MethodPut, u, tracker.reader(io.NewSectionReader(r, 0, size)))
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	// the content is read again instead of being buffered
+	// when it's sent once more after a token refresh
+	req.ContentLength = size
+	req.GetBody = func() (io.ReadCloser, error) {
+		tracker.restart(0)
+		return io.NopCloser(tracker.reader(io.NewSectionReader(r, 0, size))), nil
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Accept", "application/json")
+
+	var res types.CreateFile
+	if err := c.do(req, &res); err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
+	}
+	return &res, nil
+}
+
+type uploadChunk struct {
+	start int64
+	end   int64
+}
+
+func (c *client) uploadSessionChunks(ctx context.Context, session *types.UploadSession, r io.ReaderAt, size int64, o transferOptions, tracker *progressTracker) (*types.CreateFile, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the API requires the byte ranges in order, so the chunks are sent one
+	// at a time, only the next chunkConcurrency-1 ones are read meanwhile
+	chunks := make(chan chan chunkBody, o.chunkConcurrency-1)
+	go func() {
+		defer close(chunks)
+		for start := int64(0); start < size; start += o.chunkSize {
+			chunk := uploadChunk{start: start, end: min(start+o.chunkSize, size) - 1}
+			ch := make(chan chunkBody, 1)
+			select {
+			case chunks <- ch:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				ch <- readChunk(r, chunk, o.chunkConcurrency > 1)
+			}()
+		}
+	}()
+
+	var result *types.CreateFile
+	for ch := range chunks {
+		body := <-ch
+		if body.err != nil {
+			return nil, fmt.Errorf("chunk %d-%d: read: %w", body.chunk.start, body.chunk.end, body.err)
+		}
+		res, err := c.uploadChunk(ctx, session.UploadURL, body.r, body.chunk, size, tracker)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d-%d: %w", body.chunk.start, body.chunk.end, err)
+		}
+		if res != nil {
+			result = res
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, errors.New("upload session finished without the uploaded item")
+	}
+	return result, nil
+}
+
+// chunkBody is the content of a chunk, or why it couldn't be read
+type chunkBody struct {
+	chunk uploadChunk
+	r     io.ReadSeeker
+	err   error
+}
+
+// readChunk returns the content of the chunk, read into memory when
+// readAhead is set or else read from r while it's sent
+func readChunk(r io.ReaderAt, chunk uploadChunk, readAhead bool) chunkBody {
+	length := chunk.end - chunk.start + 1
+	if !readAhead {
+		return chunkBody{chunk: chunk, r: io.NewSectionReader(r, chunk.start, length)}
+	}
+	b := make([]byte, length)
+	if _, err := r.ReadAt(b, chunk.start); err != nil && !errors.Is(err, io.EOF) {
+		return chunkBody{chunk: chunk, err: err}
+	}
+	return chunkBody{chunk: chunk, r: bytes.NewReader(b)}
+}
+
+// uploadChunk sends a single byte range to the upload session.
+// The upload URL is pre-authenticated, so no auth header is sent.
+// It returns the uploaded item when the chunk completes the file.
+func (c *client) uploadChunk(ctx context.Context, uploadURL string, body io.ReadSeeker, chunk uploadChunk, size int64, tracker *progressTracker) (*types.CreateFile, error) {
+	length := chunk.end - chunk.start + 1
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uploadURL, tracker.reader(body))
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req.ContentLength = length
+	// the throttled chunks are sent again (see RetryMiddleware)
+	req.GetBody = func() (io.ReadCloser, error) {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		tracker.restart(chunk.start)
+		return io.NopCloser(tracker.reader(body)), nil
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", chunk.start, chunk.end, size))
+
+	res, err := c.c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	switch res.StatusCode {
+	case http.StatusAccepted:
+		return nil, nil
+	case http.StatusOK, http.StatusCreated:
+		var item types.CreateFile
+		if err := json.NewDecoder(bytes.NewReader(b)).Decode(&item); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		item.SetRawBody(string(b))
+		item.SetStatusCode(res.StatusCode)
+		return &item, nil
+	default:
+		return nil, newGraphError(res.StatusCode, b)
+	}
+}
+
+// UploadToSession sends size bytes read from r through an upload
+// session created beforehand with CreateUploadSession
+func (c *client) UploadToSession(ctx context.Context, session *types.UploadSession, r io.ReaderAt, size int64, opts ...TransferOption) (*types.CreateFile, error) {
+	o := newTransferOptions(opts...)
+	tracker := newProgressTracker(o.progress, size)
+	res, err := c.uploadSessionChunks(ctx, session, r, size, o, tracker)
+	if err != nil {
+		return nil, fmt.Errorf("upload chunks: %w", err)
+	}
+	tracker.finish()
+	return res, nil
+}
+
+// CancelUploadSession discards an upload session and the content sent through it
+func (c *client) CancelUploadSession(ctx context.Context, session *types.UploadSession) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, session.UploadURL, nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	res, err := c.c.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(res.Body)
+		return newGraphError(res.StatusCode, b)
+	}
+	return nil
+}
+
+func (c *client) cancelUploadSession(session *types.UploadSession) {
+	if err := c.CancelUploadSession(context.Background(), session); err != nil {
+		slog.With("error", err).Warn("cancel upload session")
+	}
+}
+
+// Download writes the item content into w and
+// returns how many bytes were written
+func (c *client) Download(ctx context.Context, driveID, itemID string, w io.Writer, opts ...TransferOption) (int64, error) {
+	return c.download(ctx, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/content", driveID, itemID), w, opts...)
+}
+
+func (c *client) download(ctx context.Context, u string, w io.Writer, opts ...TransferOption) (int64, error) {
+	o := newTransferOptions(opts...)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return 0, fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	if o.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", o.offset))
+	}
+
+	res, err := c.doStream(req)
+	if err != nil {
+		return 0, fmt.Errorf("executing request: %w", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if o.offset > 0 && res.StatusCode != http.StatusPartialContent {
+		// the range was ignored, the whole content is sent
+		if _, err := io.CopyN(io.Discard, res.Body, o.offset); err != nil {
+			return 0, fmt.Errorf("skip to offset %d: %w", o.offset, err)
+		}
+		res.ContentLength = max(res.ContentLength-o.offset, -1)
+	}
+
+	tracker := newProgressTracker(o.progress, max(res.ContentLength, 0))
+	n, err := io.Copy(w, tracker.reader(res.Body))
+	if err != nil {
+		return n, fmt.Errorf("copy content: %w", err)
+	}
+	tracker.finish()
+	return n, nil
+}
+
+// doStream executes a request whose response body is not
+// a JSON payload, the caller must close the response body
+func (c *client) doStream(req *http.Request) (*http.Response, error) {
+	res, err := c.c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	if res.StatusCode/100 == 2 {
+		return res, nil
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	b, _ := io.ReadAll(res.Body)
+	return nil, newGraphError(res.StatusCode, b)
+}
+
+// bandwidthMiddleware limits the request and response bodies with l,
+// the requests are sent as is when it's nil
+func bandwidthMiddleware(l BandwidthLimiter) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if l == nil {
+			return next
+		}
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			if req.Body != nil && req.Body != http.NoBody {
+				// the request must not be changed, a copy carries the limited body
+				r := *req
+				r.Body = &limitedReader{ctx: ctx, r: req.Body, l: l}
+				req = &r
+			}
+			res, err := next.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+			res.Body = &limitedReader{ctx: ctx, r: res.Body, l: l}
+			return res, nil
+		})
+	}
+}
+
+type limitedReader struct {
+	ctx context.Context
+	r   io.ReadCloser
+	l   BandwidthLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > maxLimiterWait {
+		p = p[:maxLimiterWait]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if wErr := r.l.WaitN(r.ctx, n); wErr != nil {
+			return n, wErr
+		}
+	}
+	return n, err
+}
+
+func (r *limitedReader) Close() error {
+	return r.r.Close()
+}
+
+// escapePath escapes each segment of a
+// slash separated drive path
+func escapePath(p string) string {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// IsNotFound tells if err is a Graph API
+// response for a missing item
+func IsNotFound(err error) bool {
+	var gErr *types.GraphError
+	if errors.As(err, &gErr) {
+		return gErr.StatusCode == http.StatusNotFound
+	}
+	return false
+}
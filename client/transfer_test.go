@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestUploadToSessionRetry(t *testing.T) {
+	const chunkSize = uploadFragmentSize
+	content := make([]byte, 2*chunkSize+1000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	tests := []struct {
+		name        string
+		concurrency int
+		// throttled are the chunk ranges answered once with 429
+		throttled []string
+		wantSent  []string
+	}{
+		{
+			name:        "streamed",
+			concurrency: 1,
+			throttled:   []string{"327680-655359"},
+			wantSent:    []string{"0-327679", "327680-655359", "327680-655359", "655360-656359"},
+		},
+		{
+			name:        "read ahead",
+			concurrency: 3,
+			throttled:   []string{"0-327679", "655360-656359"},
+			wantSent:    []string{"0-327679", "0-327679", "327680-655359", "655360-656359", "655360-656359"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []string
+			var got bytes.Buffer
+			throttled := map[string]bool{}
+			for _, r := range tt.throttled {
+				throttled[r] = true
+			}
+			base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				var start, end, total int64
+				if _, err := fmt.Sscanf(req.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil {
+					return nil, err
+				}
+				r := fmt.Sprintf("%d-%d", start, end)
+				sent = append(sent, r)
+				b, _ := io.ReadAll(req.Body)
+				if int64(len(b)) != end-start+1 || !bytes.Equal(b, content[start:end+1]) {
+					t.Errorf("chunk %s: got %d bytes not matching the content", r, len(b))
+				}
+				if throttled[r] {
+					delete(throttled, r)
+					res := respond(req, http.StatusTooManyRequests, `{"error":{"code":"activityLimitReached"}}`)
+					res.Header.Set("Retry-After", "0")
+					return res, nil
+				}
+				got.Write(b)
+				if end+1 < total {
+					return respond(req, http.StatusAccepted, `{}`), nil
+				}
+				return respond(req, http.StatusCreated, `{"id":"item"}`), nil
+			})
+			c := New(WithHttpClient(&http.Client{Transport: base}))
+
+			var last Progress
+			res, err := c.UploadToSession(
+				context.Background(),
+				&types.UploadSession{UploadURL: "https://upload.example.com/session"},
+				bytes.NewReader(content),
+				int64(len(content)),
+				WithChunkSize(chunkSize),
+				WithChunkConcurrency(tt.concurrency),
+				WithProgress(func(p Progress) { last = p }),
+			)
+			if err != nil {
+				t.Fatalf("upload: %v", err)
+			}
+			if res.ID != "item" {
+				t.Errorf("uploaded item = %q", res.ID)
+			}
+			if fmt.Sprint(sent) != fmt.Sprint(tt.wantSent) {
+				t.Errorf("sent %v, want %v", sent, tt.wantSent)
+			}
+			if !bytes.Equal(got.Bytes(), content) {
+				t.Errorf("uploaded %d bytes not matching the content", got.Len())
+			}
+			if !last.Finished || last.Done != int64(len(content)) {
+				t.Errorf("last progress = %+v", last)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"net/http"
+)
+
+// ListDeletedItems lists the deleted items below the folder itemID, from
+// the folder delta (the changes since it was created). Deleted items are
+// in the recycle bin until it's emptied. Delta on folders other than the
+// drive root is only supported by personal drives.
+func (c *client) ListDeletedItems(ctx context.Context, driveID, itemID string, opts ...QueryOption) (*types.ListFiles, error) {
+	deleted := &types.ListFiles{}
+	next := withQuery(graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/delta", driveID, itemID), opts)
+	for next != "" {
+		page, err := c.listPage(ctx, next)
+		if err != nil {
+			return nil, fmt.Errorf("list deleted items: %w", err)
+		}
+		for _, v := range page.Value {
+			if v.IsDeleted() {
+				deleted.Value = append(deleted.Value, v)
+			}
+		}
+		next = page.OdataNextLink
+	}
+	return deleted, nil
+}
+
+// RestoreItem restores a deleted item from the recycle bin, into the
+// folder parentID (where it was deleted from when empty) and renamed to
+// name when it isn't empty, only personal drives support it
+func (c *client) RestoreItem(ctx context.Context, driveID, itemID, parentID, name string) (*types.Item, error) {
+	var res types.Item
+	if err := c.postJSON(ctx, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/restore", driveID, itemID), newRestorePayload(parentID, name), &res); err != nil {
+		return nil, fmt.Errorf("restore item: %w", err)
+	}
+	return &res, nil
+}
+
+// PermanentDeleteItem deletes an item (a folder with all its content)
+// without moving it to the recycle bin, personal drives don't support it
+func (c *client) PermanentDeleteItem(ctx context.Context, driveID, itemID string) error {
+	req, err := http.NewRequest(http.MethodPost, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/permanentDelete", driveID, itemID), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+
+	if err := c.do(req, nil); err != nil {
+		return fmt.Errorf("permanently delete item: %w", err)
+	}
+	return nil
+}
+
+type restorePayload struct {
+	ParentReference *itemParentRef `json:"parentReference,omitempty"`
+	Name            string         `json:"name,omitempty"`
+}
+
+func newRestorePayload(parentID, name string) restorePayload {
+	p := restorePayload{Name: name}
+	if parentID != "" {
+		p.ParentReference = &itemParentRef{ID: parentID}
+	}
+	return p
+}
@@ -0,0 +1,33 @@
+package types
+
+import "encoding/json"
+
+// BatchRequests is the payload of a JSON batch request
+type BatchRequests struct {
+	Requests []BatchSubRequest `json:"requests"`
+}
+
+// BatchSubRequest is a request packed in a JSON batch
+type BatchSubRequest struct {
+	ID        string            `json:"id"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      any               `json:"body,omitempty"`
+	DependsOn []string          `json:"dependsOn,omitempty"`
+}
+
+// BatchResponses is the response of a JSON batch request,
+// the responses aren't in the requests order
+type BatchResponses struct {
+	apiResponse
+	Responses []BatchSubResponse `json:"responses"`
+}
+
+// BatchSubResponse is the response of a request packed in a JSON batch
+type BatchSubResponse struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
@@ -0,0 +1,23 @@
+package types
+
+// Drive is a drive and its storage quota
+type Drive struct {
+	apiResponse
+	ID string `json:"id"`
+	// DriveType is personal, business or documentLibrary
+	DriveType string      `json:"driveType"`
+	Name      string      `json:"name,omitempty"`
+	Owner     IdentitySet `json:"owner"`
+	Quota     *Quota      `json:"quota,omitempty"`
+}
+
+// Quota is the storage space of a drive, in bytes
+type Quota struct {
+	Total     int64 `json:"total"`
+	Used      int64 `json:"used"`
+	Remaining int64 `json:"remaining"`
+	// Deleted is the space taken by the recycle bin
+	Deleted int64 `json:"deleted"`
+	// State is normal, nearing, critical or exceeded
+	State string `json:"state"`
+}
@@ -0,0 +1,29 @@
+package types
+
+import "fmt"
+
+// GraphError is the error payload returned by the
+// Microsoft Graph API on non 2xx responses
+type GraphError struct {
+	apiResponse
+	Detail GraphErrorDetail `json:"error"`
+}
+
+type GraphErrorDetail struct {
+	Code       string          `json:"code"`
+	Message    string          `json:"message"`
+	InnerError GraphInnerError `json:"innerError"`
+}
+
+type GraphInnerError struct {
+	Date            string `json:"date"`
+	RequestID       string `json:"request-id"`
+	ClientRequestID string `json:"client-request-id"`
+}
+
+func (e *GraphError) Error() string {
+	if e.Detail.Code == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("graph error (%d): %s: %s", e.StatusCode, e.Detail.Code, e.Detail.Message)
+}
@@ -153,8 +153,9 @@ type Shared struct {
 
 type ListFiles struct {
 	apiResponse
-	OdataContext string  `json:"@odata.context"`
-	Value        []Value `json:"value"`
+	OdataContext  string  `json:"@odata.context"`
+	OdataNextLink string  `json:"@odata.nextLink,omitempty"`
+	Value         []Value `json:"value"`
 }
 type Owner struct {
 	User User `json:"user"`
@@ -175,6 +176,29 @@ type Value struct {
 	File                      File            `json:"file"`
 	FileSystemInfo            FileSystemInfo  `json:"fileSystemInfo"`
 	Shared                    Shared          `json:"shared"`
+	Folder                    *Folder         `json:"folder,omitempty"`
+	// Deleted is only set on the deleted items, in the delta listings
+	Deleted *Deleted `json:"deleted,omitempty"`
+
+	// Thumbnails, Children and Permissions are only
+	// returned when the request expands them
+	Thumbnails  []ThumbnailSet `json:"thumbnails,omitempty"`
+	Children    []Value        `json:"children,omitempty"`
+	Permissions []Permission   `json:"permissions,omitempty"`
+}
+
+// Deleted tells the item was deleted
+type Deleted struct {
+	State string `json:"state,omitempty"`
+}
+
+// IsDeleted tells if the item was deleted
+func (v Value) IsDeleted() bool {
+	return v.Deleted != nil
+}
+
+func (v Value) IsFolder() bool {
+	return v.Folder != nil
 }
 
 func (v Value) GetMimeType() string {
@@ -183,3 +207,18 @@ func (v Value) GetMimeType() string {
 	}
 	return v.File.MimeType
 }
+
+// Item is a single drive item returned by the item
+// endpoints (get by id or by path)
+type Item struct {
+	apiResponse
+	Value
+}
+
+type UploadSession struct {
+	apiResponse
+	OdataContext       string    `json:"@odata.context"`
+	UploadURL          string    `json:"uploadUrl"`
+	ExpirationDateTime time.Time `json:"expirationDateTime"`
+	NextExpectedRanges []string  `json:"nextExpectedRanges"`
+}
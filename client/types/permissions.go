@@ -0,0 +1,100 @@
+package types
+
+import "time"
+
+// Permission is a sharing permission of an item, created by a
+// sharing link (Link is set) or an invitation (Invitation is set)
+type Permission struct {
+	apiResponse
+	ID                    string             `json:"id"`
+	Roles                 []string           `json:"roles"`
+	Link                  *SharingLink       `json:"link,omitempty"`
+	Invitation            *SharingInvitation `json:"invitation,omitempty"`
+	GrantedTo             *IdentitySet       `json:"grantedTo,omitempty"`
+	GrantedToIdentities   []IdentitySet      `json:"grantedToIdentities,omitempty"`
+	GrantedToV2           *IdentitySet       `json:"grantedToV2,omitempty"`
+	GrantedToIdentitiesV2 []IdentitySet      `json:"grantedToIdentitiesV2,omitempty"`
+	InheritedFrom         *ParentReference   `json:"inheritedFrom,omitempty"`
+	ShareID               string             `json:"shareId,omitempty"`
+	ExpirationDateTime    *time.Time         `json:"expirationDateTime,omitempty"`
+	HasPassword           bool               `json:"hasPassword,omitempty"`
+}
+
+// IsInherited tells if the permission is inherited from an ancestor
+func (p Permission) IsInherited() bool {
+	return p.InheritedFrom != nil && p.InheritedFrom.ID != ""
+}
+
+// IsOwner tells if the permission is the item owner one
+func (p Permission) IsOwner() bool {
+	for _, r := range p.Roles {
+		if r == "owner" {
+			return true
+		}
+	}
+	return false
+}
+
+// Grantees returns the identities the permission is granted to
+func (p Permission) Grantees() []Identity {
+	var sets []IdentitySet
+	switch {
+	case p.GrantedToV2 != nil || len(p.GrantedToIdentitiesV2) > 0:
+		if p.GrantedToV2 != nil {
+			sets = append(sets, *p.GrantedToV2)
+		}
+		sets = append(sets, p.GrantedToIdentitiesV2...)
+	default:
+		if p.GrantedTo != nil {
+			sets = append(sets, *p.GrantedTo)
+		}
+		sets = append(sets, p.GrantedToIdentities...)
+	}
+
+	var ids []Identity
+	for _, s := range sets {
+		for _, id := range []*Identity{s.User, s.Group, s.Application, s.SiteUser} {
+			if id != nil {
+				ids = append(ids, *id)
+			}
+		}
+	}
+	return ids
+}
+
+// SharingLink is the link of a permission created by createLink
+type SharingLink struct {
+	Type             string       `json:"type"`
+	Scope            string       `json:"scope"`
+	WebURL           string       `json:"webUrl"`
+	WebHTML          string       `json:"webHtml,omitempty"`
+	PreventsDownload bool         `json:"preventsDownload,omitempty"`
+	Application      *Application `json:"application,omitempty"`
+}
+
+// SharingInvitation is the invitation of a permission created by invite
+type SharingInvitation struct {
+	Email          string       `json:"email"`
+	SignInRequired bool         `json:"signInRequired"`
+	InvitedBy      *IdentitySet `json:"invitedBy,omitempty"`
+}
+
+type IdentitySet struct {
+	User        *Identity `json:"user,omitempty"`
+	Group       *Identity `json:"group,omitempty"`
+	Application *Identity `json:"application,omitempty"`
+	SiteUser    *Identity `json:"siteUser,omitempty"`
+}
+
+type Identity struct {
+	ID          string `json:"id,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	Email       string `json:"email,omitempty"`
+	LoginName   string `json:"loginName,omitempty"`
+}
+
+type ListPermissions struct {
+	apiResponse
+	OdataContext string       `json:"@odata.context"`
+	Value        []Permission `json:"value"`
+}
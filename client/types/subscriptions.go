@@ -0,0 +1,31 @@
+package types
+
+import "time"
+
+// Subscription is a webhook subscription, the API posts a
+// Notification to NotificationURL when the resource changes
+type Subscription struct {
+	apiResponse
+	ID                 string    `json:"id"`
+	Resource           string    `json:"resource"`
+	ChangeType         string    `json:"changeType"`
+	NotificationURL    string    `json:"notificationUrl"`
+	ClientState        string    `json:"clientState,omitempty"`
+	ExpirationDateTime time.Time `json:"expirationDateTime"`
+}
+
+// Notifications is the payload posted to the notification URL
+type Notifications struct {
+	Value []Notification `json:"value"`
+}
+
+// Notification tells that the resource of a subscription changed, the
+// changed items aren't given (the resource is listed again to find them)
+type Notification struct {
+	SubscriptionID                 string    `json:"subscriptionId"`
+	ClientState                    string    `json:"clientState"`
+	Resource                       string    `json:"resource"`
+	ChangeType                     string    `json:"changeType"`
+	TenantID                       string    `json:"tenantId"`
+	SubscriptionExpirationDateTime time.Time `json:"subscriptionExpirationDateTime"`
+}
@@ -0,0 +1,83 @@
+package types
+
+import "encoding/json"
+
+// ListThumbnails is the list of thumbnail sets of an item
+type ListThumbnails struct {
+	apiResponse
+	Value []ThumbnailSet `json:"value"`
+}
+
+// ThumbnailSet has the thumbnails of an item, in the standard
+// sizes and in the custom ones requested (like "c300x300_crop")
+type ThumbnailSet struct {
+	ID     string     `json:"id"`
+	Small  *Thumbnail `json:"small,omitempty"`
+	Medium *Thumbnail `json:"medium,omitempty"`
+	Large  *Thumbnail `json:"large,omitempty"`
+	// Custom has the other sizes by their name
+	Custom map[string]*Thumbnail `json:"custom,omitempty"`
+}
+
+// Thumbnail is an image rendered from the item content, its URL
+// is pre-authenticated and only valid for a short time
+type Thumbnail struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+// Get returns the thumbnail of the given size, nil when the set has none
+func (s ThumbnailSet) Get(size string) *Thumbnail {
+	switch size {
+	case "small":
+		return s.Small
+	case "medium":
+		return s.Medium
+	case "large":
+		return s.Large
+	}
+	return s.Custom[size]
+}
+
+// UnmarshalJSON decodes a thumbnail set, the sizes
+// are properties named after them
+func (s *ThumbnailSet) UnmarshalJSON(b []byte) error {
+	var props map[string]json.RawMessage
+	if err := json.Unmarshal(b, &props); err != nil {
+		return err
+	}
+	*s = ThumbnailSet{}
+	for name, raw := range props {
+		switch name {
+		case "id":
+			if err := json.Unmarshal(raw, &s.ID); err != nil {
+				return err
+			}
+		case "custom":
+			if err := json.Unmarshal(raw, &s.Custom); err != nil {
+				return err
+			}
+		default:
+			var t Thumbnail
+			if err := json.Unmarshal(raw, &t); err != nil || t.URL == "" {
+				// not a thumbnail, like the @odata annotations
+				continue
+			}
+			switch name {
+			case "small":
+				s.Small = &t
+			case "medium":
+				s.Medium = &t
+			case "large":
+				s.Large = &t
+			default:
+				if s.Custom == nil {
+					s.Custom = map[string]*Thumbnail{}
+				}
+				s.Custom[name] = &t
+			}
+		}
+	}
+	return nil
+}
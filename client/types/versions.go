@@ -0,0 +1,19 @@
+package types
+
+import "time"
+
+// DriveItemVersion is a version of a file, the
+// first one listed is the current version
+type DriveItemVersion struct {
+	ID                   string         `json:"id"`
+	LastModifiedDateTime time.Time      `json:"lastModifiedDateTime"`
+	LastModifiedBy       LastModifiedBy `json:"lastModifiedBy"`
+	Size                 int            `json:"size"`
+}
+
+type ListVersions struct {
+	apiResponse
+	OdataContext  string             `json:"@odata.context"`
+	OdataNextLink string             `json:"@odata.nextLink,omitempty"`
+	Value         []DriveItemVersion `json:"value"`
+}
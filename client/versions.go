@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ListVersions lists the versions of a file, newest first
+func (c *client) ListVersions(ctx context.Context, driveID, itemID string) (*types.ListVersions, error) {
+	var versions *types.ListVersions
+	next := graphApiEndpoint + fmt.Sprintf("/drives/%s/items/%s/versions", driveID, itemID)
+	for next != "" {
+		req, err := http.NewRequest(http.MethodGet, next, nil)
+		if err != nil {
+			return nil, fmt.Errorf("new request: %w", err)
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", "application/json")
+
+		var page types.ListVersions
+		if err := c.do(req, &page); err != nil {
+			return nil, fmt.Errorf("executing request: %w", err)
+		}
+		if versions == nil {
+			versions = &page
+		} else {
+			versions.Value = append(versions.Value, page.Value...)
+		}
+		next = page.OdataNextLink
+	}
+	versions.OdataNextLink = ""
+	return versions, nil
+}
+
+// DownloadVersion writes the content of a file version into w
+func (c *client) DownloadVersion(ctx context.Context, driveID, itemID, versionID string, w io.Writer, opts ...TransferOption) (int64, error) {
+	return c.download(ctx, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/versions/%s/content", driveID, itemID, url.PathEscape(versionID)), w, opts...)
+}
+
+// RestoreVersion makes a previous version the current version of a file
+func (c *client) RestoreVersion(ctx context.Context, driveID, itemID, versionID string) error {
+	req, err := http.NewRequest(http.MethodPost, graphApiEndpoint+fmt.Sprintf("/drives/%s/items/%s/versions/%s/restoreVersion", driveID, itemID, url.PathEscape(versionID)), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	if err := c.do(req, nil); err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	return nil
+}
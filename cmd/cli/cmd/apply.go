@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/progress"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply <plan-file>",
+	Short: "Executes a saved upload plan",
+	Long: `Executes a plan saved by 'upload --plan-file'.
+
+It aborts without changing anything when the remote
+items changed since the plan was computed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		p, err := usecase.LoadPlan(args[0])
+		if err != nil {
+			panic(err)
+		}
+
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		uc := usecase.NewFileUpload(c)
+
+		display := progress.New(os.Stdout)
+		display.Start()
+		err = uc.Apply(ctx, p, usecase.TransferOptions{
+			Transfers:        applyOpts.transfers,
+			ChunkConcurrency: applyOpts.chunkConcurrency,
+			BandwidthLimit:   applyOpts.bandwidthLimit,
+			Observer:         display,
+		})
+		display.Stop()
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	applyOpts struct {
+		transfers        int
+		chunkConcurrency int
+		bandwidthLimit   string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().IntVar(&applyOpts.transfers, "transfers", 0, "Number of files uploaded in parallel (default from config, 4)")
+	applyCmd.Flags().IntVar(&applyOpts.chunkConcurrency, "chunk-concurrency", 0, "Number of chunks of the same file read ahead while uploading, they are sent in order (default from config, 1)")
+	applyCmd.Flags().StringVar(&applyOpts.bandwidthLimit, "bwlimit", "", `Bandwidth limit, constant ("1M") or time of day schedule ("08:00,512k 19:00,off")`)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/tui"
+	"github.com/eldius/onedrive-client/internal/usecase"
+
+	"github.com/spf13/cobra"
+)
+
+// browseCmd represents the browse command
+var browseCmd = &cobra.Command{
+	Use:   "browse",
+	Short: "Full screen file browser",
+	Long: `Full screen file browser, with the local directory on the left
+and the account drive on the right.
+
+Without --account the account is picked from the stored ones. Mark files
+with space, copy them to the other side with c (uploading or downloading)
+and delete them with d. The running transfers are shown below the panes
+and i toggles the metadata of the item under the cursor.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		err := tui.Run(context.Background(), usecase.NewShellUseCase(c), browseOpts.accountName, usecase.TransferOptions{
+			Transfers:        browseOpts.transfers,
+			ChunkConcurrency: browseOpts.chunkConcurrency,
+			BandwidthLimit:   browseOpts.bandwidthLimit,
+		})
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	browseOpts struct {
+		accountName      string
+		transfers        int
+		chunkConcurrency int
+		bandwidthLimit   string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(browseCmd)
+	browseCmd.Flags().StringVarP(&browseOpts.accountName, "account", "a", "", "Account name (picked from the stored ones when empty)")
+	browseCmd.Flags().IntVar(&browseOpts.transfers, "transfers", 0, "Number of files transferred in parallel (default from config, 4)")
+	browseCmd.Flags().IntVar(&browseOpts.chunkConcurrency, "chunk-concurrency", 0, "Number of chunks of the same file read ahead while uploading, they are sent in order (default from config, 1)")
+	browseCmd.Flags().StringVar(&browseOpts.bandwidthLimit, "bwlimit", "", `Bandwidth limit, constant ("1M") or time of day schedule ("08:00,512k 19:00,off")`)
+}
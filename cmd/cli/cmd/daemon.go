@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/model"
+	"github.com/eldius/onedrive-client/internal/output"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// daemonCmd represents the daemon command
+var daemonCmd = &cobra.Command{
+	Use:   "daemon [job]...",
+	Short: "Runs the backup jobs on their schedule",
+	Long: `Runs the backup jobs of the daemon.jobs config on their schedule.
+
+Every job syncs a local directory to a folder with the same name inside
+its remote folder:
+
+  daemon:
+    jobs:
+      - name: photos
+        account: main
+        local: /home/me/Pictures
+        remote: backup
+        schedule: "0 3 * * *"   # or @daily, @every 6h
+
+A lock file (daemon.lock_file) keeps two daemons from running at once, a
+job still running when it's due again is skipped. SIGHUP reloads the
+config. On SIGINT or SIGTERM the running jobs are given --shutdown-timeout
+to finish, the ones still running after it are interrupted and recorded
+as such (see "daemon runs").
+
+With --once the jobs given as arguments (all of them by default) are run
+one after the other and the command exits, for cron.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		jobs, err := configs.GetDaemonJobs()
+		if err != nil {
+			panic(err)
+		}
+		d, err := newDaemonUseCase().Start(ctx, usecase.DaemonOptions{
+			ShutdownTimeout: daemonOpts.shutdownTimeout,
+			Transfer: usecase.TransferOptions{
+				Transfers:        daemonOpts.transfers,
+				ChunkConcurrency: daemonOpts.chunkConcurrency,
+				BandwidthLimit:   daemonOpts.bandwidthLimit,
+			},
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		if daemonOpts.once {
+			if err := d.RunOnce(ctx, jobs, args...); err != nil {
+				panic(err)
+			}
+			return
+		}
+		if err := d.Schedule(jobs); err != nil {
+			_ = d.Stop()
+			panic(err)
+		}
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go func() {
+			for range hup {
+				if err := reloadDaemonJobs(d); err != nil {
+					slog.With("error", err).Error("failed to reload the jobs, the previous ones are kept")
+				}
+			}
+		}()
+
+		if err := d.Run(ctx); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var daemonRunsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "Lists the latest job runs",
+	Long:  `Lists the latest job runs, newest first.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := newPrinter()
+		runs, err := newDaemonUseCase().Runs(context.Background(), daemonOpts.limit)
+		if err != nil {
+			panic(err)
+		}
+		if err := output.Print(p, runs, jobRunColumns); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	daemonOpts struct {
+		once            bool
+		shutdownTimeout time.Duration
+		limit           int
+
+		transfers        int
+		chunkConcurrency int
+		bandwidthLimit   string
+	}
+)
+
+var jobRunColumns = []output.Column[model.JobRun]{
+	{Header: "Job", Value: func(r model.JobRun) string { return r.Job }},
+	{Header: "Account", Value: func(r model.JobRun) string { return r.Account }},
+	{
+		Header: "Started",
+		Value:  func(r model.JobRun) string { return r.StartedAt.Local().Format(time.DateTime) },
+		Raw:    func(r model.JobRun) string { return r.StartedAt.Format(time.RFC3339) },
+	},
+	{
+		Header: "Duration",
+		Value: func(r model.JobRun) string {
+			if r.FinishedAt.IsZero() {
+				return ""
+			}
+			return r.FinishedAt.Sub(r.StartedAt).Round(time.Second).String()
+		},
+	},
+	{Header: "Status", Value: func(r model.JobRun) string { return r.Status }},
+	{Header: "Error", Value: func(r model.JobRun) string { return r.Error }},
+}
+
+func newDaemonUseCase() *usecase.DaemonUseCase {
+	c := client.New(
+		client.WithSecretID(configs.GetSecretID()),
+	)
+	return usecase.NewDaemonUseCase(c)
+}
+
+// reloadDaemonJobs reads the config again and schedules its jobs
+func reloadDaemonJobs(d *usecase.Daemon) error {
+	if err := configs.ReloadConfig(); err != nil {
+		return err
+	}
+	jobs, err := configs.GetDaemonJobs()
+	if err != nil {
+		return err
+	}
+	if err := d.Schedule(jobs); err != nil {
+		return err
+	}
+	slog.With("jobs", len(jobs)).Info("jobs reloaded")
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.AddCommand(daemonRunsCmd)
+	daemonCmd.Flags().BoolVar(&daemonOpts.once, "once", false, "Run the jobs once and exit")
+	daemonCmd.Flags().DurationVar(&daemonOpts.shutdownTimeout, "shutdown-timeout", 0, "How long the running jobs are given to finish on shutdown (default from config, 30s)")
+	daemonCmd.Flags().IntVar(&daemonOpts.transfers, "transfers", 0, "Number of files uploaded in parallel (default from config, 4)")
+	daemonCmd.Flags().IntVar(&daemonOpts.chunkConcurrency, "chunk-concurrency", 0, "Number of chunks of the same file read ahead while uploading, they are sent in order (default from config, 1)")
+	daemonCmd.Flags().StringVar(&daemonOpts.bandwidthLimit, "bwlimit", "", `Bandwidth limit, constant ("1M") or time of day schedule ("08:00,512k 19:00,off")`)
+	daemonRunsCmd.Flags().IntVarP(&daemonOpts.limit, "limit", "n", 20, "Number of runs listed")
+}
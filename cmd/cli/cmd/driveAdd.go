@@ -5,6 +5,7 @@ import (
 	"github.com/eldius/onedrive-client/client"
 	"github.com/eldius/onedrive-client/internal/configs"
 	"github.com/eldius/onedrive-client/internal/usecase"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -20,6 +21,16 @@ var driveAddCmd = &cobra.Command{
 			client.WithSecretID(configs.GetSecretID()),
 		)
 		uc := usecase.NewDriveAddUseUseCase(c)
+		if driveAddOpts.dryRun {
+			p, err := uc.PlanDriveAdd(ctx, driveName)
+			if err != nil {
+				panic(err)
+			}
+			if err := printPlan(os.Stdout, p, driveAddOpts.format); err != nil {
+				panic(err)
+			}
+			return
+		}
 		if err := uc.DriveAdd(ctx, driveName); err != nil {
 			panic(err)
 		}
@@ -28,9 +39,16 @@ var driveAddCmd = &cobra.Command{
 
 var (
 	driveName string
+
+	driveAddOpts struct {
+		dryRun bool
+		format string
+	}
 )
 
 func init() {
 	driveCmd.AddCommand(driveAddCmd)
 	driveAddCmd.Flags().StringVarP(&driveName, "name", "n", "", "name of the drive")
+	driveAddCmd.Flags().BoolVar(&driveAddOpts.dryRun, "dry-run", false, "only show the folders that would be created")
+	driveAddCmd.Flags().StringVar(&driveAddOpts.format, "format", planFormatText, "plan output format (text or json)")
 }
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/output"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// driveEncryptionCmd represents the encryption command
+var driveEncryptionCmd = &cobra.Command{
+	Use:   "encryption",
+	Short: "Client side encryption settings",
+	Long: `Client side encryption settings.
+
+The passphrase (or base64 encoded master key) is read from the
+encryption.passphrase (encryption.master_key) config key or from the
+ONEDRIVE_CLIENT_ENCRYPTION_PASSPHRASE (ONEDRIVE_CLIENT_ENCRYPTION_MASTER_KEY)
+environment variable.
+
+The keys, wrapped by the passphrase (or master key), are kept in the
+local database and in the .onedrive-client-keyring-<root folder>.json
+file of the app folder, so they can be recovered when the database is lost.
+
+Downloads decrypt the encrypted files and pass the plain ones (uploaded
+while the encryption was disabled) through. Set encryption.require_encrypted
+to refuse the plain files of the accounts with the encryption enabled.`,
+}
+
+var driveEncryptionEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Encrypts the next uploads",
+	Long: `Encrypts the next uploads, the files already uploaded are kept as they are.
+
+The keys stored in the drive by another setup of the account are reused.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := newEncryptionUseCase().Enable(context.Background(), driveEncryptionOpts.accountName, driveEncryptionOpts.encryptNames); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var driveEncryptionDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Stops encrypting the next uploads",
+	Long:  `Stops encrypting the next uploads, encrypted files are still decrypted on download.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := newEncryptionUseCase().Disable(context.Background(), driveEncryptionOpts.accountName); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var driveEncryptionBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Stores the keys in the drive",
+	Long:  `Stores the wrapped keys in the app folder, it's done on every change of the keys.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := newEncryptionUseCase().Backup(context.Background(), driveEncryptionOpts.accountName); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var driveEncryptionRecoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Restores the keys stored in the drive",
+	Long:  `Restores the keys stored in the app folder when the local database was lost.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := newEncryptionUseCase().Recover(context.Background(), driveEncryptionOpts.accountName); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var driveEncryptionRotatePassphraseCmd = &cobra.Command{
+	Use:   "rotate-passphrase",
+	Short: "Changes the passphrase (or master key)",
+	Long:  `Changes the passphrase (or master key), the data keys are wrapped again and no file is uploaded again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var secret usecase.EncryptionSecret
+		if driveEncryptionOpts.newPassphraseFile != "" {
+			secret.Passphrase = readSecretFile(driveEncryptionOpts.newPassphraseFile)
+		}
+		if driveEncryptionOpts.newMasterKeyFile != "" {
+			secret.MasterKey = readSecretFile(driveEncryptionOpts.newMasterKeyFile)
+		}
+		if err := newEncryptionUseCase().RotateMasterKey(context.Background(), driveEncryptionOpts.accountName, secret); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var driveEncryptionRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Creates a new data key for the next uploads",
+	Long:  `Creates a new data key for the next uploads, the previous keys are kept to decrypt the existing files.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := newEncryptionUseCase().RotateDataKey(context.Background(), driveEncryptionOpts.accountName); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var driveEncryptionStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the encryption settings",
+	Long:  `Shows the encryption settings.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := newPrinter()
+		status, err := newEncryptionUseCase().Status(context.Background(), driveEncryptionOpts.accountName)
+		if err != nil {
+			panic(err)
+		}
+		if err := output.PrintItem(p, *status, encryptionStatusColumns); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	driveEncryptionOpts struct {
+		accountName       string
+		encryptNames      bool
+		newPassphraseFile string
+		newMasterKeyFile  string
+	}
+)
+
+var encryptionStatusColumns = []output.Column[usecase.EncryptionStatus]{
+	{Header: "Enabled", Value: func(s usecase.EncryptionStatus) string { return strconv.FormatBool(s.Enabled) }},
+	{Header: "Encrypt names", Value: func(s usecase.EncryptionStatus) string { return strconv.FormatBool(s.EncryptNames) }},
+	{Header: "Key source", Value: func(s usecase.EncryptionStatus) string { return orDash(s.KeySource) }},
+	{Header: "Active key", Value: func(s usecase.EncryptionStatus) string { return strconv.FormatUint(uint64(s.ActiveKey), 10) }},
+	{Header: "Keys", Value: func(s usecase.EncryptionStatus) string { return strconv.Itoa(s.Keys) }},
+}
+
+func newEncryptionUseCase() *usecase.EncryptionUseCase {
+	c := client.New(
+		client.WithSecretID(configs.GetSecretID()),
+	)
+	return usecase.NewEncryptionUseCase(c)
+}
+
+func readSecretFile(file string) string {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		panic(err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func init() {
+	driveCmd.AddCommand(driveEncryptionCmd)
+	driveEncryptionCmd.AddCommand(
+		driveEncryptionEnableCmd,
+		driveEncryptionDisableCmd,
+		driveEncryptionRotatePassphraseCmd,
+		driveEncryptionRotateKeyCmd,
+		driveEncryptionStatusCmd,
+		driveEncryptionBackupCmd,
+		driveEncryptionRecoverCmd,
+	)
+	driveEncryptionCmd.PersistentFlags().StringVarP(&driveEncryptionOpts.accountName, "account", "a", "", "Account name")
+	driveEncryptionEnableCmd.Flags().BoolVar(&driveEncryptionOpts.encryptNames, "encrypt-names", false, "Encrypt the file and folder names too")
+	driveEncryptionRotatePassphraseCmd.Flags().StringVar(&driveEncryptionOpts.newPassphraseFile, "new-passphrase-file", "", "File with the new passphrase")
+	driveEncryptionRotatePassphraseCmd.Flags().StringVar(&driveEncryptionOpts.newMasterKeyFile, "new-master-key-file", "", "File with the new base64 encoded master key")
+}
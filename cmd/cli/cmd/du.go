@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/internal/output"
+	"github.com/eldius/onedrive-client/internal/progress"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const duBarWidth = 20
+
+// duCmd represents the du command
+var duCmd = &cobra.Command{
+	Use:   "du [path]",
+	Short: "Shows the disk usage",
+	Long: `Shows the disk usage under path (relative to the account root
+folder, the root folder itself by default), biggest items first.
+
+Folder sizes include all their descendants. With --top the largest
+files found anywhere under path are listed instead.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		p := newPrinter()
+		remotePath := ""
+		if len(args) > 0 {
+			remotePath = args[0]
+		}
+		ctx := context.Background()
+		uc := newTreeUseCase()
+
+		if duOpts.top > 0 {
+			files, err := uc.LargestFiles(ctx, duOpts.accountName, remotePath, duOpts.top)
+			if err != nil {
+				panic(err)
+			}
+			if err := output.Print(p, files, []output.Column[usecase.FileEntry]{entrySizeColumn, entryModifiedColumn, entryPathColumn}); err != nil {
+				panic(err)
+			}
+			return
+		}
+
+		usage, err := uc.DiskUsage(ctx, duOpts.accountName, remotePath, duOpts.depth)
+		if err != nil {
+			panic(err)
+		}
+		if err := output.Print(p, usage, usageColumns); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	duOpts struct {
+		accountName string
+		depth       int
+		top         int
+	}
+)
+
+var usageColumns = []output.Column[usecase.UsageEntry]{
+	{
+		Header: "Size",
+		Value:  func(u usecase.UsageEntry) string { return progress.FormatBytes(int64(u.Size)) },
+		Raw:    func(u usecase.UsageEntry) string { return strconv.Itoa(u.Size) },
+	},
+	{
+		Header: "%",
+		Value:  func(u usecase.UsageEntry) string { return fmt.Sprintf("%5.1f%%", u.Percent) },
+		Raw:    func(u usecase.UsageEntry) string { return strconv.FormatFloat(u.Percent, 'f', 2, 64) },
+	},
+	{
+		Header: "Usage",
+		Value: func(u usecase.UsageEntry) string {
+			n := min(int(u.Percent*duBarWidth/100+0.5), duBarWidth)
+			return "[" + strings.Repeat("#", n) + strings.Repeat(" ", duBarWidth-n) + "]"
+		},
+	},
+	{
+		Header: "Path",
+		Value: func(u usecase.UsageEntry) string {
+			if u.IsFolder() {
+				return u.Path + "/"
+			}
+			return u.Path
+		},
+		Raw: func(u usecase.UsageEntry) string { return u.Path },
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(duCmd)
+	duCmd.Flags().StringVarP(&duOpts.accountName, "account", "a", "", "Account name")
+	duCmd.Flags().IntVarP(&duOpts.depth, "depth", "d", 1, "Depth of the listed items (0 for no limit)")
+	duCmd.Flags().IntVar(&duOpts.top, "top", 0, "List the N largest files instead")
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/output"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// findCmd represents the find command
+var findCmd = &cobra.Command{
+	Use:   "find [query]",
+	Short: "Finds files in the OneDrive",
+	Long: `Finds files in the account root folder.
+
+The query is searched by the OneDrive, matching names, metadata and
+content. Without a query, or when the names are encrypted, every
+folder is listed and the query is matched against the names. The
+results are then filtered by the flags.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		p := newPrinter()
+		filter, err := findFilter()
+		if err != nil {
+			panic(err)
+		}
+		query := ""
+		if len(args) > 0 {
+			query = args[0]
+		}
+
+		cols := findColumns
+		if findOpts.long {
+			cols = findLongColumns
+		}
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		found, err := usecase.NewFindUseCase(c).Find(context.Background(), findOpts.accountName, query, filter, output.Fields(p, cols)...)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := output.Print(p, found, cols); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	findOpts struct {
+		accountName    string
+		name           string
+		mimeType       string
+		minSize        string
+		maxSize        string
+		modifiedAfter  string
+		modifiedBefore string
+		long           bool
+	}
+)
+
+func findFilter() (usecase.FindFilter, error) {
+	var f usecase.FindFilter
+	var err error
+	if f.MinSize, err = parseSize(findOpts.minSize); err != nil {
+		return f, err
+	}
+	if f.MaxSize, err = parseSize(findOpts.maxSize); err != nil {
+		return f, err
+	}
+	if f.ModifiedAfter, err = parseTime(findOpts.modifiedAfter); err != nil {
+		return f, err
+	}
+	if f.ModifiedBefore, err = parseTime(findOpts.modifiedBefore); err != nil {
+		return f, err
+	}
+	f.Name = findOpts.name
+	f.MimeType = findOpts.mimeType
+	return f, nil
+}
+
+// parseSize parses a size like "10M" (binary units) into bytes
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := int64(1)
+	if n != "" {
+		switch n[len(n)-1] {
+		case 'K':
+			mult, n = 1<<10, n[:len(n)-1]
+		case 'M':
+			mult, n = 1<<20, n[:len(n)-1]
+		case 'G':
+			mult, n = 1<<30, n[:len(n)-1]
+		case 'T':
+			mult, n = 1<<40, n[:len(n)-1]
+		}
+	}
+	v, err := strconv.ParseFloat(n, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
+var findColumns = []output.Column[usecase.FileEntry]{
+	entryPathColumn,
+}
+
+var findLongColumns = []output.Column[usecase.FileEntry]{
+	entryTypeColumn,
+	entrySizeColumn,
+	entryModifiedColumn,
+	entryPathColumn,
+}
+
+func init() {
+	rootCmd.AddCommand(findCmd)
+	findCmd.Flags().StringVarP(&findOpts.accountName, "account", "a", "", "Account name")
+	findCmd.Flags().StringVar(&findOpts.name, "name", "", `Name glob, case insensitive ("*.jpg")`)
+	findCmd.Flags().StringVar(&findOpts.mimeType, "type", "", `Mime type glob ("image/*", "directory" for folders)`)
+	findCmd.Flags().StringVar(&findOpts.minSize, "min-size", "", `Minimum size ("10M")`)
+	findCmd.Flags().StringVar(&findOpts.maxSize, "max-size", "", `Maximum size ("1G")`)
+	findCmd.Flags().StringVar(&findOpts.modifiedAfter, "modified-after", "", "Modified after this time (RFC 3339 or YYYY-MM-DD[ HH:MM[:SS]])")
+	findCmd.Flags().StringVar(&findOpts.modifiedBefore, "modified-before", "", "Modified before this time (RFC 3339 or YYYY-MM-DD[ HH:MM[:SS]])")
+	findCmd.Flags().BoolVarP(&findOpts.long, "long", "l", false, "Long listing (type, size, modified and path)")
+}
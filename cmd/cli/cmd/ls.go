@@ -2,13 +2,26 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"github.com/eldius/onedrive-client/client"
 	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/output"
+	"github.com/eldius/onedrive-client/internal/progress"
 	"github.com/eldius/onedrive-client/internal/usecase"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+const (
+	sortByName     = "name"
+	sortBySize     = "size"
+	sortByModified = "modified"
+)
+
 // lsCmd represents the ls command
 var lsCmd = &cobra.Command{
 	Use:   "ls",
@@ -16,11 +29,28 @@ var lsCmd = &cobra.Command{
 	Long:  `Lists files.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
+		p := newPrinter()
 		c := client.New(
 			client.WithSecretID(configs.GetSecretID()),
 		)
+		cols := entryColumns
+		if lsArgs.long {
+			cols = entryLongColumns
+		}
 		uc := usecase.NewListFilesUseCase(c)
-		if err := uc.ListFilesFromDrive(ctx, lsArgs.accountName); err != nil {
+		fields := entryFields(p, cols, lsArgs.sort)
+		entries, err := uc.ListFilesFromDrive(ctx, lsArgs.accountName, usecase.ListOptions{
+			Fields:     fields,
+			Thumbnails: lsArgs.thumbnails && fields == nil,
+		})
+		if err != nil {
+			panic(err)
+		}
+		if err := sortEntries(entries, lsArgs.sort, lsArgs.reverse); err != nil {
+			panic(err)
+		}
+
+		if err := output.Print(p, entries, cols); err != nil {
 			panic(err)
 		}
 	},
@@ -29,10 +59,110 @@ var lsCmd = &cobra.Command{
 var (
 	lsArgs struct {
 		accountName string
+		long        bool
+		sort        string
+		reverse     bool
+		thumbnails  bool
+	}
+)
+
+var entryColumns = []output.Column[usecase.FileEntry]{
+	{Header: "Name", Value: func(e usecase.FileEntry) string { return e.Path }, Fields: []string{"name"}},
+	entryTypeColumn,
+}
+
+var (
+	entryPathColumn = output.Column[usecase.FileEntry]{
+		Header: "Path",
+		Value:  func(e usecase.FileEntry) string { return e.Path },
+		Fields: []string{"name"},
+	}
+	entryTypeColumn = output.Column[usecase.FileEntry]{
+		Header: "Type",
+		Value:  func(e usecase.FileEntry) string { return e.GetMimeType() },
+		Fields: []string{"file", "folder"},
+	}
+	entrySizeColumn = output.Column[usecase.FileEntry]{
+		Header: "Size",
+		Value:  func(e usecase.FileEntry) string { return progress.FormatBytes(int64(e.Size)) },
+		Raw:    func(e usecase.FileEntry) string { return strconv.Itoa(e.Size) },
+		Fields: []string{"size"},
+	}
+	entryModifiedColumn = output.Column[usecase.FileEntry]{
+		Header: "Modified",
+		Value:  func(e usecase.FileEntry) string { return e.Modified.Local().Format(time.DateTime) },
+		Raw:    func(e usecase.FileEntry) string { return e.Modified.Format(time.RFC3339) },
+		Fields: []string{"fileSystemInfo", "lastModifiedDateTime"},
 	}
 )
 
+var entryLongColumns = []output.Column[usecase.FileEntry]{
+	{Header: "Name", Value: func(e usecase.FileEntry) string { return e.Path }, Fields: []string{"name"}},
+	entrySizeColumn,
+	entryModifiedColumn,
+	{Header: "eTag", Value: func(e usecase.FileEntry) string { return e.ETag }, Fields: []string{"eTag"}},
+	{Header: "ID", Value: func(e usecase.FileEntry) string { return e.ID }, Fields: []string{"id"}},
+	{Header: "Shared", Value: func(e usecase.FileEntry) string { return orDash(e.Shared.Scope) }, Fields: []string{"shared"}},
+	{Header: "Hash", Value: func(e usecase.FileEntry) string { return orDash(e.File.Hashes.QuickXorHash) }, Fields: []string{"file"}},
+}
+
+// sortFields are the item properties read to sort the entries
+var sortFields = map[string][]string{
+	sortByName:     {"name"},
+	sortBySize:     {"size"},
+	sortByModified: {"fileSystemInfo", "lastModifiedDateTime"},
+}
+
+// entryFields returns the item properties the command reads to
+// print cols and sort the entries by, nil when it needs all of them
+func entryFields(p *output.Printer, cols []output.Column[usecase.FileEntry], sortBy string) []string {
+	fields := output.Fields(p, cols)
+	if fields == nil {
+		return nil
+	}
+	return append(fields, sortFields[sortBy]...)
+}
+
+// sortEntries sorts the entries by name, size or modification time
+func sortEntries(entries []usecase.FileEntry, by string, reverse bool) error {
+	var less func(a, b usecase.FileEntry) bool
+	switch by {
+	case sortByName, "":
+		less = func(a, b usecase.FileEntry) bool {
+			return strings.ToLower(a.Path) < strings.ToLower(b.Path)
+		}
+	case sortBySize:
+		less = func(a, b usecase.FileEntry) bool {
+			return a.Size < b.Size
+		}
+	case sortByModified:
+		less = func(a, b usecase.FileEntry) bool {
+			return a.Modified.Before(b.Modified)
+		}
+	default:
+		return fmt.Errorf("invalid sort %q (expected %s, %s or %s)", by, sortByName, sortBySize, sortByModified)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if reverse {
+			return less(entries[j], entries[i])
+		}
+		return less(entries[i], entries[j])
+	})
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
 func init() {
 	rootCmd.AddCommand(lsCmd)
 	lsCmd.Flags().StringVarP(&lsArgs.accountName, "account-name", "a", "", "account name")
+	lsCmd.Flags().BoolVarP(&lsArgs.long, "long", "l", false, "long listing (size, modified, eTag, ID, shared scope and hash)")
+	lsCmd.Flags().StringVar(&lsArgs.sort, "sort", sortByName, "sort by name, size or modified")
+	lsCmd.Flags().BoolVar(&lsArgs.reverse, "reverse", false, "reverse the sort order")
+	lsCmd.Flags().BoolVar(&lsArgs.thumbnails, "thumbnails", false, "include the thumbnails (and their URLs) in the JSON, JSONL, YAML and template outputs")
 }
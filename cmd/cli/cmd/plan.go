@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/eldius/onedrive-client/internal/progress"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"io"
+	"text/tabwriter"
+)
+
+const (
+	planFormatText = "text"
+	planFormatJSON = "json"
+)
+
+// printPlan writes the plan as a text table or JSON
+func printPlan(w io.Writer, p *usecase.Plan, format string) error {
+	switch format {
+	case planFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	case planFormatText, "":
+	default:
+		return fmt.Errorf("invalid plan format %q (expected %s or %s)", format, planFormatText, planFormatJSON)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, op := range p.Operations {
+		size := ""
+		if !op.IsFolder {
+			size = progress.FormatBytes(op.Size)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t(%s)\n", op.Type, op.Path, size, op.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	t := p.Totals
+	_, err := fmt.Fprintf(
+		w,
+		"\nPlan: %d mkdir, %d upload, %d replace, %d rename-for-conflict, %d unchanged, %d skipped; %s to upload\n",
+		t.Mkdir,
+		t.Upload,
+		t.Replace,
+		t.RenameForConflict,
+		t.Unchanged,
+		t.Skipped,
+		progress.FormatBytes(t.UploadBytes),
+	)
+	return err
+}
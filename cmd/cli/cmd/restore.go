@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/progress"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore <remote-path> <local-dir>",
+	Short: "Restores files from the OneDrive",
+	Long: `Restores files from the OneDrive.
+
+The remote path (a file or a folder, relative to the account root
+folder) is downloaded into the local directory, restoring the files
+timestamps. Use --as-of to restore the files as they were at a given
+time. An interrupted restore continues where it stopped when it's
+run again.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		uc := usecase.NewFileRestoreUseCase(c)
+
+		asOf, err := parseTime(restoreOpts.asOf)
+		if err != nil {
+			panic(err)
+		}
+
+		display := progress.New(os.Stdout)
+		display.Start()
+		err = uc.Restore(ctx, restoreOpts.accountName, args[0], args[1], usecase.RestoreOptions{
+			Transfer: usecase.TransferOptions{
+				Transfers:      restoreOpts.transfers,
+				BandwidthLimit: restoreOpts.bandwidthLimit,
+				Observer:       display,
+			},
+			Overwrite: restoreOpts.overwrite,
+			AsOf:      asOf,
+			LogFile:   restoreOpts.logFile,
+		})
+		display.Stop()
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	restoreOpts struct {
+		accountName string
+		overwrite   string
+		asOf        string
+		logFile     string
+
+		transfers      int
+		bandwidthLimit string
+	}
+)
+
+// parseTime parses a RFC 3339 time or a local date (and time)
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected RFC 3339 or YYYY-MM-DD[ HH:MM[:SS]])", s)
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().StringVarP(&restoreOpts.accountName, "account", "a", "", "Account name")
+	restoreCmd.Flags().StringVar(&restoreOpts.overwrite, "overwrite", usecase.OverwriteNever, "Which existing local files are replaced (never, older or always)")
+	restoreCmd.Flags().StringVar(&restoreOpts.asOf, "as-of", "", "Restore the files as they were at this time (RFC 3339 or YYYY-MM-DD[ HH:MM[:SS]])")
+	restoreCmd.Flags().StringVar(&restoreOpts.logFile, "restore-log", "", "Restore log used to resume interrupted restores (default <local-dir>/.onedrive-client-restore.log)")
+	restoreCmd.Flags().IntVar(&restoreOpts.transfers, "transfers", 0, "Number of files downloaded in parallel (default from config, 4)")
+	restoreCmd.Flags().StringVar(&restoreOpts.bandwidthLimit, "bwlimit", "", `Bandwidth limit, constant ("1M") or time of day schedule ("08:00,512k 19:00,off")`)
+}
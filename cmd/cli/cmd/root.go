@@ -1,10 +1,17 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	cfg "github.com/eldius/initial-config-go/configs"
 	"github.com/eldius/initial-config-go/setup"
 	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/metrics"
+	"github.com/eldius/onedrive-client/internal/output"
+	"github.com/eldius/onedrive-client/internal/tracing"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -13,7 +20,8 @@ import (
 var rootCmd = &cobra.Command{
 	Use: "onedrive",
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		return setup.InitSetup(
+		executedCmd = cmd
+		err := setup.InitSetup(
 			configs.GetAppName(),
 			setup.WithConfigFileToBeUsed(cfgFile),
 			setup.WithDefaultValues(map[string]any{
@@ -25,25 +33,123 @@ var rootCmd = &cobra.Command{
 				configs.AuthRedirectURLKey: configs.DefaultRedirectURL,
 				configs.AuthScopesKey:      configs.DefaultAuthScopes,
 				configs.DBFileKey:          ".db",
+
+				configs.TransferWorkersKey:          configs.DefaultTransferWorkers,
+				configs.TransferChunkConcurrencyKey: configs.DefaultTransferChunkConcurrency,
+
+				configs.SyncDebounceKey:       configs.DefaultSyncDebounce,
+				configs.SyncRescanIntervalKey: configs.DefaultSyncRescanInterval,
+
+				configs.ServeCacheTTLKey: configs.DefaultServeCacheTTL,
+
+				configs.DaemonShutdownTimeoutKey: configs.DefaultDaemonShutdownTimeout,
+
+				configs.MetricsQuotaIntervalKey: configs.DefaultMetricsQuotaInterval,
+
+				configs.TracingSampleRatioKey: configs.DefaultTracingSampleRatio,
 			}),
 		)
+		if err != nil {
+			return err
+		}
+		return startTracing(cmd.Context())
 	},
 	Short: "A simple command line interface to manage onedrive files",
 	Long:  `A simple command line interface to manage onedrive files.`,
 }
 
-var cfgFile string
+var (
+	cfgFile string
+
+	// metricsPushURL is the Pushgateway the metrics of the command are pushed to
+	metricsPushURL string
+	// executedCmd is the command run, set once the config is loaded
+	executedCmd *cobra.Command
+	// stopTracing flushes the spans, set when the tracing is enabled
+	stopTracing func(context.Context) error
+
+	outputOpts struct {
+		format   string
+		template string
+	}
+)
+
+// newPrinter returns the printer for the --output and --template flags
+func newPrinter() *output.Printer {
+	p, err := output.New(os.Stdout, outputOpts.format, outputOpts.template)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	var err error
+	func() {
+		// the metrics and spans are sent even when the command panics
+		defer flushTracing()
+		defer pushMetrics()
+		err = rootCmd.Execute()
+	}()
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// startTracing exports the spans when the tracing is enabled
+func startTracing(ctx context.Context) error {
+	if !configs.GetTracingEnabled() {
+		return nil
+	}
+	stop, err := tracing.Start(ctx, tracing.Options{
+		Endpoint:    configs.GetTracingEndpoint(),
+		Insecure:    configs.GetTracingInsecure(),
+		SampleRatio: configs.GetTracingSampleRatio(),
+		ServiceName: configs.GetAppName(),
+	})
+	if err != nil {
+		return err
+	}
+	stopTracing = stop
+	return nil
+}
+
+// flushTracing sends the pending spans
+func flushTracing() {
+	if stopTracing == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := stopTracing(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to send the traces: %v\n", err)
+	}
+}
+
+// pushMetrics pushes the metrics of the executed
+// command when a Pushgateway is configured
+func pushMetrics() {
+	if executedCmd == nil {
+		return
+	}
+	url := metricsPushURL
+	if url == "" {
+		url = configs.GetMetricsPushURL()
+	}
+	if url == "" {
+		return
+	}
+	if err := metrics.Push(url, executedCmd.CommandPath()); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to push the metrics: %v\n", err)
+	}
+}
+
 func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.onedrive-client.yaml)")
+	rootCmd.PersistentFlags().StringVar(&outputOpts.format, "output", output.FormatTable, "Output format of the read commands ("+strings.Join(output.Formats, ", ")+")")
+	rootCmd.PersistentFlags().StringVar(&metricsPushURL, "metrics-push", "", "Pushgateway URL the metrics of the command are pushed to once it's done (default from config, none)")
+	rootCmd.PersistentFlags().StringVar(&outputOpts.template, "template", "", `Go template executed for every item with --output template ("{{.Path}} {{.Size}}")`)
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves a drive over network protocols",
+	Long:  `Serves a drive over network protocols.`,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/dashboard"
+	"github.com/eldius/onedrive-client/internal/server"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// serveDashboardCmd represents the serve dashboard command
+var serveDashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "Serves a status dashboard of the accounts",
+	Long: `Serves a web page showing the stored accounts, their token expiry,
+root folder and quota, the root folder listing of an account, the latest
+failed requests and the daemon job runs. The same data is served as JSON
+on /api/accounts, /api/accounts/<name>, /api/accounts/<name>/files,
+/api/errors and /api/runs.
+
+The dashboard listens on localhost by default. With --token (or
+serve.dashboard.token, or the ONEDRIVE_CLIENT_SERVE_DASHBOARD_TOKEN
+environment variable) every request must carry it, as a bearer token or
+in the token query parameter: open http://127.0.0.1:8090/?token=<token>.
+The token is required to listen on other addresses. Without a token, only
+the requests addressed to localhost or a loopback IP are served, so other
+sites can't reach the dashboard through a DNS name bound to 127.0.0.1.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		token := serveDashboardOpts.token
+		if token == "" {
+			token = configs.GetServeDashboardToken()
+		}
+		if token == "" && !isLoopback(serveDashboardOpts.addr) {
+			panic(errors.New("the dashboard needs a token to listen beyond localhost, set --token (or serve.dashboard.token)"))
+		}
+
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		h := dashboard.NewHandler(usecase.NewDashboardUseCase(c))
+
+		fmt.Printf("serving the dashboard on http://%s/\n", serveDashboardOpts.addr)
+		if err := server.ListenAndServe(ctx, serveDashboardOpts.addr, server.TokenAuth(token, h)); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	serveDashboardOpts struct {
+		addr  string
+		token string
+	}
+)
+
+// isLoopback tells whether addr only listens on the loopback interface
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func init() {
+	serveCmd.AddCommand(serveDashboardCmd)
+	serveDashboardCmd.Flags().StringVar(&serveDashboardOpts.addr, "addr", "127.0.0.1:8090", "Address to listen on")
+	serveDashboardCmd.Flags().StringVar(&serveDashboardOpts.token, "token", "", "Token required on the requests (default from config, none)")
+}
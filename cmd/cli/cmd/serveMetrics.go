@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/metrics"
+	"github.com/eldius/onedrive-client/internal/server"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// serveMetricsCmd represents the serve metrics command
+var serveMetricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Serves the Prometheus metrics",
+	Long: `Serves the Prometheus metrics on /metrics: the requests sent to the
+API (by method, endpoint and status), their duration, the bytes sent and
+received, the retries, the throttled requests, the token refreshes and the
+quota of every account, refreshed every --quota-interval.
+
+The one-shot commands push their metrics to a Pushgateway instead, with
+--metrics-push (or metrics.push_url).`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		interval := serveMetricsOpts.quotaInterval
+		if interval <= 0 {
+			interval = configs.GetMetricsQuotaInterval()
+		}
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		go usecase.NewMetricsUseCase(c).WatchQuotas(ctx, interval)
+
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler(metrics.NewRegistry()))
+
+		fmt.Printf("serving the metrics on %s/metrics\n", serveMetricsOpts.addr)
+		if err := server.ListenAndServe(ctx, serveMetricsOpts.addr, mux); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	serveMetricsOpts struct {
+		addr          string
+		quotaInterval time.Duration
+	}
+)
+
+func init() {
+	serveCmd.AddCommand(serveMetricsCmd)
+	serveMetricsCmd.Flags().StringVar(&serveMetricsOpts.addr, "addr", ":9464", "Address to listen on")
+	serveMetricsCmd.Flags().DurationVar(&serveMetricsOpts.quotaInterval, "quota-interval", 0, "How often the quotas are refreshed (default from config, 5m)")
+}
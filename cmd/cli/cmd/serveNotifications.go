@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/server"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// serveNotificationsCmd represents the serve notifications command
+var serveNotificationsCmd = &cobra.Command{
+	Use:   "notifications",
+	Short: "Receives the change notifications of the account drive",
+	Long: `Receives the change notifications of the account drive and prints
+what changed in the account folder, instead of polling it.
+
+The drive posts the notifications to --url, a public https URL that must
+reach --addr (through a reverse proxy or a tunnel). The subscription is
+renewed before it expires and kept in the database, a later run with the
+same --url reuses it unless --unsubscribe is set. Every notification lists
+the account folder again, only the subfolders that changed are listed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		recv, err := usecase.NewNotificationsUseCase(c).Receiver(ctx, serveNotificationsOpts.accountName, usecase.NotificationsOptions{
+			NotificationURL: serveNotificationsOpts.url,
+			Lifetime:        serveNotificationsOpts.lifetime,
+			Unsubscribe:     serveNotificationsOpts.unsubscribe,
+		}, func(ch usecase.Change) {
+			fmt.Printf("%-8s /%s\n", ch.Kind, ch.Entry.Path)
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		// the receiver must answer the validation request
+		// sent when the subscription is created
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		served := make(chan error, 1)
+		go func() {
+			served <- server.ListenAndServe(ctx, serveNotificationsOpts.addr, recv)
+			cancel()
+		}()
+
+		fmt.Printf("receiving the %s notifications on %s\n", serveNotificationsOpts.accountName, serveNotificationsOpts.addr)
+		runErr := recv.Run(ctx)
+		cancel()
+		if err := <-served; err != nil {
+			panic(err)
+		}
+		if runErr != nil {
+			panic(runErr)
+		}
+	},
+}
+
+var (
+	serveNotificationsOpts struct {
+		accountName string
+		addr        string
+		url         string
+		lifetime    time.Duration
+		unsubscribe bool
+	}
+)
+
+func init() {
+	serveCmd.AddCommand(serveNotificationsCmd)
+	serveNotificationsCmd.Flags().StringVarP(&serveNotificationsOpts.accountName, "account", "a", "", "Account name")
+	serveNotificationsCmd.Flags().StringVar(&serveNotificationsOpts.addr, "addr", ":8080", "Address to listen on")
+	serveNotificationsCmd.Flags().StringVar(&serveNotificationsOpts.url, "url", "", "Public https URL the notifications are posted to")
+	serveNotificationsCmd.Flags().DurationVar(&serveNotificationsOpts.lifetime, "lifetime", 72*time.Hour, "How long the subscription lasts between renewals (up to 705h)")
+	serveNotificationsCmd.Flags().BoolVar(&serveNotificationsOpts.unsubscribe, "unsubscribe", false, "Delete the subscription when stopping")
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/s3"
+	"github.com/eldius/onedrive-client/internal/server"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// serveS3Cmd represents the serve s3 command
+var serveS3Cmd = &cobra.Command{
+	Use:   "s3",
+	Short: "Serves the account drive as an S3 compatible endpoint",
+	Long: `Serves the account root folder as an S3 compatible endpoint, for
+backup tools and S3 clients. The top level folders are the buckets and
+the paths below them the object keys.
+
+Requests must use path style addressing (http://host:port/bucket/key) and
+be signed (AWS Signature Version 4) with one of the access keys, given as
+"access-key:secret-key" entries in --key, serve.s3.keys or the
+ONEDRIVE_CLIENT_SERVE_S3_KEYS environment variable (comma separated). Any
+region is accepted.
+
+Supported operations: ListBuckets, CreateBucket, HeadBucket,
+ListObjects (v1 and v2), GetObject (with ranges), HeadObject, PutObject,
+DeleteObject(s) and the multipart uploads, whose parts are kept in
+local temporary files until the upload completes and then sent through a
+drive upload session, so the disk must hold the whole object. Every part
+but the last must be at least 5 MiB. The uploads in progress are only
+kept in memory and are lost when the server stops. Folder listings are
+cached for --cache-ttl.
+
+It listens on localhost by default.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		entries := serveS3Opts.keys
+		if len(entries) == 0 {
+			entries = configs.GetServeS3Keys()
+		}
+		keys, err := s3.ParseKeys(entries)
+		if err != nil {
+			panic(err)
+		}
+		if len(keys) == 0 {
+			panic(errors.New("the endpoint needs access keys, set --key (or serve.s3.keys)"))
+		}
+		ttl := serveS3Opts.cacheTTL
+		if ttl <= 0 {
+			ttl = configs.GetServeCacheTTL()
+		}
+
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		backend, err := usecase.NewS3UseCase(c).Backend(ctx, serveS3Opts.accountName, usecase.S3Options{
+			CacheTTL: ttl,
+			Transfer: usecase.TransferOptions{
+				ChunkConcurrency: serveS3Opts.chunkConcurrency,
+				BandwidthLimit:   serveS3Opts.bandwidthLimit,
+			},
+		})
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			_ = backend.Close()
+		}()
+
+		fmt.Printf("serving %s as an S3 endpoint on %s\n", serveS3Opts.accountName, serveS3Opts.addr)
+		if err := server.ListenAndServe(ctx, serveS3Opts.addr, s3.NewHandler(backend, keys)); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	serveS3Opts struct {
+		accountName      string
+		addr             string
+		keys             []string
+		cacheTTL         time.Duration
+		chunkConcurrency int
+		bandwidthLimit   string
+	}
+)
+
+func init() {
+	serveCmd.AddCommand(serveS3Cmd)
+	serveS3Cmd.Flags().StringVarP(&serveS3Opts.accountName, "account", "a", "", "Account name")
+	serveS3Cmd.Flags().StringVar(&serveS3Opts.addr, "addr", "127.0.0.1:9000", "Address to listen on")
+	serveS3Cmd.Flags().StringArrayVar(&serveS3Opts.keys, "key", nil, `Access key accepted on the requests, as "access-key:secret-key" (repeatable, default from config)`)
+	serveS3Cmd.Flags().DurationVar(&serveS3Opts.cacheTTL, "cache-ttl", 0, "How long the folder listings are cached (default from config, 30s)")
+	serveS3Cmd.Flags().IntVar(&serveS3Opts.chunkConcurrency, "chunk-concurrency", 0, "Number of chunks of the same file read ahead while uploading, they are sent in order (default from config, 1)")
+	serveS3Cmd.Flags().StringVar(&serveS3Opts.bandwidthLimit, "bwlimit", "", `Bandwidth limit, constant ("1M") or time of day schedule ("08:00,512k 19:00,off")`)
+}
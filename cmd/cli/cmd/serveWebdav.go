@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/server"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"golang.org/x/net/webdav"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// serveWebdavCmd represents the serve webdav command
+var serveWebdavCmd = &cobra.Command{
+	Use:   "webdav",
+	Short: "Serves the account drive over WebDAV",
+	Long: `Serves the account root folder over WebDAV, to open it in file
+managers or mount it with davfs2.
+
+Every request must carry the --user and --password credentials (basic
+auth), set them in serve.user and serve.password or the
+ONEDRIVE_CLIENT_SERVE_PASSWORD environment variable to keep them out of
+the command line. Folder listings are cached for --cache-ttl, changes
+made elsewhere show up after it.
+
+It listens on localhost by default, the requests are plain HTTP so put
+it behind a TLS proxy when it's reached from other hosts.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		user, password := serveWebdavOpts.user, serveWebdavOpts.password
+		if user == "" {
+			user = configs.GetServeUser()
+		}
+		if password == "" {
+			password = configs.GetServePassword()
+		}
+		if user == "" || password == "" {
+			panic(errors.New("the listener needs credentials, set --user and --password (or serve.user and serve.password)"))
+		}
+		if !isLoopback(serveWebdavOpts.addr) {
+			slog.With("addr", serveWebdavOpts.addr).Warn("WebDAV listens beyond localhost over plain HTTP, the credentials and files are sent unencrypted")
+		}
+		ttl := serveWebdavOpts.cacheTTL
+		if ttl <= 0 {
+			ttl = configs.GetServeCacheTTL()
+		}
+
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		fs, err := usecase.NewWebDAVUseCase(c).FileSystem(ctx, serveWebdavOpts.accountName, usecase.WebDAVOptions{
+			CacheTTL: ttl,
+			Transfer: usecase.TransferOptions{
+				ChunkConcurrency: serveWebdavOpts.chunkConcurrency,
+				BandwidthLimit:   serveWebdavOpts.bandwidthLimit,
+			},
+		})
+		if err != nil {
+			panic(err)
+		}
+		h := &webdav.Handler{
+			FileSystem: fs,
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(r *http.Request, err error) {
+				log := slog.With("method", r.Method, "path", r.URL.Path)
+				if err != nil {
+					log.With("error", err).WarnContext(r.Context(), "webdav request failed")
+					return
+				}
+				log.DebugContext(r.Context(), "webdav request")
+			},
+		}
+
+		fmt.Printf("serving %s over WebDAV on %s\n", serveWebdavOpts.accountName, serveWebdavOpts.addr)
+		if err := server.ListenAndServe(ctx, serveWebdavOpts.addr, server.BasicAuth("onedrive "+serveWebdavOpts.accountName, user, password, h)); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	serveWebdavOpts struct {
+		accountName      string
+		addr             string
+		user             string
+		password         string
+		cacheTTL         time.Duration
+		chunkConcurrency int
+		bandwidthLimit   string
+	}
+)
+
+func init() {
+	serveCmd.AddCommand(serveWebdavCmd)
+	serveWebdavCmd.Flags().StringVarP(&serveWebdavOpts.accountName, "account", "a", "", "Account name")
+	serveWebdavCmd.Flags().StringVar(&serveWebdavOpts.addr, "addr", "127.0.0.1:8080", "Address to listen on")
+	serveWebdavCmd.Flags().StringVar(&serveWebdavOpts.user, "user", "", "User required on the requests (default from config)")
+	serveWebdavCmd.Flags().StringVar(&serveWebdavOpts.password, "password", "", "Password required on the requests (default from config)")
+	serveWebdavCmd.Flags().DurationVar(&serveWebdavOpts.cacheTTL, "cache-ttl", 0, "How long the folder listings are cached (default from config, 30s)")
+	serveWebdavCmd.Flags().IntVar(&serveWebdavOpts.chunkConcurrency, "chunk-concurrency", 0, "Number of chunks of the same file read ahead while uploading, they are sent in order (default from config, 1)")
+	serveWebdavCmd.Flags().StringVar(&serveWebdavOpts.bandwidthLimit, "bwlimit", "", `Bandwidth limit, constant ("1M") or time of day schedule ("08:00,512k 19:00,off")`)
+}
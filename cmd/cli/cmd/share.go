@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/output"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// shareCmd represents the share command
+var shareCmd = &cobra.Command{
+	Use:   "share",
+	Short: "Sharing links and permissions",
+	Long: `Sharing links and permissions.
+
+Paths are relative to the account root folder.`,
+}
+
+var shareCreateCmd = &cobra.Command{
+	Use:   "create <path>",
+	Short: "Creates a sharing link or invites people",
+	Long: `Creates a sharing link for a file or folder or, with --invite,
+grants access to specific people.
+
+The link is reused when one with the same type and scope already
+exists.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		expires, err := parseExpiration(shareOpts.expires)
+		if err != nil {
+			panic(err)
+		}
+		perms, err := newSharingUseCase().Share(context.Background(), shareOpts.accountName, args[0], usecase.ShareOptions{
+			Type:       shareOpts.linkType,
+			Scope:      shareOpts.scope,
+			Recipients: shareOpts.invite,
+			Role:       shareOpts.role,
+			Message:    shareOpts.message,
+			Expires:    expires,
+			Password:   shareOpts.password,
+		})
+		if err != nil {
+			panic(err)
+		}
+		for _, p := range perms {
+			if p.Link != nil {
+				fmt.Println(p.Link.WebURL)
+				continue
+			}
+			fmt.Printf("Invited %s (%s)\n", permissionTarget(p), strings.Join(p.Roles, ","))
+		}
+	},
+}
+
+var shareLsCmd = &cobra.Command{
+	Use:   "ls <path>",
+	Short: "Lists the permissions of a file or folder",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		p := newPrinter()
+		perms, err := newSharingUseCase().List(context.Background(), shareOpts.accountName, args[0])
+		if err != nil {
+			panic(err)
+		}
+		if err := output.Print(p, perms, permissionColumns); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var shareRevokeCmd = &cobra.Command{
+	Use:   "revoke <path> [permission-id]...",
+	Short: "Revokes permissions of a file or folder",
+	Long: `Revokes permissions of a file or folder.
+
+With --all every permission that's neither inherited nor the owner's
+is revoked. Inherited permissions are revoked on the folder they're
+inherited from.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.MinimumNArgs(1)(cmd, args); err != nil {
+			return err
+		}
+		if shareOpts.all == (len(args) > 1) {
+			return fmt.Errorf("pass either permission IDs or --all")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		removed, err := newSharingUseCase().Revoke(context.Background(), shareOpts.accountName, args[0], args[1:]...)
+		for _, p := range removed {
+			fmt.Printf("Revoked %s (%s)\n", p.ID, permissionTarget(p))
+		}
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	shareOpts struct {
+		accountName string
+		linkType    string
+		scope       string
+		expires     string
+		password    string
+		invite      []string
+		role        string
+		message     string
+		all         bool
+	}
+)
+
+var permissionColumns = []output.Column[types.Permission]{
+	{Header: "ID", Value: func(p types.Permission) string { return p.ID }},
+	{Header: "Roles", Value: func(p types.Permission) string { return strings.Join(p.Roles, ",") }},
+	{Header: "Kind", Value: permissionKind},
+	{Header: "Granted to", Value: permissionTarget},
+	{
+		Header: "Expires",
+		Value: func(p types.Permission) string {
+			if p.ExpirationDateTime == nil {
+				return "-"
+			}
+			return p.ExpirationDateTime.Local().Format(time.DateTime)
+		},
+		Raw: func(p types.Permission) string {
+			if p.ExpirationDateTime == nil {
+				return ""
+			}
+			return p.ExpirationDateTime.Format(time.RFC3339)
+		},
+	},
+	{
+		Header: "URL",
+		Value: func(p types.Permission) string {
+			if p.Link == nil {
+				return "-"
+			}
+			return orDash(p.Link.WebURL)
+		},
+	},
+}
+
+func newSharingUseCase() *usecase.SharingUseCase {
+	c := client.New(
+		client.WithSecretID(configs.GetSecretID()),
+	)
+	return usecase.NewSharingUseCase(c)
+}
+
+// permissionKind tells how a permission was granted
+func permissionKind(p types.Permission) string {
+	switch {
+	case p.IsInherited():
+		return "inherited"
+	case p.Link != nil:
+		return p.Link.Type + " link"
+	case p.Invitation != nil:
+		return "invitation"
+	}
+	return "direct"
+}
+
+// permissionTarget describes who a permission is granted to
+func permissionTarget(p types.Permission) string {
+	if p.Link != nil {
+		if p.Link.Scope == "" {
+			return "-"
+		}
+		return p.Link.Scope
+	}
+	var names []string
+	for _, id := range p.Grantees() {
+		switch {
+		case id.Email != "":
+			names = append(names, id.Email)
+		case id.DisplayName != "":
+			names = append(names, id.DisplayName)
+		default:
+			names = append(names, id.ID)
+		}
+	}
+	if len(names) == 0 && p.Invitation != nil {
+		names = append(names, p.Invitation.Email)
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
+
+// parseExpiration parses a time (see parseTime) or a duration from
+// now, durations also accept days ("7d")
+func parseExpiration(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Now().AddDate(0, 0, n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return time.Now().Add(d), nil
+	}
+	t, err := parseTime(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiration %q (expected a duration like 7d or 12h, or a time)", s)
+	}
+	return t, nil
+}
+
+func init() {
+	rootCmd.AddCommand(shareCmd)
+	shareCmd.AddCommand(
+		shareCreateCmd,
+		shareLsCmd,
+		shareRevokeCmd,
+	)
+	shareCmd.PersistentFlags().StringVarP(&shareOpts.accountName, "account", "a", "", "Account name")
+	shareCreateCmd.Flags().StringVar(&shareOpts.linkType, "type", client.LinkTypeView, "Link type (view, edit or embed)")
+	shareCreateCmd.Flags().StringVar(&shareOpts.scope, "scope", "", "Link scope (anonymous or organization, default depends on the account)")
+	shareCreateCmd.Flags().StringVar(&shareOpts.expires, "expires", "", "When the link or invitation expires, a duration (7d, 12h) or a time")
+	shareCreateCmd.Flags().StringVar(&shareOpts.password, "password", "", "Password required to open the link (personal accounts only)")
+	shareCreateCmd.Flags().StringArrayVar(&shareOpts.invite, "invite", nil, "Invite this email instead of creating a link (repeatable)")
+	shareCreateCmd.Flags().StringVar(&shareOpts.role, "role", client.RoleRead, "Role granted to the invited people (read or write)")
+	shareCreateCmd.Flags().StringVar(&shareOpts.message, "message", "", "Message emailed to the invited people")
+	shareRevokeCmd.Flags().BoolVar(&shareOpts.all, "all", false, "Revoke every permission that's neither inherited nor the owner's")
+}
@@ -0,0 +1,504 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/output"
+	"github.com/eldius/onedrive-client/internal/progress"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"github.com/peterh/liner"
+	"github.com/spf13/pflag"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// shellCmd represents the shell command
+var shellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Interactive shell to browse a drive",
+	Long: `Interactive shell to browse a drive.
+
+Remote paths are relative to the current folder or, starting with "/",
+to the account root folder. Folder listings are cached for the whole
+session, names are completed with tab and the history is kept in
+shell.history_file (~/.onedrive-client_history by default). Type
+"help" for the commands.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := newPrinter()
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		s, err := usecase.NewShellUseCase(c).Open(context.Background(), shellOpts.accountName, usecase.TransferOptions{
+			ChunkConcurrency: shellOpts.chunkConcurrency,
+			BandwidthLimit:   shellOpts.bandwidthLimit,
+		})
+		if err != nil {
+			panic(err)
+		}
+		sh := &shell{
+			s:       s,
+			p:       p,
+			out:     os.Stdout,
+			account: shellOpts.accountName,
+		}
+		if err := sh.run(); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	shellOpts struct {
+		accountName      string
+		chunkConcurrency int
+		bandwidthLimit   string
+	}
+)
+
+type shellCommand struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, sh *shell, args []string) error
+	// local tells if the arguments are completed with local paths
+	local bool
+}
+
+// shellCommands are the shell commands by name, set in init
+// because the help command lists them
+var shellCommands map[string]shellCommand
+
+type shell struct {
+	s       *usecase.ShellSession
+	p       *output.Printer
+	out     io.Writer
+	account string
+}
+
+// run reads and runs commands until exit or the end of the input
+func (sh *shell) run() error {
+	line := liner.NewLiner()
+	defer func() {
+		_ = line.Close()
+	}()
+	line.SetCtrlCAborts(true)
+	line.SetTabCompletionStyle(liner.TabPrints)
+	line.SetWordCompleter(sh.complete)
+
+	historyFile := configs.GetShellHistoryFile()
+	if f, err := os.Open(historyFile); err == nil {
+		_, _ = line.ReadHistory(f)
+		_ = f.Close()
+	}
+	defer func() {
+		if f, err := os.Create(historyFile); err == nil {
+			_, _ = line.WriteHistory(f)
+			_ = f.Close()
+		}
+	}()
+
+	for {
+		input, err := line.Prompt(fmt.Sprintf("%s:%s> ", sh.account, sh.s.Pwd()))
+		switch {
+		case errors.Is(err, liner.ErrPromptAborted):
+			continue
+		case errors.Is(err, io.EOF):
+			_, _ = fmt.Fprintln(sh.out)
+			return nil
+		case err != nil:
+			return err
+		}
+
+		args, err := splitShellArgs(input)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		line.AppendHistory(input)
+		if args[0] == "exit" || args[0] == "quit" {
+			return nil
+		}
+		if err := sh.exec(args); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// exec runs a command, it's interrupted by ctrl+c
+func (sh *shell) exec(args []string) error {
+	cmd, ok := shellCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("%s: unknown command, type help for the commands", args[0])
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return cmd.run(ctx, sh, args[1:])
+}
+
+// complete completes the command names and the remote
+// (or, for lcd and put, local) names of the last word
+func (sh *shell) complete(line string, pos int) (string, []string, string) {
+	head, word := line[:pos], ""
+	if i := strings.LastIndexByte(head, ' '); i >= 0 {
+		head, word = head[:i+1], head[i+1:]
+	} else {
+		head, word = "", head
+	}
+	tail := line[pos:]
+
+	if strings.TrimSpace(head) == "" {
+		var names []string
+		for name := range shellCommands {
+			if strings.HasPrefix(name, word) {
+				names = append(names, name+" ")
+			}
+		}
+		sort.Strings(names)
+		return head, names, tail
+	}
+
+	args := strings.Fields(head)
+	cmd := shellCommands[args[0]]
+	local := cmd.local && (args[0] == "lcd" || len(args) == 1)
+	dir, prefix := "", word
+	if i := strings.LastIndexByte(word, '/'); i >= 0 {
+		dir, prefix = word[:i+1], word[i+1:]
+	}
+
+	var names []string
+	if local {
+		entries, _ := os.ReadDir(filepath.Join(".", dir))
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), prefix) && (args[0] != "lcd" || e.IsDir()) {
+				names = append(names, completion(dir, e.Name(), e.IsDir()))
+			}
+		}
+	} else {
+		entries, _ := sh.s.List(context.Background(), dir)
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name, prefix) && (args[0] != "cd" || e.IsFolder()) {
+				names = append(names, completion(dir, e.Name, e.IsFolder()))
+			}
+		}
+	}
+	sort.Strings(names)
+	return head, names, tail
+}
+
+// completion escapes the spaces of the completed name, folders
+// end with a slash so their content is completed next
+func completion(dir, name string, folder bool) string {
+	name = dir + strings.ReplaceAll(name, " ", `\ `)
+	if folder {
+		return name + "/"
+	}
+	return name + " "
+}
+
+// splitShellArgs splits a command line on spaces, quotes
+// and backslashes keep the spaces of an argument
+func splitShellArgs(line string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// shellFlags parses the command flags, returning the remaining arguments
+func shellFlags(name string, args []string, define func(fs *pflag.FlagSet)) ([]string, error) {
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	define(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return fs.Args(), nil
+}
+
+func argsRange(name string, args []string, minArgs, maxArgs int) error {
+	if len(args) < minArgs || len(args) > maxArgs {
+		return fmt.Errorf("usage: %s %s", name, shellCommands[name].usage)
+	}
+	return nil
+}
+
+// argOr returns the i-th argument, or def when there isn't one
+func argOr(args []string, i int, def string) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return def
+}
+
+var shellNameColumn = output.Column[usecase.FileEntry]{
+	Header: "Name",
+	Value: func(e usecase.FileEntry) string {
+		if e.IsFolder() {
+			return e.Name + "/"
+		}
+		return e.Name
+	},
+	Raw: func(e usecase.FileEntry) string { return e.Name },
+}
+
+func shellLs(ctx context.Context, sh *shell, args []string) error {
+	var long bool
+	args, err := shellFlags("ls", args, func(fs *pflag.FlagSet) {
+		fs.BoolVarP(&long, "long", "l", false, "")
+	})
+	if err != nil {
+		return err
+	}
+	if err := argsRange("ls", args, 0, 1); err != nil {
+		return err
+	}
+	entries, err := sh.s.List(ctx, argOr(args, 0, ""))
+	if err != nil {
+		return err
+	}
+	cols := []output.Column[usecase.FileEntry]{shellNameColumn}
+	if long {
+		cols = append(cols, entryLongColumns[1:]...)
+	}
+	return output.Print(sh.p, entries, cols)
+}
+
+func shellCd(ctx context.Context, sh *shell, args []string) error {
+	if err := argsRange("cd", args, 0, 1); err != nil {
+		return err
+	}
+	return sh.s.Cd(ctx, argOr(args, 0, "/"))
+}
+
+func shellPwd(_ context.Context, sh *shell, args []string) error {
+	if err := argsRange("pwd", args, 0, 0); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(sh.out, sh.s.Pwd())
+	return err
+}
+
+func shellStat(ctx context.Context, sh *shell, args []string) error {
+	if err := argsRange("stat", args, 1, 1); err != nil {
+		return err
+	}
+	e, err := sh.s.Stat(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	cols := append([]output.Column[usecase.FileEntry]{entryPathColumn}, entryLongColumns[1:]...)
+	return output.PrintItem(sh.p, e, cols)
+}
+
+func shellGet(ctx context.Context, sh *shell, args []string) error {
+	if err := argsRange("get", args, 1, 2); err != nil {
+		return err
+	}
+	display := progress.New(os.Stdout)
+	display.Start()
+	local, err := sh.s.Get(ctx, args[0], argOr(args, 1, ""), display)
+	display.Stop()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(sh.out, "saved to %s\n", local)
+	return err
+}
+
+func shellPut(ctx context.Context, sh *shell, args []string) error {
+	if err := argsRange("put", args, 1, 2); err != nil {
+		return err
+	}
+	display := progress.New(os.Stdout)
+	display.Start()
+	remote, err := sh.s.Put(ctx, args[0], argOr(args, 1, ""), display)
+	display.Stop()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(sh.out, "uploaded to /%s\n", remote)
+	return err
+}
+
+func shellRm(ctx context.Context, sh *shell, args []string) error {
+	var permanent bool
+	args, err := shellFlags("rm", args, func(fs *pflag.FlagSet) {
+		fs.BoolVar(&permanent, "permanent", false, "")
+	})
+	if err != nil {
+		return err
+	}
+	if err := argsRange("rm", args, 1, 1<<16); err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		return sh.s.Remove(ctx, args[0], permanent)
+	}
+	_, err = sh.s.RemoveAll(ctx, permanent, args...)
+	return err
+}
+
+func shellMv(ctx context.Context, sh *shell, args []string) error {
+	if err := argsRange("mv", args, 2, 1<<16); err != nil {
+		return err
+	}
+	if len(args) == 2 {
+		return sh.s.Move(ctx, args[0], args[1])
+	}
+	_, err := sh.s.MoveAll(ctx, args[:len(args)-1], args[len(args)-1])
+	return err
+}
+
+func shellMkdir(ctx context.Context, sh *shell, args []string) error {
+	if err := argsRange("mkdir", args, 1, 1<<16); err != nil {
+		return err
+	}
+	for _, a := range args {
+		if err := sh.s.Mkdir(ctx, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func shellShare(ctx context.Context, sh *shell, args []string) error {
+	var opts usecase.ShareOptions
+	var expires string
+	args, err := shellFlags("share", args, func(fs *pflag.FlagSet) {
+		fs.StringVar(&opts.Type, "type", client.LinkTypeView, "")
+		fs.StringVar(&opts.Scope, "scope", "", "")
+		fs.StringVar(&expires, "expires", "", "")
+		fs.StringVar(&opts.Password, "password", "", "")
+		fs.StringArrayVar(&opts.Recipients, "invite", nil, "")
+		fs.StringVar(&opts.Role, "role", client.RoleRead, "")
+		fs.StringVar(&opts.Message, "message", "", "")
+	})
+	if err != nil {
+		return err
+	}
+	if err := argsRange("share", args, 1, 1); err != nil {
+		return err
+	}
+	if opts.Expires, err = parseExpiration(expires); err != nil {
+		return err
+	}
+	perms, err := sh.s.Share(ctx, args[0], opts)
+	if err != nil {
+		return err
+	}
+	for _, p := range perms {
+		if p.Link != nil {
+			_, _ = fmt.Fprintln(sh.out, p.Link.WebURL)
+			continue
+		}
+		_, _ = fmt.Fprintf(sh.out, "invited %s (%s)\n", permissionTarget(p), strings.Join(p.Roles, ","))
+	}
+	return nil
+}
+
+func shellLcd(_ context.Context, sh *shell, args []string) error {
+	if err := argsRange("lcd", args, 0, 1); err != nil {
+		return err
+	}
+	dir := argOr(args, 0, "")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dir = home
+	}
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(sh.out, wd)
+	return err
+}
+
+func shellHelp(_ context.Context, sh *shell, _ []string) error {
+	names := make([]string, 0, len(shellCommands))
+	for name := range shellCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := shellCommands[name]
+		_, _ = fmt.Fprintf(sh.out, "  %-28s %s\n", name+" "+c.usage, c.help)
+	}
+	_, err := fmt.Fprintf(sh.out, "  %-28s %s\n", "exit", "Leaves the shell (or ctrl+d)")
+	return err
+}
+
+func init() {
+	shellCommands = map[string]shellCommand{
+		"ls":    {usage: "[-l] [path]", help: "Lists a folder (-l for the long listing)", run: shellLs},
+		"cd":    {usage: "[path]", help: "Changes the current folder (the root folder by default)", run: shellCd},
+		"pwd":   {help: "Shows the current folder", run: shellPwd},
+		"stat":  {usage: "<path>", help: "Shows the details of an item", run: shellStat},
+		"get":   {usage: "<path> [local]", help: "Downloads a file", run: shellGet},
+		"put":   {usage: "<local> [path]", help: "Uploads a file, replacing the remote one", run: shellPut, local: true},
+		"rm":    {usage: "[--permanent] <path>...", help: "Moves items (folders with their content) to the recycle bin, --permanent deletes them (not on personal drives)", run: shellRm},
+		"mv":    {usage: "<path>... <path>", help: "Moves or renames an item, moves several items into a folder", run: shellMv},
+		"mkdir": {usage: "<path>...", help: "Creates folders", run: shellMkdir},
+		"share": {usage: "[flags] <path>", help: "Creates a sharing link (same flags as share create)", run: shellShare},
+		"lcd":   {usage: "[dir]", help: "Changes the local directory (the home directory by default)", run: shellLcd, local: true},
+		"help":  {help: "Shows this help", run: shellHelp},
+	}
+
+	rootCmd.AddCommand(shellCmd)
+	shellCmd.Flags().StringVarP(&shellOpts.accountName, "account", "a", "", "Account name")
+	shellCmd.Flags().IntVar(&shellOpts.chunkConcurrency, "chunk-concurrency", 0, "Number of chunks of the same file read ahead while uploading, they are sent in order (default from config, 1)")
+	shellCmd.Flags().StringVar(&shellOpts.bandwidthLimit, "bwlimit", "", `Bandwidth limit, constant ("1M") or time of day schedule ("08:00,512k 19:00,off")`)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync <dir>...",
+	Short: "Syncs local directories to the OneDrive",
+	Long: `Syncs local directories to the OneDrive.
+
+Every directory is synced to a folder with the same name inside
+--output-file. With --watch the directories are watched and the
+changes are synced as they happen, renames are applied as remote
+moves. Files removed locally are kept remotely.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		uc := usecase.NewFileUpload(c)
+		opts := usecase.WatchOptions{
+			Transfer: usecase.TransferOptions{
+				Transfers:        syncOpts.transfers,
+				ChunkConcurrency: syncOpts.chunkConcurrency,
+				BandwidthLimit:   syncOpts.bandwidthLimit,
+			},
+			Conflict: syncOpts.conflict,
+			Debounce: syncOpts.debounce,
+			Rescan:   syncOpts.rescanInterval,
+		}
+
+		if !syncOpts.watch {
+			if err := uc.Sync(ctx, syncOpts.accountName, args, syncOpts.outputFile, opts); err != nil {
+				panic(err)
+			}
+			return
+		}
+		if err := uc.Watch(ctx, syncOpts.accountName, args, syncOpts.outputFile, opts); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	syncOpts struct {
+		accountName string
+		outputFile  string
+		conflict    string
+
+		watch          bool
+		debounce       time.Duration
+		rescanInterval time.Duration
+
+		transfers        int
+		chunkConcurrency int
+		bandwidthLimit   string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().StringVarP(&syncOpts.accountName, "account", "a", "", "Account name")
+	syncCmd.Flags().StringVarP(&syncOpts.outputFile, "output-file", "o", "", "Remote folder the directories are synced into")
+	syncCmd.Flags().StringVar(&syncOpts.conflict, "conflict", usecase.ConflictReplace, "What to do with remote files that differ (replace, rename or skip)")
+	syncCmd.Flags().BoolVarP(&syncOpts.watch, "watch", "w", false, "Keep watching the directories and sync the changes")
+	syncCmd.Flags().DurationVar(&syncOpts.debounce, "debounce", 0, "How long the changes must stop before they are synced (default from config, 2s)")
+	syncCmd.Flags().DurationVar(&syncOpts.rescanInterval, "rescan-interval", 0, "Interval of the full rescans that catch missed changes (default from config, 15m)")
+	syncCmd.Flags().IntVar(&syncOpts.transfers, "transfers", 0, "Number of files uploaded in parallel (default from config, 4)")
+	syncCmd.Flags().IntVar(&syncOpts.chunkConcurrency, "chunk-concurrency", 0, "Number of chunks of the same file read ahead while uploading, they are sent in order (default from config, 1)")
+	syncCmd.Flags().StringVar(&syncOpts.bandwidthLimit, "bwlimit", "", `Bandwidth limit, constant ("1M") or time of day schedule ("08:00,512k 19:00,off")`)
+}
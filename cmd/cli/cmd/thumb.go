@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// thumbCmd represents the thumb command
+var thumbCmd = &cobra.Command{
+	Use:   "thumb <path>",
+	Short: "Downloads the thumbnail of a file",
+	Long: `Downloads the thumbnail of a file (the path is relative to the
+account root folder), a preview rendered by the OneDrive without
+downloading the file itself.
+
+The size is small, medium, large or a custom one: "c{width}x{height}"
+fits the image in the size and "c{width}x{height}_crop" crops it to
+fill it ("c300x300_crop"). The thumbnail is written to --output-file
+(the file name with the size and ".jpg" in the current directory by
+default, "-" for the standard output).
+
+Encrypted files have no thumbnails, the OneDrive can't read them.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !client.IsThumbnailSize(thumbOpts.size) {
+			panic(fmt.Errorf("invalid thumbnail size %q (expected small, medium, large or c{width}x{height}[_crop])", thumbOpts.size))
+		}
+		out := thumbOpts.outputFile
+		if out == "" {
+			name := path.Base(strings.TrimSuffix(args[0], "/"))
+			out = strings.TrimSuffix(name, path.Ext(name)) + "-" + thumbOpts.size + ".jpg"
+		}
+
+		var w io.Writer = os.Stdout
+		if out != "-" {
+			f, err := os.Create(out)
+			if err != nil {
+				panic(err)
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			w = f
+		}
+		c := client.New(
+			client.WithSecretID(configs.GetSecretID()),
+		)
+		t, err := usecase.NewThumbnailsUseCase(c).Download(context.Background(), thumbOpts.accountName, args[0], thumbOpts.size, w)
+		if err != nil {
+			if out != "-" {
+				_ = os.Remove(out)
+			}
+			panic(err)
+		}
+		if out != "-" {
+			fmt.Printf("Thumbnail (%dx%d) saved to %s\n", t.Width, t.Height, out)
+		}
+	},
+}
+
+var (
+	thumbOpts struct {
+		accountName string
+		size        string
+		outputFile  string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(thumbCmd)
+	thumbCmd.Flags().StringVarP(&thumbOpts.accountName, "account", "a", "", "Account name")
+	thumbCmd.Flags().StringVar(&thumbOpts.size, "size", client.ThumbnailLarge, `Thumbnail size (small, medium, large or custom, like "c300x300_crop")`)
+	thumbCmd.Flags().StringVarP(&thumbOpts.outputFile, "output-file", "o", "", `Output file ("-" for the standard output)`)
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/output"
+	"github.com/eldius/onedrive-client/internal/usecase"
+
+	"github.com/spf13/cobra"
+)
+
+// trashCmd represents the trash command
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Recycle bin related commands",
+	Long: `Recycle bin related commands.
+
+Deleted items are kept in the drive recycle bin until it's emptied, they
+are listed and restored by their ID. Listing and restoring the deleted
+items is only supported by the personal drives.`,
+}
+
+var trashLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "Lists the deleted items",
+	Long:  `Lists the items deleted from the account folder that are still in the recycle bin.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := newPrinter()
+		entries, err := newTrashUseCase().List(context.Background(), trashOpts.accountName)
+		if err != nil {
+			panic(err)
+		}
+		if err := output.Print(p, entries, trashColumns); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore <id>...",
+	Short: "Restores deleted items",
+	Long: `Restores deleted items from the recycle bin.
+
+The items go back where they were deleted from or, with --to, into the
+given folder (relative to the account root folder).`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		restored, err := newTrashUseCase().Restore(context.Background(), trashOpts.accountName, args, trashOpts.to)
+		for _, e := range restored {
+			fmt.Printf("Restored %s (%s)\n", e.Path, e.ID)
+		}
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	trashOpts struct {
+		accountName string
+		to          string
+	}
+)
+
+var trashColumns = []output.Column[usecase.FileEntry]{
+	{Header: "Name", Value: func(e usecase.FileEntry) string { return e.Path }},
+	{Header: "ID", Value: func(e usecase.FileEntry) string { return e.ID }},
+	entryTypeColumn,
+	{
+		Header: "State",
+		Value: func(e usecase.FileEntry) string {
+			if e.Deleted == nil {
+				return ""
+			}
+			return e.Deleted.State
+		},
+	},
+	entryModifiedColumn,
+}
+
+func newTrashUseCase() *usecase.TrashUseCase {
+	c := client.New(
+		client.WithSecretID(configs.GetSecretID()),
+	)
+	return usecase.NewTrashUseCase(c)
+}
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(
+		trashLsCmd,
+		trashRestoreCmd,
+	)
+	trashCmd.PersistentFlags().StringVarP(&trashOpts.accountName, "account", "a", "", "Account name")
+	trashRestoreCmd.Flags().StringVar(&trashOpts.to, "to", "", "Folder to restore the items into (where they were deleted from by default)")
+}
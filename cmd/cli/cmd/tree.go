@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/output"
+	"github.com/eldius/onedrive-client/internal/progress"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// treeCmd represents the tree command
+var treeCmd = &cobra.Command{
+	Use:   "tree [path]",
+	Short: "Shows the folder tree",
+	Long: `Shows the folder tree under path (relative to the account
+root folder, the root folder itself by default) with the items sizes.
+
+The JSON and YAML outputs are nested, the other machine readable
+outputs list every item.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		p := newPrinter()
+		remotePath := ""
+		if len(args) > 0 {
+			remotePath = args[0]
+		}
+		thumbnails := treeOpts.thumbnails && output.Fields(p, entryLongColumns) == nil
+		root, err := newTreeUseCase().Tree(context.Background(), treeOpts.accountName, remotePath, treeOpts.depth, treeOpts.dirsOnly, thumbnails)
+		if err != nil {
+			panic(err)
+		}
+
+		switch p.Format() {
+		case output.FormatTable:
+			err = printTree(os.Stdout, root)
+		case output.FormatJSON, output.FormatYAML:
+			err = output.PrintItem(p, root, nil)
+		default:
+			err = output.Print(p, flattenTree(root, nil), entryLongColumns)
+		}
+		if err != nil {
+			panic(err)
+		}
+	},
+}
+
+var (
+	treeOpts struct {
+		accountName string
+		depth       int
+		dirsOnly    bool
+		thumbnails  bool
+	}
+)
+
+func newTreeUseCase() *usecase.TreeUseCase {
+	c := client.New(
+		client.WithSecretID(configs.GetSecretID()),
+	)
+	return usecase.NewTreeUseCase(c)
+}
+
+// printTree draws the tree like the tree command does
+func printTree(w io.Writer, root *usecase.TreeNode) error {
+	name := root.Path
+	if name == "" {
+		name = "."
+	}
+	if _, err := fmt.Fprintf(w, "%s (%s)\n", name, progress.FormatBytes(int64(root.Size))); err != nil {
+		return err
+	}
+
+	var folders, files int
+	var draw func(n *usecase.TreeNode, prefix string) error
+	draw = func(n *usecase.TreeNode, prefix string) error {
+		for i, c := range n.Children {
+			branch, indent := "├── ", "│   "
+			if i == len(n.Children)-1 {
+				branch, indent = "└── ", "    "
+			}
+			name := c.Name
+			if c.IsFolder() {
+				folders++
+				name += "/"
+			} else {
+				files++
+			}
+			if _, err := fmt.Fprintf(w, "%s%s%s (%s)\n", prefix, branch, name, progress.FormatBytes(int64(c.Size))); err != nil {
+				return err
+			}
+			if err := draw(c, prefix+indent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := draw(root, ""); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d folders, %d files\n", folders, files)
+	return err
+}
+
+func flattenTree(n *usecase.TreeNode, entries []usecase.FileEntry) []usecase.FileEntry {
+	for _, c := range n.Children {
+		entries = append(entries, c.FileEntry)
+		entries = flattenTree(c, entries)
+	}
+	return entries
+}
+
+func init() {
+	rootCmd.AddCommand(treeCmd)
+	treeCmd.Flags().StringVarP(&treeOpts.accountName, "account", "a", "", "Account name")
+	treeCmd.Flags().IntVarP(&treeOpts.depth, "depth", "L", 0, "Maximum depth of the tree (0 for no limit)")
+	treeCmd.Flags().BoolVarP(&treeOpts.dirsOnly, "dirs-only", "d", false, "Show only the folders")
+	treeCmd.Flags().BoolVar(&treeOpts.thumbnails, "thumbnails", false, "Include the thumbnails (and their URLs) in the JSON, JSONL, YAML and template outputs")
+}
@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"github.com/eldius/onedrive-client/client"
 	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/progress"
 	"github.com/eldius/onedrive-client/internal/usecase"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -13,17 +16,46 @@ import (
 var uploadCmd = &cobra.Command{
 	Use:   "upload",
 	Short: "Upload files to the OneDrive",
-	Long:  `Upload files to the OneDrive.`,
+	Long: `Upload files to the OneDrive.
+
+Use --dry-run to see what would change without touching anything,
+or --plan-file to save the plan to be executed later by 'apply'.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
 		c := client.New(
 			client.WithSecretID(configs.GetSecretID()),
 		)
 		uc := usecase.NewFileUpload(c)
-		if err := uc.Upload(ctx, uploadOpts.accountName, uploadOpts.inputFile, uploadOpts.outputFile); err != nil {
-			panic(err)
+
+		if uploadOpts.dryRun || uploadOpts.planFile != "" {
+			p, err := uc.PlanUpload(ctx, uploadOpts.accountName, uploadOpts.inputFile, uploadOpts.outputFile, uploadOpts.conflict)
+			if err != nil {
+				panic(err)
+			}
+			if uploadOpts.planFile != "" {
+				if err := usecase.SavePlan(p, uploadOpts.planFile); err != nil {
+					panic(err)
+				}
+				fmt.Printf("Plan saved to %s, run 'apply %s' to execute it\n\n", uploadOpts.planFile, uploadOpts.planFile)
+			}
+			if err := printPlan(os.Stdout, p, uploadOpts.format); err != nil {
+				panic(err)
+			}
+			return
 		}
 
+		display := progress.New(os.Stdout)
+		display.Start()
+		err := uc.Upload(ctx, uploadOpts.accountName, uploadOpts.inputFile, uploadOpts.outputFile, uploadOpts.conflict, usecase.TransferOptions{
+			Transfers:        uploadOpts.transfers,
+			ChunkConcurrency: uploadOpts.chunkConcurrency,
+			BandwidthLimit:   uploadOpts.bandwidthLimit,
+			Observer:         display,
+		})
+		display.Stop()
+		if err != nil {
+			panic(err)
+		}
 	},
 }
 
@@ -32,6 +64,15 @@ var (
 		accountName string
 		inputFile   string
 		outputFile  string
+		conflict    string
+
+		transfers        int
+		chunkConcurrency int
+		bandwidthLimit   string
+
+		dryRun   bool
+		planFile string
+		format   string
 	}
 )
 
@@ -50,4 +91,11 @@ func init() {
 	uploadCmd.Flags().StringVarP(&uploadOpts.accountName, "account", "a", "", "Account name")
 	uploadCmd.Flags().StringVarP(&uploadOpts.inputFile, "input-file", "i", "", "File to upload")
 	uploadCmd.Flags().StringVarP(&uploadOpts.outputFile, "output-file", "o", "", "Remote path")
+	uploadCmd.Flags().StringVar(&uploadOpts.conflict, "conflict", usecase.ConflictReplace, "What to do with remote files that differ (replace, rename or skip)")
+	uploadCmd.Flags().IntVar(&uploadOpts.transfers, "transfers", 0, "Number of files uploaded in parallel (default from config, 4)")
+	uploadCmd.Flags().IntVar(&uploadOpts.chunkConcurrency, "chunk-concurrency", 0, "Number of chunks of the same file read ahead while uploading, they are sent in order (default from config, 1)")
+	uploadCmd.Flags().StringVar(&uploadOpts.bandwidthLimit, "bwlimit", "", `Bandwidth limit, constant ("1M") or time of day schedule ("08:00,512k 19:00,off")`)
+	uploadCmd.Flags().BoolVar(&uploadOpts.dryRun, "dry-run", false, "Only show what would be changed")
+	uploadCmd.Flags().StringVar(&uploadOpts.planFile, "plan-file", "", "Save the plan to this file instead of executing it")
+	uploadCmd.Flags().StringVar(&uploadOpts.format, "format", planFormatText, "Plan output format (text or json)")
 }
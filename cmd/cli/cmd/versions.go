@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/output"
+	"github.com/eldius/onedrive-client/internal/progress"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// versionsCmd represents the versions command
+var versionsCmd = &cobra.Command{
+	Use:   "versions",
+	Short: "File version history",
+	Long: `File version history.
+
+Paths are relative to the account root folder. A version is picked
+by its ID or, with --as-of, as the version current at that time.`,
+}
+
+var versionsLsCmd = &cobra.Command{
+	Use:   "ls <path>",
+	Short: "Lists the versions of a file",
+	Long:  `Lists the versions of a file, newest first.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		p := newPrinter()
+		versions, err := newVersionsUseCase().List(context.Background(), versionsOpts.accountName, args[0])
+		if err != nil {
+			panic(err)
+		}
+		if err := output.Print(p, versions, versionColumns); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var versionsGetCmd = &cobra.Command{
+	Use:   "get <path> [version-id]",
+	Short: "Downloads a version of a file",
+	Long: `Downloads a version of a file.
+
+The version is written to --output-file (the file name in the current
+directory by default, "-" for the standard output).`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		sel := versionSelector(args)
+		out := versionsOpts.outputFile
+		if out == "" {
+			out = path.Base(args[0])
+		}
+
+		var w io.Writer = os.Stdout
+		if out != "-" {
+			f, err := os.Create(out)
+			if err != nil {
+				panic(err)
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			w = f
+		}
+		v, err := newVersionsUseCase().Download(context.Background(), versionsOpts.accountName, args[0], sel, w)
+		if err != nil {
+			if out != "-" {
+				_ = os.Remove(out)
+			}
+			panic(err)
+		}
+		if out != "-" {
+			fmt.Printf("Version %s (%s) saved to %s\n", v.ID, v.LastModifiedDateTime.Local().Format(time.DateTime), out)
+		}
+	},
+}
+
+var versionsRestoreCmd = &cobra.Command{
+	Use:   "restore <path> [version-id]",
+	Short: "Makes a previous version the current one",
+	Long:  `Makes a previous version the current one, the replaced content is kept as a new version.`,
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		v, err := newVersionsUseCase().Restore(context.Background(), versionsOpts.accountName, args[0], versionSelector(args))
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("Version %s (%s) restored\n", v.ID, v.LastModifiedDateTime.Local().Format(time.DateTime))
+	},
+}
+
+var (
+	versionsOpts struct {
+		accountName string
+		asOf        string
+		outputFile  string
+	}
+)
+
+var versionColumns = []output.Column[types.DriveItemVersion]{
+	{Header: "ID", Value: func(v types.DriveItemVersion) string { return v.ID }},
+	{
+		Header: "Modified",
+		Value:  func(v types.DriveItemVersion) string { return v.LastModifiedDateTime.Local().Format(time.DateTime) },
+		Raw:    func(v types.DriveItemVersion) string { return v.LastModifiedDateTime.Format(time.RFC3339) },
+	},
+	{
+		Header: "Size",
+		Value:  func(v types.DriveItemVersion) string { return progress.FormatBytes(int64(v.Size)) },
+		Raw:    func(v types.DriveItemVersion) string { return strconv.Itoa(v.Size) },
+	},
+	{Header: "Modified by", Value: func(v types.DriveItemVersion) string { return v.LastModifiedBy.User.DisplayName }},
+}
+
+func newVersionsUseCase() *usecase.VersionsUseCase {
+	c := client.New(
+		client.WithSecretID(configs.GetSecretID()),
+	)
+	return usecase.NewVersionsUseCase(c)
+}
+
+func versionSelector(args []string) usecase.VersionSelector {
+	asOf, err := parseTime(versionsOpts.asOf)
+	if err != nil {
+		panic(err)
+	}
+	sel := usecase.VersionSelector{AsOf: asOf}
+	if len(args) > 1 {
+		sel.ID = args[1]
+	}
+	return sel
+}
+
+func init() {
+	rootCmd.AddCommand(versionsCmd)
+	versionsCmd.AddCommand(
+		versionsLsCmd,
+		versionsGetCmd,
+		versionsRestoreCmd,
+	)
+	versionsCmd.PersistentFlags().StringVarP(&versionsOpts.accountName, "account", "a", "", "Account name")
+	versionsGetCmd.Flags().StringVar(&versionsOpts.asOf, "as-of", "", "Pick the version current at this time (RFC 3339 or YYYY-MM-DD[ HH:MM[:SS]])")
+	versionsGetCmd.Flags().StringVarP(&versionsOpts.outputFile, "output-file", "o", "", `Output file ("-" for the standard output)`)
+	versionsRestoreCmd.Flags().StringVar(&versionsOpts.asOf, "as-of", "", "Pick the version current at this time (RFC 3339 or YYYY-MM-DD[ HH:MM[:SS]])")
+}
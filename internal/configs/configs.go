@@ -1,7 +1,13 @@
 package configs
 
 import (
+	"fmt"
 	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
 var (
@@ -13,6 +19,60 @@ var (
 	AuthSecretIDKey    = "auth.secret_id"
 	AuthRedirectURLKey = "auth.redirect_url"
 	AuthScopesKey      = "auth.scopes"
+
+	TransferWorkersKey          = "transfer.workers"
+	TransferChunkConcurrencyKey = "transfer.chunk_concurrency"
+	TransferBandwidthLimitKey   = "transfer.bwlimit"
+
+	SyncDebounceKey       = "sync.debounce"
+	SyncRescanIntervalKey = "sync.rescan_interval"
+
+	ShellHistoryFileKey = "shell.history_file"
+
+	ServeUserKey     = "serve.user"
+	ServePasswordKey = "serve.password"
+	ServeCacheTTLKey = "serve.cache_ttl"
+	ServeS3KeysKey   = "serve.s3.keys"
+
+	ServeDashboardTokenKey = "serve.dashboard.token"
+
+	MetricsPushURLKey       = "metrics.push_url"
+	MetricsQuotaIntervalKey = "metrics.quota_interval"
+
+	TracingEnabledKey     = "tracing.enabled"
+	TracingEndpointKey    = "tracing.endpoint"
+	TracingInsecureKey    = "tracing.insecure"
+	TracingSampleRatioKey = "tracing.sample_ratio"
+
+	DaemonJobsKey            = "daemon.jobs"
+	DaemonLockFileKey        = "daemon.lock_file"
+	DaemonShutdownTimeoutKey = "daemon.shutdown_timeout"
+
+	EncryptionPassphraseKey       = "encryption.passphrase"
+	EncryptionMasterKeyKey        = "encryption.master_key"
+	EncryptionRequireEncryptedKey = "encryption.require_encrypted"
+
+	EncryptionPassphraseEnv = "ONEDRIVE_CLIENT_ENCRYPTION_PASSPHRASE"
+	EncryptionMasterKeyEnv  = "ONEDRIVE_CLIENT_ENCRYPTION_MASTER_KEY"
+
+	ServePasswordEnv = "ONEDRIVE_CLIENT_SERVE_PASSWORD"
+	ServeS3KeysEnv   = "ONEDRIVE_CLIENT_SERVE_S3_KEYS"
+
+	ServeDashboardTokenEnv = "ONEDRIVE_CLIENT_SERVE_DASHBOARD_TOKEN"
+
+	DefaultTransferWorkers          = 4
+	DefaultTransferChunkConcurrency = 1
+
+	DefaultSyncDebounce       = 2 * time.Second
+	DefaultSyncRescanInterval = 15 * time.Minute
+
+	DefaultServeCacheTTL = 30 * time.Second
+
+	DefaultDaemonShutdownTimeout = 30 * time.Second
+
+	DefaultMetricsQuotaInterval = 5 * time.Minute
+
+	DefaultTracingSampleRatio = 1.0
 )
 
 var (
@@ -21,6 +81,8 @@ var (
 		"accesstoken",
 		"refresh_token",
 		"refreshtoken",
+		"id_token",
+		"client_secret",
 		"token_type",
 		"idtoken",
 		"authorization",
@@ -29,15 +91,15 @@ var (
 )
 
 func GetSecretID() string {
-	return viper.GetString(AuthSecretIDKey)
+	return get(viper.GetString, AuthSecretIDKey)
 }
 
 func GetRedirectURL() string {
-	return viper.GetString(AuthRedirectURLKey)
+	return get(viper.GetString, AuthRedirectURLKey)
 }
 
 func GetAuthScopes() []string {
-	return viper.GetStringSlice(AuthScopesKey)
+	return get(viper.GetStringSlice, AuthScopesKey)
 }
 
 func GetAppName() string {
@@ -45,5 +107,193 @@ func GetAppName() string {
 }
 
 func GetDBFilePath() string {
-	return viper.GetString(DBFileKey)
+	return get(viper.GetString, DBFileKey)
+}
+
+func GetTransferWorkers() int {
+	return get(viper.GetInt, TransferWorkersKey)
+}
+
+func GetTransferChunkConcurrency() int {
+	return get(viper.GetInt, TransferChunkConcurrencyKey)
+}
+
+func GetTransferBandwidthLimit() string {
+	return get(viper.GetString, TransferBandwidthLimitKey)
+}
+
+func GetSyncDebounce() time.Duration {
+	return get(viper.GetDuration, SyncDebounceKey)
+}
+
+func GetSyncRescanInterval() time.Duration {
+	return get(viper.GetDuration, SyncRescanIntervalKey)
+}
+
+// GetShellHistoryFile returns the file the shell history is kept in,
+// ~/.onedrive-client_history when it isn't configured
+func GetShellHistoryFile() string {
+	if v := get(viper.GetString, ShellHistoryFileKey); v != "" {
+		return v
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "."+AppName+"_history")
+}
+
+func GetServeUser() string {
+	return get(viper.GetString, ServeUserKey)
+}
+
+// GetServePassword returns the password of the served drives,
+// the environment variable takes precedence
+func GetServePassword() string {
+	if v := os.Getenv(ServePasswordEnv); v != "" {
+		return v
+	}
+	return get(viper.GetString, ServePasswordKey)
+}
+
+func GetServeCacheTTL() time.Duration {
+	return get(viper.GetDuration, ServeCacheTTLKey)
+}
+
+// GetServeS3Keys returns the access keys of the S3 gateway, as
+// "access-key:secret-key" entries, the environment variable
+// (comma separated entries) takes precedence
+func GetServeS3Keys() []string {
+	if v := os.Getenv(ServeS3KeysEnv); v != "" {
+		return strings.Split(v, ",")
+	}
+	return get(viper.GetStringSlice, ServeS3KeysKey)
+}
+
+// GetServeDashboardToken returns the token required by the
+// dashboard, the environment variable takes precedence
+func GetServeDashboardToken() string {
+	if v := os.Getenv(ServeDashboardTokenEnv); v != "" {
+		return v
+	}
+	return get(viper.GetString, ServeDashboardTokenKey)
+}
+
+// GetMetricsPushURL returns the Pushgateway the metrics of
+// the commands are pushed to, none when it's empty
+func GetMetricsPushURL() string {
+	return get(viper.GetString, MetricsPushURLKey)
+}
+
+func GetMetricsQuotaInterval() time.Duration {
+	return get(viper.GetDuration, MetricsQuotaIntervalKey)
+}
+
+func GetTracingEnabled() bool {
+	return get(viper.GetBool, TracingEnabledKey)
+}
+
+// GetTracingEndpoint returns the OTLP/HTTP collector the spans are
+// sent to, the OTEL_EXPORTER_OTLP_* environment variables are used
+// when it's empty
+func GetTracingEndpoint() string {
+	return get(viper.GetString, TracingEndpointKey)
+}
+
+func GetTracingInsecure() bool {
+	return get(viper.GetBool, TracingInsecureKey)
+}
+
+func GetTracingSampleRatio() float64 {
+	return get(viper.GetFloat64, TracingSampleRatioKey)
+}
+
+// GetEncryptionPassphrase returns the passphrase the master key
+// is derived from, the environment variable takes precedence
+func GetEncryptionPassphrase() string {
+	if v := os.Getenv(EncryptionPassphraseEnv); v != "" {
+		return v
+	}
+	return get(viper.GetString, EncryptionPassphraseKey)
+}
+
+// GetEncryptionRequireEncrypted tells if the downloads from the accounts
+// with the encryption enabled must be encrypted files, the plain ones
+// (like those uploaded before the encryption was enabled) are refused
+func GetEncryptionRequireEncrypted() bool {
+	return get(viper.GetBool, EncryptionRequireEncryptedKey)
+}
+
+// GetEncryptionMasterKey returns the base64 encoded raw master
+// key, the environment variable takes precedence
+func GetEncryptionMasterKey() string {
+	if v := os.Getenv(EncryptionMasterKeyEnv); v != "" {
+		return v
+	}
+	return get(viper.GetString, EncryptionMasterKeyKey)
+}
+
+// Job is a backup run by the daemon, the local directory is synced
+// to a folder with the same name inside the remote folder
+type Job struct {
+	Name    string `mapstructure:"name"`
+	Account string `mapstructure:"account"`
+	Local   string `mapstructure:"local"`
+	Remote  string `mapstructure:"remote"`
+	// Schedule is a cron expression ("0 3 * * *")
+	// or a descriptor ("@daily", "@every 6h")
+	Schedule string `mapstructure:"schedule"`
+	// Conflict is how the remote files that differ are handled
+	// (replace, rename or skip), replace when it's empty
+	Conflict string `mapstructure:"conflict"`
+}
+
+// GetDaemonJobs returns the jobs run by the daemon
+func GetDaemonJobs() ([]Job, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	var jobs []Job
+	if err := viper.UnmarshalKey(DaemonJobsKey, &jobs); err != nil {
+		return nil, fmt.Errorf("read %s: %w", DaemonJobsKey, err)
+	}
+	return jobs, nil
+}
+
+// GetDaemonLockFile returns the lock file held by the daemon,
+// ~/.onedrive-client.lock when it isn't configured
+func GetDaemonLockFile() string {
+	if v := get(viper.GetString, DaemonLockFileKey); v != "" {
+		return v
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), AppName+".lock")
+	}
+	return filepath.Join(home, "."+AppName+".lock")
+}
+
+func GetDaemonShutdownTimeout() time.Duration {
+	return get(viper.GetDuration, DaemonShutdownTimeoutKey)
+}
+
+// mu guards the config reads while ReloadConfig replaces
+// it, viper isn't safe for concurrent use
+var mu sync.RWMutex
+
+// get reads the config key with the viper getter
+func get[T any](getter func(string) T, key string) T {
+	mu.RLock()
+	defer mu.RUnlock()
+	return getter(key)
+}
+
+// ReloadConfig reads the config file again, it
+// can run while the config is being read
+func ReloadConfig() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	return nil
 }
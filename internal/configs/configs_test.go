@@ -0,0 +1,61 @@
+package configs
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestReloadConfigConcurrent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(workers int) {
+		cfg := fmt.Sprintf("transfer:\n  workers: %d\ndaemon:\n  jobs:\n    - name: photos\n      account: main\n      local: /photos\n      schedule: \"@daily\"\n", workers)
+		if err := os.WriteFile(file, []byte(cfg), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(2)
+	viper.SetConfigFile(file)
+	t.Cleanup(viper.Reset)
+	if err := ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	// run with -race: the jobs read the config while SIGHUP reloads it
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := ReloadConfig(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			if n := GetTransferWorkers(); n != 2 {
+				t.Errorf("workers = %d, want 2", n)
+				return
+			}
+			if jobs, err := GetDaemonJobs(); err != nil || len(jobs) != 1 {
+				t.Errorf("jobs = %v, %v", jobs, err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	write(8)
+	if err := ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if n := GetTransferWorkers(); n != 8 {
+		t.Errorf("workers after reload = %d, want 8", n)
+	}
+}
@@ -0,0 +1,319 @@
+// Package dashboard serves the state of the stored accounts as a web
+// page and a JSON API
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/model"
+	"github.com/eldius/onedrive-client/internal/progress"
+	"github.com/eldius/onedrive-client/internal/static"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// runsLimit is the number of job runs shown by default
+const runsLimit = 20
+
+var tmpl = template.Must(template.ParseFS(static.HandlerTemplates, "templates/dashboard.html"))
+
+// Source provides the state shown by the dashboard
+type Source interface {
+	Names(ctx context.Context) ([]string, error)
+	Accounts(ctx context.Context) ([]usecase.AccountStatus, error)
+	Account(ctx context.Context, accName string) (*usecase.AccountStatus, error)
+	Files(ctx context.Context, accName string) ([]usecase.FileEntry, error)
+	Errors() []client.ErrorRecord
+	Runs(ctx context.Context, limit int) ([]model.JobRun, error)
+}
+
+// Handler serves the dashboard page on / and the JSON API on /api:
+//
+//	GET /api/accounts
+//	GET /api/accounts/{name}
+//	GET /api/accounts/{name}/files
+//	GET /api/errors
+//	GET /api/runs?limit=n
+type Handler struct {
+	src Source
+	mux *http.ServeMux
+}
+
+func NewHandler(src Source) *Handler {
+	h := &Handler{
+		src: src,
+		mux: http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /{$}", h.page)
+	h.mux.HandleFunc("GET /api/accounts", h.accounts)
+	h.mux.HandleFunc("GET /api/accounts/{name}", h.account)
+	h.mux.HandleFunc("GET /api/accounts/{name}/files", h.files)
+	h.mux.HandleFunc("GET /api/errors", h.errors)
+	h.mux.HandleFunc("GET /api/runs", h.runs)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	slog.With("method", r.Method, "path", r.URL.Path).DebugContext(r.Context(), "dashboard request")
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) accounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := h.src.Accounts(r.Context())
+	writeJSON(w, r, accounts, err)
+}
+
+func (h *Handler) account(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.accountName(w, r)
+	if !ok {
+		return
+	}
+	acc, err := h.src.Account(r.Context(), name)
+	writeJSON(w, r, acc, err)
+}
+
+func (h *Handler) files(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.accountName(w, r)
+	if !ok {
+		return
+	}
+	files, err := h.src.Files(r.Context(), name)
+	writeJSON(w, r, files, err)
+}
+
+func (h *Handler) errors(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.src.Errors(), nil)
+}
+
+func (h *Handler) runs(w http.ResponseWriter, r *http.Request) {
+	limit, ok := queryLimit(w, r)
+	if !ok {
+		return
+	}
+	runs, err := h.src.Runs(r.Context(), limit)
+	writeJSON(w, r, runs, err)
+}
+
+// accountName returns the account of the request path,
+// it answers not found when there's no such account
+func (h *Handler) accountName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.PathValue("name")
+	names, err := h.src.Names(r.Context())
+	if err != nil {
+		writeJSON(w, r, nil, err)
+		return "", false
+	}
+	if !slices.Contains(names, name) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown account %q", name))
+		return "", false
+	}
+	return name, true
+}
+
+// page renders the dashboard, with the root folder listing
+// of the account query parameter (the first account by default)
+func (h *Handler) page(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accounts, err := h.src.Accounts(ctx)
+	if err != nil {
+		slog.With("error", err).WarnContext(ctx, "failed to load the dashboard accounts")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	v := pageView{
+		Generated: time.Now().Format(time.DateTime),
+		Accounts:  make([]accountView, 0, len(accounts)),
+	}
+	for _, acc := range accounts {
+		v.Accounts = append(v.Accounts, newAccountView(acc))
+	}
+
+	v.Selected = r.URL.Query().Get("account")
+	if v.Selected == "" && len(accounts) > 0 {
+		v.Selected = accounts[0].Name
+	}
+	if slices.ContainsFunc(accounts, func(a usecase.AccountStatus) bool { return a.Name == v.Selected }) {
+		files, err := h.src.Files(ctx, v.Selected)
+		if err != nil {
+			v.FilesError = err.Error()
+		}
+		for _, f := range files {
+			v.Files = append(v.Files, newFileView(f))
+		}
+	} else if v.Selected != "" {
+		v.FilesError = fmt.Sprintf("unknown account %q", v.Selected)
+	}
+
+	for _, e := range h.src.Errors() {
+		v.Errors = append(v.Errors, newErrorView(e))
+	}
+	runs, err := h.src.Runs(ctx, runsLimit)
+	if err != nil {
+		v.RunsError = err.Error()
+	}
+	for _, run := range runs {
+		v.Runs = append(v.Runs, newRunView(run))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.ExecuteTemplate(w, "dashboard.html", v); err != nil {
+		slog.With("error", err).WarnContext(ctx, "failed to render the dashboard")
+	}
+}
+
+// queryLimit parses the limit query parameter,
+// it answers bad request when it's invalid
+func queryLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return runsLimit, true
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q", s))
+		return 0, false
+	}
+	return limit, true
+}
+
+// writeJSON writes v, or err as an internal error
+func writeJSON(w http.ResponseWriter, r *http.Request, v any, err error) {
+	if err != nil {
+		slog.With("path", r.URL.Path, "error", err).WarnContext(r.Context(), "dashboard request failed")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.With("path", r.URL.Path, "error", err).DebugContext(r.Context(), "failed to write the dashboard response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// the views hold the display strings, the templates can't use functions
+// as the client parses all of them without any
+type pageView struct {
+	Generated  string
+	Accounts   []accountView
+	Selected   string
+	Files      []fileView
+	FilesError string
+	Errors     []errorView
+	Runs       []runView
+	RunsError  string
+}
+
+type accountView struct {
+	Name        string
+	DriveType   string
+	RootFolder  string
+	Encrypted   bool
+	TokenExpiry string
+	Expired     bool
+	Quota       string
+	QuotaState  string
+	// QuotaPercent is the used share of the quota, for the meter
+	QuotaPercent int64
+	Error        string
+}
+
+func newAccountView(a usecase.AccountStatus) accountView {
+	v := accountView{
+		Name:        a.Name,
+		DriveType:   a.DriveType,
+		RootFolder:  a.RootFolder,
+		Encrypted:   a.Encrypted,
+		TokenExpiry: a.TokenExpiresAt.Local().Format(time.DateTime),
+		Expired:     a.TokenExpired,
+		Error:       a.Error,
+	}
+	if q := a.Quota; q != nil {
+		v.Quota = fmt.Sprintf("%s of %s", progress.FormatBytes(q.Used), progress.FormatBytes(q.Total))
+		if q.Deleted > 0 {
+			v.Quota += fmt.Sprintf(" (%s in the recycle bin)", progress.FormatBytes(q.Deleted))
+		}
+		v.QuotaState = q.State
+		if q.Total > 0 {
+			v.QuotaPercent = q.Used * 100 / q.Total
+		}
+	}
+	return v
+}
+
+type fileView struct {
+	Name     string
+	Folder   bool
+	Size     string
+	Modified string
+}
+
+func newFileView(f usecase.FileEntry) fileView {
+	v := fileView{
+		Name:     f.Path,
+		Folder:   f.Folder != nil,
+		Modified: f.Modified.Local().Format(time.DateTime),
+	}
+	if v.Folder {
+		v.Size = fmt.Sprintf("%d items", f.Folder.ChildCount)
+	} else {
+		v.Size = progress.FormatBytes(int64(f.Size))
+	}
+	return v
+}
+
+type errorView struct {
+	Time    string
+	Request string
+	Status  string
+	Message string
+}
+
+func newErrorView(e client.ErrorRecord) errorView {
+	v := errorView{
+		Time:    e.Time.Local().Format(time.DateTime),
+		Request: e.Method + " " + e.URL,
+		Message: e.Message,
+	}
+	if e.StatusCode != 0 {
+		v.Status = strconv.Itoa(e.StatusCode)
+	}
+	if e.Code != "" {
+		v.Status += " " + e.Code
+	}
+	return v
+}
+
+type runView struct {
+	Job      string
+	Account  string
+	Started  string
+	Duration string
+	Status   string
+	Error    string
+}
+
+func newRunView(r model.JobRun) runView {
+	v := runView{
+		Job:     r.Job,
+		Account: r.Account,
+		Started: r.StartedAt.Local().Format(time.DateTime),
+		Status:  r.Status,
+		Error:   r.Error,
+	}
+	if !r.FinishedAt.IsZero() {
+		v.Duration = r.FinishedAt.Sub(r.StartedAt).Round(time.Second).String()
+	}
+	return v
+}
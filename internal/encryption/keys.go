@@ -0,0 +1,166 @@
+// Package encryption implements the client side encryption of the
+// uploaded files.
+//
+// Every file is encrypted with its own random key. File keys are
+// wrapped by an account data key and stored in the file header, data
+// keys are wrapped by the master key (a raw key or a key derived from
+// a passphrase) and stored locally and in the drive. Rotating the master key only
+// rewraps the data keys and rotating a data key only affects new
+// uploads, so no file has to be uploaded again.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"io"
+)
+
+const (
+	// KeySize is the size of every key (AES-256)
+	KeySize = 32
+
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	saltSize     = 16
+)
+
+var (
+	// ErrWrongKey is returned when a wrapped key can't be
+	// opened, usually because of a wrong passphrase
+	ErrWrongKey = errors.New("wrong passphrase or master key")
+	// ErrUnknownKey is returned when a file was encrypted
+	// with a data key that isn't in the keyring
+	ErrUnknownKey = errors.New("unknown data key")
+)
+
+// KDFParams are the argon2id parameters used to
+// derive the master key from a passphrase
+type KDFParams struct {
+	Salt    []byte
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// NewKDFParams creates parameters with a random salt
+func NewKDFParams() (KDFParams, error) {
+	salt, err := randomBytes(saltSize)
+	if err != nil {
+		return KDFParams{}, err
+	}
+	return KDFParams{
+		Salt:    salt,
+		Time:    argonTime,
+		Memory:  argonMemory,
+		Threads: argonThreads,
+	}, nil
+}
+
+// DeriveMasterKey derives the master key from a passphrase
+func DeriveMasterKey(passphrase string, p KDFParams) []byte {
+	return argon2.IDKey([]byte(passphrase), p.Salt, p.Time, p.Memory, p.Threads, KeySize)
+}
+
+// ParseMasterKey decodes a base64 encoded raw master key
+func ParseMasterKey(s string) ([]byte, error) {
+	k, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode master key: %w", err)
+	}
+	if len(k) != KeySize {
+		return nil, fmt.Errorf("master key must have %d bytes, got %d", KeySize, len(k))
+	}
+	return k, nil
+}
+
+// NewKey generates a random key
+func NewKey() ([]byte, error) {
+	return randomBytes(KeySize)
+}
+
+// WrapKey encrypts key with kek (nonce + sealed key)
+func WrapKey(kek, key []byte) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, key, nil), nil
+}
+
+// UnwrapKey decrypts a key wrapped by WrapKey
+func UnwrapKey(kek, wrapped []byte) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrWrongKey
+	}
+	key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return key, nil
+}
+
+// Keyring holds the unwrapped data keys of an account
+type Keyring struct {
+	keys         map[uint32][]byte
+	active       uint32
+	encryptNames bool
+	requireEnc   bool
+}
+
+// NewKeyring creates a keyring, new files are encrypted with the active
+// key. With requireEncrypted, plain content is rejected on download
+// instead of being passed through (see NewAutoDecrypter).
+func NewKeyring(keys map[uint32][]byte, active uint32, encryptNames, requireEncrypted bool) (*Keyring, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active data key %d: %w", active, ErrUnknownKey)
+	}
+	return &Keyring{
+		keys:         keys,
+		active:       active,
+		encryptNames: encryptNames,
+		requireEnc:   requireEncrypted,
+	}, nil
+}
+
+// EncryptNames tells if the file names are encrypted too
+func (k *Keyring) EncryptNames() bool {
+	return k.encryptNames
+}
+
+func (k *Keyring) key(id uint32) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("data key %d: %w", id, ErrUnknownKey)
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("new cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, fmt.Errorf("read random bytes: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,74 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+var (
+	nameKeyLabel   = []byte("onedrive-client name key")
+	nameNonceLabel = []byte("onedrive-client name nonce")
+)
+
+// EncryptName encrypts a file name with the active data key. The
+// result is deterministic (the nonce is derived from the name) so
+// the same name is always stored with the same encrypted name.
+// Names are returned untouched when name encryption is disabled.
+func (k *Keyring) EncryptName(name string) (string, error) {
+	if !k.encryptNames {
+		return name, nil
+	}
+	dataKey, err := k.key(k.active)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(derive(dataKey, nameKeyLabel))
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, derive(dataKey, nameNonceLabel))
+	mac.Write([]byte(name))
+	nonce := mac.Sum(nil)[:aead.NonceSize()]
+
+	out := binary.BigEndian.AppendUint32(nil, k.active)
+	out = append(out, nonce...)
+	out = aead.Seal(out, nonce, []byte(name), nil)
+	return base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+// DecryptName reverts EncryptName
+func (k *Keyring) DecryptName(encrypted string) (string, error) {
+	if !k.encryptNames {
+		return encrypted, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(encrypted)
+	if err != nil || len(b) < 4 {
+		return "", fmt.Errorf("%w: name %q", ErrInvalidFile, encrypted)
+	}
+	dataKey, err := k.key(binary.BigEndian.Uint32(b))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(derive(dataKey, nameKeyLabel))
+	if err != nil {
+		return "", err
+	}
+	b = b[4:]
+	if len(b) < aead.NonceSize() {
+		return "", fmt.Errorf("%w: name %q", ErrInvalidFile, encrypted)
+	}
+	name, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: name %q", ErrInvalidFile, encrypted)
+	}
+	return string(name), nil
+}
+
+func derive(key, label []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(label)
+	return mac.Sum(nil)
+}
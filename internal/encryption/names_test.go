@@ -0,0 +1,40 @@
+package encryption
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	k := testKeyring(t, true, false)
+	for _, name := range []string{"a", "photo 1.jpg", "relatório.pdf", ""} {
+		enc, err := k.EncryptName(name)
+		if err != nil {
+			t.Fatalf("encrypt %q: %v", name, err)
+		}
+		if again, _ := k.EncryptName(name); again != enc {
+			t.Errorf("encrypt %q isn't deterministic: %q, %q", name, enc, again)
+		}
+		got, err := k.DecryptName(enc)
+		if err != nil || got != name {
+			t.Errorf("decrypt %q = %q, %v", enc, got, err)
+		}
+	}
+
+	enc, _ := k.EncryptName("name")
+	tampered := []byte(enc)
+	tampered[len(tampered)-1] ^= 1
+	for _, s := range []string{"plain name.txt", enc[:len(enc)-2], string(tampered)} {
+		if _, err := k.DecryptName(s); err == nil {
+			t.Errorf("decrypt %q: no error", s)
+		}
+	}
+	if _, err := testKeyring(t, true, false).DecryptName(enc); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("decrypt with another keyring: %v", err)
+	}
+
+	plain := testKeyring(t, false, false)
+	if got, _ := plain.EncryptName("name"); got != "name" {
+		t.Errorf("encrypt without name encryption = %q", got)
+	}
+}
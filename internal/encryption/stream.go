@@ -0,0 +1,379 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Encrypted file layout:
+//
+//	header   magic (5) | version (1) | data key id (4) | wrapped file key (60) | nonce prefix (8)
+//	segments AES-256-GCM sealed segments, the nonce is the prefix followed by the
+//	         segment index and the last segment is sealed with a different AAD
+//
+// Segments are sized so that, including the header, every sealed segment ends
+// at a multiple of SegmentSize. Upload session ranges (multiples of 320 KiB)
+// always hold whole segments this way.
+const (
+	// SegmentSize is the size of every sealed segment (but the last one)
+	SegmentSize = 64 * 1024
+
+	magic       = "ODENC" // keep headerSize in sync
+	version     = 1
+	prefixSize  = 8
+	wrappedSize = 12 + KeySize + 16
+	headerSize  = 5 + 1 + 4 + wrappedSize + prefixSize
+	overhead    = 16
+
+	firstSegmentPlain = SegmentSize - overhead - headerSize
+	segmentPlain      = SegmentSize - overhead
+
+	// MarkerSize is how many bytes of the content IsEncrypted needs
+	MarkerSize = len(magic) + 1
+)
+
+var (
+	// ErrInvalidFile is returned when the content isn't
+	// an encrypted file or was tampered with
+	ErrInvalidFile = errors.New("invalid encrypted file")
+	// ErrNotEncrypted is returned when plain content is downloaded
+	// with a keyring requiring the content to be encrypted
+	ErrNotEncrypted = errors.New("content is not encrypted")
+
+	aadSegment = []byte{0}
+	aadFinal   = []byte{1}
+)
+
+func segments(plainSize int64) int64 {
+	if plainSize <= firstSegmentPlain {
+		return 1
+	}
+	return 1 + (plainSize-firstSegmentPlain+segmentPlain-1)/segmentPlain
+}
+
+// CipherSize returns the encrypted size of a plainSize bytes file
+func CipherSize(plainSize int64) int64 {
+	return int64(headerSize) + plainSize + overhead*segments(plainSize)
+}
+
+// PlainSize returns the original size of an encrypted file
+func PlainSize(cipherSize int64) int64 {
+	body := cipherSize - int64(headerSize)
+	if body <= SegmentSize-int64(headerSize) {
+		return max(body-overhead, 0)
+	}
+	rest := body - (SegmentSize - int64(headerSize))
+	n := 1 + (rest+SegmentSize-1)/SegmentSize
+	return body - overhead*n
+}
+
+func segmentPlainRange(i, plainSize int64) (int64, int64) {
+	start := int64(0)
+	length := int64(firstSegmentPlain)
+	if i > 0 {
+		start = firstSegmentPlain + (i-1)*segmentPlain
+		length = segmentPlain
+	}
+	return start, min(length, plainSize-start)
+}
+
+func segmentCipherStart(i int64) int64 {
+	if i == 0 {
+		return int64(headerSize)
+	}
+	return i * SegmentSize
+}
+
+func segmentNonce(prefix []byte, i int64) []byte {
+	nonce := make([]byte, prefixSize+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], uint32(i))
+	return nonce
+}
+
+// Encrypter exposes the encrypted content of a file as an
+// io.ReaderAt, segments are sealed on demand so any range
+// of the encrypted content can be read independently
+type Encrypter struct {
+	src      io.ReaderAt
+	size     int64
+	segments int64
+	header   []byte
+	prefix   []byte
+	aead     cipher.AEAD
+
+	mu       sync.Mutex
+	cacheIdx int64
+	cache    []byte
+}
+
+// NewEncrypter encrypts size bytes read from src with a new
+// random file key, wrapped by the keyring active data key
+func (k *Keyring) NewEncrypter(src io.ReaderAt, size int64) (*Encrypter, error) {
+	fileKey, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := k.key(k.active)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := WrapKey(dataKey, fileKey)
+	if err != nil {
+		return nil, fmt.Errorf("wrap file key: %w", err)
+	}
+	prefix, err := randomBytes(prefixSize)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, version)
+	header = binary.BigEndian.AppendUint32(header, k.active)
+	header = append(header, wrapped...)
+	header = append(header, prefix...)
+
+	return &Encrypter{
+		src:      src,
+		size:     size,
+		segments: segments(size),
+		header:   header,
+		prefix:   prefix,
+		aead:     aead,
+		cacheIdx: -1,
+	}, nil
+}
+
+// Size returns the encrypted content size
+func (e *Encrypter) Size() int64 {
+	return CipherSize(e.size)
+}
+
+func (e *Encrypter) ReadAt(p []byte, off int64) (int, error) {
+	total := e.Size()
+	if off >= total {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && off < total {
+		if off < int64(headerSize) {
+			c := copy(p[n:], e.header[off:])
+			n += c
+			off += int64(c)
+			continue
+		}
+		i := off / SegmentSize
+		sealed, err := e.segment(i)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], sealed[off-segmentCipherStart(i):])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (e *Encrypter) segment(i int64) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cacheIdx == i {
+		return e.cache, nil
+	}
+
+	start, length := segmentPlainRange(i, e.size)
+	plain := make([]byte, length)
+	if _, err := e.src.ReadAt(plain, start); err != nil && !(errors.Is(err, io.EOF) && length == 0) {
+		return nil, fmt.Errorf("read segment %d: %w", i, err)
+	}
+	aad := aadSegment
+	if i == e.segments-1 {
+		aad = aadFinal
+	}
+	e.cache = e.aead.Seal(nil, segmentNonce(e.prefix, i), plain, aad)
+	e.cacheIdx = i
+	return e.cache, nil
+}
+
+// Decrypter is an io.WriteCloser that decrypts the content
+// written to it, Close must be called to check the file
+// wasn't truncated
+type Decrypter struct {
+	k      *Keyring
+	w      io.Writer
+	buf    bytes.Buffer
+	aead   cipher.AEAD
+	prefix []byte
+	idx    int64
+}
+
+// NewDecrypter writes the decrypted content into w
+func (k *Keyring) NewDecrypter(w io.Writer) *Decrypter {
+	return &Decrypter{
+		k: k,
+		w: w,
+	}
+}
+
+func (d *Decrypter) Write(p []byte) (int, error) {
+	d.buf.Write(p)
+	if d.aead == nil {
+		if d.buf.Len() < headerSize {
+			return len(p), nil
+		}
+		if err := d.readHeader(); err != nil {
+			return 0, err
+		}
+	}
+	// a segment is only opened when more data follows,
+	// the last one is only known on Close
+	for d.buf.Len() > d.segmentSize() {
+		if err := d.open(d.segmentSize(), aadSegment); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (d *Decrypter) Close() error {
+	if d.aead == nil {
+		return fmt.Errorf("%w: truncated header", ErrInvalidFile)
+	}
+	if d.buf.Len() < overhead {
+		return fmt.Errorf("%w: truncated content", ErrInvalidFile)
+	}
+	return d.open(d.buf.Len(), aadFinal)
+}
+
+func (d *Decrypter) segmentSize() int {
+	if d.idx == 0 {
+		return SegmentSize - headerSize
+	}
+	return SegmentSize
+}
+
+func (d *Decrypter) readHeader() error {
+	h := d.buf.Next(headerSize)
+	if string(h[:len(magic)]) != magic || h[len(magic)] != version {
+		return fmt.Errorf("%w: bad header", ErrInvalidFile)
+	}
+	h = h[len(magic)+1:]
+	dataKey, err := d.k.key(binary.BigEndian.Uint32(h))
+	if err != nil {
+		return err
+	}
+	fileKey, err := UnwrapKey(dataKey, h[4:4+wrappedSize])
+	if err != nil {
+		return fmt.Errorf("%w: unwrap file key", ErrInvalidFile)
+	}
+	d.aead, err = newAEAD(fileKey)
+	if err != nil {
+		return err
+	}
+	d.prefix = bytes.Clone(h[4+wrappedSize:])
+	return nil
+}
+
+func (d *Decrypter) open(n int, aad []byte) error {
+	plain, err := d.aead.Open(nil, segmentNonce(d.prefix, d.idx), d.buf.Next(n), aad)
+	if err != nil {
+		return fmt.Errorf("%w: segment %d", ErrInvalidFile, d.idx)
+	}
+	d.idx++
+	_, err = d.w.Write(plain)
+	return err
+}
+
+// IsEncrypted tells if head starts with an encrypted file header
+func IsEncrypted(head []byte) bool {
+	return len(head) >= MarkerSize && string(head[:len(magic)]) == magic && head[len(magic)] == version
+}
+
+// NewAutoDecrypter decrypts the content written to it when it's
+// an encrypted file and passes plain content through untouched,
+// unless the keyring requires it to be encrypted (ErrNotEncrypted).
+// A nil keyring only accepts plain content.
+func NewAutoDecrypter(k *Keyring, w io.Writer) io.WriteCloser {
+	return &autoDecrypter{
+		k: k,
+		w: w,
+	}
+}
+
+type autoDecrypter struct {
+	k    *Keyring
+	w    io.Writer
+	head []byte
+	dst  io.Writer
+}
+
+func (a *autoDecrypter) Write(p []byte) (int, error) {
+	if a.dst != nil {
+		return a.dst.Write(p)
+	}
+	a.head = append(a.head, p...)
+	if len(a.head) < MarkerSize {
+		return len(p), nil
+	}
+	if err := a.choose(); err != nil {
+		return 0, err
+	}
+	if _, err := a.dst.Write(a.head); err != nil {
+		return 0, err
+	}
+	a.head = nil
+	return len(p), nil
+}
+
+func (a *autoDecrypter) Close() error {
+	if a.dst == nil {
+		// shorter than a header, so it's plain content
+		if err := a.plain(); err != nil {
+			return err
+		}
+		a.dst = a.w
+		if _, err := a.w.Write(a.head); err != nil {
+			return err
+		}
+	}
+	if d, ok := a.dst.(*Decrypter); ok {
+		return d.Close()
+	}
+	return nil
+}
+
+func (a *autoDecrypter) choose() error {
+	if !IsEncrypted(a.head) {
+		if err := a.plain(); err != nil {
+			return err
+		}
+		a.dst = a.w
+		return nil
+	}
+	if a.k == nil {
+		return fmt.Errorf("%w: the file is encrypted but the account has no encryption keys", ErrUnknownKey)
+	}
+	a.dst = a.k.NewDecrypter(a.w)
+	return nil
+}
+
+func (a *autoDecrypter) plain() error {
+	if a.k != nil && a.k.requireEnc {
+		return fmt.Errorf("%w: the account requires the downloaded files to be encrypted", ErrNotEncrypted)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func testKeyring(t *testing.T, encryptNames, requireEncrypted bool) *Keyring {
+	t.Helper()
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewKeyring(map[uint32][]byte{1: key}, 1, encryptNames, requireEncrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func encrypt(t *testing.T, k *Keyring, plain []byte) []byte {
+	t.Helper()
+	e, err := k.NewEncrypter(bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(io.NewSectionReader(e, 0, e.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func decrypt(k *Keyring, content []byte, chunk int) ([]byte, error) {
+	var out bytes.Buffer
+	d := k.NewDecrypter(&out)
+	for len(content) > 0 {
+		n := min(chunk, len(content))
+		if _, err := d.Write(content[:n]); err != nil {
+			return nil, err
+		}
+		content = content[n:]
+	}
+	if err := d.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	k := testKeyring(t, false, false)
+	sizes := []int{
+		0, 1, firstSegmentPlain - 1, firstSegmentPlain, firstSegmentPlain + 1,
+		firstSegmentPlain + segmentPlain, firstSegmentPlain + 3*segmentPlain + 7, 320 * 1024 * 3,
+	}
+	for _, size := range sizes {
+		plain := bytes.Repeat([]byte("0123456789abcdef"), size/16+1)[:size]
+		cipher := encrypt(t, k, plain)
+		if int64(len(cipher)) != CipherSize(int64(size)) {
+			t.Errorf("size %d: encrypted size = %d, want %d", size, len(cipher), CipherSize(int64(size)))
+		}
+		if got := PlainSize(int64(len(cipher))); got != int64(size) {
+			t.Errorf("size %d: PlainSize = %d", size, got)
+		}
+		for _, chunk := range []int{1000, SegmentSize, 3 * SegmentSize} {
+			got, err := decrypt(k, cipher, chunk)
+			if err != nil {
+				t.Fatalf("size %d chunk %d: decrypt: %v", size, chunk, err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatalf("size %d chunk %d: decrypted content differs", size, chunk)
+			}
+		}
+	}
+}
+
+func TestEncrypterReadAt(t *testing.T) {
+	k := testKeyring(t, false, false)
+	plain := bytes.Repeat([]byte("x"), 3*SegmentSize)
+	e, err := k.NewEncrypter(bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole := make([]byte, e.Size())
+	if _, err := e.ReadAt(whole, 0); err != nil {
+		t.Fatal(err)
+	}
+	// upload session ranges are read out of order and across segments
+	for _, r := range [][2]int64{{SegmentSize - 10, 20}, {0, headerSize + 5}, {2*SegmentSize + 1, 100}, {e.Size() - 5, 5}} {
+		p := make([]byte, r[1])
+		if _, err := e.ReadAt(p, r[0]); err != nil {
+			t.Fatalf("ReadAt(%d, %d): %v", r[0], r[1], err)
+		}
+		if !bytes.Equal(p, whole[r[0]:r[0]+r[1]]) {
+			t.Errorf("ReadAt(%d, %d) differs from the whole content", r[0], r[1])
+		}
+	}
+	if n, err := e.ReadAt(make([]byte, 10), e.Size()-4); n != 4 || err != io.EOF {
+		t.Errorf("ReadAt past the end = %d, %v", n, err)
+	}
+}
+
+func TestDecryptInvalid(t *testing.T) {
+	k := testKeyring(t, false, false)
+	plain := bytes.Repeat([]byte("y"), firstSegmentPlain+2*segmentPlain+100)
+	cipher := encrypt(t, k, plain)
+
+	flip := func(i int) []byte {
+		b := bytes.Clone(cipher)
+		b[i] ^= 1
+		return b
+	}
+	swapped := bytes.Clone(cipher)
+	copy(swapped[SegmentSize:], cipher[2*SegmentSize:3*SegmentSize])
+	copy(swapped[2*SegmentSize:], cipher[SegmentSize:2*SegmentSize])
+
+	tests := []struct {
+		name    string
+		k       *Keyring
+		content []byte
+		wantErr error
+	}{
+		{name: "truncated header", k: k, content: cipher[:headerSize-1], wantErr: ErrInvalidFile},
+		{name: "header only", k: k, content: cipher[:headerSize], wantErr: ErrInvalidFile},
+		{name: "truncated last segment", k: k, content: cipher[:len(cipher)-1], wantErr: ErrInvalidFile},
+		{name: "truncated at a segment end", k: k, content: cipher[:2*SegmentSize], wantErr: ErrInvalidFile},
+		{name: "extended", k: k, content: append(bytes.Clone(cipher), 0), wantErr: ErrInvalidFile},
+		{name: "bad magic", k: k, content: flip(0), wantErr: ErrInvalidFile},
+		{name: "tampered file key", k: k, content: flip(20), wantErr: ErrInvalidFile},
+		{name: "tampered nonce prefix", k: k, content: flip(headerSize - 1), wantErr: ErrInvalidFile},
+		{name: "tampered first segment", k: k, content: flip(headerSize + 10), wantErr: ErrInvalidFile},
+		{name: "tampered last segment", k: k, content: flip(len(cipher) - 1), wantErr: ErrInvalidFile},
+		{name: "reordered segments", k: k, content: swapped, wantErr: ErrInvalidFile},
+		{name: "unknown data key", k: k, content: flip(9), wantErr: ErrUnknownKey},
+		{name: "another keyring", k: testKeyring(t, false, false), content: cipher, wantErr: ErrInvalidFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decrypt(tt.k, tt.content, SegmentSize); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAutoDecrypter(t *testing.T) {
+	k := testKeyring(t, false, false)
+	strict := testKeyring(t, false, true)
+	plain := []byte("plain content of a file")
+
+	tests := []struct {
+		name    string
+		k       *Keyring
+		content []byte
+		want    []byte
+		wantErr error
+	}{
+		{name: "plain content", k: k, content: plain, want: plain},
+		{name: "short plain content", k: k, content: []byte("ab"), want: []byte("ab")},
+		{name: "empty content", k: k, content: nil, want: nil},
+		{name: "plain content without keyring", content: plain, want: plain},
+		{name: "encrypted content", k: k, content: encrypt(t, k, plain), want: plain},
+		{name: "encrypted content without keyring", content: encrypt(t, k, plain), wantErr: ErrUnknownKey},
+		{name: "encrypted content required", k: strict, content: encrypt(t, strict, plain), want: plain},
+		{name: "plain content rejected", k: strict, content: plain, wantErr: ErrNotEncrypted},
+		{name: "short plain content rejected", k: strict, content: []byte("ab"), wantErr: ErrNotEncrypted},
+		{name: "empty content rejected", k: strict, content: nil, wantErr: ErrNotEncrypted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			d := NewAutoDecrypter(tt.k, &out)
+			_, err := d.Write(tt.content)
+			if err == nil {
+				err = d.Close()
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decrypt: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), tt.want) {
+				t.Errorf("got %q, want %q", out.Bytes(), tt.want)
+			}
+		})
+	}
+}
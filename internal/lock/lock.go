@@ -0,0 +1,44 @@
+// Package lock holds the lock files keeping two
+// processes from running the same work at once
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ErrLocked is returned when another process holds the lock
+var ErrLocked = errors.New("locked by another process")
+
+// File is a held lock file
+type File struct {
+	f *os.File
+}
+
+// Acquire takes the lock file at path, creating it when missing. The
+// lock is released by Release or when the process exits, the file
+// keeps the PID of the holder.
+func Acquire(path string) (*File, error) {
+	f, err := open(path)
+	if err != nil {
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &File{f: f}, nil
+}
+
+// Release releases the lock, the file is kept
+func (l *File) Release() error {
+	_ = l.f.Truncate(0)
+	if err := l.f.Close(); err != nil {
+		return fmt.Errorf("release lock: %w", err)
+	}
+	return nil
+}
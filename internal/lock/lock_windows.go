@@ -0,0 +1,28 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errSharingViolation is returned when opening a file
+// another process opened without sharing it
+const errSharingViolation syscall.Errno = 32
+
+// open opens the file without sharing it, other processes
+// can't open it until it's closed
+func open(path string) (*os.File, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if errors.Is(err, errSharingViolation) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
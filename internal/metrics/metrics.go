@@ -0,0 +1,45 @@
+// Package metrics exposes the client metrics to Prometheus
+package metrics
+
+import (
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"net/http"
+)
+
+// Job is the job the metrics are pushed under
+const Job = "onedrive-client"
+
+// NewRegistry returns a registry with the metrics of
+// the clients, the Go runtime and the process
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		client.DefaultMetrics,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// Handler serves the metrics of reg in the exposition format
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+}
+
+// Push sends the metrics of the clients to the Pushgateway at url,
+// replacing the ones pushed before by the same command
+func Push(url, command string) error {
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(client.DefaultMetrics); err != nil {
+		return fmt.Errorf("register metrics: %w", err)
+	}
+	if err := push.New(url, Job).Gatherer(reg).Grouping("command", command).Push(); err != nil {
+		return fmt.Errorf("push metrics to %s: %w", url, err)
+	}
+	return nil
+}
@@ -3,12 +3,14 @@ package model
 import "time"
 
 type OnedriveAccount struct {
-	ID        string     `gorm:"id"`
-	Name      string     `gorm:"index"`
-	AuthData  *TokenData `gorm:"foreignKey:AccountID"`
-	Drive     *DriveInfo `gorm:"foreignKey:AccountID"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID       string     `gorm:"id"`
+	Name     string     `gorm:"index"`
+	AuthData *TokenData `gorm:"foreignKey:AccountID"`
+	Drive    *DriveInfo `gorm:"foreignKey:AccountID"`
+	// Encryption is the optional client side encryption setup
+	Encryption *EncryptionConfig `gorm:"foreignKey:AccountID"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
 }
 
 type TokenData struct {
@@ -20,6 +22,9 @@ type TokenData struct {
 	RefreshToken string
 	IDToken      string
 	AccountID    string `gorm:"index"`
+	// UpdatedAt is when the token was stored, it
+	// expires ExpiresIn seconds after it
+	UpdatedAt time.Time
 }
 
 type DriveInfo struct {
@@ -29,3 +34,60 @@ type DriveInfo struct {
 	RootFolder string `gorm:"index"`
 	AccountID  string `gorm:"index"`
 }
+
+// EncryptionConfig is the client side encryption setup of an
+// account, the data keys are stored wrapped by the master key
+type EncryptionConfig struct {
+	ID           string `gorm:"id"`
+	AccountID    string `gorm:"index"`
+	Enabled      bool
+	EncryptNames bool
+	// KeySource is how the master key is obtained
+	// (passphrase or master-key)
+	KeySource  string
+	KDFSalt    []byte
+	KDFTime    uint32
+	KDFMemory  uint32
+	KDFThreads uint8
+	// ActiveKey is the data key version used for new uploads
+	ActiveKey uint32
+	Keys      []EncryptionKey `gorm:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// EncryptionKey is a data key wrapped by the account master key
+type EncryptionKey struct {
+	ID         string `gorm:"id"`
+	AccountID  string `gorm:"index"`
+	Version    uint32
+	WrappedKey []byte
+	CreatedAt  time.Time
+}
+
+// Subscription is a webhook subscription to the changes of an account
+// drive, kept to renew it and to check the notifications it sends
+type Subscription struct {
+	// ID is the subscription ID given by the API
+	ID              string `gorm:"id"`
+	AccountID       string `gorm:"index"`
+	NotificationURL string
+	// ClientState is the secret sent along the notifications
+	ClientState string
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// JobRun is a run of a daemon job
+type JobRun struct {
+	ID        string `gorm:"id"`
+	Job       string `gorm:"index"`
+	Account   string
+	StartedAt time.Time
+	// FinishedAt is zero while the job runs
+	FinishedAt time.Time
+	// Status is running, succeeded, failed or interrupted
+	Status string `gorm:"index"`
+	Error  string
+}
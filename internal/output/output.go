@@ -0,0 +1,232 @@
+// Package output renders the read commands results as a table or
+// in a machine readable format (JSON, JSONL, CSV, YAML or a Go template)
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/internal/progress"
+	"gopkg.in/yaml.v3"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+)
+
+const (
+	FormatTable    = "table"
+	FormatJSON     = "json"
+	FormatJSONL    = "jsonl"
+	FormatCSV      = "csv"
+	FormatYAML     = "yaml"
+	FormatTemplate = "template"
+)
+
+// Formats are the supported output formats
+var Formats = []string{FormatTable, FormatJSON, FormatJSONL, FormatCSV, FormatYAML, FormatTemplate}
+
+// Column is a table (and CSV) column
+type Column[T any] struct {
+	Header string
+	Value  func(T) string
+	// Raw is the value written to CSV when it differs from the
+	// human readable one (raw byte counts, RFC 3339 times)
+	Raw func(T) string
+	// Fields are the source properties the column reads, so
+	// the commands can fetch only those
+	Fields []string
+}
+
+// Fields returns the source properties read by the columns, or nil
+// when the format writes the whole items (JSON, JSONL, YAML and the
+// template) and so needs all of them
+func Fields[T any](p *Printer, cols []Column[T]) []string {
+	switch p.format {
+	case FormatJSON, FormatJSONL, FormatYAML, FormatTemplate:
+		return nil
+	}
+	var fields []string
+	for _, c := range cols {
+		for _, f := range c.Fields {
+			if !slices.Contains(fields, f) {
+				fields = append(fields, f)
+			}
+		}
+	}
+	return fields
+}
+
+// Printer writes results in the configured format, the JSON, JSONL
+// and YAML formats use the items JSON encoding and the template is
+// executed once per item
+type Printer struct {
+	w      io.Writer
+	format string
+	tmpl   *template.Template
+}
+
+// New returns a printer writing to w, tmpl is the
+// Go template used by the template format
+func New(w io.Writer, format, tmpl string) (*Printer, error) {
+	p := &Printer{
+		w:      w,
+		format: strings.ToLower(format),
+	}
+	switch p.format {
+	case "":
+		p.format = FormatTable
+	case FormatTable, FormatJSON, FormatJSONL, FormatCSV, FormatYAML, FormatTemplate:
+	default:
+		return nil, fmt.Errorf("invalid output format %q (expected %s)", format, strings.Join(Formats, ", "))
+	}
+
+	if p.format != FormatTemplate {
+		if tmpl != "" {
+			return nil, errors.New("a template is only used with the template output format")
+		}
+		return p, nil
+	}
+	if tmpl == "" {
+		return nil, errors.New("the template output format requires a template")
+	}
+	t, err := template.New("output").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"bytes": func(n int) string {
+			return progress.FormatBytes(int64(n))
+		},
+		"join": strings.Join,
+	}).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	p.tmpl = t
+	return p, nil
+}
+
+// Format returns the output format
+func (p *Printer) Format() string {
+	return p.format
+}
+
+// Print writes a list of items
+func Print[T any](p *Printer, items []T, cols []Column[T]) error {
+	if items == nil {
+		items = []T{}
+	}
+	switch p.format {
+	case FormatJSON:
+		return p.json(items)
+	case FormatYAML:
+		return p.yaml(items)
+	}
+	return writeRows(p, items, cols)
+}
+
+// PrintItem writes a single item, as an object
+// instead of a list in the JSON and YAML formats
+func PrintItem[T any](p *Printer, item T, cols []Column[T]) error {
+	switch p.format {
+	case FormatJSON:
+		return p.json(item)
+	case FormatYAML:
+		return p.yaml(item)
+	}
+	return writeRows(p, []T{item}, cols)
+}
+
+func writeRows[T any](p *Printer, items []T, cols []Column[T]) error {
+	switch p.format {
+	case FormatJSONL:
+		enc := json.NewEncoder(p.w)
+		for _, it := range items {
+			if err := enc.Encode(it); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatTemplate:
+		for _, it := range items {
+			if err := p.tmpl.Execute(p.w, it); err != nil {
+				return fmt.Errorf("execute template: %w", err)
+			}
+			if _, err := fmt.Fprintln(p.w); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		cw := csv.NewWriter(p.w)
+		row := make([]string, len(cols))
+		for i, c := range cols {
+			row[i] = c.Header
+		}
+		_ = cw.Write(row)
+		for _, it := range items {
+			for i, c := range cols {
+				if c.Raw != nil {
+					row[i] = c.Raw(it)
+				} else {
+					row[i] = c.Value(it)
+				}
+			}
+			_ = cw.Write(row)
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	row := make([]string, len(cols))
+	for i, c := range cols {
+		row[i] = strings.ToUpper(c.Header)
+	}
+	_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+	for _, it := range items {
+		for i, c := range cols {
+			row[i] = c.Value(it)
+		}
+		_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (p *Printer) json(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// yaml writes v as YAML, going through its JSON encoding
+// so the keys (and their order) match the JSON output
+func (p *Printer) yaml(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var n yaml.Node
+	if err := yaml.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	blockStyle(&n)
+	enc := yaml.NewEncoder(p.w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&n); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle drops the JSON (flow and quoted) styles, the
+// encoder quotes the values that need it
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
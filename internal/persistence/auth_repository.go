@@ -46,3 +46,22 @@ func (r *AuthRepository) FindOneByName(ctx context.Context, name string) (*model
 
 	return &acc, nil
 }
+
+// UpdateToken replaces the stored token of the account
+func (r *AuthRepository) UpdateToken(ctx context.Context, accountID string, token *model.TokenData) error {
+	tx := r.db.WithContext(ctx).Model(&model.TokenData{}).Where("account_id = ?", accountID).
+		Select("TokenType", "Scope", "ExpiresIn", "ExtExpiresIn", "AccessToken", "RefreshToken", "IDToken", "UpdatedAt").
+		Updates(token)
+	if tx.Error != nil {
+		return fmt.Errorf("update onedrive account token: %w", tx.Error)
+	}
+	return nil
+}
+
+func (r *AuthRepository) FindAllNames(ctx context.Context) ([]string, error) {
+	var names []string
+	if tx := r.db.WithContext(ctx).Model(&model.OnedriveAccount{}).Order("name").Pluck("name", &names); tx.Error != nil {
+		return nil, fmt.Errorf("find onedrive accounts: %w", tx.Error)
+	}
+	return names, nil
+}
@@ -20,6 +20,10 @@ func newDB(file string) *gorm.DB {
 		&model.OnedriveAccount{},
 		&model.TokenData{},
 		&model.DriveInfo{},
+		&model.EncryptionConfig{},
+		&model.EncryptionKey{},
+		&model.Subscription{},
+		&model.JobRun{},
 	); err != nil {
 		panic(fmt.Errorf("failed to migrate database: %w", err))
 	}
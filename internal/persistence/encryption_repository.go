@@ -0,0 +1,57 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/internal/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type EncryptionRepository struct {
+	db *gorm.DB
+}
+
+func NewEncryptionRepository(db *gorm.DB) *EncryptionRepository {
+	return &EncryptionRepository{db: db}
+}
+
+// Persist saves the encryption config and its data keys
+func (r *EncryptionRepository) Persist(ctx context.Context, cfg *model.EncryptionConfig) error {
+	if cfg.ID == "" {
+		cfg.ID = uuid.NewString()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(cfg).Error; err != nil {
+			return fmt.Errorf("save encryption config: %w", err)
+		}
+		for i := range cfg.Keys {
+			k := &cfg.Keys[i]
+			if k.ID == "" {
+				k.ID = uuid.NewString()
+			}
+			k.AccountID = cfg.AccountID
+			if err := tx.Save(k).Error; err != nil {
+				return fmt.Errorf("save encryption key %d: %w", k.Version, err)
+			}
+		}
+		return nil
+	})
+}
+
+// FindByAccountID returns the account encryption config,
+// or nil when encryption was never set up
+func (r *EncryptionRepository) FindByAccountID(ctx context.Context, accountID string) (*model.EncryptionConfig, error) {
+	var cfg model.EncryptionConfig
+	if tx := r.db.WithContext(ctx).First(&cfg, "account_id", accountID); tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("find encryption config: %w", tx.Error)
+	}
+	if tx := r.db.WithContext(ctx).Order("version").Find(&cfg.Keys, "account_id", accountID); tx.Error != nil {
+		return nil, fmt.Errorf("find encryption keys: %w", tx.Error)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,60 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/internal/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type JobRunRepository struct {
+	db *gorm.DB
+}
+
+func NewJobRunRepository(db *gorm.DB) *JobRunRepository {
+	return &JobRunRepository{db: db}
+}
+
+// Persist saves the job run
+func (r *JobRunRepository) Persist(ctx context.Context, run *model.JobRun) error {
+	if run.ID == "" {
+		run.ID = uuid.NewString()
+	}
+	if tx := r.db.WithContext(ctx).Save(run); tx.Error != nil {
+		return fmt.Errorf("save job run: %w", tx.Error)
+	}
+	return nil
+}
+
+// FindLatest returns the latest runs, newest first
+func (r *JobRunRepository) FindLatest(ctx context.Context, limit int) ([]model.JobRun, error) {
+	var runs []model.JobRun
+	if tx := r.db.WithContext(ctx).Order("started_at desc").Limit(limit).Find(&runs); tx.Error != nil {
+		return nil, fmt.Errorf("find job runs: %w", tx.Error)
+	}
+	return runs, nil
+}
+
+// UpdateStatus sets the status of the runs with the status from,
+// along with their finish time. It returns the updated runs.
+func (r *JobRunRepository) UpdateStatus(ctx context.Context, from, to string, finishedAt time.Time) ([]model.JobRun, error) {
+	var runs []model.JobRun
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Find(&runs, "status", from).Error; err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			return nil
+		}
+		return tx.Model(&model.JobRun{}).Where("status = ?", from).Updates(map[string]any{
+			"status":      to,
+			"finished_at": finishedAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("update job runs: %w", err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,42 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/internal/model"
+	"gorm.io/gorm"
+)
+
+type SubscriptionRepository struct {
+	db *gorm.DB
+}
+
+func NewSubscriptionRepository(db *gorm.DB) *SubscriptionRepository {
+	return &SubscriptionRepository{db: db}
+}
+
+// Persist saves the subscription, replacing the one with the same ID
+func (r *SubscriptionRepository) Persist(ctx context.Context, s *model.Subscription) error {
+	if tx := r.db.WithContext(ctx).Save(s); tx.Error != nil {
+		return fmt.Errorf("save subscription: %w", tx.Error)
+	}
+	return nil
+}
+
+// FindByAccountID returns the account subscriptions, the
+// ones expiring last first
+func (r *SubscriptionRepository) FindByAccountID(ctx context.Context, accountID string) ([]model.Subscription, error) {
+	var subs []model.Subscription
+	if tx := r.db.WithContext(ctx).Order("expires_at desc").Find(&subs, "account_id", accountID); tx.Error != nil {
+		return nil, fmt.Errorf("find subscriptions: %w", tx.Error)
+	}
+	return subs, nil
+}
+
+// Delete removes the subscription with the given ID
+func (r *SubscriptionRepository) Delete(ctx context.Context, id string) error {
+	if tx := r.db.WithContext(ctx).Delete(&model.Subscription{}, "id", id); tx.Error != nil {
+		return fmt.Errorf("delete subscription: %w", tx.Error)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package progress
+
+import (
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ttyRefreshInterval = 200 * time.Millisecond
+	logInterval        = 10 * time.Second
+	maxNameWidth       = 40
+)
+
+// Display renders the transfers progress, one line per
+// active transfer plus the overall total. When the output
+// isn't a terminal it logs periodic structured lines instead.
+type Display struct {
+	out      io.Writer
+	tty      bool
+	interval time.Duration
+
+	mu        sync.Mutex
+	active    map[string]*transfer
+	order     []string
+	count     int
+	finished  int
+	failed    int
+	total     int64
+	doneBytes int64
+	started   time.Time
+	lines     int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type transfer struct {
+	name     string
+	size     int64
+	progress client.Progress
+}
+
+// New creates a display writing into out
+func New(out *os.File) *Display {
+	d := &Display{
+		out:      out,
+		tty:      IsTerminal(out),
+		interval: logInterval,
+		active:   make(map[string]*transfer),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if d.tty {
+		d.interval = ttyRefreshInterval
+	}
+	return d
+}
+
+// IsTerminal tells if f is attached to a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Start begins rendering in background
+func (d *Display) Start() {
+	d.started = time.Now()
+	go func() {
+		defer close(d.done)
+		t := time.NewTicker(d.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				d.render()
+			case <-d.stop:
+				d.render()
+				return
+			}
+		}
+	}()
+}
+
+// Stop renders the final state and stops the display
+func (d *Display) Stop() {
+	close(d.stop)
+	<-d.done
+}
+
+func (d *Display) TransfersQueued(count int, size int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.count += count
+	d.total += size
+}
+
+func (d *Display) TransferStarted(name string, size int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active[name] = &transfer{
+		name:     name,
+		size:     size,
+		progress: client.Progress{Total: size},
+	}
+	d.order = append(d.order, name)
+}
+
+func (d *Display) TransferProgress(name string, p client.Progress) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t, ok := d.active[name]; ok {
+		t.progress = p
+	}
+}
+
+func (d *Display) TransferFinished(name string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.active[name]
+	if !ok {
+		return
+	}
+	delete(d.active, name)
+	for i, n := range d.order {
+		if n == name {
+			d.order = append(d.order[:i], d.order[i+1:]...)
+			break
+		}
+	}
+	d.finished++
+	if err != nil {
+		d.failed++
+		d.doneBytes += t.progress.Done
+		return
+	}
+	d.doneBytes += max(t.size, t.progress.Done)
+}
+
+func (d *Display) render() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	done := d.doneBytes
+	var rate float64
+	for _, t := range d.active {
+		done += t.progress.Done
+		rate += t.progress.Rate
+	}
+	var eta time.Duration
+	if rate > 0 && d.total > done {
+		eta = time.Duration(float64(d.total-done) / rate * float64(time.Second))
+	}
+
+	if !d.tty {
+		slog.With(
+			slog.Int("files_done", d.finished),
+			slog.Int("files_total", d.count),
+			slog.Int("files_failed", d.failed),
+			slog.Int("files_active", len(d.active)),
+			slog.Int64("bytes_done", done),
+			slog.Int64("bytes_total", d.total),
+			slog.Float64("rate", rate),
+			slog.Duration("eta", eta),
+			slog.Duration("elapsed", time.Since(d.started)),
+		).Info("transfer progress")
+		return
+	}
+
+	var b strings.Builder
+	if d.lines > 0 {
+		// moves the cursor back to the first line of the last render
+		fmt.Fprintf(&b, "\033[%dA", d.lines)
+	}
+	for _, name := range d.order {
+		t := d.active[name]
+		fmt.Fprintf(&b, "\033[2K%s\n", line(shortName(t.name), t.progress.Done, t.progress.Total, t.progress.Rate, t.progress.ETA))
+	}
+	summary := fmt.Sprintf("Total [%d/%d files", d.finished, d.count)
+	if d.failed > 0 {
+		summary += fmt.Sprintf(", %d failed", d.failed)
+	}
+	summary += "]"
+	fmt.Fprintf(&b, "\033[2K%s\n", line(summary, done, d.total, rate, eta))
+	// clears leftovers from transfers that finished since the last render
+	for i := len(d.order) + 1; i < d.lines; i++ {
+		b.WriteString("\033[2K\n")
+	}
+	extra := max(d.lines-len(d.order)-1, 0)
+	if extra > 0 {
+		fmt.Fprintf(&b, "\033[%dA", extra)
+	}
+	d.lines = len(d.order) + 1
+
+	_, _ = io.WriteString(d.out, b.String())
+}
+
+func line(name string, done, total int64, rate float64, eta time.Duration) string {
+	percent := ""
+	if total > 0 {
+		percent = fmt.Sprintf("%3d%%", done*100/total)
+	}
+	etaStr := "-"
+	if eta > 0 {
+		etaStr = FormatDuration(eta)
+	}
+	return fmt.Sprintf(
+		"%-*s %4s %10s / %-10s %10s/s  ETA %s",
+		maxNameWidth,
+		name,
+		percent,
+		FormatBytes(done),
+		FormatBytes(total),
+		FormatBytes(int64(rate)),
+		etaStr,
+	)
+}
+
+// shortName fits name in maxNameWidth runes, cutting the folders
+// before the base name or, when it's too long, the name start
+func shortName(name string) string {
+	runes := []rune(name)
+	if len(runes) <= maxNameWidth {
+		return name
+	}
+	base := []rune(path.Base(name))
+	if len(base) > maxNameWidth-4 {
+		return "..." + string(base[len(base)-(maxNameWidth-3):])
+	}
+	return string(runes[:maxNameWidth-len(base)-4]) + ".../" + string(base)
+}
+
+// FormatBytes formats a size using binary units
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// FormatDuration formats a duration rounded to seconds
+func FormatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,38 @@
+package progress
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestShortName(t *testing.T) {
+	folders := "backup/2023/photos/holidays/"
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "short", in: "backup/photo.jpg", want: "backup/photo.jpg"},
+		{name: "fits", in: strings.Repeat("a", 40), want: strings.Repeat("a", 40)},
+		{name: "base of 35", in: folders + strings.Repeat("b", 35), want: "b.../" + strings.Repeat("b", 35)},
+		{name: "base of 36", in: folders + strings.Repeat("b", 36), want: ".../" + strings.Repeat("b", 36)},
+		{name: "base of 37", in: folders + strings.Repeat("b", 37), want: "..." + strings.Repeat("b", 37)},
+		{name: "long base", in: folders + "x" + strings.Repeat("b", 50), want: "..." + strings.Repeat("b", 37)},
+		{name: "long folders", in: strings.Repeat("f", 50) + "/photo.jpg", want: strings.Repeat("f", 27) + ".../photo.jpg"},
+		{name: "multi-byte fits", in: strings.Repeat("é", 40), want: strings.Repeat("é", 40)},
+		{name: "multi-byte base", in: folders + strings.Repeat("é", 38), want: "..." + strings.Repeat("é", 37)},
+		{name: "multi-byte folders", in: strings.Repeat("ü", 50) + "/photo.jpg", want: strings.Repeat("ü", 27) + ".../photo.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := shortName(tt.in)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) || utf8.RuneCountInString(got) > maxNameWidth {
+				t.Errorf("%q doesn't fit in %d runes", got, maxNameWidth)
+			}
+		})
+	}
+}
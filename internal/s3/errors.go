@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"errors"
+	"net/http"
+)
+
+// apiError is an S3 error response
+type apiError struct {
+	code    string
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.code + ": " + e.message
+}
+
+var (
+	errAccessDenied          = &apiError{"AccessDenied", http.StatusForbidden, "Access Denied"}
+	errExpired               = &apiError{"AccessDenied", http.StatusForbidden, "Request has expired"}
+	errInvalidAccessKeyID    = &apiError{"InvalidAccessKeyId", http.StatusForbidden, "The access key ID you provided does not exist in our records."}
+	errSignatureMismatch     = &apiError{"SignatureDoesNotMatch", http.StatusForbidden, "The request signature we calculated does not match the signature you provided."}
+	errTimeSkewed            = &apiError{"RequestTimeTooSkewed", http.StatusForbidden, "The difference between the request time and the server's time is too large."}
+	errUnsupportedAuth       = &apiError{"InvalidRequest", http.StatusBadRequest, "Only AWS Signature Version 4 (AWS4-HMAC-SHA256) is supported."}
+	errAuthHeaderMalformed   = &apiError{"AuthorizationHeaderMalformed", http.StatusBadRequest, "The authorization header is malformed."}
+	errAuthQueryMalformed    = &apiError{"AuthorizationQueryParametersError", http.StatusBadRequest, "The authorization query parameters are malformed."}
+	errMissingDate           = &apiError{"AccessDenied", http.StatusForbidden, "AWS authentication requires a valid Date or x-amz-date header"}
+	errHostNotSigned         = &apiError{"AccessDenied", http.StatusForbidden, "The host header must be signed."}
+	errMissingContentSHA256  = &apiError{"InvalidRequest", http.StatusBadRequest, "Missing required header for this request: x-amz-content-sha256"}
+	errInvalidContentSHA256  = &apiError{"InvalidArgument", http.StatusBadRequest, "x-amz-content-sha256 must be UNSIGNED-PAYLOAD, a streaming payload or a valid sha256 value."}
+	errContentSHA256Mismatch = &apiError{"XAmzContentSHA256Mismatch", http.StatusBadRequest, "The provided 'x-amz-content-sha256' header does not match what was computed."}
+	errBadDigest             = &apiError{"BadDigest", http.StatusBadRequest, "The Content-MD5 you specified did not match what we received."}
+	errInvalidDigest         = &apiError{"InvalidDigest", http.StatusBadRequest, "The Content-MD5 you specified is not valid."}
+	errIncompleteBody        = &apiError{"IncompleteBody", http.StatusBadRequest, "You did not provide the number of bytes specified by the Content-Length HTTP header."}
+	errMalformedXML          = &apiError{"MalformedXML", http.StatusBadRequest, "The XML you provided was not well-formed or did not validate against our published schema."}
+	errInvalidRange          = &apiError{"InvalidRange", http.StatusRequestedRangeNotSatisfiable, "The requested range is not satisfiable"}
+	errInvalidPartNumber     = &apiError{"InvalidArgument", http.StatusBadRequest, "Part number must be an integer between 1 and 10000, inclusive"}
+	errInvalidMaxKeys        = &apiError{"InvalidArgument", http.StatusBadRequest, "Provided max-keys not an integer or within integer range"}
+	errInvalidToken          = &apiError{"InvalidArgument", http.StatusBadRequest, "The continuation token provided is incorrect"}
+	errInvalidPartOrder      = &apiError{"InvalidPartOrder", http.StatusBadRequest, "The list of parts was not in ascending order. Parts must be ordered by part number."}
+	errMethodNotAllowed      = &apiError{"MethodNotAllowed", http.StatusMethodNotAllowed, "The specified method is not allowed against this resource."}
+	errNotImplemented        = &apiError{"NotImplemented", http.StatusNotImplemented, "A header or query you provided implies functionality that is not implemented."}
+	errInternal              = &apiError{"InternalError", http.StatusInternalServerError, "We encountered an internal error. Please try again."}
+)
+
+// backendErrors maps the backend errors to their responses
+var backendErrors = []struct {
+	err  error
+	resp *apiError
+}{
+	{ErrNoSuchBucket, &apiError{"NoSuchBucket", http.StatusNotFound, "The specified bucket does not exist"}},
+	{ErrBucketExists, &apiError{"BucketAlreadyOwnedByYou", http.StatusConflict, "Your previous request to create the named bucket succeeded and you already own it."}},
+	{ErrInvalidBucket, &apiError{"InvalidBucketName", http.StatusBadRequest, "The specified bucket is not valid."}},
+	{ErrNoSuchKey, &apiError{"NoSuchKey", http.StatusNotFound, "The specified key does not exist."}},
+	{ErrInvalidKey, &apiError{"InvalidArgument", http.StatusBadRequest, "The specified key can't be stored."}},
+	{ErrNoSuchUpload, &apiError{"NoSuchUpload", http.StatusNotFound, "The specified multipart upload does not exist."}},
+	{ErrInvalidPart, &apiError{"InvalidPart", http.StatusBadRequest, "One or more of the specified parts could not be found or its entity tag did not match."}},
+	{ErrEntityTooSmall, &apiError{"EntityTooSmall", http.StatusBadRequest, "Your proposed upload is smaller than the minimum allowed object size."}},
+}
+
+// toAPIError returns the response of err, internal errors
+// are reported as such
+func toAPIError(err error) *apiError {
+	var e *apiError
+	if errors.As(err, &e) {
+		return e
+	}
+	for _, b := range backendErrors {
+		if errors.Is(err, b.err) {
+			return b.resp
+		}
+	}
+	return errInternal
+}
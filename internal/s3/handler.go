@@ -0,0 +1,218 @@
+package s3
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// unsupported are the sub-resources that aren't implemented, requests
+// on them fail instead of being served as the plain resource
+var unsupported = []string{
+	"acl", "tagging", "policy", "cors", "lifecycle", "versioning", "versions",
+	"retention", "legal-hold", "object-lock", "torrent", "attributes", "uploads",
+	"encryption", "replication", "website", "logging", "notification",
+}
+
+// Handler serves the S3 API over a backend, the requests must be
+// signed with one of the access keys. Buckets and keys come from the
+// request path (path style), the region of the signature is accepted
+// as is.
+type Handler struct {
+	backend Backend
+	// keys maps the access keys to their secret keys
+	keys map[string]string
+}
+
+func NewHandler(b Backend, keys map[string]string) *Handler {
+	return &Handler{
+		backend: b,
+		keys:    keys,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := requestID()
+	w.Header().Set("x-amz-request-id", id)
+	w.Header().Set("Server", "onedrive-client")
+
+	sig, err := h.authenticate(r)
+	if err == nil {
+		err = h.route(w, r, sig)
+	}
+	log := slog.With("method", r.Method, "path", r.URL.Path, "request_id", id)
+	if err == nil {
+		log.DebugContext(r.Context(), "s3 request")
+		return
+	}
+	resp := toAPIError(err)
+	if resp.status >= http.StatusInternalServerError {
+		log.With("error", err).WarnContext(r.Context(), "s3 request failed")
+	} else {
+		log.With("error", err).DebugContext(r.Context(), "s3 request rejected")
+	}
+	writeError(w, r, resp, id)
+}
+
+func (h *Handler) route(w http.ResponseWriter, r *http.Request, sig *signature) error {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	q := r.URL.Query()
+	for _, sub := range unsupported {
+		if q.Has(sub) && !(sub == "uploads" && r.Method == http.MethodPost) {
+			return errNotImplemented
+		}
+	}
+
+	switch {
+	case bucket == "":
+		if r.Method != http.MethodGet {
+			return errMethodNotAllowed
+		}
+		return h.listBuckets(w, r)
+
+	case key == "":
+		switch r.Method {
+		case http.MethodGet:
+			switch {
+			case q.Has("location"):
+				return h.bucketLocation(w, r, bucket)
+			case q.Get("list-type") == "2":
+				return h.listObjectsV2(w, r, bucket)
+			}
+			return h.listObjectsV1(w, r, bucket)
+		case http.MethodHead:
+			return h.backend.HeadBucket(r.Context(), bucket)
+		case http.MethodPut:
+			return h.createBucket(w, r, bucket)
+		case http.MethodPost:
+			if q.Has("delete") {
+				return h.deleteObjects(w, r, bucket)
+			}
+			return errNotImplemented
+		case http.MethodDelete:
+			return errNotImplemented
+		}
+
+	default:
+		switch r.Method {
+		case http.MethodGet:
+			return h.getObject(w, r, bucket, key)
+		case http.MethodHead:
+			return h.headObject(w, r, bucket, key)
+		case http.MethodPut:
+			switch {
+			case r.Header.Get("X-Amz-Copy-Source") != "":
+				return errNotImplemented
+			case q.Has("uploadId"):
+				return h.uploadPart(w, r, sig, bucket, key)
+			}
+			return h.putObject(w, r, sig, bucket, key)
+		case http.MethodDelete:
+			if q.Has("uploadId") {
+				return h.abortMultipartUpload(w, r, bucket, key)
+			}
+			return h.deleteObject(w, r, bucket, key)
+		case http.MethodPost:
+			switch {
+			case q.Has("uploads"):
+				return h.createMultipartUpload(w, r, bucket, key)
+			case q.Has("uploadId"):
+				return h.completeMultipartUpload(w, r, bucket, key)
+			}
+			return errNotImplemented
+		}
+	}
+	return errMethodNotAllowed
+}
+
+func (h *Handler) listBuckets(w http.ResponseWriter, r *http.Request) error {
+	buckets, err := h.backend.ListBuckets(r.Context())
+	if err != nil {
+		return err
+	}
+	res := listBucketsResult{Owner: owner{ID: "onedrive", DisplayName: "onedrive"}}
+	for _, b := range buckets {
+		res.Buckets = append(res.Buckets, bucketEntry{Name: b.Name, CreationDate: formatTime(b.Created)})
+	}
+	return writeXML(w, http.StatusOK, res)
+}
+
+func (h *Handler) bucketLocation(w http.ResponseWriter, r *http.Request, bucket string) error {
+	if err := h.backend.HeadBucket(r.Context(), bucket); err != nil {
+		return err
+	}
+	return writeXML(w, http.StatusOK, locationResult{})
+}
+
+func (h *Handler) createBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	if err := h.backend.CreateBucket(r.Context(), bucket); err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// readXML decodes the request document into v
+func readXML(r *http.Request, v any) error {
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxXMLBody))
+	if err != nil {
+		return errIncompleteBody
+	}
+	if err := xml.Unmarshal(b, v); err != nil {
+		return errMalformedXML
+	}
+	return nil
+}
+
+// writeXML sends the response document, once the status is sent the
+// errors (of clients gone away) can't be reported so they're dropped
+func writeXML(w http.ResponseWriter, status int, v any) error {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = encodeXML(w, v)
+	return nil
+}
+
+func encodeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, e *apiError, id string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(e.status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = encodeXML(w, errorBody(r, e, id))
+}
+
+func errorBody(r *http.Request, e *apiError, id string) errorResponse {
+	return errorResponse{
+		Code:      e.code,
+		Message:   e.message,
+		Resource:  r.URL.Path,
+		RequestID: id,
+	}
+}
+
+func requestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+// encodeKey encodes a key for the url encoding type of the listings
+func encodeKey(key, encoding string) string {
+	if encoding != "url" {
+		return key
+	}
+	return uriEncode(key, false)
+}
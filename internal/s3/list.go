@@ -0,0 +1,169 @@
+package s3
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxKeys = 1000
+
+// listing is a page of objects and common prefixes, sorted by key
+type listing struct {
+	objects   []Object
+	prefixes  []string
+	truncated bool
+	// last is the last key or prefix of the page
+	last string
+}
+
+// list returns the page of the keys starting with prefix, after the
+// after key. The objects below the delimiter are grouped into common
+// prefixes, the "/" delimiter is pushed down to the backend.
+func (h *Handler) list(r *http.Request, bucket, prefix, delimiter, after string, maxKeys int) (*listing, error) {
+	objects, prefixes, err := h.backend.ListObjects(r.Context(), bucket, prefix, delimiter != "/")
+	if err != nil {
+		return nil, err
+	}
+
+	type entry struct {
+		key    string
+		object *Object
+	}
+	var entries []entry
+	seen := map[string]bool{}
+	addPrefix := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			entries = append(entries, entry{key: p})
+		}
+	}
+	for _, p := range prefixes {
+		addPrefix(p)
+	}
+	for i, o := range objects {
+		if delimiter != "" && delimiter != "/" {
+			if j := strings.Index(o.Key[len(prefix):], delimiter); j >= 0 {
+				addPrefix(o.Key[:len(prefix)+j+len(delimiter)])
+				continue
+			}
+		}
+		entries = append(entries, entry{key: o.Key, object: &objects[i]})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	l := &listing{}
+	for _, e := range entries {
+		if e.key <= after {
+			continue
+		}
+		if len(l.objects)+len(l.prefixes) == maxKeys {
+			l.truncated = true
+			break
+		}
+		if e.object != nil {
+			l.objects = append(l.objects, *e.object)
+		} else {
+			l.prefixes = append(l.prefixes, e.key)
+		}
+		l.last = e.key
+	}
+	return l, nil
+}
+
+func (h *Handler) listObjectsV2(w http.ResponseWriter, r *http.Request, bucket string) error {
+	q := r.URL.Query()
+	maxKeys, err := parseMaxKeys(q.Get("max-keys"))
+	if err != nil {
+		return err
+	}
+	token, after := q.Get("continuation-token"), q.Get("start-after")
+	if token != "" {
+		b, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return errInvalidToken
+		}
+		after = max(after, string(b))
+	}
+
+	prefix, delimiter, encoding := q.Get("prefix"), q.Get("delimiter"), q.Get("encoding-type")
+	l, err := h.list(r, bucket, prefix, delimiter, after, maxKeys)
+	if err != nil {
+		return err
+	}
+	count := len(l.objects) + len(l.prefixes)
+	res := listObjectsResult{
+		Name:              bucket,
+		Prefix:            encodeKey(prefix, encoding),
+		Delimiter:         encodeKey(delimiter, encoding),
+		EncodingType:      encoding,
+		MaxKeys:           maxKeys,
+		IsTruncated:       l.truncated,
+		KeyCount:          &count,
+		ContinuationToken: token,
+		StartAfter:        encodeKey(q.Get("start-after"), encoding),
+	}
+	if l.truncated {
+		res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(l.last))
+	}
+	l.fill(&res, encoding)
+	return writeXML(w, http.StatusOK, res)
+}
+
+func (h *Handler) listObjectsV1(w http.ResponseWriter, r *http.Request, bucket string) error {
+	q := r.URL.Query()
+	maxKeys, err := parseMaxKeys(q.Get("max-keys"))
+	if err != nil {
+		return err
+	}
+	prefix, delimiter, encoding, marker := q.Get("prefix"), q.Get("delimiter"), q.Get("encoding-type"), q.Get("marker")
+	l, err := h.list(r, bucket, prefix, delimiter, marker, maxKeys)
+	if err != nil {
+		return err
+	}
+	encodedMarker := encodeKey(marker, encoding)
+	res := listObjectsResult{
+		Name:         bucket,
+		Prefix:       encodeKey(prefix, encoding),
+		Delimiter:    encodeKey(delimiter, encoding),
+		EncodingType: encoding,
+		MaxKeys:      maxKeys,
+		IsTruncated:  l.truncated,
+		Marker:       &encodedMarker,
+	}
+	if l.truncated {
+		res.NextMarker = encodeKey(l.last, encoding)
+	}
+	l.fill(&res, encoding)
+	return writeXML(w, http.StatusOK, res)
+}
+
+func (l *listing) fill(res *listObjectsResult, encoding string) {
+	for _, o := range l.objects {
+		res.Contents = append(res.Contents, objectEntry{
+			Key:          encodeKey(o.Key, encoding),
+			LastModified: formatTime(o.Modified),
+			ETag:         o.ETag,
+			Size:         o.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	for _, p := range l.prefixes {
+		res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: encodeKey(p, encoding)})
+	}
+}
+
+func parseMaxKeys(s string) (int, error) {
+	if s == "" {
+		return defaultMaxKeys, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, errInvalidMaxKeys
+	}
+	return min(n, defaultMaxKeys), nil
+}
@@ -0,0 +1,151 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxPartNumber = 10000
+	// keepAliveInterval is how often whitespace is sent while a
+	// long multipart upload completes, so clients don't time out
+	keepAliveInterval = 10 * time.Second
+)
+
+func (h *Handler) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	id, err := h.backend.CreateMultipartUpload(r.Context(), bucket, key)
+	if err != nil {
+		return err
+	}
+	return writeXML(w, http.StatusOK, initiateMultipartUploadResult{
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: id,
+	})
+}
+
+func (h *Handler) uploadPart(w http.ResponseWriter, r *http.Request, sig *signature, bucket, key string) error {
+	q := r.URL.Query()
+	number, err := strconv.Atoi(q.Get("partNumber"))
+	if err != nil || number < 1 || number > maxPartNumber {
+		return errInvalidPartNumber
+	}
+	body, _, err := contentBody(r, sig)
+	if err != nil {
+		return err
+	}
+	etag, err := h.backend.UploadPart(r.Context(), bucket, key, q.Get("uploadId"), number, body)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// completeMultipartUpload assembles the parts. The status is sent once
+// the upload takes longer than keepAliveInterval, then the errors are
+// reported in the body like S3 does
+func (h *Handler) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	var req completeMultipartUpload
+	if err := readXML(r, &req); err != nil {
+		return err
+	}
+	if len(req.Parts) == 0 {
+		return errMalformedXML
+	}
+	parts := make([]Part, len(req.Parts))
+	for i, p := range req.Parts {
+		if i > 0 && p.PartNumber <= parts[i-1].Number {
+			return errInvalidPartOrder
+		}
+		parts[i] = Part{Number: p.PartNumber, ETag: quote(p.ETag)}
+	}
+	etag, err := multipartETag(parts)
+	if err != nil {
+		return err
+	}
+	res := completeMultipartUploadResult{
+		Location: "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     etag,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.backend.CompleteMultipartUpload(r.Context(), bucket, key, r.URL.Query().Get("uploadId"), parts)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		return writeXML(w, http.StatusOK, res)
+	case <-time.After(keepAliveInterval):
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, xml.Header)
+	flush(w)
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				_ = xml.NewEncoder(w).Encode(errorBody(r, toAPIError(err), w.Header().Get("x-amz-request-id")))
+				return nil
+			}
+			_ = xml.NewEncoder(w).Encode(res)
+			return nil
+		case <-ticker.C:
+			_, _ = io.WriteString(w, " ")
+			flush(w)
+		}
+	}
+}
+
+func (h *Handler) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if err := h.backend.AbortMultipartUpload(r.Context(), bucket, key, r.URL.Query().Get("uploadId")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// multipartETag is the entity tag S3 gives to multipart uploads,
+// the MD5 of the parts MD5 followed by the number of parts
+func multipartETag(parts []Part) (string, error) {
+	m := md5.New()
+	for _, p := range parts {
+		b, err := hex.DecodeString(strings.Trim(p.ETag, `"`))
+		if err != nil {
+			return "", fmt.Errorf("part %d: %w", p.Number, ErrInvalidPart)
+		}
+		m.Write(b)
+	}
+	return fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(m.Sum(nil)), len(parts)), nil
+}
+
+func quote(etag string) string {
+	etag = strings.TrimSpace(etag)
+	if strings.HasPrefix(etag, `"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
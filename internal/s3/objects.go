@@ -0,0 +1,196 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// errLimitReached stops the download once the requested range is sent
+var errLimitReached = errors.New("range sent")
+
+func (h *Handler) headObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	o, err := h.backend.HeadObject(r.Context(), bucket, key)
+	if err != nil {
+		return err
+	}
+	setObjectHeaders(w, o)
+	w.Header().Set("Content-Length", strconv.FormatInt(o.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (h *Handler) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	o, err := h.backend.HeadObject(r.Context(), bucket, key)
+	if err != nil {
+		return err
+	}
+	start, length, partial, err := parseRange(r.Header.Get("Range"), o.Size)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", o.Size))
+		return err
+	}
+
+	setObjectHeaders(w, o)
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	status := http.StatusOK
+	if partial {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, o.Size))
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	if length == 0 {
+		return nil
+	}
+
+	// the download is cancelled once the range is sent
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	lw := &limitedWriter{w: w, left: length}
+	err = h.backend.GetObject(ctx, bucket, key, start, lw)
+	if err != nil && lw.left > 0 {
+		// the status is sent, the client sees the truncated body
+		slog.With("error", err, "bucket", bucket, "key", key).WarnContext(r.Context(), "s3 download failed")
+	}
+	return nil
+}
+
+func setObjectHeaders(w http.ResponseWriter, o Object) {
+	w.Header().Set("Content-Type", o.ContentType)
+	w.Header().Set("ETag", o.ETag)
+	w.Header().Set("Last-Modified", o.Modified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+}
+
+// parseRange parses a single range Range header ("bytes=0-99",
+// "bytes=100-" or "bytes=-100"), the unsupported ones are ignored
+func parseRange(header string, size int64) (start, length int64, partial bool, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, false, nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, size, false, nil
+	}
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, size, false, nil
+		}
+		if n <= 0 || size == 0 {
+			return 0, 0, false, errInvalidRange
+		}
+		n = min(n, size)
+		return size - n, n, true, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, false, nil
+	}
+	if start >= size {
+		return 0, 0, false, errInvalidRange
+	}
+	end := size - 1
+	if last != "" {
+		e, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || e < start {
+			return 0, size, false, nil
+		}
+		end = min(e, end)
+	}
+	return start, end - start + 1, true, nil
+}
+
+// limitedWriter writes up to left bytes, then it fails with errLimitReached
+type limitedWriter struct {
+	w    io.Writer
+	left int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.left <= 0 {
+		return 0, errLimitReached
+	}
+	short := int64(len(p)) > l.left
+	if short {
+		p = p[:l.left]
+	}
+	n, err := l.w.Write(p)
+	l.left -= int64(n)
+	if err == nil && short {
+		err = errLimitReached
+	}
+	return n, err
+}
+
+func (h *Handler) putObject(w http.ResponseWriter, r *http.Request, sig *signature, bucket, key string) error {
+	body, sum, err := contentBody(r, sig)
+	if err != nil {
+		return err
+	}
+	if err := h.backend.PutObject(r.Context(), bucket, key, body); err != nil {
+		return err
+	}
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum.Sum(nil))+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// contentBody returns the request body, checked against the signed
+// payload and the Content-MD5 header, and the hash of its content
+func contentBody(r *http.Request, sig *signature) (io.Reader, hash.Hash, error) {
+	body, err := sig.body(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	var want []byte
+	if v := r.Header.Get("Content-MD5"); v != "" {
+		want, err = base64.StdEncoding.DecodeString(v)
+		if err != nil || len(want) != md5.Size {
+			return nil, nil, errInvalidDigest
+		}
+	}
+	c := &checkedReader{r: body, h: md5.New(), want: want, mismatch: errBadDigest}
+	return c, c.h, nil
+}
+
+func (h *Handler) deleteObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if err := h.backend.DeleteObject(r.Context(), bucket, key); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *Handler) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	var req deleteObjects
+	if err := readXML(r, &req); err != nil {
+		return err
+	}
+	var res deleteResult
+	for _, o := range req.Objects {
+		if err := h.backend.DeleteObject(r.Context(), bucket, o.Key); err != nil {
+			e := toAPIError(err)
+			if e.status >= http.StatusInternalServerError {
+				slog.With("error", err, "bucket", bucket, "key", o.Key).WarnContext(r.Context(), "s3 delete failed")
+			}
+			res.Errors = append(res.Errors, deleteError{Key: o.Key, Code: e.code, Message: e.message})
+			continue
+		}
+		if !req.Quiet {
+			res.Deleted = append(res.Deleted, deletedEntry{Key: o.Key})
+		}
+	}
+	return writeXML(w, http.StatusOK, res)
+}
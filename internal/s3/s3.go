@@ -0,0 +1,95 @@
+// Package s3 serves a subset of the S3 API (path style requests,
+// signed with AWS Signature Version 4) over a storage backend
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoSuchBucket   = errors.New("no such bucket")
+	ErrBucketExists   = errors.New("bucket already exists")
+	ErrNoSuchKey      = errors.New("no such key")
+	ErrInvalidKey     = errors.New("invalid key")
+	ErrNoSuchUpload   = errors.New("no such upload")
+	ErrInvalidPart    = errors.New("invalid part")
+	ErrInvalidBucket  = errors.New("invalid bucket name")
+	ErrEntityTooSmall = errors.New("part too small")
+)
+
+// MinPartSize is the minimum size of the multipart upload parts,
+// the last part of an upload may be smaller
+const MinPartSize = 5 << 20
+
+// Bucket is a top level container of objects
+type Bucket struct {
+	Name    string
+	Created time.Time
+}
+
+// Object describes a stored object
+type Object struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+	// ETag is the quoted entity tag
+	ETag        string
+	ContentType string
+}
+
+// Part is a multipart upload part, as listed when the upload is completed
+type Part struct {
+	Number int
+	ETag   string
+}
+
+// Backend stores the buckets and the objects. The errors wrap the
+// package errors (like ErrNoSuchKey) so they map to S3 error codes.
+type Backend interface {
+	ListBuckets(ctx context.Context) ([]Bucket, error)
+	CreateBucket(ctx context.Context, bucket string) error
+	HeadBucket(ctx context.Context, bucket string) error
+
+	// ListObjects returns the objects of bucket whose keys start with
+	// prefix. Unless recursive, the objects below the next "/" after
+	// the prefix are returned as common prefixes (ending with "/")
+	ListObjects(ctx context.Context, bucket, prefix string, recursive bool) ([]Object, []string, error)
+	HeadObject(ctx context.Context, bucket, key string) (Object, error)
+	// GetObject writes the object content from offset to w, the
+	// caller stops reading once it has the length it needs
+	GetObject(ctx context.Context, bucket, key string, offset int64, w io.Writer) error
+	PutObject(ctx context.Context, bucket, key string, r io.Reader) error
+	// DeleteObject removes an object, missing objects aren't an error
+	DeleteObject(ctx context.Context, bucket, key string) error
+
+	CreateMultipartUpload(ctx context.Context, bucket, key string) (string, error)
+	// UploadPart stores a part and returns its quoted entity tag
+	UploadPart(ctx context.Context, bucket, key, uploadID string, number int, r io.Reader) (string, error)
+	CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []Part) error
+	AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error
+
+	// Close releases the uploads that weren't completed
+	Close() error
+}
+
+// ParseKeys parses the access keys, given as "access-key:secret-key" entries
+func ParseKeys(entries []string) (map[string]string, error) {
+	keys := map[string]string{}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		access, secret, ok := strings.Cut(e, ":")
+		if !ok || access == "" || secret == "" {
+			return nil, fmt.Errorf("invalid key %q, expected access-key:secret-key", e)
+		}
+		keys[access] = secret
+	}
+	return keys, nil
+}
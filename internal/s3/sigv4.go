@@ -0,0 +1,412 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm      = "AWS4-HMAC-SHA256"
+	chunkAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+	amzDateLayout  = "20060102T150405Z"
+	// maxSkew is how far the request time can be from the server one
+	maxSkew = 15 * time.Minute
+	// maxExpires is the longest validity of a presigned request (7 days)
+	maxExpires = 7 * 24 * 60 * 60
+
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingPayloadTrailer  = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	emptySHA256              = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// signature is a verified request signature
+type signature struct {
+	key   []byte
+	date  string
+	scope string
+	value string
+	// payload is the signed payload hash (x-amz-content-sha256)
+	payload string
+}
+
+// authenticate verifies the request signature, from the
+// Authorization header or the query (presigned requests)
+func (h *Handler) authenticate(r *http.Request) (*signature, error) {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return h.verifyHeader(r, auth)
+	}
+	if r.URL.Query().Has("X-Amz-Signature") {
+		return h.verifyQuery(r)
+	}
+	return nil, errAccessDenied
+}
+
+func (h *Handler) verifyHeader(r *http.Request, auth string) (*signature, error) {
+	rest, ok := strings.CutPrefix(auth, algorithm+" ")
+	if !ok {
+		return nil, errUnsupportedAuth
+	}
+	fields := map[string]string{}
+	for _, f := range strings.Split(rest, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(f), "=")
+		fields[k] = v
+	}
+	credential, signed, sig := fields["Credential"], fields["SignedHeaders"], fields["Signature"]
+	if credential == "" || signed == "" || sig == "" {
+		return nil, errAuthHeaderMalformed
+	}
+
+	date := r.Header.Get("X-Amz-Date")
+	if date == "" {
+		t, err := http.ParseTime(r.Header.Get("Date"))
+		if err != nil {
+			return nil, errMissingDate
+		}
+		date = t.UTC().Format(amzDateLayout)
+	}
+	t, err := time.Parse(amzDateLayout, date)
+	if err != nil {
+		return nil, errMissingDate
+	}
+	if d := time.Since(t); d > maxSkew || d < -maxSkew {
+		return nil, errTimeSkewed
+	}
+	payload := r.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		return nil, errMissingContentSHA256
+	}
+	return h.verify(r, credential, signed, sig, date, payload, "")
+}
+
+func (h *Handler) verifyQuery(r *http.Request) (*signature, error) {
+	q := r.URL.Query()
+	if q.Get("X-Amz-Algorithm") != algorithm {
+		return nil, errUnsupportedAuth
+	}
+	date := q.Get("X-Amz-Date")
+	t, err := time.Parse(amzDateLayout, date)
+	if err != nil {
+		return nil, errMissingDate
+	}
+	expires, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+	if err != nil || expires < 0 || expires > maxExpires {
+		return nil, errAuthQueryMalformed
+	}
+	if time.Until(t) > maxSkew {
+		return nil, errTimeSkewed
+	}
+	if time.Since(t) > time.Duration(expires)*time.Second {
+		return nil, errExpired
+	}
+	return h.verify(r, q.Get("X-Amz-Credential"), q.Get("X-Amz-SignedHeaders"), q.Get("X-Amz-Signature"), date, unsignedPayload, "X-Amz-Signature")
+}
+
+// verify compares the signature with the one computed from the
+// request, the excluded query parameter isn't signed
+func (h *Handler) verify(r *http.Request, credential, signedHeaders, sig, date, payload, exclude string) (*signature, error) {
+	// access-key/date/region/service/aws4_request
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return nil, errAuthHeaderMalformed
+	}
+	secret, ok := h.keys[parts[0]]
+	if !ok {
+		return nil, errInvalidAccessKeyID
+	}
+	if !strings.HasPrefix(date, parts[1]) {
+		return nil, errAuthHeaderMalformed
+	}
+	scope := strings.Join(parts[1:], "/")
+	// a signature without the host could be replayed on another endpoint
+	if !slices.Contains(strings.Split(signedHeaders, ";"), "host") {
+		return nil, errHostNotSigned
+	}
+
+	req := canonicalRequest(r, signedHeaders, payload, exclude)
+	toSign := strings.Join([]string{algorithm, date, scope, hexSHA256([]byte(req))}, "\n")
+	key := signingKey(secret, parts[1], parts[2], parts[3])
+	want := hex.EncodeToString(hmacSHA256(key, toSign))
+	if !hmac.Equal([]byte(want), []byte(sig)) {
+		return nil, errSignatureMismatch
+	}
+	return &signature{
+		key:     key,
+		date:    date,
+		scope:   scope,
+		value:   sig,
+		payload: payload,
+	}, nil
+}
+
+func canonicalRequest(r *http.Request, signedHeaders, payload, exclude string) string {
+	var headers strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		headers.WriteString(name + ":" + headerValue(r, name) + "\n")
+	}
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(r.URL.Query(), exclude),
+		headers.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+}
+
+// headerValue returns the canonical value of a signed header,
+// including the ones the HTTP server moves out of the headers
+func headerValue(r *http.Request, name string) string {
+	values := r.Header.Values(name)
+	switch {
+	case name == "host":
+		return r.Host
+	case name == "content-length" && len(values) == 0:
+		return strconv.FormatInt(r.ContentLength, 10)
+	case name == "transfer-encoding" && len(values) == 0:
+		return strings.Join(r.TransferEncoding, ",")
+	}
+	for i, v := range values {
+		values[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+func canonicalQuery(q url.Values, exclude string) string {
+	type pair struct{ k, v string }
+	var pairs []pair
+	for k, values := range q {
+		if k == exclude {
+			continue
+		}
+		for _, v := range values {
+			pairs = append(pairs, pair{uriEncode(k, true), uriEncode(v, true)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].k != pairs[j].k {
+			return pairs[i].k < pairs[j].k
+		}
+		return pairs[i].v < pairs[j].v
+	})
+	encoded := make([]string, len(pairs))
+	for i, p := range pairs {
+		encoded[i] = p.k + "=" + p.v
+	}
+	return strings.Join(encoded, "&")
+}
+
+// uriEncode percent encodes everything but the unreserved characters
+// (and the slashes unless encodeSlash), as the signature expects
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
+
+func signingKey(secret, date, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+func hexSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// body returns the request body, checked against the signed payload
+func (s *signature) body(r *http.Request) (io.Reader, error) {
+	switch s.payload {
+	case unsignedPayload:
+		return r.Body, nil
+	case streamingPayload, streamingPayloadTrailer:
+		return newChunkedReader(r.Body, s), nil
+	case streamingUnsignedTrailer:
+		return newChunkedReader(r.Body, nil), nil
+	}
+	want, err := hex.DecodeString(s.payload)
+	if err != nil || len(want) != sha256.Size {
+		return nil, errInvalidContentSHA256
+	}
+	return &checkedReader{r: r.Body, h: sha256.New(), want: want, mismatch: errContentSHA256Mismatch}, nil
+}
+
+// checkedReader hashes what it reads, it fails at the end
+// of the content when the hash isn't the expected one
+type checkedReader struct {
+	r        io.Reader
+	h        hash.Hash
+	want     []byte
+	mismatch error
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.h.Write(p[:n])
+	if errors.Is(err, io.EOF) && c.want != nil && !bytes.Equal(c.h.Sum(nil), c.want) {
+		return n, c.mismatch
+	}
+	return n, err
+}
+
+// chunkedReader decodes an aws-chunked body, verifying the
+// chunk signatures unless they're unsigned. The trailers
+// (like the checksums) are skipped.
+type chunkedReader struct {
+	r   *bufio.Reader
+	sig *signature
+	// prev is the previous chunk signature, the seed is the request one
+	prev    string
+	h       hash.Hash
+	chunk   string
+	left    int64
+	started bool
+	err     error
+}
+
+func newChunkedReader(r io.Reader, sig *signature) *chunkedReader {
+	c := &chunkedReader{
+		r:   bufio.NewReader(r),
+		sig: sig,
+		h:   sha256.New(),
+	}
+	if sig != nil {
+		c.prev = sig.value
+	}
+	return c
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.left == 0 {
+		if c.err = c.next(); c.err != nil {
+			return 0, c.err
+		}
+	}
+	n, err := c.r.Read(p[:min(int64(len(p)), c.left)])
+	c.h.Write(p[:n])
+	c.left -= int64(n)
+	if errors.Is(err, io.EOF) {
+		err = errIncompleteBody
+	}
+	c.err = err
+	return n, err
+}
+
+// next verifies the current chunk and reads the header of the next one,
+// it returns io.EOF after the final chunk and the trailers
+func (c *chunkedReader) next() error {
+	if c.started {
+		if line, err := c.line(); err != nil || line != "" {
+			return errIncompleteBody
+		}
+		if err := c.verify(); err != nil {
+			return err
+		}
+	}
+	c.started = true
+
+	line, err := c.line()
+	if err != nil {
+		return errIncompleteBody
+	}
+	head, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(head), 16, 64)
+	if err != nil || size < 0 {
+		return errIncompleteBody
+	}
+	if c.sig != nil {
+		chunk, ok := strings.CutPrefix(ext, "chunk-signature=")
+		if !ok {
+			return errSignatureMismatch
+		}
+		c.chunk = chunk
+	}
+	c.h.Reset()
+	c.left = size
+	if size > 0 {
+		return nil
+	}
+
+	if err := c.verify(); err != nil {
+		return err
+	}
+	for {
+		line, err := c.line()
+		if errors.Is(err, io.EOF) || line == "" && err == nil {
+			return io.EOF
+		}
+		if err != nil {
+			return errIncompleteBody
+		}
+	}
+}
+
+// verify checks the signature of the chunk read, chained to the previous one
+func (c *chunkedReader) verify() error {
+	if c.sig == nil {
+		return nil
+	}
+	toSign := strings.Join([]string{
+		chunkAlgorithm,
+		c.sig.date,
+		c.sig.scope,
+		c.prev,
+		emptySHA256,
+		hex.EncodeToString(c.h.Sum(nil)),
+	}, "\n")
+	want := hex.EncodeToString(hmacSHA256(c.sig.key, toSign))
+	if !hmac.Equal([]byte(want), []byte(c.chunk)) {
+		return errSignatureMismatch
+	}
+	c.prev = want
+	return nil
+}
+
+// line reads a CRLF terminated line, without the terminator
+func (c *chunkedReader) line() (string, error) {
+	b, err := c.r.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(b) == 0 {
+			return "", io.EOF
+		}
+		return "", errIncompleteBody
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
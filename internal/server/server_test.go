@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenAuthLoopbackHost(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		host  string
+		token string
+		want  int
+	}{
+		{"localhost:8080", "", http.StatusOK},
+		{"LOCALHOST", "", http.StatusOK},
+		{"app.localhost:8080", "", http.StatusOK},
+		{"127.0.0.1:8080", "", http.StatusOK},
+		{"127.0.0.2", "", http.StatusOK},
+		{"[::1]:8080", "", http.StatusOK},
+		{"::1", "", http.StatusOK},
+		{"evil.example.com:8080", "", http.StatusMisdirectedRequest},
+		{"localhost.example.com", "", http.StatusMisdirectedRequest},
+		{"192.168.1.10:8080", "", http.StatusMisdirectedRequest},
+		{"", "", http.StatusMisdirectedRequest},
+		// the token is checked instead of the host
+		{"evil.example.com:8080", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = tt.host
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		TokenAuth(tt.token, ok).ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("host %q, token %q: got status %d, want %d", tt.host, tt.token, w.Code, tt.want)
+		}
+	}
+}
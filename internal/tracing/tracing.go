@@ -0,0 +1,68 @@
+// Package tracing exports the OpenTelemetry spans of the
+// usecases and the requests they send
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"log/slog"
+	"strings"
+)
+
+// Options configures the export of the spans
+type Options struct {
+	// Endpoint is the OTLP/HTTP collector, as host:port or URL. The
+	// OTEL_EXPORTER_OTLP_* environment variables are used when it's empty.
+	Endpoint string
+	// Insecure sends the spans over plain HTTP
+	Insecure bool
+	// SampleRatio is the share of the traces kept, all of them when
+	// it's not between 0 and 1
+	SampleRatio float64
+	ServiceName string
+}
+
+// Start exports the spans to an OTLP collector, the
+// returned function flushes the pending ones and stops
+func Start(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	var eOpts []otlptracehttp.Option
+	switch {
+	case strings.Contains(opts.Endpoint, "://"):
+		eOpts = append(eOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+	case opts.Endpoint != "":
+		eOpts = append(eOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+	}
+	if opts.Insecure {
+		eOpts = append(eOpts, otlptracehttp.WithInsecure())
+	}
+	exp, err := otlptracehttp.New(ctx, eOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+	return Install(exp, opts), nil
+}
+
+// Install sets the global tracer provider, exporting the spans to exp
+// (an in-memory exporter for tests). The returned function flushes the
+// pending spans and stops.
+func Install(exp sdktrace.SpanExporter, opts Options) func(context.Context) error {
+	ratio := opts.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(opts.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.With("error", err).Warn("failed to export the spans")
+	}))
+	return tp.Shutdown
+}
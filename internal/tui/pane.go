@@ -0,0 +1,307 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	localPane = iota
+	remotePane
+)
+
+// entry is a row of a pane, a local file or a remote item
+type entry struct {
+	name     string
+	dir      bool
+	size     int64
+	modified time.Time
+	// parent is the ".." row
+	parent bool
+	// local is set for the local files
+	local os.FileInfo
+	// remote is set for the remote items
+	remote *usecase.FileEntry
+}
+
+// pane is one side of the browser, a local directory or a remote folder
+type pane struct {
+	kind int
+	// dir is the local directory, or the remote folder
+	// relative to the account root folder
+	dir     string
+	entries []entry
+	cursor  int
+	offset  int
+	// marked are the names of the marked entries
+	marked  map[string]bool
+	loading bool
+	err     error
+	// selectName is the entry the cursor is moved to once listed
+	selectName string
+}
+
+func newPane(kind int, dir string) *pane {
+	return &pane{
+		kind:   kind,
+		dir:    dir,
+		marked: map[string]bool{},
+	}
+}
+
+// title is the pane location shown above the entries
+func (p *pane) title() string {
+	if p.kind == localPane {
+		return "Local: " + p.dir
+	}
+	return "Remote: /" + p.dir
+}
+
+// path returns the path of the named entry, as expected by the session
+// for the remote items
+func (p *pane) path(name string) string {
+	if p.kind == localPane {
+		return filepath.Join(p.dir, name)
+	}
+	return "/" + path.Join(p.dir, name)
+}
+
+func (p *pane) current() (entry, bool) {
+	if p.cursor < 0 || p.cursor >= len(p.entries) {
+		return entry{}, false
+	}
+	return p.entries[p.cursor], true
+}
+
+// selection returns the marked entries or, when none
+// is marked, the entry under the cursor
+func (p *pane) selection() []entry {
+	var sel []entry
+	for _, e := range p.entries {
+		if p.marked[e.name] && !e.parent {
+			sel = append(sel, e)
+		}
+	}
+	if len(sel) > 0 {
+		return sel
+	}
+	if e, ok := p.current(); ok && !e.parent {
+		return []entry{e}
+	}
+	return nil
+}
+
+func (p *pane) toggleMark() {
+	e, ok := p.current()
+	if !ok || e.parent {
+		return
+	}
+	if p.marked[e.name] {
+		delete(p.marked, e.name)
+	} else {
+		p.marked[e.name] = true
+	}
+}
+
+// toggleAll marks every entry, or clears the marks when all are marked
+func (p *pane) toggleAll() {
+	all := true
+	for _, e := range p.entries {
+		if !e.parent && !p.marked[e.name] {
+			all = false
+			break
+		}
+	}
+	p.marked = map[string]bool{}
+	if all {
+		return
+	}
+	for _, e := range p.entries {
+		if !e.parent {
+			p.marked[e.name] = true
+		}
+	}
+}
+
+// move moves the cursor by delta rows, keeping it visible in height rows
+func (p *pane) move(delta, height int) {
+	p.cursor = max(min(p.cursor+delta, len(p.entries)-1), 0)
+	p.scroll(height)
+}
+
+func (p *pane) scroll(height int) {
+	height = max(height, 1)
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+height {
+		p.offset = p.cursor - height + 1
+	}
+	p.offset = max(min(p.offset, len(p.entries)-height), 0)
+}
+
+// chdir changes the pane folder, the entries are listed by the returned command
+func (p *pane) chdir(dir, selectName string, list func(*pane) tea.Cmd) tea.Cmd {
+	p.dir = dir
+	p.entries = nil
+	p.cursor, p.offset = 0, 0
+	p.marked = map[string]bool{}
+	p.selectName = selectName
+	return list(p)
+}
+
+// parentDir returns the parent folder and the name of the current one in it
+func (p *pane) parentDir() (string, string, bool) {
+	if p.kind == localPane {
+		parent := filepath.Dir(p.dir)
+		if parent == p.dir {
+			return "", "", false
+		}
+		return parent, filepath.Base(p.dir), true
+	}
+	if p.dir == "" {
+		return "", "", false
+	}
+	parent := path.Dir(p.dir)
+	if parent == "." {
+		parent = ""
+	}
+	return parent, path.Base(p.dir), true
+}
+
+// childDir returns the folder of the named entry
+func (p *pane) childDir(name string) string {
+	if p.kind == localPane {
+		return filepath.Join(p.dir, name)
+	}
+	return path.Join(p.dir, name)
+}
+
+// listed replaces the entries with a new listing of the pane folder,
+// keeping the marks and the cursor on the entries that still exist
+func (p *pane) listed(msg listedMsg, height int) {
+	p.loading = false
+	p.err = msg.err
+	if msg.err != nil {
+		return
+	}
+	selectName := p.selectName
+	if selectName == "" {
+		if e, ok := p.current(); ok {
+			selectName = e.name
+		}
+	}
+	p.selectName = ""
+
+	entries := msg.entries
+	if _, _, ok := p.parentDir(); ok {
+		entries = append([]entry{{name: "..", dir: true, parent: true}}, entries...)
+	}
+	p.entries = entries
+
+	marked := map[string]bool{}
+	p.cursor = min(p.cursor, max(len(entries)-1, 0))
+	for i, e := range entries {
+		if p.marked[e.name] {
+			marked[e.name] = true
+		}
+		if e.name == selectName {
+			p.cursor = i
+		}
+	}
+	p.marked = marked
+	p.scroll(height)
+}
+
+type listedMsg struct {
+	pane    int
+	dir     string
+	entries []entry
+	err     error
+}
+
+// listLocal lists the local directory, folders first
+func listLocal(dir string) tea.Cmd {
+	return func() tea.Msg {
+		des, err := os.ReadDir(dir)
+		if err != nil {
+			return listedMsg{pane: localPane, dir: dir, err: err}
+		}
+		entries := make([]entry, 0, len(des))
+		for _, de := range des {
+			info, err := de.Info()
+			if err != nil {
+				continue
+			}
+			entries = append(entries, entry{
+				name:     de.Name(),
+				dir:      info.IsDir(),
+				size:     info.Size(),
+				modified: info.ModTime(),
+				local:    info,
+			})
+		}
+		sortEntries(entries)
+		return listedMsg{pane: localPane, dir: dir, entries: entries}
+	}
+}
+
+// listRemote lists the remote folder, folders first
+func listRemote(ctx context.Context, s *usecase.ShellSession, dir string) tea.Cmd {
+	return func() tea.Msg {
+		items, err := s.List(ctx, "/"+dir)
+		if err != nil {
+			return listedMsg{pane: remotePane, dir: dir, err: err}
+		}
+		entries := make([]entry, 0, len(items))
+		for _, it := range items {
+			entries = append(entries, entry{
+				name:     it.Name,
+				dir:      it.IsFolder(),
+				size:     int64(it.Size),
+				modified: it.Modified,
+				remote:   &it,
+			})
+		}
+		sortEntries(entries)
+		return listedMsg{pane: remotePane, dir: dir, entries: entries}
+	}
+}
+
+func sortEntries(entries []entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].dir != entries[j].dir {
+			return entries[i].dir
+		}
+		return strings.ToLower(entries[i].name) < strings.ToLower(entries[j].name)
+	})
+}
+
+// describe returns a short description of the entries, for the prompts
+func describe(entries []entry) string {
+	if len(entries) == 1 {
+		if entries[0].dir {
+			return fmt.Sprintf("folder %q with its content", entries[0].name)
+		}
+		return fmt.Sprintf("%q", entries[0].name)
+	}
+	folders := 0
+	for _, e := range entries {
+		if e.dir {
+			folders++
+		}
+	}
+	if folders > 0 {
+		return fmt.Sprintf("%d items (%d folders with their content)", len(entries), folders)
+	}
+	return fmt.Sprintf("%d files", len(entries))
+}
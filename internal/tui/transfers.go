@@ -0,0 +1,168 @@
+package tui
+
+import (
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/progress"
+	"path"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	maxTransferLines = 4
+	barWidth         = 20
+)
+
+type (
+	transfersQueuedMsg struct {
+		count int
+		size  int64
+	}
+	transferStartedMsg struct {
+		name string
+		size int64
+	}
+	transferProgressMsg struct {
+		name     string
+		progress client.Progress
+	}
+	transferFinishedMsg struct {
+		name string
+		err  error
+	}
+)
+
+// observer forwards the transfers lifecycle to the program,
+// it's called from the transfer goroutines
+type observer struct {
+	send func(tea.Msg)
+}
+
+func (o *observer) TransfersQueued(count int, size int64) {
+	o.send(transfersQueuedMsg{count: count, size: size})
+}
+
+func (o *observer) TransferStarted(name string, size int64) {
+	o.send(transferStartedMsg{name: name, size: size})
+}
+
+func (o *observer) TransferProgress(name string, p client.Progress) {
+	o.send(transferProgressMsg{name: name, progress: p})
+}
+
+func (o *observer) TransferFinished(name string, err error) {
+	o.send(transferFinishedMsg{name: name, err: err})
+}
+
+type transfer struct {
+	name     string
+	progress client.Progress
+}
+
+// transfers is the state of the transfers panel
+type transfers struct {
+	active    []*transfer
+	count     int
+	finished  int
+	failed    int
+	total     int64
+	doneBytes int64
+}
+
+func (t *transfers) running() bool {
+	return t.finished < t.count
+}
+
+func (t *transfers) update(msg tea.Msg) {
+	switch msg := msg.(type) {
+	case transfersQueuedMsg:
+		t.count += msg.count
+		t.total += msg.size
+	case transferStartedMsg:
+		t.active = append(t.active, &transfer{
+			name:     msg.name,
+			progress: client.Progress{Total: msg.size},
+		})
+	case transferProgressMsg:
+		if tr := t.find(msg.name); tr != nil {
+			tr.progress = msg.progress
+		}
+	case transferFinishedMsg:
+		tr := t.find(msg.name)
+		if tr == nil {
+			return
+		}
+		for i, a := range t.active {
+			if a == tr {
+				t.active = append(t.active[:i], t.active[i+1:]...)
+				break
+			}
+		}
+		t.finished++
+		if msg.err != nil {
+			t.failed++
+			t.doneBytes += tr.progress.Done
+			return
+		}
+		t.doneBytes += max(tr.progress.Total, tr.progress.Done)
+	}
+}
+
+func (t *transfers) find(name string) *transfer {
+	for _, a := range t.active {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// height is how many lines the panel takes, nothing before the first transfer
+func (t *transfers) height() int {
+	if t.count == 0 {
+		return 0
+	}
+	return 1 + min(len(t.active), maxTransferLines)
+}
+
+func (t *transfers) view(width int) string {
+	if t.count == 0 {
+		return ""
+	}
+	done := t.doneBytes
+	for _, a := range t.active {
+		done += a.progress.Done
+	}
+	summary := fmt.Sprintf("Transfers: %d/%d done", t.finished, t.count)
+	if t.failed > 0 {
+		summary += fmt.Sprintf(", %d failed", t.failed)
+	}
+	summary += fmt.Sprintf(", %s of %s", progress.FormatBytes(done), progress.FormatBytes(t.total))
+	if hidden := len(t.active) - maxTransferLines; hidden > 0 {
+		summary += fmt.Sprintf(" (%d more running)", hidden)
+	}
+
+	lines := []string{titleStyle.Render(truncate(summary, width))}
+	for _, a := range t.active[:min(len(t.active), maxTransferLines)] {
+		lines = append(lines, truncate(transferLine(a, width), width))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// transferLine renders a transfer as "name [#####.....]  50% 1.2 MiB/s 00:05"
+func transferLine(t *transfer, width int) string {
+	p := t.progress
+	ratio := 0.0
+	if p.Total > 0 {
+		ratio = min(float64(p.Done)/float64(p.Total), 1)
+	}
+	filled := int(ratio * barWidth)
+	stats := fmt.Sprintf(" [%s%s] %3.0f%% %s/s", strings.Repeat("#", filled), strings.Repeat(".", barWidth-filled), ratio*100, progress.FormatBytes(int64(p.Rate)))
+	if p.ETA > 0 {
+		stats += " " + progress.FormatDuration(p.ETA)
+	}
+	nameWidth := max(width-len(stats)-2, 10)
+	return "  " + pad(truncate(path.Base(t.name), nameWidth), nameWidth) + stats
+}
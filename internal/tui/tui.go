@@ -0,0 +1,392 @@
+// Package tui is a full screen, two pane (local and remote),
+// file browser built on the shell session of an account
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/internal/usecase"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Run starts the browser on the account, picked from the stored
+// accounts when empty, and waits for the user to quit it
+func Run(ctx context.Context, u *usecase.ShellUseCase, account string, opts usecase.TransferOptions) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	m := &model{
+		ctx:      ctx,
+		cancel:   cancel,
+		u:        u,
+		opts:     opts,
+		observer: &observer{},
+		account:  account,
+		panes:    [2]*pane{newPane(localPane, wd), newPane(remotePane, "")},
+		focus:    remotePane,
+	}
+	if account == "" {
+		if m.accounts, err = u.Accounts(ctx); err != nil {
+			return err
+		}
+		if len(m.accounts) == 0 {
+			return errors.New("no stored accounts, add one with drive add")
+		}
+	}
+
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx))
+	m.observer.send = p.Send
+	_, err = p.Run()
+	if errors.Is(err, tea.ErrProgramKilled) && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+type model struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	u        *usecase.ShellUseCase
+	opts     usecase.TransferOptions
+	observer *observer
+
+	width  int
+	height int
+
+	// accounts are the stored accounts to pick from, before a session is open
+	accounts []string
+	picked   int
+	opening  bool
+
+	account   string
+	session   *usecase.ShellSession
+	panes     [2]*pane
+	focus     int
+	info      bool
+	transfers transfers
+	// confirm is the pending question, answered with y or n
+	confirm *confirmation
+	status  string
+	failed  bool
+}
+
+type confirmation struct {
+	prompt string
+	yes    func() tea.Cmd
+}
+
+type (
+	sessionMsg struct {
+		session *usecase.ShellSession
+		err     error
+	}
+	// batchDoneMsg is sent when a batch of transfers or deletions finishes
+	batchDoneMsg struct {
+		action string
+		count  int
+		err    error
+	}
+)
+
+func (m *model) Init() tea.Cmd {
+	if m.account == "" {
+		return nil
+	}
+	return m.open(m.account)
+}
+
+func (m *model) open(account string) tea.Cmd {
+	m.account = account
+	m.opening = true
+	m.setStatus(fmt.Sprintf("opening %s...", account), nil)
+	return func() tea.Msg {
+		s, err := m.u.Open(m.ctx, account, m.opts)
+		return sessionMsg{session: s, err: err}
+	}
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scrollPanes()
+		return m, nil
+
+	case sessionMsg:
+		m.opening = false
+		if msg.err != nil {
+			m.setStatus("", msg.err)
+			if len(m.accounts) == 0 {
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+		m.session = msg.session
+		m.setStatus("", nil)
+		return m, tea.Batch(m.list(m.panes[localPane]), m.list(m.panes[remotePane]))
+
+	case listedMsg:
+		p := m.panes[msg.pane]
+		if p.dir == msg.dir {
+			p.listed(msg, m.listHeight())
+		}
+		return m, nil
+
+	case transfersQueuedMsg, transferStartedMsg, transferProgressMsg, transferFinishedMsg:
+		m.transfers.update(msg)
+		m.scrollPanes()
+		return m, nil
+
+	case batchDoneMsg:
+		m.setStatus(fmt.Sprintf("%s %d items", msg.action, msg.count), msg.err)
+		return m, tea.Batch(m.list(m.panes[localPane]), m.list(m.panes[remotePane]))
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			m.cancel()
+			return m, tea.Quit
+		}
+		if m.confirm != nil {
+			c := m.confirm
+			m.confirm = nil
+			if msg.String() == "y" || msg.String() == "Y" {
+				return m, c.yes()
+			}
+			m.setStatus("cancelled", nil)
+			return m, nil
+		}
+		if m.session == nil {
+			return m, m.pickerKey(msg)
+		}
+		return m, m.browserKey(msg)
+	}
+	return m, nil
+}
+
+func (m *model) pickerKey(msg tea.KeyMsg) tea.Cmd {
+	if m.opening {
+		return nil
+	}
+	switch msg.String() {
+	case "up", "k":
+		m.picked = max(m.picked-1, 0)
+	case "down", "j":
+		m.picked = min(m.picked+1, len(m.accounts)-1)
+	case "enter":
+		return m.open(m.accounts[m.picked])
+	case "q", "esc":
+		return tea.Quit
+	}
+	return nil
+}
+
+func (m *model) browserKey(msg tea.KeyMsg) tea.Cmd {
+	p := m.panes[m.focus]
+	height := m.listHeight()
+	switch msg.String() {
+	case "q":
+		if m.transfers.running() {
+			m.confirm = &confirmation{
+				prompt: "Transfers are running, quit anyway?",
+				yes: func() tea.Cmd {
+					m.cancel()
+					return tea.Quit
+				},
+			}
+			return nil
+		}
+		return tea.Quit
+	case "tab":
+		m.focus = 1 - m.focus
+	case "up", "k":
+		p.move(-1, height)
+	case "down", "j":
+		p.move(1, height)
+	case "pgup":
+		p.move(-height, height)
+	case "pgdown":
+		p.move(height, height)
+	case "home", "g":
+		p.move(-len(p.entries), height)
+	case "end", "G":
+		p.move(len(p.entries), height)
+	case "enter", "right", "l":
+		e, ok := p.current()
+		if !ok || !e.dir {
+			return nil
+		}
+		if e.parent {
+			return m.up(p)
+		}
+		return p.chdir(p.childDir(e.name), "", m.list)
+	case "backspace", "left", "h":
+		return m.up(p)
+	case " ", "insert":
+		p.toggleMark()
+		p.move(1, height)
+	case "a":
+		p.toggleAll()
+	case "c", "f5":
+		return m.copySelection()
+	case "d", "delete", "f8":
+		m.deleteSelection()
+	case "r", "ctrl+r":
+		if p.kind == remotePane {
+			m.session.Refresh("/" + p.dir)
+		}
+		return m.list(p)
+	case "i":
+		m.info = !m.info
+	}
+	return nil
+}
+
+// up moves the pane to the parent folder, with the cursor on the current one
+func (m *model) up(p *pane) tea.Cmd {
+	parent, name, ok := p.parentDir()
+	if !ok {
+		return nil
+	}
+	return p.chdir(parent, name, m.list)
+}
+
+func (m *model) list(p *pane) tea.Cmd {
+	p.loading = true
+	if p.kind == localPane {
+		return listLocal(p.dir)
+	}
+	return listRemote(m.ctx, m.session, p.dir)
+}
+
+// copySelection uploads (from the local pane) or downloads (from
+// the remote pane) the selected files into the other pane folder
+func (m *model) copySelection() tea.Cmd {
+	src := m.panes[m.focus]
+	local, remote := m.panes[localPane], m.panes[remotePane]
+	var files []entry
+	skipped := 0
+	for _, e := range src.selection() {
+		if e.dir {
+			skipped++
+			continue
+		}
+		files = append(files, e)
+	}
+	if len(files) == 0 {
+		m.setStatus("nothing to transfer, folders are skipped (use upload, sync or restore for them)", nil)
+		return nil
+	}
+	if skipped > 0 {
+		m.setStatus(fmt.Sprintf("%d folders skipped, use upload, sync or restore for them", skipped), nil)
+	}
+	src.marked = map[string]bool{}
+
+	s, ctx, obs := m.session, m.ctx, m.observer
+	localDir, remoteDir := local.dir, "/"+remote.dir
+	upload := m.focus == localPane
+	action := "downloaded"
+	if upload {
+		action = "uploaded"
+	}
+	return m.batch(action, files, func(e entry) error {
+		if upload {
+			_, err := s.Put(ctx, filepath.Join(localDir, e.name), remoteDir, obs)
+			return err
+		}
+		_, err := s.Get(ctx, path.Join(remoteDir, e.name), localDir, obs)
+		return err
+	})
+}
+
+// deleteSelection asks to delete the selected entries of the focused pane
+func (m *model) deleteSelection() {
+	p := m.panes[m.focus]
+	sel := p.selection()
+	if len(sel) == 0 {
+		return
+	}
+	prompt := fmt.Sprintf("Delete local %s?", describe(sel))
+	if p.kind == remotePane {
+		prompt = fmt.Sprintf("Move remote %s to the recycle bin?", describe(sel))
+	}
+	m.confirm = &confirmation{
+		prompt: prompt,
+		yes: func() tea.Cmd {
+			p.marked = map[string]bool{}
+			s, ctx := m.session, m.ctx
+			paths := make(map[string]string, len(sel))
+			for _, e := range sel {
+				paths[e.name] = p.path(e.name)
+			}
+			if p.kind == remotePane {
+				return func() tea.Msg {
+					remote := make([]string, 0, len(sel))
+					for _, e := range sel {
+						remote = append(remote, paths[e.name])
+					}
+					count, err := s.RemoveAll(ctx, false, remote...)
+					return batchDoneMsg{action: "deleted", count: count, err: err}
+				}
+			}
+			return m.batch("deleted", sel, func(e entry) error {
+				return os.RemoveAll(paths[e.name])
+			})
+		},
+	}
+}
+
+// batch runs fn for each entry in background, at most
+// the session transfers at the same time
+func (m *model) batch(action string, entries []entry, fn func(entry) error) tea.Cmd {
+	workers := max(m.session.Transfers(), 1)
+	return func() tea.Msg {
+		var (
+			wg   sync.WaitGroup
+			mu   sync.Mutex
+			errs []error
+			sem  = make(chan struct{}, workers)
+		)
+		for _, e := range entries {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if err := fn(e); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		return batchDoneMsg{
+			action: action,
+			count:  len(entries) - len(errs),
+			err:    errors.Join(errs...),
+		}
+	}
+}
+
+func (m *model) setStatus(status string, err error) {
+	m.status, m.failed = status, err != nil
+	if err != nil {
+		m.status = err.Error()
+	}
+}
+
+func (m *model) scrollPanes() {
+	for _, p := range m.panes {
+		p.scroll(m.listHeight())
+	}
+}
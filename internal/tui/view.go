@@ -0,0 +1,218 @@
+package tui
+
+import (
+	"fmt"
+	"github.com/eldius/onedrive-client/internal/progress"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+const (
+	infoWidth  = 42
+	timeLayout = "2006-01-02 15:04"
+	helpLine   = "tab switch  enter open  bksp up  space mark  a mark all  c copy  d delete  r refresh  i info  q quit"
+)
+
+var (
+	titleStyle   = lipgloss.NewStyle().Bold(true)
+	headerStyle  = lipgloss.NewStyle().Bold(true).Reverse(true)
+	paneStyle    = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8"))
+	focusedStyle = paneStyle.BorderForeground(lipgloss.Color("12"))
+	cursorStyle  = lipgloss.NewStyle().Reverse(true)
+	markedStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	dirStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("12"))
+	faintStyle   = lipgloss.NewStyle().Faint(true)
+	errorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	promptStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("11"))
+)
+
+func (m *model) View() string {
+	if m.width == 0 {
+		return ""
+	}
+	if m.session == nil {
+		return m.pickerView()
+	}
+
+	paneWidth := m.width / 2
+	var info string
+	if m.info {
+		paneWidth = (m.width - infoWidth) / 2
+		info = m.infoView(m.height - m.transfers.height() - 2)
+	}
+	local := m.paneView(m.panes[localPane], paneWidth, m.focus == localPane)
+	remote := m.paneView(m.panes[remotePane], m.width-paneWidth-lipgloss.Width(info), m.focus == remotePane)
+
+	rows := []string{
+		headerStyle.Render(pad(truncate(" onedrive - "+m.account, m.width), m.width)),
+		lipgloss.JoinHorizontal(lipgloss.Top, local, remote, info),
+	}
+	if t := m.transfers.view(m.width); t != "" {
+		rows = append(rows, t)
+	}
+	rows = append(rows, m.statusView())
+	return strings.Join(rows, "\n")
+}
+
+// listHeight is how many entries fit in a pane
+func (m *model) listHeight() int {
+	// header, status, borders and pane title
+	return max(m.height-m.transfers.height()-5, 1)
+}
+
+func (m *model) pickerView() string {
+	lines := []string{headerStyle.Render(pad(" onedrive - pick an account", m.width)), ""}
+	for i, acc := range m.accounts {
+		line := "  " + acc
+		if i == m.picked {
+			line = cursorStyle.Render(pad(line, min(m.width, 40)))
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", m.statusView())
+	return strings.Join(lines, "\n")
+}
+
+func (m *model) statusView() string {
+	switch {
+	case m.confirm != nil:
+		return promptStyle.Render(truncate(m.confirm.prompt+" (y/N)", m.width))
+	case m.failed:
+		return errorStyle.Render(truncate(m.status, m.width))
+	case m.status != "":
+		return truncate(m.status, m.width)
+	}
+	if m.session == nil {
+		return faintStyle.Render(truncate("enter open  q quit", m.width))
+	}
+	return faintStyle.Render(truncate(helpLine, m.width))
+}
+
+func (m *model) paneView(p *pane, width int, focused bool) string {
+	inner := max(width-2, 10)
+	height := m.listHeight()
+
+	lines := []string{titleStyle.Render(truncate(p.title(), inner))}
+	switch {
+	case p.err != nil:
+		lines = append(lines, errorStyle.Render(truncate(p.err.Error(), inner)))
+	case p.loading && len(p.entries) == 0:
+		lines = append(lines, faintStyle.Render("loading..."))
+	}
+	if p.err == nil {
+		end := min(p.offset+height, len(p.entries))
+		for i := p.offset; i < end; i++ {
+			lines = append(lines, entryLine(p, i, inner, focused))
+		}
+	}
+	for len(lines) < height+1 {
+		lines = append(lines, "")
+	}
+
+	style := paneStyle
+	if focused {
+		style = focusedStyle
+	}
+	return style.Width(inner).Render(strings.Join(lines, "\n"))
+}
+
+// entryLine renders an entry as "* name    size"
+func entryLine(p *pane, i, width int, focused bool) string {
+	e := p.entries[i]
+	mark := " "
+	if p.marked[e.name] {
+		mark = "*"
+	}
+	name := e.name
+	size := ""
+	if e.dir {
+		name += "/"
+	} else {
+		size = progress.FormatBytes(e.size)
+	}
+	nameWidth := max(width-len(size)-3, 1)
+	line := mark + " " + pad(truncate(name, nameWidth), nameWidth) + " " + size
+
+	switch {
+	case i == p.cursor && focused:
+		return cursorStyle.Render(line)
+	case i == p.cursor:
+		return lipgloss.NewStyle().Underline(true).Render(line)
+	case p.marked[e.name]:
+		return markedStyle.Render(line)
+	case e.dir:
+		return dirStyle.Render(line)
+	}
+	return line
+}
+
+// infoView renders the metadata of the entry under the cursor
+func (m *model) infoView(height int) string {
+	inner := infoWidth - 2
+	lines := []string{titleStyle.Render("Info")}
+	p := m.panes[m.focus]
+	if e, ok := p.current(); ok && !e.parent {
+		for _, f := range entryFields(p, e) {
+			if f[1] == "" {
+				continue
+			}
+			lines = append(lines, faintStyle.Render(f[0]))
+			lines = append(lines, "  "+truncate(f[1], inner-2))
+		}
+	}
+	lines = lines[:min(len(lines), max(height-2, 1))]
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+	return paneStyle.Width(inner).Render(strings.Join(lines, "\n"))
+}
+
+// entryFields are the metadata shown for the entry, as label and value pairs
+func entryFields(p *pane, e entry) [][2]string {
+	kind := "file"
+	if e.dir {
+		kind = "folder"
+	}
+	fields := [][2]string{
+		{"Name", e.name},
+		{"Path", p.path(e.name)},
+		{"Type", kind},
+		{"Modified", e.modified.Local().Format(timeLayout)},
+	}
+	if !e.dir {
+		fields = append(fields, [2]string{"Size", fmt.Sprintf("%s (%d bytes)", progress.FormatBytes(e.size), e.size)})
+	}
+	if e.local != nil {
+		return append(fields, [2]string{"Mode", e.local.Mode().String()})
+	}
+
+	r := e.remote
+	if r.IsFolder() {
+		fields = append(fields,
+			[2]string{"Size", progress.FormatBytes(int64(r.Size))},
+			[2]string{"Children", fmt.Sprint(r.Folder.ChildCount)},
+		)
+	} else {
+		fields = append(fields, [2]string{"Mime type", r.GetMimeType()})
+	}
+	return append(fields,
+		[2]string{"Created", r.FileSystemInfo.CreatedDateTime.Local().Format(timeLayout)},
+		[2]string{"ID", r.ID},
+		[2]string{"eTag", r.ETag},
+		[2]string{"Hash", r.File.Hashes.QuickXorHash},
+		[2]string{"Shared", r.Shared.Scope},
+		[2]string{"Web URL", r.WebURL},
+	)
+}
+
+// truncate cuts s to width cells, with an ellipsis
+func truncate(s string, width int) string {
+	return ansi.Truncate(s, width, "…")
+}
+
+// pad fills s with spaces up to width cells
+func pad(s string, width int) string {
+	return s + strings.Repeat(" ", max(width-lipgloss.Width(s), 0))
+}
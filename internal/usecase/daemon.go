@@ -0,0 +1,313 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/lock"
+	"github.com/eldius/onedrive-client/internal/model"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"github.com/robfig/cron/v3"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	JobRunning     = "running"
+	JobSucceeded   = "succeeded"
+	JobFailed      = "failed"
+	JobInterrupted = "interrupted"
+)
+
+// DaemonOptions configures the daemon
+type DaemonOptions struct {
+	// LockFile is held while the daemon runs, so only one runs at once
+	LockFile string
+	// ShutdownTimeout is how long the running jobs are given to
+	// finish on shutdown before they're interrupted
+	ShutdownTimeout time.Duration
+	Transfer        TransferOptions
+}
+
+// withDefaults fills the unset options with the configured values
+func (o DaemonOptions) withDefaults() DaemonOptions {
+	if o.LockFile == "" {
+		o.LockFile = configs.GetDaemonLockFile()
+	}
+	if o.ShutdownTimeout <= 0 {
+		o.ShutdownTimeout = configs.GetDaemonShutdownTimeout()
+	}
+	if o.ShutdownTimeout <= 0 {
+		o.ShutdownTimeout = configs.DefaultDaemonShutdownTimeout
+	}
+	return o
+}
+
+type DaemonUseCase struct {
+	up *FileUploadUseCase
+	jr *persistence.JobRunRepository
+}
+
+func newDaemonUseCase(up *FileUploadUseCase, jr *persistence.JobRunRepository) *DaemonUseCase {
+	return &DaemonUseCase{
+		up: up,
+		jr: jr,
+	}
+}
+
+// Runs returns the latest job runs, newest first
+func (u *DaemonUseCase) Runs(ctx context.Context, limit int) ([]model.JobRun, error) {
+	return u.jr.FindLatest(ctx, limit)
+}
+
+// Daemon runs the backup jobs, on their schedule (Schedule and Run)
+// or once (RunOnce)
+type Daemon struct {
+	u    *DaemonUseCase
+	opts DaemonOptions
+	lock *lock.File
+
+	// jobsCtx is the context of the job runs, it's only
+	// canceled once the shutdown timeout is over
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
+	wg         sync.WaitGroup
+
+	mu       sync.Mutex
+	cron     *cron.Cron
+	running  map[string]bool
+	stopping bool
+}
+
+// Start acquires the daemon lock file, it fails with lock.ErrLocked when
+// another daemon holds it. The runs left running by a daemon that didn't
+// stop cleanly are recorded as interrupted.
+func (u *DaemonUseCase) Start(ctx context.Context, opts DaemonOptions) (*Daemon, error) {
+	opts = opts.withDefaults()
+	l, err := lock.Acquire(opts.LockFile)
+	if err != nil {
+		return nil, err
+	}
+	runs, err := u.jr.UpdateStatus(ctx, JobRunning, JobInterrupted, time.Now())
+	if err != nil {
+		_ = l.Release()
+		return nil, err
+	}
+	for _, r := range runs {
+		slog.With("job", r.Job, "started", r.StartedAt).WarnContext(ctx, "job run left unfinished by a previous daemon recorded as interrupted")
+	}
+
+	jobsCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	return &Daemon{
+		u:          u,
+		opts:       opts,
+		lock:       l,
+		jobsCtx:    jobsCtx,
+		cancelJobs: cancel,
+		running:    map[string]bool{},
+	}, nil
+}
+
+// Schedule replaces the scheduled jobs, the running ones keep running.
+// The schedule is kept unchanged when a job is invalid.
+func (d *Daemon) Schedule(jobs []configs.Job) error {
+	schedules, err := parseJobs(jobs)
+	if err != nil {
+		return err
+	}
+	c := cron.New()
+	for i, job := range jobs {
+		c.Schedule(schedules[i], cron.FuncJob(func() {
+			d.start(job)
+		}))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopping {
+		return errors.New("the daemon is stopping")
+	}
+	if d.cron != nil {
+		d.cron.Stop()
+	}
+	d.cron = c
+	c.Start()
+	for i, job := range jobs {
+		slog.With("job", job.Name, "schedule", job.Schedule, "next", schedules[i].Next(time.Now())).Info("job scheduled")
+	}
+	return nil
+}
+
+// Run runs the scheduled jobs until ctx is done, then it stops
+// (see Stop)
+func (d *Daemon) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return d.Stop()
+}
+
+// RunOnce runs the jobs with the given names (all of them when names is
+// empty) one after the other, then it stops. When ctx is done the
+// running job is given the shutdown timeout to finish, the others
+// aren't run.
+func (d *Daemon) RunOnce(ctx context.Context, jobs []configs.Job, names ...string) error {
+	if _, err := parseJobs(jobs); err != nil {
+		_ = d.Stop()
+		return err
+	}
+	if len(names) > 0 {
+		selected := make([]configs.Job, 0, len(names))
+		for _, name := range names {
+			i := slices.IndexFunc(jobs, func(j configs.Job) bool { return j.Name == name })
+			if i < 0 {
+				_ = d.Stop()
+				return fmt.Errorf("unknown job %q", name)
+			}
+			selected = append(selected, jobs[i])
+		}
+		jobs = selected
+	}
+
+	done := make(chan error, 1)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		var errs []error
+		for _, job := range jobs {
+			if ctx.Err() != nil {
+				break
+			}
+			if err := d.run(job); err != nil {
+				errs = append(errs, fmt.Errorf("job %s: %w", job.Name, err))
+			}
+		}
+		done <- errors.Join(errs...)
+	}()
+
+	select {
+	case err := <-done:
+		return errors.Join(err, d.Stop())
+	case <-ctx.Done():
+		stopErr := d.Stop()
+		return errors.Join(<-done, stopErr)
+	}
+}
+
+// Stop stops scheduling the jobs and waits for the running ones to
+// finish, they're interrupted once the shutdown timeout is over. The
+// lock file is released.
+func (d *Daemon) Stop() error {
+	d.mu.Lock()
+	d.stopping = true
+	if d.cron != nil {
+		d.cron.Stop()
+	}
+	d.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(d.opts.ShutdownTimeout):
+		slog.With("timeout", d.opts.ShutdownTimeout).Warn("interrupting the running jobs")
+		d.cancelJobs()
+		<-finished
+	}
+	d.cancelJobs()
+	return d.lock.Release()
+}
+
+// start runs the job in the background, unless it's still running
+func (d *Daemon) start(job configs.Job) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopping {
+		return
+	}
+	if d.running[job.Name] {
+		slog.With("job", job.Name).Warn("job still running, run skipped")
+		return
+	}
+	d.running[job.Name] = true
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		_ = d.run(job)
+		d.mu.Lock()
+		delete(d.running, job.Name)
+		d.mu.Unlock()
+	}()
+}
+
+// run runs the job and records the run
+func (d *Daemon) run(job configs.Job) error {
+	// the run is recorded even when the jobs are interrupted
+	recordCtx := context.WithoutCancel(d.jobsCtx)
+	run := &model.JobRun{
+		Job:       job.Name,
+		Account:   job.Account,
+		StartedAt: time.Now(),
+		Status:    JobRunning,
+	}
+	if err := d.u.jr.Persist(recordCtx, run); err != nil {
+		return err
+	}
+	log := slog.With("job", job.Name, "run", run.ID)
+	log.Info("job started")
+
+	ctx, span := startSpan(d.jobsCtx, "DaemonJob", jobKey.String(job.Name), accountKey.String(job.Account))
+	err := d.u.up.Sync(ctx, job.Account, []string{job.Local}, job.Remote, WatchOptions{
+		Transfer: d.opts.Transfer,
+		Conflict: job.Conflict,
+	})
+	endSpan(span, err)
+	run.FinishedAt = time.Now()
+	switch {
+	case d.jobsCtx.Err() != nil:
+		run.Status = JobInterrupted
+		err = errors.New("interrupted")
+		log.Warn("job interrupted")
+	case err != nil:
+		run.Status = JobFailed
+		log.With("error", err).Error("job failed")
+	default:
+		run.Status = JobSucceeded
+		log.With("duration", run.FinishedAt.Sub(run.StartedAt)).Info("job finished")
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if pErr := d.u.jr.Persist(recordCtx, run); pErr != nil {
+		return errors.Join(err, pErr)
+	}
+	return err
+}
+
+// parseJobs checks the jobs and returns their schedules
+func parseJobs(jobs []configs.Job) ([]cron.Schedule, error) {
+	schedules := make([]cron.Schedule, len(jobs))
+	names := make(map[string]bool, len(jobs))
+	for i, job := range jobs {
+		if job.Name == "" {
+			return nil, fmt.Errorf("job %d has no name", i+1)
+		}
+		if names[job.Name] {
+			return nil, fmt.Errorf("duplicated job %q", job.Name)
+		}
+		names[job.Name] = true
+		if job.Account == "" || job.Local == "" {
+			return nil, fmt.Errorf("job %q needs an account and a local directory", job.Name)
+		}
+		s, err := cron.ParseStandard(job.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %q schedule: %w", job.Name, err)
+		}
+		schedules[i] = s
+	}
+	return schedules, nil
+}
@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"context"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/model"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"time"
+)
+
+// AccountStatus is the state of a stored account
+type AccountStatus struct {
+	Name       string `json:"name"`
+	DriveID    string `json:"driveId"`
+	RootFolder string `json:"rootFolder"`
+	RootItemID string `json:"rootItemId"`
+	Scopes     string `json:"scopes"`
+	// TokenExpiresAt is when the stored access token expires, the
+	// clients refresh it (without storing it) once it expired
+	TokenExpiresAt time.Time    `json:"tokenExpiresAt"`
+	TokenExpired   bool         `json:"tokenExpired"`
+	Encrypted      bool         `json:"encrypted"`
+	DriveType      string       `json:"driveType,omitempty"`
+	Quota          *types.Quota `json:"quota,omitempty"`
+	// Error is why the drive couldn't be reached
+	Error string `json:"error,omitempty"`
+}
+
+type DashboardUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+	jr *persistence.JobRunRepository
+}
+
+func newDashboardUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository, jr *persistence.JobRunRepository) *DashboardUseCase {
+	return &DashboardUseCase{
+		r:  r,
+		er: er,
+		jr: jr,
+	}
+}
+
+// Names returns the names of the stored accounts, sorted
+func (u *DashboardUseCase) Names(ctx context.Context) ([]string, error) {
+	return u.r.FindAllNames(ctx)
+}
+
+// Accounts returns the state of the stored accounts, sorted by name.
+// The drive of every account is fetched for its quota.
+func (u *DashboardUseCase) Accounts(ctx context.Context) ([]AccountStatus, error) {
+	names, err := u.r.FindAllNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]AccountStatus, 0, len(names))
+	for _, name := range names {
+		s, err := u.Account(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *s)
+	}
+	return accounts, nil
+}
+
+// Account returns the state of the account
+func (u *DashboardUseCase) Account(ctx context.Context, accName string) (*AccountStatus, error) {
+	acc, err := loadSession(ctx, u.r, accName)
+	if err != nil {
+		return nil, err
+	}
+	s := &AccountStatus{
+		Name:           acc.Name,
+		DriveID:        acc.Drive.DriveID,
+		RootFolder:     acc.Drive.RootFolder,
+		RootItemID:     acc.Drive.ItemID,
+		Scopes:         acc.AuthData.Scope,
+		TokenExpiresAt: tokenExpiry(acc),
+	}
+	s.TokenExpired = time.Now().After(s.TokenExpiresAt)
+
+	cfg, err := u.er.FindByAccountID(ctx, acc.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.Encrypted = cfg != nil && cfg.Enabled
+
+	drive, err := newAccountClient(u.r, acc).GetDrive(ctx, acc.Drive.DriveID)
+	if err != nil {
+		s.Error = err.Error()
+		return s, nil
+	}
+	s.DriveType, s.Quota = drive.DriveType, drive.Quota
+	return s, nil
+}
+
+// Files lists the account root folder
+func (u *DashboardUseCase) Files(ctx context.Context, accName string) ([]FileEntry, error) {
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, "")
+	if err != nil {
+		return nil, err
+	}
+	return f.children(ctx, f.item.ID, "")
+}
+
+// Errors returns the latest failed requests
+// of the clients, newest first
+func (u *DashboardUseCase) Errors() []client.ErrorRecord {
+	return client.DefaultErrorLog.Records()
+}
+
+// Runs returns the latest daemon job runs, newest first
+func (u *DashboardUseCase) Runs(ctx context.Context, limit int) ([]model.JobRun, error) {
+	return u.jr.FindLatest(ctx, limit)
+}
+
+// tokenExpiry is when the stored access token expires, the tokens stored
+// before their update time was kept are dated by the account
+func tokenExpiry(acc *model.OnedriveAccount) time.Time {
+	stored := acc.AuthData.UpdatedAt
+	if stored.IsZero() {
+		stored = acc.UpdatedAt
+	}
+	return stored.Add(time.Duration(acc.AuthData.ExpiresIn) * time.Second)
+}
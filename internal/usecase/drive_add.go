@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
 	"github.com/eldius/onedrive-client/internal/model"
 	"github.com/eldius/onedrive-client/internal/persistence"
+	"log/slog"
 	"os"
+	"time"
 )
 
 type DriveAddUseUseCase struct {
@@ -22,23 +25,13 @@ func newDriveAddUseCase(c client.Client, r *persistence.AuthRepository) *DriveAd
 }
 
 // DriveAdd adds a new drive configuration
-func (u *DriveAddUseUseCase) DriveAdd(ctx context.Context, name string) error {
-	auth, err := u.c.Authenticate(ctx)
-	if err != nil {
-		return fmt.Errorf("DriveAdd: authenticate: %w", err)
-	}
+func (u *DriveAddUseUseCase) DriveAdd(ctx context.Context, name string) (err error) {
+	ctx, span := startSpan(ctx, "DriveAdd", accountKey.String(name))
+	defer func() { endSpan(span, err) }()
 
-	fmt.Printf("Auth Token: %s\n", auth.AccessToken)
-
-	user, err := u.c.AuthenticatedUser(ctx)
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("user: %+v\n", user)
-
-	appDrive, err := u.c.GetAppDriveInfo(ctx)
+	auth, appDrive, err := u.authenticate(ctx)
 	if err != nil {
-		return fmt.Errorf("DriveAdd: get app drive info: %w", err)
+		return err
 	}
 
 	account := &model.OnedriveAccount{
@@ -68,3 +61,61 @@ func (u *DriveAddUseUseCase) DriveAdd(ctx context.Context, name string) error {
 
 	return u.r.Persist(ctx, account)
 }
+
+// PlanDriveAdd authenticates and shows the folders DriveAdd
+// would create, without persisting the account
+func (u *DriveAddUseUseCase) PlanDriveAdd(ctx context.Context, name string) (_ *Plan, err error) {
+	ctx, span := startSpan(ctx, "PlanDriveAdd", accountKey.String(name))
+	defer func() { endSpan(span, err) }()
+
+	_, appDrive, err := u.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := u.c.ListFiles(ctx, appDrive.ParentReference.DriveID, appDrive.ID, client.WithSelect("id", "name", "eTag"))
+	if err != nil {
+		return nil, fmt.Errorf("PlanDriveAdd: list app folder: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	op := Operation{
+		Type:     OperationMkdir,
+		Path:     hostname,
+		IsFolder: true,
+		Reason:   "account root folder not present in the app folder",
+		ParentID: appDrive.ID,
+	}
+	if remote, ok := childrenByName(children.Value)[nameKey(hostname)]; ok {
+		op.Type = OperationRenameForConflict
+		op.Reason = "an item with the same name exists in the app folder, the root folder is created with a new name"
+		op.RemoteID = remote.ID
+		op.RemoteETag = remote.ETag
+	}
+
+	p := &Plan{
+		Account:   name,
+		CreatedAt: time.Now(),
+	}
+	p.add(op)
+	return p, nil
+}
+
+func (u *DriveAddUseUseCase) authenticate(ctx context.Context) (*types.TokenData, *types.AppFolderInfo, error) {
+	auth, err := u.c.Authenticate(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("DriveAdd: authenticate: %w", err)
+	}
+
+	user, err := u.c.AuthenticatedUser(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("DriveAdd: get authenticated user: %w", err)
+	}
+	slog.DebugContext(ctx, "authenticated", slog.String("user", user.DisplayName))
+
+	appDrive, err := u.c.GetAppDriveInfo(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("DriveAdd: get app drive info: %w", err)
+	}
+	return auth, appDrive, nil
+}
@@ -0,0 +1,456 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/encryption"
+	"github.com/eldius/onedrive-client/internal/model"
+	"github.com/eldius/onedrive-client/internal/persistence"
+)
+
+const (
+	KeySourcePassphrase = "passphrase"
+	KeySourceMasterKey  = "master-key"
+
+	// keyringFileName is the copy of the account keys kept in the app
+	// folder, next to the account root folder (its name is the %s) and
+	// out of the files tree. The data keys in it are wrapped by the master
+	// key so they can be recovered when the local database is lost.
+	keyringFileName = ".onedrive-client-keyring-%s.json"
+)
+
+// EncryptionSecret is what the master key is obtained from,
+// a raw master key takes precedence over a passphrase
+type EncryptionSecret struct {
+	Passphrase string
+	// MasterKey is a base64 encoded 32 bytes key
+	MasterKey string
+}
+
+// ConfiguredEncryptionSecret returns the secret set in the
+// config file or in the environment
+func ConfiguredEncryptionSecret() EncryptionSecret {
+	return EncryptionSecret{
+		Passphrase: configs.GetEncryptionPassphrase(),
+		MasterKey:  configs.GetEncryptionMasterKey(),
+	}
+}
+
+// setup sets the key source (and KDF parameters) for the secret
+func (s EncryptionSecret) setup(cfg *model.EncryptionConfig) error {
+	switch {
+	case s.MasterKey != "":
+		if _, err := encryption.ParseMasterKey(s.MasterKey); err != nil {
+			return err
+		}
+		cfg.KeySource = KeySourceMasterKey
+		cfg.KDFSalt = nil
+	case s.Passphrase != "":
+		p, err := encryption.NewKDFParams()
+		if err != nil {
+			return err
+		}
+		cfg.KeySource = KeySourcePassphrase
+		cfg.KDFSalt = p.Salt
+		cfg.KDFTime = p.Time
+		cfg.KDFMemory = p.Memory
+		cfg.KDFThreads = p.Threads
+	default:
+		return errors.New("no encryption secret, set a passphrase or a master key")
+	}
+	return nil
+}
+
+func (s EncryptionSecret) masterKey(cfg *model.EncryptionConfig) ([]byte, error) {
+	switch cfg.KeySource {
+	case KeySourceMasterKey:
+		if s.MasterKey == "" {
+			return nil, fmt.Errorf("account encryption uses a master key, set %s or %s", configs.EncryptionMasterKeyKey, configs.EncryptionMasterKeyEnv)
+		}
+		return encryption.ParseMasterKey(s.MasterKey)
+	case KeySourcePassphrase:
+		if s.Passphrase == "" {
+			return nil, fmt.Errorf("account encryption uses a passphrase, set %s or %s", configs.EncryptionPassphraseKey, configs.EncryptionPassphraseEnv)
+		}
+		return encryption.DeriveMasterKey(s.Passphrase, encryption.KDFParams{
+			Salt:    cfg.KDFSalt,
+			Time:    cfg.KDFTime,
+			Memory:  cfg.KDFMemory,
+			Threads: cfg.KDFThreads,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown encryption key source %q", cfg.KeySource)
+	}
+}
+
+// EncryptionStatus describes the account encryption setup
+type EncryptionStatus struct {
+	Enabled      bool   `json:"enabled"`
+	EncryptNames bool   `json:"encrypt_names"`
+	KeySource    string `json:"key_source,omitempty"`
+	ActiveKey    uint32 `json:"active_key,omitempty"`
+	Keys         int    `json:"keys"`
+}
+
+type EncryptionUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+}
+
+func newEncryptionUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *EncryptionUseCase {
+	return &EncryptionUseCase{
+		r:  r,
+		er: er,
+	}
+}
+
+// Enable turns on the encryption of new uploads, creating the first data
+// key when the account has none. The keys stored in the drive by another
+// setup of the account are reused instead of creating new ones.
+func (u *EncryptionUseCase) Enable(ctx context.Context, accName string, encryptNames bool) error {
+	acc, err := loadSession(ctx, u.r, accName)
+	if err != nil {
+		return err
+	}
+	cfg, err := u.er.FindByAccountID(ctx, acc.ID)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		if cfg, err = fetchKeyring(ctx, newAccountClient(u.r, acc), acc); err != nil {
+			return err
+		}
+	}
+	secret := ConfiguredEncryptionSecret()
+
+	if cfg != nil {
+		if cfg.Enabled && cfg.ID != "" {
+			return fmt.Errorf("encryption is already enabled for account %q", accName)
+		}
+		if _, err := unwrapKeys(cfg, secret); err != nil {
+			return err
+		}
+		cfg.Enabled = true
+		cfg.EncryptNames = encryptNames
+		return u.save(ctx, acc, cfg)
+	}
+
+	cfg = &model.EncryptionConfig{
+		AccountID:    acc.ID,
+		Enabled:      true,
+		EncryptNames: encryptNames,
+	}
+	if err := secret.setup(cfg); err != nil {
+		return err
+	}
+	mk, err := secret.masterKey(cfg)
+	if err != nil {
+		return err
+	}
+	if err := addDataKey(cfg, mk); err != nil {
+		return err
+	}
+	return u.save(ctx, acc, cfg)
+}
+
+// Disable stops encrypting new uploads, the keys are
+// kept so encrypted files can still be downloaded
+func (u *EncryptionUseCase) Disable(ctx context.Context, accName string) error {
+	acc, cfg, err := u.config(ctx, accName)
+	if err != nil {
+		return err
+	}
+	cfg.Enabled = false
+	return u.save(ctx, acc, cfg)
+}
+
+// RotateMasterKey rewraps the data keys with a new master
+// key (or passphrase), the uploaded files are untouched
+func (u *EncryptionUseCase) RotateMasterKey(ctx context.Context, accName string, newSecret EncryptionSecret) error {
+	acc, cfg, err := u.config(ctx, accName)
+	if err != nil {
+		return err
+	}
+	keys, err := unwrapKeys(cfg, ConfiguredEncryptionSecret())
+	if err != nil {
+		return err
+	}
+
+	if err := newSecret.setup(cfg); err != nil {
+		return err
+	}
+	mk, err := newSecret.masterKey(cfg)
+	if err != nil {
+		return err
+	}
+	for i := range cfg.Keys {
+		k := &cfg.Keys[i]
+		if k.WrappedKey, err = encryption.WrapKey(mk, keys[k.Version]); err != nil {
+			return fmt.Errorf("wrap data key %d: %w", k.Version, err)
+		}
+	}
+	return u.save(ctx, acc, cfg)
+}
+
+// RotateDataKey creates a new data key for the next uploads,
+// the previous keys are kept to decrypt the existing files
+func (u *EncryptionUseCase) RotateDataKey(ctx context.Context, accName string) error {
+	acc, cfg, err := u.config(ctx, accName)
+	if err != nil {
+		return err
+	}
+	secret := ConfiguredEncryptionSecret()
+	if _, err := unwrapKeys(cfg, secret); err != nil {
+		return err
+	}
+	mk, err := secret.masterKey(cfg)
+	if err != nil {
+		return err
+	}
+	if err := addDataKey(cfg, mk); err != nil {
+		return err
+	}
+	return u.save(ctx, acc, cfg)
+}
+
+// Backup stores the account keys in the drive, it's done
+// on every change of the keys, this is for the older setups
+func (u *EncryptionUseCase) Backup(ctx context.Context, accName string) error {
+	acc, cfg, err := u.config(ctx, accName)
+	if err != nil {
+		return err
+	}
+	return storeKeyring(ctx, newAccountClient(u.r, acc), acc, cfg)
+}
+
+// Recover restores the account keys from the copy stored in the
+// drive, when the local database was lost. The configured passphrase
+// (or master key) must open them.
+func (u *EncryptionUseCase) Recover(ctx context.Context, accName string) error {
+	acc, err := loadSession(ctx, u.r, accName)
+	if err != nil {
+		return err
+	}
+	cfg, err := u.er.FindByAccountID(ctx, acc.ID)
+	if err != nil {
+		return err
+	}
+	if cfg != nil {
+		return fmt.Errorf("encryption is already set up for account %q", accName)
+	}
+	cfg, err = fetchKeyring(ctx, newAccountClient(u.r, acc), acc)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		return fmt.Errorf("no keys stored in the drive of account %q", accName)
+	}
+	if _, err := unwrapKeys(cfg, ConfiguredEncryptionSecret()); err != nil {
+		return err
+	}
+	return u.er.Persist(ctx, cfg)
+}
+
+// Status returns the account encryption setup
+func (u *EncryptionUseCase) Status(ctx context.Context, accName string) (*EncryptionStatus, error) {
+	acc, err := loadSession(ctx, u.r, accName)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := u.er.FindByAccountID(ctx, acc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return &EncryptionStatus{}, nil
+	}
+	return &EncryptionStatus{
+		Enabled:      cfg.Enabled,
+		EncryptNames: cfg.EncryptNames,
+		KeySource:    cfg.KeySource,
+		ActiveKey:    cfg.ActiveKey,
+		Keys:         len(cfg.Keys),
+	}, nil
+}
+
+func (u *EncryptionUseCase) config(ctx context.Context, accName string) (*model.OnedriveAccount, *model.EncryptionConfig, error) {
+	acc, err := loadSession(ctx, u.r, accName)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := u.er.FindByAccountID(ctx, acc.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg == nil {
+		return nil, nil, fmt.Errorf("encryption is not set up for account %q", accName)
+	}
+	return acc, cfg, nil
+}
+
+// save persists the config and stores its keys in the drive
+func (u *EncryptionUseCase) save(ctx context.Context, acc *model.OnedriveAccount, cfg *model.EncryptionConfig) error {
+	if err := u.er.Persist(ctx, cfg); err != nil {
+		return err
+	}
+	return storeKeyring(ctx, newAccountClient(u.r, acc), acc, cfg)
+}
+
+// keyringFile is the content of the keyringFileName file
+type keyringFile struct {
+	Enabled      bool             `json:"enabled"`
+	EncryptNames bool             `json:"encrypt_names"`
+	KeySource    string           `json:"key_source"`
+	KDFSalt      []byte           `json:"kdf_salt,omitempty"`
+	KDFTime      uint32           `json:"kdf_time,omitempty"`
+	KDFMemory    uint32           `json:"kdf_memory,omitempty"`
+	KDFThreads   uint8            `json:"kdf_threads,omitempty"`
+	ActiveKey    uint32           `json:"active_key"`
+	Keys         []keyringFileKey `json:"keys"`
+}
+
+type keyringFileKey struct {
+	Version    uint32 `json:"version"`
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+func newKeyringFile(cfg *model.EncryptionConfig) keyringFile {
+	f := keyringFile{
+		Enabled:      cfg.Enabled,
+		EncryptNames: cfg.EncryptNames,
+		KeySource:    cfg.KeySource,
+		KDFSalt:      cfg.KDFSalt,
+		KDFTime:      cfg.KDFTime,
+		KDFMemory:    cfg.KDFMemory,
+		KDFThreads:   cfg.KDFThreads,
+		ActiveKey:    cfg.ActiveKey,
+		Keys:         make([]keyringFileKey, 0, len(cfg.Keys)),
+	}
+	for _, k := range cfg.Keys {
+		f.Keys = append(f.Keys, keyringFileKey{Version: k.Version, WrappedKey: k.WrappedKey})
+	}
+	return f
+}
+
+func (f keyringFile) config(accountID string) *model.EncryptionConfig {
+	cfg := &model.EncryptionConfig{
+		AccountID:    accountID,
+		Enabled:      f.Enabled,
+		EncryptNames: f.EncryptNames,
+		KeySource:    f.KeySource,
+		KDFSalt:      f.KDFSalt,
+		KDFTime:      f.KDFTime,
+		KDFMemory:    f.KDFMemory,
+		KDFThreads:   f.KDFThreads,
+		ActiveKey:    f.ActiveKey,
+	}
+	for _, k := range f.Keys {
+		cfg.Keys = append(cfg.Keys, model.EncryptionKey{
+			AccountID:  accountID,
+			Version:    k.Version,
+			WrappedKey: k.WrappedKey,
+		})
+	}
+	return cfg
+}
+
+// storeKeyring writes the config keys into the app folder
+func storeKeyring(ctx context.Context, c client.Client, acc *model.OnedriveAccount, cfg *model.EncryptionConfig) error {
+	b, err := json.MarshalIndent(newKeyringFile(cfg), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal keyring: %w", err)
+	}
+	name := fmt.Sprintf(keyringFileName, acc.Drive.RootFolder)
+	if _, err := c.UploadFile(ctx, acc.Drive.DriveID, acc.Drive.ItemID, name, bytes.NewReader(b), int64(len(b)),
+		client.WithConflictBehavior(client.ConflictBehaviorReplace)); err != nil {
+		return fmt.Errorf("store keyring in the drive: %w", err)
+	}
+	return nil
+}
+
+// fetchKeyring reads the config stored in the app folder
+// by storeKeyring, it's nil when there's none
+func fetchKeyring(ctx context.Context, c client.Client, acc *model.OnedriveAccount) (*model.EncryptionConfig, error) {
+	name := fmt.Sprintf(keyringFileName, acc.Drive.RootFolder)
+	item, err := c.GetItemByPath(ctx, acc.Drive.DriveID, acc.Drive.ItemID, name)
+	if client.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find keyring in the drive: %w", err)
+	}
+	var buf bytes.Buffer
+	if _, err := c.Download(ctx, acc.Drive.DriveID, item.ID, &buf); err != nil {
+		return nil, fmt.Errorf("download keyring: %w", err)
+	}
+	var f keyringFile
+	if err := json.Unmarshal(buf.Bytes(), &f); err != nil {
+		return nil, fmt.Errorf("parse keyring: %w", err)
+	}
+	if len(f.Keys) == 0 {
+		return nil, errors.New("parse keyring: no data keys")
+	}
+	return f.config(acc.ID), nil
+}
+
+func addDataKey(cfg *model.EncryptionConfig, mk []byte) error {
+	dk, err := encryption.NewKey()
+	if err != nil {
+		return err
+	}
+	wrapped, err := encryption.WrapKey(mk, dk)
+	if err != nil {
+		return fmt.Errorf("wrap data key: %w", err)
+	}
+	version := uint32(1)
+	for _, k := range cfg.Keys {
+		version = max(version, k.Version+1)
+	}
+	cfg.Keys = append(cfg.Keys, model.EncryptionKey{
+		AccountID:  cfg.AccountID,
+		Version:    version,
+		WrappedKey: wrapped,
+	})
+	cfg.ActiveKey = version
+	return nil
+}
+
+func unwrapKeys(cfg *model.EncryptionConfig, secret EncryptionSecret) (map[uint32][]byte, error) {
+	mk, err := secret.masterKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[uint32][]byte, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		dk, err := encryption.UnwrapKey(mk, k.WrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("unwrap data key %d: %w", k.Version, err)
+		}
+		keys[k.Version] = dk
+	}
+	return keys, nil
+}
+
+// loadKeyring returns the account keyring, or nil when
+// the account has no encryption set up. The enabled
+// result tells if new uploads must be encrypted.
+func loadKeyring(ctx context.Context, er *persistence.EncryptionRepository, acc *model.OnedriveAccount) (kr *encryption.Keyring, enabled bool, err error) {
+	cfg, err := er.FindByAccountID(ctx, acc.ID)
+	if err != nil || cfg == nil {
+		return nil, false, err
+	}
+	keys, err := unwrapKeys(cfg, ConfiguredEncryptionSecret())
+	if err != nil {
+		return nil, false, err
+	}
+	kr, err = encryption.NewKeyring(keys, cfg.ActiveKey, cfg.EncryptNames, cfg.Enabled && configs.GetEncryptionRequireEncrypted())
+	if err != nil {
+		return nil, false, err
+	}
+	return kr, cfg.Enabled, nil
+}
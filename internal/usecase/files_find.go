@@ -0,0 +1,236 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/encryption"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+type FindUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+}
+
+func newFindUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *FindUseCase {
+	return &FindUseCase{
+		r:  r,
+		er: er,
+	}
+}
+
+// FindFilter narrows down the found items, the zero
+// value of every field matches any item
+type FindFilter struct {
+	// Name is a glob matched against the item name, case insensitive
+	Name string
+	// MimeType is a glob matched against the item mime type ("image/*"),
+	// folders have the "directory" type
+	MimeType string
+	// MinSize and MaxSize bound the item size as stored remotely
+	MinSize int64
+	MaxSize int64
+	// ModifiedAfter and ModifiedBefore bound the item modification time
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+}
+
+func (f FindFilter) validate() error {
+	for _, p := range []string{f.Name, f.MimeType} {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	if f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return fmt.Errorf("minimum size %d is bigger than the maximum size %d", f.MinSize, f.MaxSize)
+	}
+	return nil
+}
+
+func (f FindFilter) match(v types.Value) bool {
+	if f.Name != "" {
+		if ok, _ := path.Match(strings.ToLower(f.Name), strings.ToLower(v.Name)); !ok {
+			return false
+		}
+	}
+	if f.MimeType != "" {
+		if ok, _ := path.Match(f.MimeType, v.GetMimeType()); !ok {
+			return false
+		}
+	}
+	if int64(v.Size) < f.MinSize || (f.MaxSize > 0 && int64(v.Size) > f.MaxSize) {
+		return false
+	}
+	modified := itemModified(v)
+	if !f.ModifiedAfter.IsZero() && !modified.After(f.ModifiedAfter) {
+		return false
+	}
+	if !f.ModifiedBefore.IsZero() && !modified.Before(f.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// findFields are the item properties Find reads to walk the
+// folders, rebuild the search results paths and filter them
+var findFields = []string{"id", "name", "folder", "file", "size", "fileSystemInfo", "lastModifiedDateTime", "parentReference"}
+
+// Find finds the items of the account root folder matching query and
+// filter. The query is searched server side, matching names, metadata
+// and content. Without a query, or when the names are encrypted (so
+// the server can't match them), the folder tree is walked instead and
+// the query is matched against the decrypted names. The found items
+// have the fields properties, all of them when empty.
+func (u *FindUseCase) Find(ctx context.Context, accName, query string, filter FindFilter, fields ...string) (_ []FileEntry, err error) {
+	ctx, span := startSpan(ctx, "Find", accountKey.String(accName))
+	defer func() { endSpan(span, err) }()
+
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []client.QueryOption
+	if len(fields) > 0 {
+		opts = append(opts, client.WithSelect(findFields...), client.WithSelect(fields...))
+	}
+	var found []FileEntry
+	if query == "" || (f.kr != nil && f.kr.EncryptNames()) {
+		found, err = walkFind(ctx, f, strings.ToLower(query), opts...)
+	} else {
+		found, err = searchFind(ctx, f, query, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := found[:0]
+	for _, it := range found {
+		if filter.match(it.Value) {
+			res = append(res, it)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res, nil
+}
+
+// walkFind lists the whole folder tree under root, keeping
+// the items with a (decrypted) name containing query
+func walkFind(ctx context.Context, root *remoteItem, query string, opts ...client.QueryOption) ([]FileEntry, error) {
+	var found []FileEntry
+	var walk func(id, dir string) error
+	walk = func(id, dir string) error {
+		entries, err := root.children(ctx, id, dir, opts...)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if strings.Contains(strings.ToLower(e.Name), query) {
+				found = append(found, e)
+			}
+			if e.IsFolder() {
+				if err := walk(e.ID, e.Path); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(root.item.ID, ""); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// searchFind searches the whole drive, keeping the
+// results that are inside the root folder
+func searchFind(ctx context.Context, root *remoteItem, query string, opts ...client.QueryOption) ([]FileEntry, error) {
+	res, err := root.c.Search(ctx, root.driveID, query, opts...)
+	if err != nil {
+		return nil, err
+	}
+	paths := &itemPaths{
+		c:       root.c,
+		kr:      root.kr,
+		driveID: root.driveID,
+		rootID:  root.item.ID,
+		dirs:    map[string]itemPath{root.item.ID: {inside: true}},
+	}
+	var found []FileEntry
+	for _, v := range res.Value {
+		if v.ID == root.item.ID {
+			continue
+		}
+		dir, err := paths.dir(ctx, v.ParentReference.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !dir.inside {
+			continue
+		}
+		v.Name = decryptName(root.kr, v.Name)
+		found = append(found, newFileEntry(path.Join(dir.path, v.Name), v))
+	}
+	return found, nil
+}
+
+type itemPath struct {
+	path   string
+	inside bool
+}
+
+// itemPaths rebuilds the path of the folders (relative to the root
+// folder) by walking up their parents, search results don't carry it
+type itemPaths struct {
+	c       client.Client
+	kr      *encryption.Keyring
+	driveID string
+	rootID  string
+	dirs    map[string]itemPath
+}
+
+func (p *itemPaths) dir(ctx context.Context, id string) (itemPath, error) {
+	if id == "" {
+		return itemPath{}, nil
+	}
+	if d, ok := p.dirs[id]; ok {
+		return d, nil
+	}
+	item, err := p.c.GetItem(ctx, p.driveID, id, client.WithSelect("id", "name", "parentReference"))
+	if err != nil {
+		return itemPath{}, fmt.Errorf("get parent folder: %w", err)
+	}
+	parent, err := p.dir(ctx, item.ParentReference.ID)
+	if err != nil {
+		return itemPath{}, err
+	}
+	d := itemPath{inside: parent.inside}
+	if d.inside {
+		d.path = path.Join(parent.path, decryptName(p.kr, item.Name))
+	}
+	p.dirs[id] = d
+	return d, nil
+}
+
+// decryptName returns the decrypted name, or the name
+// itself when it isn't an encrypted one
+func decryptName(kr *encryption.Keyring, name string) string {
+	if kr == nil || !kr.EncryptNames() {
+		return name
+	}
+	if n, err := kr.DecryptName(name); err == nil {
+		return n
+	}
+	return name
+}
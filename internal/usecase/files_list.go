@@ -6,45 +6,90 @@ import (
 	"github.com/eldius/onedrive-client/client"
 	"github.com/eldius/onedrive-client/client/types"
 	"github.com/eldius/onedrive-client/internal/persistence"
+	"time"
 )
 
 type ListFilesUseCase struct {
-	r *persistence.AuthRepository
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
 }
 
-func newListFilesUseCase(r *persistence.AuthRepository) *ListFilesUseCase {
+func newListFilesUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *ListFilesUseCase {
 	return &ListFilesUseCase{
-		r: r,
+		r:  r,
+		er: er,
 	}
 }
 
-func (l *ListFilesUseCase) ListFilesFromDrive(ctx context.Context, accountName string) error {
+// FileEntry is a remote item returned by the read usecases, its
+// Path and Name are decrypted when the account encrypts the names
+type FileEntry struct {
+	Path string `json:"path"`
+	// Modified is when the content was last modified, the file
+	// system time (set from the local file on upload) when there's one
+	Modified time.Time `json:"modified"`
+	types.Value
+}
+
+func newFileEntry(p string, v types.Value) FileEntry {
+	return FileEntry{
+		Path:     p,
+		Modified: itemModified(v),
+		Value:    v,
+	}
+}
+
+func itemModified(v types.Value) time.Time {
+	if !v.FileSystemInfo.LastModifiedDateTime.IsZero() {
+		return v.FileSystemInfo.LastModifiedDateTime
+	}
+	return v.LastModifiedDateTime
+}
+
+// ListOptions selects what the listings return
+type ListOptions struct {
+	// Fields are the item properties returned, all of them when empty
+	Fields []string
+	// Thumbnails returns the thumbnail sets (and their URLs) of the items
+	Thumbnails bool
+}
+
+func (o ListOptions) queryOptions() []client.QueryOption {
+	var opts []client.QueryOption
+	if len(o.Fields) > 0 {
+		opts = append(opts, client.WithSelect(o.Fields...), client.WithSelect("name"))
+	}
+	if o.Thumbnails {
+		opts = append(opts, client.WithExpand(client.ExpandThumbnails))
+	}
+	return opts
+}
+
+// ListFilesFromDrive lists the items of the account app folder
+func (l *ListFilesUseCase) ListFilesFromDrive(ctx context.Context, accountName string, opts ListOptions) (_ []FileEntry, err error) {
+	ctx, span := startSpan(ctx, "ListFilesFromDrive", accountKey.String(accountName))
+	defer func() { endSpan(span, err) }()
+
 	acc, err := loadSession(ctx, l.r, accountName)
 	if err != nil {
-		return fmt.Errorf("could not find account %q: %w", accountName, err)
-	}
-
-	token := &types.TokenData{
-		TokenType:    acc.AuthData.TokenType,
-		Scope:        acc.AuthData.Scope,
-		ExpiresIn:    acc.AuthData.ExpiresIn,
-		ExtExpiresIn: acc.AuthData.ExtExpiresIn,
-		AccessToken:  acc.AuthData.AccessToken,
-		RefreshToken: acc.AuthData.RefreshToken,
-		IDToken:      acc.AuthData.IDToken,
-	}
-	c := client.New(
-		client.WithScopes(acc.AuthData.Scope),
-		client.WithAuthenticationTokenData(token),
-	)
-	remoteFiles, err := c.ListFiles(ctx, acc.Drive.DriveID, acc.Drive.ItemID)
+		return nil, fmt.Errorf("could not find account %q: %w", accountName, err)
+	}
+
+	c := newAccountClient(l.r, acc)
+	remoteFiles, err := c.ListFiles(ctx, acc.Drive.DriveID, acc.Drive.ItemID, opts.queryOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("listing files: %w", err)
+	}
+
+	kr, _, err := loadKeyring(ctx, l.er, acc)
 	if err != nil {
-		return fmt.Errorf("listing files: %w", err)
+		return nil, fmt.Errorf("load encryption keys: %w", err)
 	}
 
+	entries := make([]FileEntry, 0, len(remoteFiles.Value))
 	for _, f := range remoteFiles.Value {
-		fmt.Printf(" -> file: %s (%s)\n", f.Name, f.GetMimeType())
+		f.Name = decryptName(kr, f.Name)
+		entries = append(entries, newFileEntry(f.Name, f))
 	}
-
-	return nil
+	return entries, nil
 }
@@ -0,0 +1,453 @@
+package usecase
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/encryption"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	OverwriteNever  = "never"
+	OverwriteOlder  = "older"
+	OverwriteAlways = "always"
+
+	// restoreLogName is the default restore log file, created
+	// inside the local directory and removed when done
+	restoreLogName = ".onedrive-client-restore.log"
+)
+
+// RestoreOptions configures a restore
+type RestoreOptions struct {
+	Transfer TransferOptions
+	// Overwrite tells which existing local files are
+	// replaced (never, older or always)
+	Overwrite string
+	// AsOf restores the files as they were at this time,
+	// picking previous versions when needed (optional)
+	AsOf time.Time
+	// LogFile records the restored files so an interrupted
+	// restore continues where it stopped (optional)
+	LogFile string
+}
+
+type FileRestoreUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+}
+
+func newFileRestoreUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *FileRestoreUseCase {
+	return &FileRestoreUseCase{
+		r:  r,
+		er: er,
+	}
+}
+
+// restoreFile is a remote file (or one of its
+// versions) to be written to a local path
+type restoreFile struct {
+	rel       string
+	local     string
+	itemID    string
+	versionID string
+	// revision identifies the restored content in the log
+	revision string
+	size     int64
+	// hash is the remote quickXorHash, versions have none
+	hash     string
+	created  time.Time
+	modified time.Time
+}
+
+// restoreFolder is a local folder whose timestamps
+// are restored after its content is written
+type restoreFolder struct {
+	local    string
+	created  time.Time
+	modified time.Time
+}
+
+// Restore downloads remotePath (a file or a whole folder, relative
+// to the account root folder) into localDir. Encrypted files are
+// decrypted and the downloaded content is checked against its hash.
+func (u *FileRestoreUseCase) Restore(ctx context.Context, accName, remotePath, localDir string, opts RestoreOptions) (err error) {
+	ctx, span := startSpan(ctx, "Restore", accountKey.String(accName), pathKey.String(remotePath), localPathKey.String(localDir))
+	defer func() { endSpan(span, err) }()
+
+	switch opts.Overwrite {
+	case "":
+		opts.Overwrite = OverwriteNever
+	case OverwriteNever, OverwriteOlder, OverwriteAlways:
+	default:
+		return fmt.Errorf("invalid overwrite mode %q (expected %s, %s or %s)", opts.Overwrite, OverwriteNever, OverwriteOlder, OverwriteAlways)
+	}
+
+	acc, err := loadSession(ctx, u.r, accName)
+	if err != nil {
+		return fmt.Errorf("loadSession: %w", err)
+	}
+	opts.Transfer = opts.Transfer.withDefaults()
+	cOpts, err := opts.Transfer.clientOptions()
+	if err != nil {
+		return err
+	}
+	c := newAccountClient(u.r, acc, cOpts...)
+
+	// encrypted files are decrypted even when
+	// the encryption of new uploads is disabled
+	kr, _, err := loadKeyring(ctx, u.er, acc)
+	if err != nil {
+		return fmt.Errorf("load encryption keys: %w", err)
+	}
+
+	root, err := accountRoot(ctx, c, acc)
+	if err != nil {
+		return err
+	}
+	item, err := resolveRemote(ctx, c, kr, acc.Drive.DriveID, root.ID, remotePath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(localDir, 0o755); err != nil {
+		return fmt.Errorf("create local directory: %w", err)
+	}
+	if opts.LogFile == "" {
+		opts.LogFile = filepath.Join(localDir, restoreLogName)
+	}
+	rlog, err := openRestoreLog(opts.LogFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rlog.Close()
+	}()
+
+	w := &restoreWalker{
+		c:       c,
+		kr:      kr,
+		driveID: acc.Drive.DriveID,
+		opts:    opts,
+		log:     rlog,
+	}
+	if item.IsFolder() {
+		err = w.folder(ctx, *item, "", localDir)
+	} else {
+		name := w.name(*item)
+		err = w.file(ctx, *item, name, filepath.Join(localDir, name))
+	}
+	if err != nil {
+		return err
+	}
+	slog.With("files", len(w.files), "unchanged", w.unchanged, "skipped", w.skipped).Info("restore planned")
+
+	transfers := make([]Transfer, 0, len(w.files))
+	for _, f := range w.files {
+		transfers = append(transfers, Transfer{
+			Name: f.rel,
+			Size: f.size,
+			Run: func(ctx context.Context, progress client.ProgressFunc) error {
+				return w.restore(ctx, f, progress)
+			},
+		})
+	}
+	if err := NewTransferScheduler(opts.Transfer.Transfers, opts.Transfer.Observer).Run(ctx, transfers); err != nil {
+		return err
+	}
+
+	// writing the files changes the folders modification
+	// time, so the deepest folders are restored first
+	sort.Slice(w.folders, func(i, j int) bool {
+		return len(w.folders[i].local) > len(w.folders[j].local)
+	})
+	for _, f := range w.folders {
+		if err := setFileTimes(f.local, f.created, f.modified); err != nil {
+			return fmt.Errorf("set folder %q times: %w", f.local, err)
+		}
+	}
+	return rlog.finish()
+}
+
+// restoreWalker walks the remote tree, creating the local
+// folders and collecting the files to be downloaded
+type restoreWalker struct {
+	c       client.Client
+	kr      *encryption.Keyring
+	driveID string
+	opts    RestoreOptions
+	log     *restoreLog
+
+	files     []restoreFile
+	folders   []restoreFolder
+	unchanged int
+	skipped   int
+}
+
+// name returns the item name, decrypted when needed
+func (w *restoreWalker) name(item types.Value) string {
+	if w.kr == nil || !w.kr.EncryptNames() {
+		return item.Name
+	}
+	if name, err := w.kr.DecryptName(item.Name); err == nil {
+		return name
+	}
+	return item.Name
+}
+
+func (w *restoreWalker) folder(ctx context.Context, item types.Value, rel, local string) error {
+	if !w.opts.AsOf.IsZero() && item.CreatedDateTime.After(w.opts.AsOf) {
+		w.skipped++
+		return nil
+	}
+	if err := os.MkdirAll(local, 0o755); err != nil {
+		return fmt.Errorf("create local folder: %w", err)
+	}
+	w.folders = append(w.folders, restoreFolder{
+		local:    local,
+		created:  item.FileSystemInfo.CreatedDateTime,
+		modified: item.FileSystemInfo.LastModifiedDateTime,
+	})
+
+	res, err := w.c.ListFiles(ctx, w.driveID, item.ID, client.WithSelect(itemFields...))
+	if err != nil {
+		return fmt.Errorf("list remote folder %q: %w", rel, err)
+	}
+	for _, child := range res.Value {
+		name := w.name(child)
+		childRel := path.Join(rel, name)
+		childLocal := filepath.Join(local, filepath.FromSlash(name))
+		if child.IsFolder() {
+			err = w.folder(ctx, child, childRel, childLocal)
+		} else {
+			err = w.file(ctx, child, childRel, childLocal)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *restoreWalker) file(ctx context.Context, item types.Value, rel, local string) error {
+	f, ok, err := w.source(ctx, item)
+	if err != nil {
+		return fmt.Errorf("file %q: %w", rel, err)
+	}
+	if !ok {
+		// the file didn't exist at the restore time
+		w.skipped++
+		return nil
+	}
+	f.rel = rel
+	f.local = local
+
+	if w.log.done(f.rel, f.revision) {
+		w.unchanged++
+		return nil
+	}
+
+	info, err := os.Stat(local)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		w.files = append(w.files, f)
+		return nil
+	case err != nil:
+		return fmt.Errorf("stat local file: %w", err)
+	case info.IsDir():
+		return fmt.Errorf("local path %q is a directory", local)
+	}
+
+	switch w.opts.Overwrite {
+	case OverwriteNever:
+		w.skipped++
+		return nil
+	case OverwriteOlder:
+		if !info.ModTime().Truncate(time.Second).Before(f.modified.Truncate(time.Second)) {
+			w.skipped++
+			return nil
+		}
+	}
+
+	if f.hash != "" && info.Size() == f.size {
+		hash, err := localHash(local)
+		if err != nil {
+			return fmt.Errorf("hash local file %q: %w", local, err)
+		}
+		if hash == f.hash {
+			w.unchanged++
+			return setFileTimes(local, f.created, f.modified)
+		}
+	}
+	w.files = append(w.files, f)
+	return nil
+}
+
+// source returns the content to restore for the item, it's
+// false when the item didn't exist at the restore time
+func (w *restoreWalker) source(ctx context.Context, item types.Value) (restoreFile, bool, error) {
+	f := restoreFile{
+		itemID:   item.ID,
+		revision: item.ETag,
+		size:     int64(item.Size),
+		hash:     item.File.Hashes.QuickXorHash,
+		created:  item.FileSystemInfo.CreatedDateTime,
+		modified: item.FileSystemInfo.LastModifiedDateTime,
+	}
+	asOf := w.opts.AsOf
+	if asOf.IsZero() || !item.LastModifiedDateTime.After(asOf) {
+		return f, true, nil
+	}
+	if item.CreatedDateTime.After(asOf) {
+		return f, false, nil
+	}
+
+	versions, err := w.c.ListVersions(ctx, w.driveID, item.ID)
+	if err != nil {
+		return f, false, fmt.Errorf("list versions: %w", err)
+	}
+	v, ok := versionAsOf(versions.Value, asOf)
+	if !ok {
+		return f, false, nil
+	}
+	f.versionID = v.ID
+	f.revision = v.ID
+	f.size = int64(v.Size)
+	f.hash = ""
+	f.modified = v.LastModifiedDateTime
+	return f, true, nil
+}
+
+// restore downloads a file into a temporary file that
+// replaces the local one once its content is checked
+func (w *restoreWalker) restore(ctx context.Context, f restoreFile, progress client.ProgressFunc) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.local), "."+filepath.Base(f.local)+".*.partial")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	opts := append(w.opts.Transfer.transferOptions(), client.WithProgress(progress))
+	n, hash, err := downloadItem(ctx, w.c, w.kr, w.driveID, f.itemID, f.versionID, tmp, opts...)
+	if err != nil {
+		return err
+	}
+	if n != f.size {
+		return fmt.Errorf("downloaded %d bytes, expected %d", n, f.size)
+	}
+	if f.hash != "" && hash != f.hash {
+		return fmt.Errorf("hash mismatch (got %s, expected %s)", hash, f.hash)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temporary file: %w", err)
+	}
+	if err := setFileTimes(tmp.Name(), f.created, f.modified); err != nil {
+		return fmt.Errorf("set file times: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.local); err != nil {
+		return fmt.Errorf("replace local file: %w", err)
+	}
+	return w.log.add(f.rel, f.revision)
+}
+
+// restoreLog records the restored files (one JSON entry
+// per line) so an interrupted restore can be resumed
+type restoreLog struct {
+	name string
+	mu   sync.Mutex
+	f    *os.File
+	// entries maps the restored paths to their revisions
+	entries map[string]string
+}
+
+type restoreLogEntry struct {
+	Path     string `json:"path"`
+	Revision string `json:"revision"`
+}
+
+func openRestoreLog(name string) (*restoreLog, error) {
+	l := &restoreLog{
+		name:    name,
+		entries: make(map[string]string),
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open restore log: %w", err)
+	}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e restoreLogEntry
+		// a partially written last line is ignored
+		if err := json.Unmarshal(s.Bytes(), &e); err == nil {
+			l.entries[e.Path] = e.Revision
+		}
+	}
+	if err := s.Err(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("read restore log: %w", err)
+	}
+	if len(l.entries) > 0 {
+		slog.With("log", name, "restored", len(l.entries)).Info("resuming restore")
+	}
+	l.f = f
+	return l, nil
+}
+
+// done tells if the file revision was already restored
+func (l *restoreLog) done(rel, revision string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.entries[rel]
+	return ok && r == revision
+}
+
+func (l *restoreLog) add(rel, revision string) error {
+	b, err := json.Marshal(restoreLogEntry{Path: rel, Revision: revision})
+	if err != nil {
+		return fmt.Errorf("marshal restore log entry: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write restore log: %w", err)
+	}
+	l.entries[rel] = revision
+	return nil
+}
+
+// finish removes the log of a completed restore
+func (l *restoreLog) finish() error {
+	if err := l.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(l.name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove restore log: %w", err)
+	}
+	return nil
+}
+
+func (l *restoreLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
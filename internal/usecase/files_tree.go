@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"context"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"sort"
+)
+
+type TreeUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+}
+
+func newTreeUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *TreeUseCase {
+	return &TreeUseCase{
+		r:  r,
+		er: er,
+	}
+}
+
+// TreeNode is a remote item and, for folders, its children
+type TreeNode struct {
+	FileEntry
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+// UsageEntry is the size of a remote item, folders
+// sizes aggregate all their descendants
+type UsageEntry struct {
+	FileEntry
+	// Percent is the share of the size of the folder du was run on
+	Percent float64 `json:"percent"`
+}
+
+// Tree lists the item at remotePath and its descendants down to depth
+// levels (0 for no limit), skipping the files when dirsOnly is set. The
+// descendants have their thumbnail sets when thumbnails is set.
+func (u *TreeUseCase) Tree(ctx context.Context, accName, remotePath string, depth int, dirsOnly, thumbnails bool) (_ *TreeNode, err error) {
+	ctx, span := startSpan(ctx, "Tree", accountKey.String(accName), pathKey.String(remotePath))
+	defer func() { endSpan(span, err) }()
+
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	var opts []client.QueryOption
+	if thumbnails {
+		opts = append(opts, client.WithSelect(itemFields...), client.WithExpand(client.ExpandThumbnails))
+	}
+
+	var walk func(n *TreeNode, level int) error
+	walk = func(n *TreeNode, level int) error {
+		if !n.IsFolder() || (depth > 0 && level >= depth) {
+			return nil
+		}
+		entries, err := f.children(ctx, n.ID, n.Path, opts...)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if dirsOnly && !e.IsFolder() {
+				continue
+			}
+			child := &TreeNode{FileEntry: e}
+			n.Children = append(n.Children, child)
+			if err := walk(child, level+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	root := &TreeNode{FileEntry: newFileEntry(cleanRemotePath(remotePath), *f.item)}
+	if err := walk(root, 0); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// DiskUsage returns the size of the items under remotePath down to depth
+// levels (0 for no limit), biggest first. Folder sizes are the ones
+// the OneDrive reports, summing the children when it reports none.
+func (u *TreeUseCase) DiskUsage(ctx context.Context, accName, remotePath string, depth int) (_ []UsageEntry, err error) {
+	ctx, span := startSpan(ctx, "DiskUsage", accountKey.String(accName), pathKey.String(remotePath))
+	defer func() { endSpan(span, err) }()
+
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	root := newFileEntry(cleanRemotePath(remotePath), *f.item)
+	if !root.IsFolder() {
+		return []UsageEntry{{FileEntry: root, Percent: 100}}, nil
+	}
+	if root.Size, err = f.size(ctx, root); err != nil {
+		return nil, err
+	}
+
+	var usage []UsageEntry
+	var walk func(dir FileEntry, level int) error
+	walk = func(dir FileEntry, level int) error {
+		entries, err := f.children(ctx, dir.ID, dir.Path)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Size, err = f.size(ctx, e); err != nil {
+				return err
+			}
+			usage = append(usage, UsageEntry{FileEntry: e})
+			if e.IsFolder() && (depth <= 0 || level+1 < depth) {
+				if err := walk(e, level+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(root, 0); err != nil {
+		return nil, err
+	}
+
+	for i := range usage {
+		if root.Size > 0 {
+			usage[i].Percent = float64(usage[i].Size) * 100 / float64(root.Size)
+		}
+	}
+	sort.SliceStable(usage, func(i, j int) bool {
+		return usage[i].Size > usage[j].Size
+	})
+	return usage, nil
+}
+
+// LargestFiles returns the n biggest files under remotePath
+func (u *TreeUseCase) LargestFiles(ctx context.Context, accName, remotePath string, n int) (_ []FileEntry, err error) {
+	ctx, span := startSpan(ctx, "LargestFiles", accountKey.String(accName), pathKey.String(remotePath))
+	defer func() { endSpan(span, err) }()
+
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	root := newFileEntry(cleanRemotePath(remotePath), *f.item)
+	if !root.IsFolder() {
+		return []FileEntry{root}, nil
+	}
+
+	var files []FileEntry
+	var walk func(dir FileEntry) error
+	walk = func(dir FileEntry) error {
+		entries, err := f.children(ctx, dir.ID, dir.Path)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !e.IsFolder() {
+				files = append(files, e)
+				continue
+			}
+			if err := walk(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Size > files[j].Size
+	})
+	if n > 0 && len(files) > n {
+		files = files[:n]
+	}
+	return files, nil
+}
+
+// size returns the item size, summing the folder
+// children when the OneDrive doesn't report it
+func (f *remoteItem) size(ctx context.Context, e FileEntry) (int, error) {
+	if !e.IsFolder() || e.Size > 0 || e.Folder.ChildCount == 0 {
+		return e.Size, nil
+	}
+	entries, err := f.children(ctx, e.ID, e.Path)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, c := range entries {
+		n, err := f.size(ctx, c)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -2,27 +2,545 @@ package usecase
 
 import (
 	"context"
+	"fmt"
 	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/quickxorhash"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/encryption"
+	"github.com/eldius/onedrive-client/internal/model"
 	"github.com/eldius/onedrive-client/internal/persistence"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
 type FileUploadUseCase struct {
-	c client.Client
-	r *persistence.AuthRepository
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
 }
 
-func newFileUploadUseCase(c client.Client, r *persistence.AuthRepository) *FileUploadUseCase {
+func newFileUploadUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *FileUploadUseCase {
 	return &FileUploadUseCase{
-		c: c,
-		r: r,
+		r:  r,
+		er: er,
+	}
+}
+
+type localFile struct {
+	path   string
+	remote string
+	size   int64
+}
+
+// Upload sends inputFile (a file or a whole directory) to outputFile,
+// a path relative to the account root folder. The remote files that
+// differ are handled following conflict (replace, rename or skip).
+func (u *FileUploadUseCase) Upload(ctx context.Context, accName, inputFile, outputFile, conflict string, opts TransferOptions) (err error) {
+	ctx, span := startSpan(ctx, "Upload", accountKey.String(accName), localPathKey.String(inputFile), pathKey.String(outputFile))
+	defer func() { endSpan(span, err) }()
+
+	files, err := localFiles(inputFile, outputFile)
+	if err != nil {
+		return fmt.Errorf("list local files: %w", err)
+	}
+	opts = opts.withDefaults()
+	a, err := u.openAccount(ctx, accName, opts)
+	if err != nil {
+		return err
 	}
+	p, err := u.planFiles(ctx, a, inputFile, outputFile, conflict, files)
+	if err != nil {
+		return err
+	}
+	return u.apply(ctx, a, p, opts, false)
+}
+
+// Apply executes a previously computed plan, aborting when
+// the remote items changed since the plan was computed
+func (u *FileUploadUseCase) Apply(ctx context.Context, p *Plan, opts TransferOptions) (err error) {
+	ctx, span := startSpan(ctx, "Apply", accountKey.String(p.Account), localPathKey.String(p.Source), pathKey.String(p.Destination))
+	defer func() { endSpan(span, err) }()
+
+	opts = opts.withDefaults()
+	a, err := u.openAccount(ctx, p.Account, opts)
+	if err != nil {
+		return err
+	}
+	return u.apply(ctx, a, p, opts, true)
 }
 
-func (u *FileUploadUseCase) Upload(ctx context.Context, accName, inputFile, outputFile string) error {
-	//acc, err := loadSession(ctx, u.r, accName)
-	//if err != nil {
-	//	return fmt.Errorf("loadSession: %w", err)
-	//}
+// PlanUpload computes the operations needed to upload
+// inputFile to outputFile without changing anything
+func (u *FileUploadUseCase) PlanUpload(ctx context.Context, accName, inputFile, outputFile, conflict string) (_ *Plan, err error) {
+	ctx, span := startSpan(ctx, "PlanUpload", accountKey.String(accName), localPathKey.String(inputFile), pathKey.String(outputFile))
+	defer func() { endSpan(span, err) }()
 
+	files, err := localFiles(inputFile, outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("list local files: %w", err)
+	}
+	a, err := u.openAccount(ctx, accName, TransferOptions{}.withDefaults())
+	if err != nil {
+		return nil, err
+	}
+	return u.planFiles(ctx, a, inputFile, outputFile, conflict, files)
+}
+
+// uploadAccount is an account with its client and encryption keys,
+// loaded once for planning and applying its uploads
+type uploadAccount struct {
+	name string
+	acc  *model.OnedriveAccount
+	c    client.Client
+	kr   *encryption.Keyring
+	// encrypted tells if the new uploads are encrypted,
+	// kr is loaded anyway to decrypt the names
+	encrypted bool
+}
+
+// openAccount loads the account and creates its client
+// with opts, they must have their defaults set
+func (u *FileUploadUseCase) openAccount(ctx context.Context, accName string, opts TransferOptions) (*uploadAccount, error) {
+	acc, err := loadSession(ctx, u.r, accName)
+	if err != nil {
+		return nil, fmt.Errorf("loadSession: %w", err)
+	}
+	cOpts, err := opts.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	kr, enabled, err := loadKeyring(ctx, u.er, acc)
+	if err != nil {
+		return nil, fmt.Errorf("load encryption keys: %w", err)
+	}
+	return &uploadAccount{
+		name:      accName,
+		acc:       acc,
+		c:         newAccountClient(u.r, acc, cOpts...),
+		kr:        kr,
+		encrypted: enabled,
+	}, nil
+}
+
+// planFiles computes the operations needed to upload files,
+// inputFile and outputFile are only recorded in the plan
+func (u *FileUploadUseCase) planFiles(ctx context.Context, a *uploadAccount, inputFile, outputFile, conflict string, files []localFile) (*Plan, error) {
+	switch conflict {
+	case "":
+		conflict = ConflictReplace
+	case ConflictReplace, ConflictRename, ConflictSkip:
+	default:
+		return nil, fmt.Errorf("invalid conflict mode %q (expected %s, %s or %s)", conflict, ConflictReplace, ConflictRename, ConflictSkip)
+	}
+
+	kr := a.kr
+	if !a.encrypted {
+		kr = nil
+	}
+	root, err := accountRoot(ctx, a.c, a.acc)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{
+		Account:     a.name,
+		Source:      inputFile,
+		Destination: cleanRemotePath(outputFile),
+		Conflict:    conflict,
+		Encrypted:   kr != nil,
+		CreatedAt:   time.Now(),
+	}
+	planner := &uploadPlanner{
+		c:        a.c,
+		kr:       kr,
+		driveID:  a.acc.Drive.DriveID,
+		conflict: conflict,
+		plan:     p,
+		folders:  map[string]string{"": root.ID},
+		listings: make(map[string]map[string]types.Value),
+	}
+	for _, f := range files {
+		if err := planner.file(ctx, f); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// apply executes p with the client of a, created with opts
+func (u *FileUploadUseCase) apply(ctx context.Context, a *uploadAccount, p *Plan, opts TransferOptions, verify bool) error {
+	c := a.c
+	driveID := a.acc.Drive.DriveID
+
+	var kr *encryption.Keyring
+	if p.Encrypted {
+		kr = a.kr
+		if kr == nil {
+			return fmt.Errorf("the plan is encrypted but account %q has no encryption keys", p.Account)
+		}
+	}
+
+	if verify {
+		if err := verifyPlan(ctx, c, driveID, p); err != nil {
+			return err
+		}
+	}
+
+	created := make(map[string]string)
+	parentOf := func(op Operation) (string, error) {
+		if op.ParentID != "" {
+			return op.ParentID, nil
+		}
+		id, ok := created[path.Dir(op.Path)]
+		if !ok {
+			return "", fmt.Errorf("parent folder of %q is not created by the plan", op.Path)
+		}
+		return id, nil
+	}
+
+	var transfers []Transfer
+	for _, op := range p.Operations {
+		parentID, err := parentOf(op)
+		if err != nil {
+			return err
+		}
+		if op.IsFolder {
+			folder, err := c.CreateFolder(ctx, op.remoteName(), parentID, driveID)
+			if err != nil {
+				return fmt.Errorf("create folder %q: %w", op.Path, err)
+			}
+			created[op.Path] = folder.ID
+			continue
+		}
+
+		up := fileUpload{
+			file:     localFile{path: op.LocalPath, remote: op.Path, size: op.Size},
+			name:     op.remoteName(),
+			parentID: parentID,
+			behavior: conflictBehavior(op.Type),
+			kr:       kr,
+		}
+		size := op.Size
+		if kr != nil {
+			size = encryption.CipherSize(size)
+		}
+		transfers = append(transfers, Transfer{
+			Name: op.Path,
+			Size: size,
+			Run: func(ctx context.Context, progress client.ProgressFunc) error {
+				return uploadLocalFile(ctx, c, driveID, up, opts, progress)
+			},
+		})
+	}
+
+	return NewTransferScheduler(opts.Transfers, opts.Observer).Run(ctx, transfers)
+}
+
+func conflictBehavior(t OperationType) string {
+	switch t {
+	case OperationReplace:
+		return client.ConflictBehaviorReplace
+	case OperationRenameForConflict:
+		return client.ConflictBehaviorRename
+	default:
+		return client.ConflictBehaviorFail
+	}
+}
+
+// fileUpload is a local file to be uploaded as
+// name inside the parentID remote folder
+type fileUpload struct {
+	file     localFile
+	name     string
+	parentID string
+	behavior string
+	// kr encrypts the content when set
+	kr *encryption.Keyring
+}
+
+func uploadLocalFile(ctx context.Context, c client.Client, driveID string, up fileUpload, opts TransferOptions, progress client.ProgressFunc) error {
+	f := up.file
+	in, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("stat file: %w", err)
+	}
+	if info.Size() != f.size {
+		return fmt.Errorf("local file changed since it was planned (size %d, was %d)", info.Size(), f.size)
+	}
+
+	var content io.ReaderAt = in
+	size := f.size
+	if up.kr != nil {
+		enc, err := up.kr.NewEncrypter(in, f.size)
+		if err != nil {
+			return fmt.Errorf("encrypt file: %w", err)
+		}
+		content, size = enc, enc.Size()
+	}
+
+	tOpts := append(
+		opts.transferOptions(),
+		client.WithConflictBehavior(up.behavior),
+		client.WithProgress(progress),
+		client.WithFileSystemInfo(time.Time{}, info.ModTime()),
+	)
+	if _, err := c.UploadFile(ctx, driveID, up.parentID, up.name, content, size, tOpts...); err != nil {
+		return fmt.Errorf("upload file: %w", err)
+	}
 	return nil
 }
+
+// uploadPlanner compares the local files with the remote
+// folders listings and records the needed operations
+type uploadPlanner struct {
+	c client.Client
+	// kr encrypts the new uploads when set
+	kr       *encryption.Keyring
+	driveID  string
+	conflict string
+	plan     *Plan
+	// folders maps remote paths to their IDs, an empty
+	// ID means the folder is created by the plan
+	folders  map[string]string
+	listings map[string]map[string]types.Value
+}
+
+func (p *uploadPlanner) children(ctx context.Context, folderID string) (map[string]types.Value, error) {
+	if children, ok := p.listings[folderID]; ok {
+		return children, nil
+	}
+	res, err := p.c.ListFiles(ctx, p.driveID, folderID, client.WithSelect(itemFields...))
+	if err != nil {
+		return nil, fmt.Errorf("list remote folder: %w", err)
+	}
+	children := foldNames(decryptedChildren(p.kr, res.Value))
+	p.listings[folderID] = children
+	return children, nil
+}
+
+// remoteName returns the name a new item is stored with
+func (p *uploadPlanner) remoteName(op *Operation) error {
+	if p.kr == nil || !p.kr.EncryptNames() {
+		return nil
+	}
+	name, err := p.kr.EncryptName(path.Base(op.Path))
+	if err != nil {
+		return fmt.Errorf("encrypt name of %q: %w", op.Path, err)
+	}
+	op.RemoteName = name
+	return nil
+}
+
+func (p *uploadPlanner) folder(ctx context.Context, dir string) (string, error) {
+	dir = cleanRemotePath(dir)
+	if id, ok := p.folders[dir]; ok {
+		return id, nil
+	}
+	parentID, err := p.folder(ctx, path.Dir(dir))
+	if err != nil {
+		return "", err
+	}
+
+	op := Operation{
+		Type:     OperationMkdir,
+		Path:     dir,
+		IsFolder: true,
+		ParentID: parentID,
+	}
+	p.folders[dir] = ""
+	if err := p.remoteName(&op); err != nil {
+		return "", err
+	}
+	if parentID == "" {
+		op.Reason = "parent folder is created by the plan"
+		p.plan.add(op)
+		return "", nil
+	}
+
+	children, err := p.children(ctx, parentID)
+	if err != nil {
+		return "", fmt.Errorf("folder %q: %w", dir, err)
+	}
+	remote, ok := children[nameKey(path.Base(dir))]
+	switch {
+	case !ok:
+		op.Reason = "folder not present remotely"
+	case remote.IsFolder():
+		p.folders[dir] = remote.ID
+		return remote.ID, nil
+	default:
+		op.Type = OperationRenameForConflict
+		op.Reason = "a file with the same name exists remotely"
+		op.RemoteID = remote.ID
+		op.RemoteETag = remote.ETag
+	}
+	p.plan.add(op)
+	return "", nil
+}
+
+func (p *uploadPlanner) file(ctx context.Context, f localFile) error {
+	parentID, err := p.folder(ctx, path.Dir(f.remote))
+	if err != nil {
+		return err
+	}
+
+	op := Operation{
+		Type:      OperationUpload,
+		Path:      f.remote,
+		LocalPath: f.path,
+		Size:      f.size,
+		ParentID:  parentID,
+	}
+	if err := p.remoteName(&op); err != nil {
+		return err
+	}
+	if parentID == "" {
+		op.Reason = "parent folder is created by the plan"
+		p.plan.add(op)
+		return nil
+	}
+
+	children, err := p.children(ctx, parentID)
+	if err != nil {
+		return fmt.Errorf("file %q: %w", f.remote, err)
+	}
+	remote, ok := children[nameKey(path.Base(f.remote))]
+	if !ok {
+		op.Reason = "not present remotely"
+		p.plan.add(op)
+		return nil
+	}
+	op.RemoteID = remote.ID
+	op.RemoteETag = remote.ETag
+	if remote.Name != path.Base(op.Path) {
+		op.RemoteName = remote.Name
+	}
+
+	if remote.IsFolder() {
+		op.Type = OperationRenameForConflict
+		op.Reason = "a folder with the same name exists remotely"
+		p.plan.add(op)
+		return nil
+	}
+
+	if p.kr != nil {
+		return p.compareEncrypted(op, f, remote)
+	}
+
+	if int64(remote.Size) != f.size {
+		return p.conflicting(op, fmt.Sprintf("size differs (local %d bytes, remote %d bytes)", f.size, remote.Size))
+	}
+
+	hash, err := localHash(f.path)
+	if err != nil {
+		return fmt.Errorf("hash local file %q: %w", f.path, err)
+	}
+	if hash == remote.File.Hashes.QuickXorHash {
+		p.plan.Totals.Unchanged++
+		return nil
+	}
+	return p.conflicting(op, "content differs (quickXorHash)")
+}
+
+// compareEncrypted compares an encrypted remote file by its size and
+// modification time, its hash is the hash of the encrypted content
+func (p *uploadPlanner) compareEncrypted(op Operation, f localFile, remote types.Value) error {
+	if int64(remote.Size) != encryption.CipherSize(f.size) {
+		return p.conflicting(op, fmt.Sprintf("size differs (local %d bytes, remote %d bytes decrypted)", f.size, encryption.PlainSize(int64(remote.Size))))
+	}
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("stat local file %q: %w", f.path, err)
+	}
+	if !info.ModTime().Truncate(time.Second).Equal(remote.FileSystemInfo.LastModifiedDateTime.Truncate(time.Second)) {
+		return p.conflicting(op, "modification time differs (encrypted content)")
+	}
+	p.plan.Totals.Unchanged++
+	return nil
+}
+
+// conflicting records an operation for a remote
+// file that differs from the local one
+func (p *uploadPlanner) conflicting(op Operation, reason string) error {
+	op.Reason = reason
+	switch p.conflict {
+	case ConflictSkip:
+		p.plan.Totals.Skipped++
+		return nil
+	case ConflictRename:
+		op.Type = OperationRenameForConflict
+	default:
+		op.Type = OperationReplace
+	}
+	p.plan.add(op)
+	return nil
+}
+
+func localHash(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return quickxorhash.Sum(f)
+}
+
+// localFiles lists the files to be uploaded and their remote paths.
+// A directory is walked recursively and mirrored under outputFile.
+func localFiles(inputFile, outputFile string) ([]localFile, error) {
+	info, err := os.Stat(inputFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		remote := outputFile
+		if remote == "" || strings.HasSuffix(remote, "/") {
+			remote = path.Join(remote, info.Name())
+		}
+		return []localFile{{path: inputFile, remote: cleanRemotePath(remote), size: info.Size()}}, nil
+	}
+
+	var files []localFile
+	err = filepath.WalkDir(inputFile, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(inputFile, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, localFile{
+			path:   p,
+			remote: cleanRemotePath(path.Join(outputFile, filepath.ToSlash(rel))),
+			size:   info.Size(),
+		})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].remote < files[j].remote
+	})
+	return files, err
+}
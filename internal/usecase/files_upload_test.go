@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/quickxorhash"
+	"github.com/eldius/onedrive-client/client/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// listingClient answers ListFiles with the folders children
+type listingClient struct {
+	client.Client
+	folders map[string][]types.Value
+}
+
+func (c *listingClient) ListFiles(_ context.Context, _, itemID string, _ ...client.QueryOption) (*types.ListFiles, error) {
+	return &types.ListFiles{Value: c.folders[itemID]}, nil
+}
+
+func TestUploadPlannerFile(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("hello planner")
+	local := filepath.Join(dir, "Foo.txt")
+	if err := os.WriteFile(local, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := quickxorhash.Sum(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(content))
+
+	remoteFile := func(name string, size int, hash string) types.Value {
+		return types.Value{ID: "id-" + name, Name: name, ETag: "etag-" + name, Size: size, File: types.File{Hashes: types.Hashes{QuickXorHash: hash}}}
+	}
+	remoteFolder := func(name string) types.Value {
+		return types.Value{ID: "id-" + name, Name: name, ETag: "etag-" + name, Folder: &types.Folder{}}
+	}
+
+	tests := []struct {
+		name       string
+		remote     string
+		conflict   string
+		children   map[string][]types.Value
+		wantOps    []Operation
+		unchanged  int
+		skipped    int
+		remoteName string
+	}{
+		{
+			name:    "new file",
+			remote:  "Foo.txt",
+			wantOps: []Operation{{Type: OperationUpload, Path: "Foo.txt", ParentID: "root"}},
+		},
+		{
+			name:      "same content with another case",
+			remote:    "Foo.txt",
+			children:  map[string][]types.Value{"root": {remoteFile("foo.txt", len(content), hash)}},
+			unchanged: 1,
+		},
+		{
+			name:       "different size with another case is replaced",
+			remote:     "Foo.txt",
+			children:   map[string][]types.Value{"root": {remoteFile("FOO.TXT", 3, "x")}},
+			wantOps:    []Operation{{Type: OperationReplace, Path: "Foo.txt", ParentID: "root", RemoteID: "id-FOO.TXT", RemoteETag: "etag-FOO.TXT"}},
+			remoteName: "FOO.TXT",
+		},
+		{
+			name:     "different content is renamed",
+			remote:   "Foo.txt",
+			conflict: ConflictRename,
+			children: map[string][]types.Value{"root": {remoteFile("Foo.txt", len(content), "other")}},
+			wantOps:  []Operation{{Type: OperationRenameForConflict, Path: "Foo.txt", ParentID: "root", RemoteID: "id-Foo.txt", RemoteETag: "etag-Foo.txt"}},
+		},
+		{
+			name:     "different content is skipped",
+			remote:   "Foo.txt",
+			conflict: ConflictSkip,
+			children: map[string][]types.Value{"root": {remoteFile("Foo.txt", len(content), "other")}},
+			skipped:  1,
+		},
+		{
+			name:     "folder with the file name",
+			remote:   "Foo.txt",
+			children: map[string][]types.Value{"root": {remoteFolder("foo.TXT")}},
+			wantOps:  []Operation{{Type: OperationRenameForConflict, Path: "Foo.txt", ParentID: "root", RemoteID: "id-foo.TXT", RemoteETag: "etag-foo.TXT"}},
+		},
+		{
+			name:   "missing folder is created",
+			remote: "docs/Foo.txt",
+			wantOps: []Operation{
+				{Type: OperationMkdir, Path: "docs", ParentID: "root", IsFolder: true},
+				{Type: OperationUpload, Path: "docs/Foo.txt"},
+			},
+		},
+		{
+			name:     "existing folder with another case",
+			remote:   "docs/Foo.txt",
+			children: map[string][]types.Value{"root": {remoteFolder("Docs")}},
+			wantOps:  []Operation{{Type: OperationUpload, Path: "docs/Foo.txt", ParentID: "id-Docs"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflict := tt.conflict
+			if conflict == "" {
+				conflict = ConflictReplace
+			}
+			p := &Plan{}
+			planner := &uploadPlanner{
+				c:        &listingClient{folders: tt.children},
+				conflict: conflict,
+				plan:     p,
+				folders:  map[string]string{"": "root"},
+				listings: make(map[string]map[string]types.Value),
+			}
+			if err := planner.file(context.Background(), localFile{path: local, remote: tt.remote, size: size}); err != nil {
+				t.Fatalf("file: %v", err)
+			}
+
+			if len(p.Operations) != len(tt.wantOps) {
+				t.Fatalf("got %d operations %+v, want %d", len(p.Operations), p.Operations, len(tt.wantOps))
+			}
+			for i, want := range tt.wantOps {
+				got := p.Operations[i]
+				if got.Type != want.Type || got.Path != want.Path || got.ParentID != want.ParentID ||
+					got.IsFolder != want.IsFolder || got.RemoteID != want.RemoteID || got.RemoteETag != want.RemoteETag {
+					t.Errorf("operation %d = %+v, want %+v", i, got, want)
+				}
+			}
+			if tt.remoteName != "" && p.Operations[0].RemoteName != tt.remoteName {
+				t.Errorf("remote name = %q, want %q", p.Operations[0].RemoteName, tt.remoteName)
+			}
+			if p.Totals.Unchanged != tt.unchanged {
+				t.Errorf("unchanged = %d, want %d", p.Totals.Unchanged, tt.unchanged)
+			}
+			if p.Totals.Skipped != tt.skipped {
+				t.Errorf("skipped = %d, want %d", p.Totals.Skipped, tt.skipped)
+			}
+		})
+	}
+}
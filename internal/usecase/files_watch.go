@@ -0,0 +1,548 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"github.com/eldius/onedrive-client/internal/encryption"
+	"github.com/fsnotify/fsnotify"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchMaxDelay bounds (in debounce intervals) how long
+// a continuous burst of events delays the sync
+const watchMaxDelay = 10
+
+// WatchOptions configures the watch mode
+type WatchOptions struct {
+	Transfer TransferOptions
+	// Conflict is how the remote files that differ
+	// are handled (replace, rename or skip)
+	Conflict string
+	// Debounce is how long the events must stop
+	// before the changes are synced
+	Debounce time.Duration
+	// Rescan is the interval of the full rescans,
+	// they catch the changes the watcher missed
+	Rescan time.Duration
+}
+
+// withDefaults fills the unset options with the configured values
+func (o WatchOptions) withDefaults() WatchOptions {
+	if o.Debounce <= 0 {
+		o.Debounce = configs.GetSyncDebounce()
+	}
+	if o.Debounce <= 0 {
+		o.Debounce = configs.DefaultSyncDebounce
+	}
+	if o.Rescan <= 0 {
+		o.Rescan = configs.GetSyncRescanInterval()
+	}
+	if o.Rescan <= 0 {
+		o.Rescan = configs.DefaultSyncRescanInterval
+	}
+	o.Transfer = o.Transfer.withDefaults()
+	return o
+}
+
+// watchRoot is a watched local directory
+// and the remote folder it's synced to
+type watchRoot struct {
+	local  string
+	remote string
+}
+
+// Sync uploads the changes of the local directories once. Every
+// directory is synced to a folder with the same name inside outputFile.
+func (u *FileUploadUseCase) Sync(ctx context.Context, accName string, dirs []string, outputFile string, opts WatchOptions) error {
+	s, err := u.newWatchSession(accName, dirs, outputFile, opts, nil)
+	if err != nil {
+		return err
+	}
+	return s.sync(ctx)
+}
+
+// Watch keeps the remote folders in sync with the local directories
+// until ctx is done, see Sync. Local renames are applied as remote
+// moves and removed files are kept remotely.
+func (u *FileUploadUseCase) Watch(ctx context.Context, accName string, dirs []string, outputFile string, opts WatchOptions) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("new watcher: %w", err)
+	}
+	defer func() {
+		_ = w.Close()
+	}()
+
+	s, err := u.newWatchSession(accName, dirs, outputFile, opts, w)
+	if err != nil {
+		return err
+	}
+	opts = s.opts
+	if err := s.rescan(ctx); err != nil {
+		return err
+	}
+
+	debounce := time.NewTimer(opts.Debounce)
+	debounce.Stop()
+	rescan := time.NewTicker(opts.Rescan)
+	defer rescan.Stop()
+
+	var burst time.Time
+	rescanPending := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if !s.event(ev) {
+				continue
+			}
+			if burst.IsZero() {
+				burst = time.Now()
+			}
+			debounce.Reset(min(opts.Debounce, max(time.Until(burst.Add(watchMaxDelay*opts.Debounce)), 0)))
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			slog.With("error", err).Warn("watcher error")
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				rescanPending = true
+				debounce.Reset(opts.Debounce)
+			}
+		case <-debounce.C:
+			burst = time.Time{}
+			if rescanPending {
+				rescanPending = false
+				err = s.rescan(ctx)
+			} else {
+				err = s.flush(ctx)
+			}
+			if err != nil && ctx.Err() == nil {
+				slog.With("error", err).Error("failed to sync the changes, they are retried on the next rescan")
+			}
+		case <-rescan.C:
+			if err := s.rescan(ctx); err != nil && ctx.Err() == nil {
+				slog.With("error", err).Error("failed to rescan")
+			}
+		}
+	}
+}
+
+func (u *FileUploadUseCase) newWatchSession(accName string, dirs []string, outputFile string, opts WatchOptions, w *fsnotify.Watcher) (*watchSession, error) {
+	s := &watchSession{
+		u:       u,
+		accName: accName,
+		opts:    opts.withDefaults(),
+		w:       w,
+		index:   make(map[string]os.FileInfo),
+		dirty:   make(map[string]struct{}),
+	}
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %q: %w", dir, err)
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("stat %q: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%q is not a directory", dir)
+		}
+		s.roots = append(s.roots, watchRoot{
+			local:  abs,
+			remote: cleanRemotePath(path.Join(outputFile, filepath.Base(abs))),
+		})
+	}
+	return s, nil
+}
+
+// watchSession holds the watch mode state
+type watchSession struct {
+	u       *FileUploadUseCase
+	accName string
+	opts    WatchOptions
+	w       *fsnotify.Watcher
+	roots   []watchRoot
+	// index has the local paths known to be synced,
+	// it's used to tell renames from new files
+	index map[string]os.FileInfo
+	// dirty has the paths changed since the last sync
+	dirty map[string]struct{}
+	// acc is loaded on the first sync and reused by the next
+	// ones, its client keeps the token refreshed meanwhile
+	acc *uploadAccount
+}
+
+// event records a watcher event, it returns false
+// for the events that don't need a sync
+func (s *watchSession) event(ev fsnotify.Event) bool {
+	if ev.Op == fsnotify.Chmod {
+		return false
+	}
+	s.dirty[ev.Name] = struct{}{}
+	if ev.Has(fsnotify.Create) {
+		// the watcher isn't recursive, new folders must be added
+		if info, err := os.Lstat(ev.Name); err == nil && info.IsDir() {
+			if err := s.watchTree(ev.Name); err != nil {
+				slog.With("error", err, "path", ev.Name).Warn("failed to watch folder")
+			}
+		}
+	}
+	return true
+}
+
+// rescan syncs the whole directories and rebuilds the index
+func (s *watchSession) rescan(ctx context.Context) error {
+	slog.With("roots", len(s.roots)).Info("full rescan")
+	s.dirty = make(map[string]struct{})
+	s.index = make(map[string]os.FileInfo)
+
+	for _, r := range s.roots {
+		if err := s.watchTree(r.local); err != nil {
+			return err
+		}
+		if _, err := s.indexTree(r.local); err != nil {
+			return err
+		}
+	}
+	return s.sync(ctx)
+}
+
+// sync uploads the changes of the whole directories
+func (s *watchSession) sync(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "Sync", accountKey.String(s.accName))
+	defer func() { endSpan(span, err) }()
+
+	a, err := s.account(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, r := range s.roots {
+		if err := s.syncRoot(ctx, a, r); err != nil {
+			errs = append(errs, fmt.Errorf("sync %q: %w", r.local, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *watchSession) syncRoot(ctx context.Context, a *uploadAccount, r watchRoot) error {
+	files, err := localFiles(r.local, r.remote)
+	if err != nil {
+		return fmt.Errorf("list local files: %w", err)
+	}
+	p, err := s.u.planFiles(ctx, a, r.local, r.remote, s.opts.Conflict, files)
+	if err != nil {
+		return err
+	}
+	return s.u.apply(ctx, a, p, s.opts.Transfer, false)
+}
+
+// account returns the watched account, loaded once
+func (s *watchSession) account(ctx context.Context) (*uploadAccount, error) {
+	if s.acc == nil {
+		a, err := s.u.openAccount(ctx, s.accName, s.opts.Transfer)
+		if err != nil {
+			return nil, err
+		}
+		s.acc = a
+	}
+	return s.acc, nil
+}
+
+// flush syncs the paths changed since the last sync
+func (s *watchSession) flush(ctx context.Context) error {
+	dirty := s.dirty
+	s.dirty = make(map[string]struct{})
+
+	var gone, fresh []string
+	current := make(map[string]os.FileInfo)
+	for p := range dirty {
+		info, err := os.Lstat(p)
+		switch {
+		case err == nil:
+			current[p] = info
+			if _, known := s.index[p]; !known {
+				fresh = append(fresh, p)
+			}
+		case errors.Is(err, fs.ErrNotExist):
+			if _, known := s.index[p]; known {
+				gone = append(gone, p)
+			}
+		default:
+			slog.With("error", err, "path", p).Warn("failed to stat changed path")
+		}
+	}
+	sort.Strings(gone)
+	sort.Strings(fresh)
+
+	moved := s.moves(ctx, gone, fresh, current)
+	for _, p := range gone {
+		if _, known := s.index[p]; known && !moved[p] {
+			s.forget(p)
+			slog.With("path", p).Info("removed locally, the remote copy is kept")
+		}
+	}
+
+	paths := make([]string, 0, len(current))
+	for p := range current {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	changed := make(map[string]struct{})
+	for _, p := range paths {
+		info := current[p]
+		switch {
+		case info.IsDir():
+			// moved folders content is already remote
+			if _, known := s.index[p]; known || moved[p] {
+				continue
+			}
+			files, err := s.indexTree(p)
+			if err != nil {
+				return err
+			}
+			for _, f := range files {
+				changed[f] = struct{}{}
+			}
+		case info.Mode().IsRegular():
+			s.index[p] = info
+			changed[p] = struct{}{}
+		}
+	}
+	return s.upload(ctx, changed)
+}
+
+// moves applies the local renames as remote moves, the removed paths
+// are matched with the new ones by file identity. It returns the
+// paths (both sides) that were moved.
+func (s *watchSession) moves(ctx context.Context, gone, fresh []string, current map[string]os.FileInfo) map[string]bool {
+	moved := make(map[string]bool)
+	if len(gone) == 0 || len(fresh) == 0 {
+		return moved
+	}
+
+	var rm *watchRemote
+	for _, to := range fresh {
+		for _, from := range gone {
+			old, known := s.index[from]
+			if moved[from] || !known || !os.SameFile(old, current[to]) {
+				continue
+			}
+			if rm == nil {
+				var err error
+				if rm, err = s.remote(ctx); err != nil {
+					slog.With("error", err).Warn("failed to move remotely, uploading instead")
+					return moved
+				}
+			}
+			if err := rm.move(ctx, s.remotePath(from), s.remotePath(to)); err != nil {
+				slog.With("error", err, "from", from, "to", to).Warn("failed to move remotely, uploading instead")
+				break
+			}
+			slog.With("from", from, "to", to).Info("moved")
+			s.reindex(from, to)
+			moved[from], moved[to] = true, true
+			break
+		}
+	}
+	return moved
+}
+
+// upload plans and applies the upload of
+// the changed files, root by root
+func (s *watchSession) upload(ctx context.Context, changed map[string]struct{}) error {
+	if len(changed) == 0 {
+		return nil
+	}
+	a, err := s.account(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, r := range s.roots {
+		var files []localFile
+		for p := range changed {
+			rel, err := filepath.Rel(r.local, p)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			files = append(files, localFile{
+				path:   p,
+				remote: cleanRemotePath(path.Join(r.remote, filepath.ToSlash(rel))),
+				size:   s.index[p].Size(),
+			})
+		}
+		if len(files) == 0 {
+			continue
+		}
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].remote < files[j].remote
+		})
+
+		p, err := s.u.planFiles(ctx, a, r.local, r.remote, s.opts.Conflict, files)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("plan %q: %w", r.local, err))
+			continue
+		}
+		if len(p.Operations) == 0 {
+			continue
+		}
+		if err := s.u.apply(ctx, a, p, s.opts.Transfer, false); err != nil {
+			errs = append(errs, fmt.Errorf("sync %q: %w", r.local, err))
+			continue
+		}
+		slog.With(
+			"root", r.local,
+			"uploaded", p.Totals.Upload+p.Totals.Replace+p.Totals.RenameForConflict,
+			"bytes", p.Totals.UploadBytes,
+		).Info("synced changes")
+	}
+	return errors.Join(errs...)
+}
+
+// remotePath returns the remote path of a local path
+func (s *watchSession) remotePath(p string) string {
+	for _, r := range s.roots {
+		rel, err := filepath.Rel(r.local, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return cleanRemotePath(path.Join(r.remote, filepath.ToSlash(rel)))
+	}
+	return ""
+}
+
+// watchTree adds dir and its sub folders to the watcher
+func (s *watchSession) watchTree(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := s.w.Add(p); err != nil {
+			return fmt.Errorf("watch %q: %w", p, err)
+		}
+		return nil
+	})
+}
+
+// indexTree adds dir and its content to the index,
+// it returns the regular files found
+func (s *watchSession) indexTree(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		s.index[p] = info
+		if info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index %q: %w", dir, err)
+	}
+	return files, nil
+}
+
+// reindex moves the index entries from a path (and its content) to
+// another after a rename. The watcher drops the moved folder watch
+// itself, the new path is watched when its create event arrives.
+func (s *watchSession) reindex(from, to string) {
+	for p, info := range s.index {
+		if p == from || strings.HasPrefix(p, from+string(filepath.Separator)) {
+			delete(s.index, p)
+			s.index[to+strings.TrimPrefix(p, from)] = info
+		}
+	}
+	if info, err := os.Lstat(to); err == nil {
+		s.index[to] = info
+	}
+}
+
+// forget removes a path (and its content) from the index
+func (s *watchSession) forget(from string) {
+	for p := range s.index {
+		if p == from || strings.HasPrefix(p, from+string(filepath.Separator)) {
+			delete(s.index, p)
+		}
+	}
+}
+
+// watchRemote resolves the remote items of the watched folders
+type watchRemote struct {
+	c       client.Client
+	kr      *encryption.Keyring
+	driveID string
+	rootID  string
+}
+
+func (s *watchSession) remote(ctx context.Context) (*watchRemote, error) {
+	a, err := s.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+	kr := a.kr
+	if !a.encrypted {
+		kr = nil
+	}
+	root, err := accountRoot(ctx, a.c, a.acc)
+	if err != nil {
+		return nil, err
+	}
+	return &watchRemote{
+		c:       a.c,
+		kr:      kr,
+		driveID: a.acc.Drive.DriveID,
+		rootID:  root.ID,
+	}, nil
+}
+
+func (r *watchRemote) move(ctx context.Context, from, to string) error {
+	item, err := resolveRemote(ctx, r.c, r.kr, r.driveID, r.rootID, from)
+	if err != nil {
+		return err
+	}
+	parent, err := resolveRemote(ctx, r.c, r.kr, r.driveID, r.rootID, path.Dir(to))
+	if err != nil {
+		return err
+	}
+	if !parent.IsFolder() {
+		return fmt.Errorf("remote parent of %q is not a folder", to)
+	}
+
+	name := path.Base(to)
+	if r.kr != nil {
+		if name, err = r.kr.EncryptName(name); err != nil {
+			return fmt.Errorf("encrypt name: %w", err)
+		}
+	}
+	if _, err := r.c.MoveItem(ctx, r.driveID, item.ID, parent.ID, name); err != nil {
+		return err
+	}
+	return nil
+}
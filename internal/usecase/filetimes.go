@@ -0,0 +1,17 @@
+//go:build !windows
+
+package usecase
+
+import (
+	"os"
+	"time"
+)
+
+// setFileTimes sets the modification time of a local file, the
+// creation time can't be changed on this platform and is ignored
+func setFileTimes(name string, _, modified time.Time) error {
+	if modified.IsZero() {
+		return nil
+	}
+	return os.Chtimes(name, modified, modified)
+}
@@ -0,0 +1,32 @@
+package usecase
+
+import (
+	"syscall"
+	"time"
+)
+
+// setFileTimes sets the creation and modification times of a local file
+func setFileTimes(name string, created, modified time.Time) error {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	h, err := syscall.CreateFile(p, syscall.FILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_WRITE, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = syscall.CloseHandle(h)
+	}()
+
+	var c, m *syscall.Filetime
+	if !created.IsZero() {
+		ft := syscall.NsecToFiletime(created.UnixNano())
+		c = &ft
+	}
+	if !modified.IsZero() {
+		ft := syscall.NsecToFiletime(modified.UnixNano())
+		m = &ft
+	}
+	return syscall.SetFileTime(h, c, m, m)
+}
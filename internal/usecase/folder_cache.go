@@ -0,0 +1,168 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/encryption"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// folderCache caches the folder listings of an account by their path
+// relative to the root folder. The listings are kept until they're
+// invalidated or, when ttl is set, until they're older than ttl. It's
+// safe for concurrent use.
+type folderCache struct {
+	root *remoteItem
+	ttl  time.Duration
+
+	mu   sync.Mutex
+	dirs map[string]*cachedDir
+	// encrypted tells if the items are stored encrypted,
+	// by their ID and eTag
+	encrypted map[string]bool
+}
+
+// cachedDir is a cached folder listing
+type cachedDir struct {
+	id      string
+	entries []FileEntry
+	// stored maps the (decrypted) names to the names stored remotely
+	stored map[string]string
+	listed time.Time
+}
+
+func newFolderCache(root *remoteItem, ttl time.Duration) *folderCache {
+	return &folderCache{
+		root:      root,
+		ttl:       ttl,
+		dirs:      map[string]*cachedDir{},
+		encrypted: map[string]bool{},
+	}
+}
+
+// stat returns the item at abs, the errors of missing items wrap fs.ErrNotExist
+func (c *folderCache) stat(ctx context.Context, abs string) (FileEntry, error) {
+	abs = cleanRemotePath(abs)
+	if abs == "" {
+		return newFileEntry("", *c.root.item), nil
+	}
+	parent, err := c.dir(ctx, path.Dir(abs))
+	if err != nil {
+		return FileEntry{}, err
+	}
+	name := path.Base(abs)
+	for _, e := range parent.entries {
+		if e.Name == name {
+			return e, nil
+		}
+	}
+	return FileEntry{}, fmt.Errorf("/%s: %w", abs, fs.ErrNotExist)
+}
+
+// dir returns the listing of the folder at abs
+func (c *folderCache) dir(ctx context.Context, abs string) (*cachedDir, error) {
+	abs = cleanRemotePath(abs)
+	c.mu.Lock()
+	d, ok := c.dirs[abs]
+	c.mu.Unlock()
+	if ok && (c.ttl <= 0 || time.Since(d.listed) < c.ttl) {
+		return d, nil
+	}
+	e, err := c.stat(ctx, abs)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsFolder() {
+		return nil, fmt.Errorf("/%s: not a folder", abs)
+	}
+
+	res, err := c.root.c.ListFiles(ctx, c.root.driveID, e.ID, client.WithSelect(itemFields...))
+	if err != nil {
+		return nil, fmt.Errorf("list remote folder /%s: %w", abs, err)
+	}
+	d = &cachedDir{
+		id:     e.ID,
+		stored: map[string]string{},
+		listed: time.Now(),
+	}
+	for name, v := range decryptedChildren(c.root.kr, res.Value) {
+		d.stored[name] = v.Name
+		v.Name = name
+		d.entries = append(d.entries, newFileEntry(path.Join(abs, name), v))
+	}
+	sort.Slice(d.entries, func(i, j int) bool {
+		return d.entries[i].Name < d.entries[j].Name
+	})
+	c.mu.Lock()
+	c.dirs[abs] = d
+	c.mu.Unlock()
+	return d, nil
+}
+
+// storedName returns the name an item named name is stored with inside
+// parent, the existing name or, for new items, the encrypted one
+func (c *folderCache) storedName(parent *cachedDir, name string) (string, error) {
+	if stored, ok := parent.stored[name]; ok {
+		return stored, nil
+	}
+	kr := c.root.uploadKeyring()
+	if kr == nil {
+		return name, nil
+	}
+	stored, err := kr.EncryptName(name)
+	if err != nil {
+		return "", fmt.Errorf("encrypt name of %q: %w", name, err)
+	}
+	return stored, nil
+}
+
+// plainSize returns the size of the content of the file e and whether
+// it's stored encrypted. The files uploaded while the encryption was
+// disabled are plain, so the first bytes of every file are read once.
+func (c *folderCache) plainSize(ctx context.Context, e FileEntry) (int64, bool, error) {
+	size := int64(e.Size)
+	if c.root.kr == nil || e.IsFolder() || size < encryption.CipherSize(0) {
+		return size, false, nil
+	}
+	key := e.ID + "@" + e.ETag
+	c.mu.Lock()
+	encrypted, ok := c.encrypted[key]
+	c.mu.Unlock()
+	if !ok {
+		var err error
+		if encrypted, err = isEncryptedItem(ctx, c.root.c, c.root.driveID, e.ID); err != nil {
+			return 0, false, fmt.Errorf("read /%s: %w", e.Path, err)
+		}
+		c.mu.Lock()
+		c.encrypted[key] = encrypted
+		c.mu.Unlock()
+	}
+	if !encrypted {
+		return size, false, nil
+	}
+	// the stored size is the encrypted one
+	return encryption.PlainSize(size), true, nil
+}
+
+// invalidate drops the cached listings of the folder at abs and its descendants
+func (c *folderCache) invalidate(abs string) {
+	abs = cleanRemotePath(abs)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for p := range c.dirs {
+		if within(p, abs) {
+			delete(c.dirs, p)
+		}
+	}
+}
+
+// within tells if p is dir or one of its descendants
+func within(p, dir string) bool {
+	return dir == "" || p == dir || strings.HasPrefix(p, dir+"/")
+}
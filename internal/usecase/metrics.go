@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"log/slog"
+	"time"
+)
+
+type MetricsUseCase struct {
+	r *persistence.AuthRepository
+}
+
+func newMetricsUseCase(r *persistence.AuthRepository) *MetricsUseCase {
+	return &MetricsUseCase{
+		r: r,
+	}
+}
+
+// UpdateQuotas fetches the drive of every account
+// and sets their quota in the client metrics
+func (u *MetricsUseCase) UpdateQuotas(ctx context.Context) error {
+	names, err := u.r.FindAllNames(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range names {
+		acc, err := loadSession(ctx, u.r, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		drive, err := newAccountClient(u.r, acc).GetDrive(ctx, acc.Drive.DriveID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", name, err))
+			continue
+		}
+		client.DefaultMetrics.SetQuota(name, drive.Quota)
+	}
+	return errors.Join(errs...)
+}
+
+// WatchQuotas updates the quotas every interval until ctx is done
+func (u *MetricsUseCase) WatchQuotas(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := u.UpdateQuotas(ctx); err != nil && ctx.Err() == nil {
+			slog.With("error", err).WarnContext(ctx, "failed to update the quotas")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
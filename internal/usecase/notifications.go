@@ -0,0 +1,388 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/model"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeRemoved  = "removed"
+
+	// defaultSubscriptionLifetime is how long the subscriptions
+	// last when NotificationsOptions doesn't tell it
+	defaultSubscriptionLifetime = 72 * time.Hour
+	// subscriptionRetryDelay is the wait before trying
+	// again to renew (or create) a subscription
+	subscriptionRetryDelay = time.Minute
+	// maxNotificationSize bounds the notification payloads read
+	maxNotificationSize = 1 << 20
+)
+
+// NotificationsOptions configures the notification receiver
+type NotificationsOptions struct {
+	// NotificationURL is the public (https) URL the API posts
+	// the notifications to, it must reach the receiver
+	NotificationURL string
+	// Lifetime is how long the subscription lasts between renewals,
+	// it's capped to the longest the API allows
+	Lifetime time.Duration
+	// Unsubscribe deletes the subscription when the receiver stops,
+	// otherwise it's kept and reused by the next receiver
+	Unsubscribe bool
+}
+
+// Change is a change of the account folder found
+// after a notification
+type Change struct {
+	// Kind is ChangeAdded, ChangeModified or ChangeRemoved
+	Kind  string
+	Entry FileEntry
+}
+
+type NotificationsUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+	sr *persistence.SubscriptionRepository
+}
+
+func newNotificationsUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository, sr *persistence.SubscriptionRepository) *NotificationsUseCase {
+	return &NotificationsUseCase{
+		r:  r,
+		er: er,
+		sr: sr,
+	}
+}
+
+// NotificationReceiver is the http.Handler receiving the notifications
+// of a drive subscription, Run subscribes and reports the changes
+type NotificationReceiver struct {
+	sr        *persistence.SubscriptionRepository
+	f         *remoteItem
+	accountID string
+	opts      NotificationsOptions
+	onChange  func(Change)
+
+	// notified has a pending notification to handle
+	notified chan struct{}
+
+	mu  sync.Mutex
+	sub *model.Subscription
+	// entries is the last listing of the account folder, by path
+	entries map[string]FileEntry
+}
+
+// Receiver returns the notification receiver of the account, onChange is
+// called with the changes found after every notification. The receiver
+// must be served on opts.NotificationURL before calling Run.
+func (u *NotificationsUseCase) Receiver(ctx context.Context, accName string, opts NotificationsOptions, onChange func(Change)) (*NotificationReceiver, error) {
+	if opts.NotificationURL == "" {
+		return nil, errors.New("the notification URL is required")
+	}
+	if opts.Lifetime <= 0 {
+		opts.Lifetime = defaultSubscriptionLifetime
+	}
+	opts.Lifetime = min(opts.Lifetime, client.MaxSubscriptionLifetime)
+
+	acc, err := loadSession(ctx, u.r, accName)
+	if err != nil {
+		return nil, fmt.Errorf("loadSession: %w", err)
+	}
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, "")
+	if err != nil {
+		return nil, err
+	}
+	return &NotificationReceiver{
+		sr:        u.sr,
+		f:         f,
+		accountID: acc.ID,
+		opts:      opts,
+		onChange:  onChange,
+		notified:  make(chan struct{}, 1),
+	}, nil
+}
+
+// ServeHTTP answers the validation requests sent when the subscription
+// is created and queues the notifications with the expected client state
+func (n *NotificationReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if token := r.URL.Query().Get("validationToken"); token != "" {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, token)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var payload types.Notifications
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxNotificationSize)).Decode(&payload); err != nil {
+		http.Error(w, "invalid notification payload", http.StatusBadRequest)
+		return
+	}
+	valid := false
+	for _, ntf := range payload.Value {
+		if !n.genuine(ntf) {
+			slog.With("subscription", ntf.SubscriptionID).WarnContext(r.Context(), "notification with an unexpected client state ignored")
+			continue
+		}
+		slog.With("subscription", ntf.SubscriptionID, "resource", ntf.Resource).DebugContext(r.Context(), "notification received")
+		valid = true
+	}
+	if valid {
+		select {
+		case n.notified <- struct{}{}:
+		default:
+		}
+	}
+	// the API expects a quick answer, the changes are listed later
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// genuine tells if the notification was sent for the current subscription
+func (n *NotificationReceiver) genuine(ntf types.Notification) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.sub == nil || ntf.SubscriptionID != n.sub.ID {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(ntf.ClientState), []byte(n.sub.ClientState)) == 1
+}
+
+// Run lists the account folder, subscribes to the drive changes and
+// then, until ctx is done, lists the folder again after every
+// notification and renews the subscription before it expires
+func (n *NotificationReceiver) Run(ctx context.Context) error {
+	entries, err := n.list(ctx, nil)
+	if err != nil {
+		return err
+	}
+	n.entries = entries
+	if err := n.subscribe(ctx); err != nil {
+		return err
+	}
+	if n.opts.Unsubscribe {
+		defer n.unsubscribe()
+	}
+
+	renew := time.NewTimer(n.renewIn())
+	defer renew.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-renew.C:
+			if err := n.renew(ctx); err != nil {
+				slog.With("error", err).WarnContext(ctx, "failed to renew the subscription")
+				renew.Reset(subscriptionRetryDelay)
+				continue
+			}
+			renew.Reset(n.renewIn())
+		case <-n.notified:
+			if err := n.refresh(ctx); err != nil {
+				slog.With("error", err).WarnContext(ctx, "failed to list the changes")
+			}
+		}
+	}
+}
+
+// subscribe renews the persisted subscription of the notification URL or,
+// when there's none, creates one. The subscriptions persisted for other
+// URLs are deleted.
+func (n *NotificationReceiver) subscribe(ctx context.Context) error {
+	subs, err := n.sr.FindByAccountID(ctx, n.accountID)
+	if err != nil {
+		return err
+	}
+	for _, s := range subs {
+		if s.NotificationURL == n.opts.NotificationURL && n.current() == nil {
+			n.setCurrent(&s)
+			err := n.renew(ctx)
+			if err == nil {
+				continue
+			}
+			slog.With("subscription", s.ID, "error", err).WarnContext(ctx, "failed to renew the persisted subscription")
+			n.setCurrent(nil)
+		}
+		if err := n.f.c.DeleteSubscription(ctx, s.ID); err != nil && !client.IsNotFound(err) {
+			slog.With("subscription", s.ID, "error", err).WarnContext(ctx, "failed to delete the subscription")
+		}
+		if err := n.sr.Delete(ctx, s.ID); err != nil {
+			return err
+		}
+	}
+	if n.current() != nil {
+		return nil
+	}
+	return n.create(ctx)
+}
+
+// create creates a new subscription with a new client state
+func (n *NotificationReceiver) create(ctx context.Context) error {
+	state := make([]byte, 32)
+	if _, err := rand.Read(state); err != nil {
+		return fmt.Errorf("generate client state: %w", err)
+	}
+	s := &model.Subscription{
+		AccountID:       n.accountID,
+		NotificationURL: n.opts.NotificationURL,
+		ClientState:     hex.EncodeToString(state),
+	}
+	res, err := n.f.c.CreateSubscription(ctx, n.f.driveID, s.NotificationURL, s.ClientState, time.Now().Add(n.opts.Lifetime))
+	if err != nil {
+		return err
+	}
+	s.ID, s.ExpiresAt = res.ID, res.ExpirationDateTime
+	n.setCurrent(s)
+	if err := n.sr.Persist(ctx, s); err != nil {
+		return err
+	}
+	slog.With("subscription", s.ID, "expires", s.ExpiresAt).InfoContext(ctx, "subscription created")
+	return nil
+}
+
+// renew extends the current subscription, a new one is
+// created when it's gone (it expired or was deleted)
+func (n *NotificationReceiver) renew(ctx context.Context) error {
+	s := *n.current()
+	res, err := n.f.c.RenewSubscription(ctx, s.ID, time.Now().Add(n.opts.Lifetime))
+	if client.IsNotFound(err) {
+		if err := n.sr.Delete(ctx, s.ID); err != nil {
+			return err
+		}
+		return n.create(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	s.ExpiresAt = res.ExpirationDateTime
+	n.setCurrent(&s)
+	if err := n.sr.Persist(ctx, &s); err != nil {
+		return err
+	}
+	slog.With("subscription", s.ID, "expires", s.ExpiresAt).InfoContext(ctx, "subscription renewed")
+	return nil
+}
+
+// unsubscribe deletes the current subscription
+func (n *NotificationReceiver) unsubscribe() {
+	s := n.current()
+	if s == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := n.f.c.DeleteSubscription(ctx, s.ID); err != nil && !client.IsNotFound(err) {
+		slog.With("subscription", s.ID, "error", err).WarnContext(ctx, "failed to delete the subscription")
+		return
+	}
+	if err := n.sr.Delete(ctx, s.ID); err != nil {
+		slog.With("subscription", s.ID, "error", err).WarnContext(ctx, "failed to delete the persisted subscription")
+	}
+}
+
+// renewIn is the wait before renewing the current subscription, a
+// quarter of its lifetime before it expires
+func (n *NotificationReceiver) renewIn() time.Duration {
+	return max(time.Until(n.current().ExpiresAt.Add(-n.opts.Lifetime/4)), 0)
+}
+
+func (n *NotificationReceiver) current() *model.Subscription {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.sub
+}
+
+func (n *NotificationReceiver) setCurrent(s *model.Subscription) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sub = s
+}
+
+// refresh lists the account folder again and reports the changes
+func (n *NotificationReceiver) refresh(ctx context.Context) error {
+	entries, err := n.list(ctx, n.entries)
+	if err != nil {
+		return err
+	}
+	var changes []Change
+	for p, e := range entries {
+		prev, ok := n.entries[p]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: ChangeAdded, Entry: e})
+		case !e.IsFolder() && e.ETag != prev.ETag:
+			changes = append(changes, Change{Kind: ChangeModified, Entry: e})
+		}
+	}
+	for p, e := range n.entries {
+		if _, ok := entries[p]; !ok {
+			changes = append(changes, Change{Kind: ChangeRemoved, Entry: e})
+		}
+	}
+	n.entries = entries
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Entry.Path < changes[j].Entry.Path
+	})
+	for _, c := range changes {
+		n.onChange(c)
+	}
+	return nil
+}
+
+// list lists the account folder tree, the subfolders unchanged since the
+// previous listing (same eTag, size and modification time) aren't listed
+// again, their previous entries are kept
+func (n *NotificationReceiver) list(ctx context.Context, prev map[string]FileEntry) (map[string]FileEntry, error) {
+	entries := map[string]FileEntry{}
+	var walk func(id, dir string) error
+	walk = func(id, dir string) error {
+		children, err := n.f.children(ctx, id, dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range children {
+			entries[e.Path] = e
+			if !e.IsFolder() {
+				continue
+			}
+			if p, ok := prev[e.Path]; ok && p.ID == e.ID && p.ETag == e.ETag && p.Size == e.Size && p.LastModifiedDateTime.Equal(e.LastModifiedDateTime) {
+				keepSubtree(entries, prev, e.Path)
+				continue
+			}
+			if err := walk(e.ID, e.Path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(n.f.item.ID, ""); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// keepSubtree copies the prev entries below the folder dir into entries
+func keepSubtree(entries, prev map[string]FileEntry, dir string) {
+	for p, e := range prev {
+		if strings.HasPrefix(p, dir+"/") {
+			entries[p] = e
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// OperationType is the kind of change a plan operation makes
+type OperationType string
+
+const (
+	OperationMkdir             OperationType = "mkdir"
+	OperationUpload            OperationType = "upload"
+	OperationReplace           OperationType = "replace"
+	OperationRenameForConflict OperationType = "rename-for-conflict"
+)
+
+const (
+	// ConflictReplace overwrites the remote files that differ
+	ConflictReplace = "replace"
+	// ConflictRename uploads the files that differ with a new name
+	ConflictRename = "rename"
+	// ConflictSkip leaves the remote files that differ untouched
+	ConflictSkip = "skip"
+)
+
+// Operation is a single remote change of a plan
+type Operation struct {
+	Type OperationType `json:"type"`
+	// Path is the remote path, relative to the account root folder
+	Path      string `json:"path"`
+	LocalPath string `json:"local_path,omitempty"`
+	IsFolder  bool   `json:"is_folder,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Reason    string `json:"reason"`
+	// ParentID is the remote parent folder, empty when
+	// the parent folder is created by the plan itself
+	ParentID string `json:"parent_id,omitempty"`
+	// RemoteID and RemoteETag identify the remote item found
+	// when planning, both are empty when it didn't exist
+	RemoteID   string `json:"remote_id,omitempty"`
+	RemoteETag string `json:"remote_etag,omitempty"`
+	// RemoteName is the stored name when it differs from
+	// the path base name (encrypted names)
+	RemoteName string `json:"remote_name,omitempty"`
+}
+
+func (op Operation) remoteName() string {
+	if op.RemoteName != "" {
+		return op.RemoteName
+	}
+	return path.Base(op.Path)
+}
+
+// PlanTotals summarizes a plan
+type PlanTotals struct {
+	Mkdir             int   `json:"mkdir"`
+	Upload            int   `json:"upload"`
+	Replace           int   `json:"replace"`
+	RenameForConflict int   `json:"rename_for_conflict"`
+	Unchanged         int   `json:"unchanged"`
+	Skipped           int   `json:"skipped"`
+	UploadBytes       int64 `json:"upload_bytes"`
+}
+
+// Plan is the list of operations needed to
+// mirror a local tree into the remote drive
+type Plan struct {
+	Account     string      `json:"account"`
+	Source      string      `json:"source,omitempty"`
+	Destination string      `json:"destination,omitempty"`
+	Conflict    string      `json:"conflict,omitempty"`
+	Encrypted   bool        `json:"encrypted,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Operations  []Operation `json:"operations"`
+	Totals      PlanTotals  `json:"totals"`
+}
+
+func (p *Plan) add(op Operation) {
+	p.Operations = append(p.Operations, op)
+	switch op.Type {
+	case OperationMkdir:
+		p.Totals.Mkdir++
+	case OperationUpload:
+		p.Totals.Upload++
+	case OperationReplace:
+		p.Totals.Replace++
+	case OperationRenameForConflict:
+		p.Totals.RenameForConflict++
+	}
+	if !op.IsFolder {
+		p.Totals.UploadBytes += op.Size
+	}
+}
+
+// SavePlan writes the plan as JSON into file
+func SavePlan(p *Plan, file string) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal plan: %w", err)
+	}
+	if err := os.WriteFile(file, b, 0o600); err != nil {
+		return fmt.Errorf("write plan file: %w", err)
+	}
+	return nil
+}
+
+// LoadPlan reads a plan saved by SavePlan
+func LoadPlan(file string) (*Plan, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read plan file: %w", err)
+	}
+	var p Plan
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("parse plan file: %w", err)
+	}
+	return &p, nil
+}
+
+// verifyPlan checks the remote items are still the
+// ones seen when planning, comparing their eTags
+func verifyPlan(ctx context.Context, c client.Client, driveID string, p *Plan) error {
+	listings := make(map[string]map[string]types.Value)
+	for _, op := range p.Operations {
+		if op.ParentID == "" {
+			continue
+		}
+		children, ok := listings[op.ParentID]
+		if !ok {
+			res, err := c.ListFiles(ctx, driveID, op.ParentID, client.WithSelect("id", "name", "eTag"))
+			if err != nil {
+				return fmt.Errorf("list remote folder of %q: %w", op.Path, err)
+			}
+			children = childrenByName(res.Value)
+			listings[op.ParentID] = children
+		}
+
+		remote, exists := children[nameKey(op.remoteName())]
+		switch {
+		case op.RemoteETag == "" && exists:
+			return fmt.Errorf("plan is stale: %q was created since it was planned", op.Path)
+		case op.RemoteETag != "" && !exists:
+			return fmt.Errorf("plan is stale: %q was removed since it was planned", op.Path)
+		case op.RemoteETag != "" && remote.ETag != op.RemoteETag:
+			return fmt.Errorf("plan is stale: %q changed since it was planned (eTag %s, was %s)", op.Path, remote.ETag, op.RemoteETag)
+		}
+	}
+	return nil
+}
+
+// childrenByName maps the items by their name key
+func childrenByName(values []types.Value) map[string]types.Value {
+	m := make(map[string]types.Value, len(values))
+	for _, v := range values {
+		m[nameKey(v.Name)] = v
+	}
+	return m
+}
+
+// foldNames maps the children by the key of their name
+func foldNames(children map[string]types.Value) map[string]types.Value {
+	m := make(map[string]types.Value, len(children))
+	for name, v := range children {
+		m[nameKey(name)] = v
+	}
+	return m
+}
+
+// nameKey is how an item name is matched by the planner, OneDrive
+// names are case-insensitive ("Foo.txt" is the same item as "foo.txt")
+func nameKey(name string) string {
+	return strings.ToLower(name)
+}
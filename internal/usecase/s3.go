@@ -0,0 +1,686 @@
+package usecase
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"github.com/eldius/onedrive-client/internal/s3"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+type S3UseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+}
+
+func newS3UseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *S3UseCase {
+	return &S3UseCase{
+		r:  r,
+		er: er,
+	}
+}
+
+// S3Options configures the served buckets
+type S3Options struct {
+	// CacheTTL is how long the folder listings are cached
+	CacheTTL time.Duration
+	Transfer TransferOptions
+}
+
+// Backend returns the account root folder as an S3 backend: its
+// folders are the buckets and the paths below them the keys. Objects
+// are spooled into temporary files before they're uploaded, the parts
+// of the multipart uploads are kept until the upload is completed and
+// then sent through a drive upload session, which needs the total (and
+// encrypted) size up front. The uploads in progress are only tracked in
+// memory, they're lost when the server stops.
+func (u *S3UseCase) Backend(ctx context.Context, accName string, opts S3Options) (s3.Backend, error) {
+	tOpts := opts.Transfer.withDefaults()
+	cOpts, err := tOpts.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	root, err := resolveAccountItem(ctx, u.r, u.er, accName, "", cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := os.MkdirTemp("", "onedrive-s3-*")
+	if err != nil {
+		return nil, fmt.Errorf("create parts folder: %w", err)
+	}
+	return &s3Backend{
+		root:    root,
+		opts:    tOpts,
+		cache:   newFolderCache(root, opts.CacheTTL),
+		parts:   parts,
+		uploads: map[string]*s3Upload{},
+	}, nil
+}
+
+type s3Backend struct {
+	root  *remoteItem
+	opts  TransferOptions
+	cache *folderCache
+	// parts holds the parts of the multipart uploads
+	parts string
+
+	mu      sync.Mutex
+	uploads map[string]*s3Upload
+}
+
+// s3Upload is a multipart upload, its parts are stored in dir
+type s3Upload struct {
+	abs     string
+	session *types.UploadSession
+	dir     string
+
+	mu    sync.Mutex
+	parts map[int]s3Part
+}
+
+type s3Part struct {
+	path string
+	size int64
+	etag string
+}
+
+func (b *s3Backend) ListBuckets(ctx context.Context) ([]s3.Bucket, error) {
+	d, err := b.cache.dir(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var buckets []s3.Bucket
+	for _, e := range d.entries {
+		if e.IsFolder() {
+			buckets = append(buckets, s3.Bucket{Name: e.Name, Created: e.CreatedDateTime})
+		}
+	}
+	return buckets, nil
+}
+
+func (b *s3Backend) CreateBucket(ctx context.Context, bucket string) error {
+	if !validName(bucket) {
+		return fmt.Errorf("%q: %w", bucket, s3.ErrInvalidBucket)
+	}
+	if _, err := b.cache.stat(ctx, bucket); err == nil {
+		return fmt.Errorf("%q: %w", bucket, s3.ErrBucketExists)
+	}
+	_, err := b.mkdirAll(ctx, bucket)
+	return err
+}
+
+func (b *s3Backend) HeadBucket(ctx context.Context, bucket string) error {
+	if !validName(bucket) {
+		return fmt.Errorf("%q: %w", bucket, s3.ErrNoSuchBucket)
+	}
+	e, err := b.cache.stat(ctx, bucket)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && !e.IsFolder() {
+		return fmt.Errorf("%q: %w", bucket, s3.ErrNoSuchBucket)
+	}
+	return err
+}
+
+// objectPath returns the path of an object relative to the root folder,
+// keys with empty, "." or ".." segments can't be stored as paths
+func (b *s3Backend) objectPath(ctx context.Context, bucket, key string) (string, error) {
+	if err := b.HeadBucket(ctx, bucket); err != nil {
+		return "", err
+	}
+	for _, name := range strings.Split(strings.TrimSuffix(key, "/"), "/") {
+		if !validName(name) {
+			return "", fmt.Errorf("%q: %w", key, s3.ErrInvalidKey)
+		}
+	}
+	return bucket + "/" + strings.TrimSuffix(key, "/"), nil
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+func (b *s3Backend) ListObjects(ctx context.Context, bucket, prefix string, recursive bool) ([]s3.Object, []string, error) {
+	if err := b.HeadBucket(ctx, bucket); err != nil {
+		return nil, nil, err
+	}
+	// the deepest folder holding all the keys with the prefix
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i]
+	}
+	l := &s3Listing{backend: b, bucket: bucket, prefix: prefix, recursive: recursive}
+	if err := l.walk(ctx, dir); err != nil {
+		return nil, nil, err
+	}
+	return l.objects, l.prefixes, nil
+}
+
+// s3Listing collects the objects and common prefixes of a listing
+type s3Listing struct {
+	backend   *s3Backend
+	bucket    string
+	prefix    string
+	recursive bool
+
+	objects  []s3.Object
+	prefixes []string
+}
+
+func (l *s3Listing) walk(ctx context.Context, dir string) error {
+	abs := path.Join(l.bucket, dir)
+	e, err := l.backend.cache.stat(ctx, abs)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && !e.IsFolder() {
+		// keys can't go below a missing folder or a file
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	d, err := l.backend.cache.dir(ctx, abs)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range d.entries {
+		key := path.Join(dir, e.Name)
+		if !e.IsFolder() {
+			if strings.HasPrefix(key, l.prefix) {
+				o, err := l.backend.object(ctx, key, e)
+				if err != nil {
+					return err
+				}
+				l.objects = append(l.objects, o)
+			}
+			continue
+		}
+		p := key + "/"
+		if !strings.HasPrefix(p, l.prefix) && !strings.HasPrefix(l.prefix, p) {
+			continue
+		}
+		if l.recursive || strings.HasPrefix(l.prefix, p) {
+			if err := l.walk(ctx, key); err != nil {
+				return err
+			}
+			continue
+		}
+		l.prefixes = append(l.prefixes, p)
+	}
+	return nil
+}
+
+func (b *s3Backend) HeadObject(ctx context.Context, bucket, key string) (s3.Object, error) {
+	_, o, err := b.stat(ctx, bucket, key)
+	return o, err
+}
+
+// stat returns the item of an object, keys ending with "/"
+// are the (empty) folder markers of the existing folders
+func (b *s3Backend) stat(ctx context.Context, bucket, key string) (FileEntry, s3.Object, error) {
+	abs, err := b.objectPath(ctx, bucket, key)
+	if errors.Is(err, s3.ErrInvalidKey) {
+		return FileEntry{}, s3.Object{}, fmt.Errorf("%q: %w", key, s3.ErrNoSuchKey)
+	}
+	if err != nil {
+		return FileEntry{}, s3.Object{}, err
+	}
+	e, err := b.cache.stat(ctx, abs)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && e.IsFolder() != strings.HasSuffix(key, "/") {
+		return FileEntry{}, s3.Object{}, fmt.Errorf("%q: %w", key, s3.ErrNoSuchKey)
+	}
+	if err != nil {
+		return FileEntry{}, s3.Object{}, err
+	}
+	o, err := b.object(ctx, key, e)
+	if err != nil {
+		return FileEntry{}, s3.Object{}, err
+	}
+	return e, o, nil
+}
+
+func (b *s3Backend) object(ctx context.Context, key string, e FileEntry) (s3.Object, error) {
+	o := s3.Object{
+		Key:         key,
+		Modified:    e.Modified,
+		ETag:        itemETag(e),
+		ContentType: "application/octet-stream",
+	}
+	if e.IsFolder() {
+		return o, nil
+	}
+	size, encrypted, err := b.cache.plainSize(ctx, e)
+	if err != nil {
+		return s3.Object{}, err
+	}
+	o.Size = size
+	if t := mime.TypeByExtension(path.Ext(key)); t != "" {
+		o.ContentType = t
+	} else if !encrypted && e.File.MimeType != "" {
+		o.ContentType = e.File.MimeType
+	}
+	return o, nil
+}
+
+// itemETag is the entity tag of an item, the hex encoded quickXorHash
+// (which can't be mistaken for an MD5) or else the drive eTag
+func itemETag(e FileEntry) string {
+	if h, err := base64.StdEncoding.DecodeString(e.File.Hashes.QuickXorHash); err == nil && len(h) > 0 {
+		return `"` + hex.EncodeToString(h) + `"`
+	}
+	return `"` + strings.Trim(e.ETag, `"`) + `"`
+}
+
+func (b *s3Backend) GetObject(ctx context.Context, bucket, key string, offset int64, w io.Writer) error {
+	e, _, err := b.stat(ctx, bucket, key)
+	if err != nil || e.IsFolder() {
+		return err
+	}
+	_, encrypted, err := b.cache.plainSize(ctx, e)
+	if err != nil {
+		return err
+	}
+	var opts []client.TransferOption
+	if !encrypted {
+		opts = append(opts, client.WithOffset(offset))
+	} else if offset > 0 {
+		// encrypted content is decrypted from its start
+		w = &skipWriter{w: w, skip: offset}
+	}
+	if _, _, err := downloadItem(ctx, b.root.c, b.root.kr, b.root.driveID, e.ID, "", w, opts...); err != nil {
+		return fmt.Errorf("download /%s: %w", e.Path, err)
+	}
+	return nil
+}
+
+// skipWriter discards the first skip bytes written
+type skipWriter struct {
+	w    io.Writer
+	skip int64
+}
+
+func (s *skipWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if s.skip > 0 {
+		skipped := min(int64(len(p)), s.skip)
+		s.skip -= skipped
+		p = p[skipped:]
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+	if _, err := s.w.Write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (b *s3Backend) PutObject(ctx context.Context, bucket, key string, r io.Reader) error {
+	abs, err := b.objectPath(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(key, "/") {
+		// folder markers create the folder, they can't have content
+		if n, err := io.Copy(io.Discard, r); err != nil || n > 0 {
+			return errors.Join(fmt.Errorf("%q has content: %w", key, s3.ErrInvalidKey), err)
+		}
+		_, err := b.mkdirAll(ctx, abs)
+		return err
+	}
+
+	tmp, err := os.CreateTemp(b.parts, "object-*")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return fmt.Errorf("receive content: %w", err)
+	}
+
+	parent, stored, err := b.target(ctx, abs)
+	if err != nil {
+		return err
+	}
+	up := fileUpload{
+		file:     localFile{path: tmp.Name(), remote: abs, size: size},
+		name:     stored,
+		parentID: parent.id,
+		behavior: client.ConflictBehaviorReplace,
+		kr:       b.root.uploadKeyring(),
+	}
+	err = uploadLocalFile(ctx, b.root.c, b.root.driveID, up, b.opts, nil)
+	b.cache.invalidate(path.Dir(abs))
+	if err != nil {
+		return fmt.Errorf("upload /%s: %w", abs, err)
+	}
+	return nil
+}
+
+// target returns the folder and the stored name of a new object,
+// creating the missing folders. The keys can't replace folders.
+func (b *s3Backend) target(ctx context.Context, abs string) (*cachedDir, string, error) {
+	if e, err := b.cache.stat(ctx, abs); err == nil && e.IsFolder() {
+		return nil, "", fmt.Errorf("/%s is a folder: %w", abs, s3.ErrInvalidKey)
+	}
+	parent, err := b.mkdirAll(ctx, path.Dir(abs))
+	if err != nil {
+		return nil, "", err
+	}
+	stored, err := b.cache.storedName(parent, path.Base(abs))
+	if err != nil {
+		return nil, "", err
+	}
+	return parent, stored, nil
+}
+
+// mkdirAll returns the listing of the folder at abs, creating it and
+// its missing parents
+func (b *s3Backend) mkdirAll(ctx context.Context, abs string) (*cachedDir, error) {
+	d, err := b.cache.dir(ctx, abs)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return d, err
+	}
+	parent, err := b.mkdirAll(ctx, path.Dir(abs))
+	if err != nil {
+		return nil, err
+	}
+	stored, err := b.cache.storedName(parent, path.Base(abs))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := b.root.c.CreateFolder(ctx, stored, parent.id, b.root.driveID); err != nil {
+		return nil, fmt.Errorf("create folder /%s: %w", abs, err)
+	}
+	b.cache.invalidate(path.Dir(abs))
+	return b.cache.dir(ctx, abs)
+}
+
+func (b *s3Backend) DeleteObject(ctx context.Context, bucket, key string) error {
+	e, _, err := b.stat(ctx, bucket, key)
+	if errors.Is(err, s3.ErrNoSuchKey) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if e.IsFolder() {
+		// the folder marker goes away with the folder content
+		d, err := b.cache.dir(ctx, e.Path)
+		if err != nil || len(d.entries) > 0 {
+			return err
+		}
+	}
+	if err := b.root.c.DeleteItem(ctx, b.root.driveID, e.ID); err != nil {
+		return fmt.Errorf("remove /%s: %w", e.Path, err)
+	}
+	b.cache.invalidate(path.Dir(e.Path))
+	return nil
+}
+
+func (b *s3Backend) CreateMultipartUpload(ctx context.Context, bucket, key string) (string, error) {
+	abs, err := b.objectPath(ctx, bucket, key)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(key, "/") {
+		return "", fmt.Errorf("%q is a folder marker: %w", key, s3.ErrInvalidKey)
+	}
+	up := &s3Upload{abs: abs, parts: map[int]s3Part{}}
+	if up.session, err = b.createSession(ctx, abs); err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	uploadID := hex.EncodeToString(id)
+	if up.dir, err = os.MkdirTemp(b.parts, "upload-*"); err != nil {
+		b.cancelSession(up.session)
+		return "", fmt.Errorf("create upload folder: %w", err)
+	}
+	b.mu.Lock()
+	b.uploads[uploadID] = up
+	b.mu.Unlock()
+	return uploadID, nil
+}
+
+// createSession creates the drive upload session of the object at abs
+func (b *s3Backend) createSession(ctx context.Context, abs string) (*types.UploadSession, error) {
+	parent, stored, err := b.target(ctx, abs)
+	if err != nil {
+		return nil, err
+	}
+	session, err := b.root.c.CreateUploadSession(ctx, b.root.driveID, parent.id, stored, client.WithConflictBehavior(client.ConflictBehaviorReplace))
+	if err != nil {
+		return nil, fmt.Errorf("create upload session of /%s: %w", abs, err)
+	}
+	return session, nil
+}
+
+func (b *s3Backend) cancelSession(session *types.UploadSession) {
+	if err := b.root.c.CancelUploadSession(context.Background(), session); err != nil {
+		slog.With("error", err).Warn("cancel upload session")
+	}
+}
+
+// upload returns the multipart upload of the object
+func (b *s3Backend) upload(ctx context.Context, bucket, key, uploadID string) (*s3Upload, error) {
+	abs, err := b.objectPath(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	up, ok := b.uploads[uploadID]
+	b.mu.Unlock()
+	if !ok || up.abs != abs {
+		return nil, fmt.Errorf("%q: %w", uploadID, s3.ErrNoSuchUpload)
+	}
+	return up, nil
+}
+
+func (b *s3Backend) UploadPart(ctx context.Context, bucket, key, uploadID string, number int, r io.Reader) (string, error) {
+	up, err := b.upload(ctx, bucket, key, uploadID)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(up.dir, fmt.Sprintf("part-%05d-*", number))
+	if err != nil {
+		return "", fmt.Errorf("create part file: %w", err)
+	}
+	h := md5.New()
+	size, err := io.Copy(io.MultiWriter(f, h), r)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("receive part %d: %w", number, err)
+	}
+
+	part := s3Part{path: f.Name(), size: size, etag: `"` + hex.EncodeToString(h.Sum(nil)) + `"`}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if old, ok := up.parts[number]; ok {
+		_ = os.Remove(old.path)
+	}
+	up.parts[number] = part
+	return part.etag, nil
+}
+
+func (b *s3Backend) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []s3.Part) error {
+	up, err := b.upload(ctx, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+
+	var (
+		content = &partsReader{}
+		size    int64
+	)
+	defer content.Close()
+	for i, p := range parts {
+		stored, ok := up.parts[p.Number]
+		if !ok || stored.etag != p.ETag {
+			return fmt.Errorf("part %d: %w", p.Number, s3.ErrInvalidPart)
+		}
+		if i < len(parts)-1 && stored.size < s3.MinPartSize {
+			return fmt.Errorf("part %d: %w", p.Number, s3.ErrEntityTooSmall)
+		}
+		if err := content.add(stored); err != nil {
+			return err
+		}
+		size += stored.size
+	}
+
+	var r io.ReaderAt = content
+	if kr := b.root.uploadKeyring(); kr != nil {
+		enc, err := kr.NewEncrypter(content, size)
+		if err != nil {
+			return fmt.Errorf("encrypt content: %w", err)
+		}
+		r, size = enc, enc.Size()
+	}
+	if err := b.uploadParts(ctx, up, r, size); err != nil {
+		return fmt.Errorf("upload /%s: %w", up.abs, err)
+	}
+	b.cache.invalidate(path.Dir(up.abs))
+
+	b.mu.Lock()
+	delete(b.uploads, uploadID)
+	b.mu.Unlock()
+	_ = os.RemoveAll(up.dir)
+	return nil
+}
+
+// uploadParts sends the content through the upload session, a new
+// one replaces the session when it expired or a previous attempt failed
+func (b *s3Backend) uploadParts(ctx context.Context, up *s3Upload, r io.ReaderAt, size int64) error {
+	if size == 0 {
+		// sessions can't upload empty content
+		b.cancelSession(up.session)
+		up.session = nil
+		parent, stored, err := b.target(ctx, up.abs)
+		if err != nil {
+			return err
+		}
+		_, err = b.root.c.UploadFile(ctx, b.root.driveID, parent.id, stored, r, 0, client.WithConflictBehavior(client.ConflictBehaviorReplace))
+		return err
+	}
+
+	if up.session == nil || time.Now().After(up.session.ExpirationDateTime) {
+		session, err := b.createSession(ctx, up.abs)
+		if err != nil {
+			return err
+		}
+		up.session = session
+	}
+	if _, err := b.root.c.UploadToSession(ctx, up.session, r, size, b.opts.transferOptions()...); err != nil {
+		b.cancelSession(up.session)
+		up.session = nil
+		return err
+	}
+	return nil
+}
+
+func (b *s3Backend) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	up, err := b.upload(ctx, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	delete(b.uploads, uploadID)
+	b.mu.Unlock()
+	b.abort(up)
+	return nil
+}
+
+func (b *s3Backend) abort(up *s3Upload) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if up.session != nil {
+		b.cancelSession(up.session)
+	}
+	_ = os.RemoveAll(up.dir)
+}
+
+// Close aborts the uploads that weren't completed
+func (b *s3Backend) Close() error {
+	b.mu.Lock()
+	uploads := b.uploads
+	b.uploads = map[string]*s3Upload{}
+	b.mu.Unlock()
+	for _, up := range uploads {
+		b.abort(up)
+	}
+	return os.RemoveAll(b.parts)
+}
+
+// partsReader reads the part files one after the other
+type partsReader struct {
+	files   []*os.File
+	offsets []int64
+	size    int64
+}
+
+func (p *partsReader) add(part s3Part) error {
+	f, err := os.Open(part.path)
+	if err != nil {
+		return fmt.Errorf("open part: %w", err)
+	}
+	p.files = append(p.files, f)
+	p.offsets = append(p.offsets, p.size)
+	p.size += part.size
+	return nil
+}
+
+func (p *partsReader) ReadAt(b []byte, off int64) (int, error) {
+	read := 0
+	for i, f := range p.files {
+		end := p.size
+		if i+1 < len(p.offsets) {
+			end = p.offsets[i+1]
+		}
+		if off >= end {
+			continue
+		}
+		for read < len(b) && off < end {
+			n, err := f.ReadAt(b[read:min(int64(len(b)), int64(read)+end-off)], off-p.offsets[i])
+			read += n
+			off += int64(n)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return read, err
+			}
+			if n == 0 {
+				return read, io.ErrUnexpectedEOF
+			}
+		}
+		if read == len(b) {
+			return read, nil
+		}
+	}
+	return read, io.EOF
+}
+
+func (p *partsReader) Close() {
+	for _, f := range p.files {
+		_ = f.Close()
+	}
+}
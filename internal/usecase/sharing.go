@@ -0,0 +1,165 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"time"
+)
+
+type SharingUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+}
+
+func newSharingUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *SharingUseCase {
+	return &SharingUseCase{
+		r:  r,
+		er: er,
+	}
+}
+
+// ShareOptions describes a sharing link or an invitation
+type ShareOptions struct {
+	// Type is the link type (view, edit or embed)
+	Type string
+	// Scope is the link scope (anonymous or organization)
+	Scope string
+	// Recipients are invited instead of creating a link
+	Recipients []string
+	// Role granted to the Recipients (read or write)
+	Role string
+	// Message sent to the Recipients
+	Message  string
+	Expires  time.Time
+	Password string
+}
+
+func (o ShareOptions) clientOptions() []client.ShareOption {
+	var opts []client.ShareOption
+	if !o.Expires.IsZero() {
+		opts = append(opts, client.WithExpiration(o.Expires))
+	}
+	if o.Password != "" {
+		opts = append(opts, client.WithPassword(o.Password))
+	}
+	if o.Message != "" {
+		opts = append(opts, client.WithInvitationMessage(o.Message))
+	}
+	return opts
+}
+
+// Share creates a sharing link for the item at remotePath or,
+// when there are recipients, invites them to the item
+func (u *SharingUseCase) Share(ctx context.Context, accName, remotePath string, opts ShareOptions) ([]types.Permission, error) {
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	return shareItem(ctx, f, opts)
+}
+
+func shareItem(ctx context.Context, f *remoteItem, opts ShareOptions) ([]types.Permission, error) {
+	if len(opts.Recipients) > 0 {
+		role := opts.Role
+		if role == "" {
+			role = client.RoleRead
+		}
+		res, err := f.c.Invite(ctx, f.driveID, f.item.ID, opts.Recipients, []string{role}, opts.clientOptions()...)
+		if err != nil {
+			return nil, err
+		}
+		return res.Value, nil
+	}
+
+	linkType := opts.Type
+	if linkType == "" {
+		linkType = client.LinkTypeView
+	}
+	perm, err := f.c.CreateLink(ctx, f.driveID, f.item.ID, linkType, opts.Scope, opts.clientOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return []types.Permission{*perm}, nil
+}
+
+// List lists the permissions of the item at remotePath
+func (u *SharingUseCase) List(ctx context.Context, accName, remotePath string) ([]types.Permission, error) {
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.c.ListPermissions(ctx, f.driveID, f.item.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list permissions: %w", err)
+	}
+	return res.Value, nil
+}
+
+// Revoke removes the permissions with the given IDs from the item at
+// remotePath or, when no ID is given, every permission that's neither
+// inherited nor the owner's. It returns the removed permissions.
+func (u *SharingUseCase) Revoke(ctx context.Context, accName, remotePath string, ids ...string) ([]types.Permission, error) {
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.c.ListPermissions(ctx, f.driveID, f.item.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list permissions: %w", err)
+	}
+
+	var revoke []types.Permission
+	if len(ids) == 0 {
+		for _, p := range res.Value {
+			if !p.IsInherited() && !p.IsOwner() {
+				revoke = append(revoke, p)
+			}
+		}
+	}
+	for _, id := range ids {
+		p, ok := findPermission(res.Value, id)
+		if !ok {
+			return nil, fmt.Errorf("permission %q not found", id)
+		}
+		if p.IsInherited() {
+			return nil, fmt.Errorf("permission %q is inherited from a parent folder, revoke it there", id)
+		}
+		if p.IsOwner() {
+			return nil, fmt.Errorf("permission %q is the owner's and can't be revoked", id)
+		}
+		revoke = append(revoke, p)
+	}
+
+	reqs := make([]client.BatchRequest, len(revoke))
+	for i, p := range revoke {
+		reqs[i] = client.DeletePermissionRequest(f.driveID, f.item.ID, p.ID)
+	}
+	responses, err := f.c.Batch(ctx, reqs)
+	if err != nil {
+		return nil, fmt.Errorf("revoke permissions: %w", err)
+	}
+
+	var removed []types.Permission
+	var errs []error
+	for i, p := range revoke {
+		if err := responses[i].Err; err != nil {
+			errs = append(errs, fmt.Errorf("revoke permission %q: %w", p.ID, err))
+			continue
+		}
+		removed = append(removed, p)
+	}
+	return removed, errors.Join(errs...)
+}
+
+func findPermission(perms []types.Permission, id string) (types.Permission, bool) {
+	for _, p := range perms {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return types.Permission{}, false
+}
@@ -0,0 +1,482 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type ShellUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+}
+
+func newShellUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *ShellUseCase {
+	return &ShellUseCase{
+		r:  r,
+		er: er,
+	}
+}
+
+// ShellSession is an interactive session on an account. The same client
+// (and so the same, refreshed, token) is used by every command and the
+// folder listings are cached until a command changes them. It's safe
+// for concurrent use, so transfers can run in background.
+type ShellSession struct {
+	root  *remoteItem
+	opts  TransferOptions
+	cache *folderCache
+
+	// mu guards cwd
+	mu sync.Mutex
+	// cwd is the current folder, relative to the account root folder
+	cwd string
+}
+
+// Accounts returns the names of the stored accounts
+func (u *ShellUseCase) Accounts(ctx context.Context) ([]string, error) {
+	return u.r.FindAllNames(ctx)
+}
+
+// Open starts a session on the account root folder
+func (u *ShellUseCase) Open(ctx context.Context, accName string, opts TransferOptions) (*ShellSession, error) {
+	opts = opts.withDefaults()
+	cOpts, err := opts.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	item, err := resolveAccountItem(ctx, u.r, u.er, accName, "", cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ShellSession{
+		root:  item,
+		opts:  opts,
+		cache: newFolderCache(item, 0),
+	}, nil
+}
+
+// Pwd returns the current folder
+func (s *ShellSession) Pwd() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return "/" + s.cwd
+}
+
+// Abs returns the path relative to the account root folder of p, a
+// path relative to the current folder or, starting with "/", to the root
+func (s *ShellSession) Abs(p string) string {
+	if strings.HasPrefix(p, "/") {
+		return cleanRemotePath(p)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return cleanRemotePath(path.Join(s.cwd, p))
+}
+
+// Transfers returns how many files should be transferred at the same time
+func (s *ShellSession) Transfers() int {
+	return s.opts.Transfers
+}
+
+// Refresh drops the cached listings of the folder at p and its
+// descendants, they're listed again the next time they're used
+func (s *ShellSession) Refresh(p string) {
+	s.cache.invalidate(s.Abs(p))
+}
+
+// Stat returns the item at p
+func (s *ShellSession) Stat(ctx context.Context, p string) (FileEntry, error) {
+	return s.cache.stat(ctx, s.Abs(p))
+}
+
+// List lists the folder at p, or returns the file at p
+func (s *ShellSession) List(ctx context.Context, p string) ([]FileEntry, error) {
+	e, err := s.Stat(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsFolder() {
+		return []FileEntry{e}, nil
+	}
+	d, err := s.cache.dir(ctx, e.Path)
+	if err != nil {
+		return nil, err
+	}
+	return d.entries, nil
+}
+
+// Cd changes the current folder
+func (s *ShellSession) Cd(ctx context.Context, p string) error {
+	e, err := s.Stat(ctx, p)
+	if err != nil {
+		return err
+	}
+	if !e.IsFolder() {
+		return fmt.Errorf("/%s: not a folder", e.Path)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cwd = e.Path
+	return nil
+}
+
+// Get downloads the file at remote into local (a file or an existing
+// directory, the current directory when empty) and returns the written
+// file. The observer (optional) receives the download progress.
+func (s *ShellSession) Get(ctx context.Context, remote, local string, observer TransferObserver) (string, error) {
+	e, err := s.Stat(ctx, remote)
+	if err != nil {
+		return "", err
+	}
+	if e.IsFolder() {
+		return "", fmt.Errorf("/%s is a folder, use restore to download folders", e.Path)
+	}
+	if local == "" {
+		local = e.Name
+	} else if info, err := os.Stat(local); err == nil && info.IsDir() {
+		local = filepath.Join(local, e.Name)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(local), "."+filepath.Base(local)+".*.partial")
+	if err != nil {
+		return "", fmt.Errorf("create temporary file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	err = transferOne(ctx, observer, e.Path, int64(e.Size), func(ctx context.Context, progress client.ProgressFunc) error {
+		_, hash, err := downloadItem(ctx, s.root.c, s.root.kr, s.root.driveID, e.ID, "", tmp, client.WithProgress(progress))
+		if err != nil {
+			return err
+		}
+		if want := e.File.Hashes.QuickXorHash; want != "" && hash != want {
+			return fmt.Errorf("content hash mismatch (got %s, expected %s)", hash, want)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("close file: %w", err)
+	}
+	if err := setFileTimes(tmp.Name(), e.FileSystemInfo.CreatedDateTime, e.FileSystemInfo.LastModifiedDateTime); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), local); err != nil {
+		return "", fmt.Errorf("rename file: %w", err)
+	}
+	return local, nil
+}
+
+// Put uploads the local file to remote (a file or an existing folder, the
+// current folder when empty), replacing the remote file. It returns the
+// path of the uploaded file, the observer (optional) receives the upload
+// progress.
+func (s *ShellSession) Put(ctx context.Context, local, remote string, observer TransferObserver) (string, error) {
+	info, err := os.Stat(local)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory, use upload or sync to send directories", local)
+	}
+
+	abs := s.Abs(remote)
+	if e, err := s.Stat(ctx, remote); err == nil && e.IsFolder() {
+		abs = path.Join(e.Path, filepath.Base(local))
+	}
+	if abs == "" {
+		return "", errors.New("can't replace the root folder")
+	}
+	parent, err := s.cache.dir(ctx, path.Dir(abs))
+	if err != nil {
+		return "", err
+	}
+	name, err := s.cache.storedName(parent, path.Base(abs))
+	if err != nil {
+		return "", err
+	}
+
+	up := fileUpload{
+		file:     localFile{path: local, remote: abs, size: info.Size()},
+		name:     name,
+		parentID: parent.id,
+		behavior: client.ConflictBehaviorReplace,
+		kr:       s.root.uploadKeyring(),
+	}
+	err = transferOne(ctx, observer, abs, info.Size(), func(ctx context.Context, progress client.ProgressFunc) error {
+		return uploadLocalFile(ctx, s.root.c, s.root.driveID, up, s.opts, progress)
+	})
+	s.cache.invalidate(path.Dir(abs))
+	if err != nil {
+		return "", err
+	}
+	return abs, nil
+}
+
+// Remove deletes the item at p, folders are deleted with their content.
+// The item is moved to the recycle bin unless permanent is set, which
+// personal drives don't support.
+func (s *ShellSession) Remove(ctx context.Context, p string, permanent bool) error {
+	e, err := s.Stat(ctx, p)
+	if err != nil {
+		return err
+	}
+	if e.Path == "" {
+		return errors.New("can't remove the root folder")
+	}
+	if permanent {
+		if err := s.root.requireDrive(ctx, false, "deleting permanently"); err != nil {
+			return err
+		}
+	}
+	if permanent {
+		err = s.root.c.PermanentDeleteItem(ctx, s.root.driveID, e.ID)
+	} else {
+		err = s.root.c.DeleteItem(ctx, s.root.driveID, e.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("remove /%s: %w", e.Path, err)
+	}
+	s.cache.invalidate(path.Dir(e.Path))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if within(s.cwd, e.Path) {
+		s.cwd = cleanRemotePath(path.Dir(e.Path))
+	}
+	return nil
+}
+
+// RemoveAll removes the items at paths with batched requests, the
+// paths inside another removed folder are skipped. The items are moved
+// to the recycle bin unless permanent is set, which personal drives
+// don't support. It returns how many items were removed, along with
+// the errors of the others.
+func (s *ShellSession) RemoveAll(ctx context.Context, permanent bool, paths ...string) (int, error) {
+	if permanent {
+		if err := s.root.requireDrive(ctx, false, "deleting permanently"); err != nil {
+			return 0, err
+		}
+	}
+	var found []FileEntry
+	var errs []error
+	for _, p := range paths {
+		e, err := s.Stat(ctx, p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if e.Path == "" {
+			errs = append(errs, errors.New("can't remove the root folder"))
+			continue
+		}
+		found = append(found, e)
+	}
+	var entries []FileEntry
+	for i, e := range found {
+		nested := slices.ContainsFunc(found, func(o FileEntry) bool {
+			return o.Path != e.Path && within(e.Path, o.Path)
+		})
+		repeated := slices.ContainsFunc(found[:i], func(o FileEntry) bool {
+			return o.Path == e.Path
+		})
+		if !nested && !repeated {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		return 0, errors.Join(errs...)
+	}
+
+	reqs := make([]client.BatchRequest, len(entries))
+	for i, e := range entries {
+		if permanent {
+			reqs[i] = client.PermanentDeleteItemRequest(s.root.driveID, e.ID)
+		} else {
+			reqs[i] = client.DeleteItemRequest(s.root.driveID, e.ID)
+		}
+	}
+	responses, err := s.root.c.Batch(ctx, reqs)
+	if err != nil {
+		return 0, errors.Join(append(errs, fmt.Errorf("remove: %w", err))...)
+	}
+
+	removed := 0
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, e := range entries {
+		if err := responses[i].Err; err != nil {
+			errs = append(errs, fmt.Errorf("remove /%s: %w", e.Path, err))
+			continue
+		}
+		removed++
+		s.cache.invalidate(path.Dir(e.Path))
+		if within(s.cwd, e.Path) {
+			s.cwd = cleanRemotePath(path.Dir(e.Path))
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// MoveAll moves the items at srcs into the existing folder dst with
+// batched requests. It returns how many items were moved, along
+// with the errors of the others.
+func (s *ShellSession) MoveAll(ctx context.Context, srcs []string, dst string) (int, error) {
+	d, err := s.Stat(ctx, dst)
+	if err != nil {
+		return 0, err
+	}
+	if !d.IsFolder() {
+		return 0, fmt.Errorf("/%s isn't a folder", d.Path)
+	}
+	parent, err := s.cache.dir(ctx, d.Path)
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []FileEntry
+	var reqs []client.BatchRequest
+	var errs []error
+	for _, src := range srcs {
+		e, err := s.Stat(ctx, src)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if e.Path == "" {
+			errs = append(errs, errors.New("can't move the root folder"))
+			continue
+		}
+		if within(d.Path, e.Path) {
+			errs = append(errs, fmt.Errorf("can't move /%s into itself", e.Path))
+			continue
+		}
+		name, err := s.cache.storedName(parent, e.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		entries = append(entries, e)
+		reqs = append(reqs, client.MoveItemRequest(s.root.driveID, e.ID, parent.id, name, nil))
+	}
+	if len(reqs) == 0 {
+		return 0, errors.Join(errs...)
+	}
+	responses, err := s.root.c.Batch(ctx, reqs)
+	if err != nil {
+		return 0, errors.Join(append(errs, fmt.Errorf("move: %w", err))...)
+	}
+
+	moved := 0
+	s.cache.invalidate(d.Path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, e := range entries {
+		if err := responses[i].Err; err != nil {
+			errs = append(errs, fmt.Errorf("move /%s: %w", e.Path, err))
+			continue
+		}
+		moved++
+		s.cache.invalidate(path.Dir(e.Path))
+		if within(s.cwd, e.Path) {
+			s.cwd = cleanRemotePath(path.Join(d.Path, e.Name) + strings.TrimPrefix(s.cwd, e.Path))
+		}
+	}
+	return moved, errors.Join(errs...)
+}
+
+// Move moves (or renames) the item at src to dst, into
+// dst when it's an existing folder
+func (s *ShellSession) Move(ctx context.Context, src, dst string) error {
+	e, err := s.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	if e.Path == "" {
+		return errors.New("can't move the root folder")
+	}
+	abs := s.Abs(dst)
+	if d, err := s.Stat(ctx, dst); err == nil {
+		if !d.IsFolder() {
+			return fmt.Errorf("/%s already exists", d.Path)
+		}
+		abs = path.Join(d.Path, e.Name)
+	}
+	if within(abs, e.Path) {
+		return fmt.Errorf("can't move /%s into itself", e.Path)
+	}
+	parent, err := s.cache.dir(ctx, path.Dir(abs))
+	if err != nil {
+		return err
+	}
+	name, err := s.cache.storedName(parent, path.Base(abs))
+	if err != nil {
+		return err
+	}
+	if _, err := s.root.c.MoveItem(ctx, s.root.driveID, e.ID, parent.id, name); err != nil {
+		return fmt.Errorf("move /%s: %w", e.Path, err)
+	}
+
+	s.cache.invalidate(path.Dir(e.Path))
+	s.cache.invalidate(path.Dir(abs))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if within(s.cwd, e.Path) {
+		s.cwd = cleanRemotePath(abs + strings.TrimPrefix(s.cwd, e.Path))
+	}
+	return nil
+}
+
+// Mkdir creates the folder at p, its parent must exist
+func (s *ShellSession) Mkdir(ctx context.Context, p string) error {
+	abs := s.Abs(p)
+	if _, err := s.Stat(ctx, p); err == nil {
+		return fmt.Errorf("/%s already exists", abs)
+	}
+	parent, err := s.cache.dir(ctx, path.Dir(abs))
+	if err != nil {
+		return err
+	}
+	name, err := s.cache.storedName(parent, path.Base(abs))
+	if err != nil {
+		return err
+	}
+	if _, err := s.root.c.CreateFolder(ctx, name, parent.id, s.root.driveID); err != nil {
+		return fmt.Errorf("create folder /%s: %w", abs, err)
+	}
+	s.cache.invalidate(path.Dir(abs))
+	return nil
+}
+
+// Share creates a sharing link for (or invites people to) the item at p
+func (s *ShellSession) Share(ctx context.Context, p string, opts ShareOptions) ([]types.Permission, error) {
+	e, err := s.Stat(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	item := *s.root
+	item.item = &e.Value
+	return shareItem(ctx, &item, opts)
+}
+
+// transferOne runs a single transfer through the scheduler
+func transferOne(ctx context.Context, observer TransferObserver, name string, size int64, run func(ctx context.Context, progress client.ProgressFunc) error) error {
+	return NewTransferScheduler(1, observer).Run(ctx, []Transfer{{
+		Name: name,
+		Size: size,
+		Run:  run,
+	}})
+}
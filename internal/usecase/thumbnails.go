@@ -0,0 +1,48 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"io"
+)
+
+type ThumbnailsUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+}
+
+func newThumbnailsUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *ThumbnailsUseCase {
+	return &ThumbnailsUseCase{
+		r:  r,
+		er: er,
+	}
+}
+
+// Download writes the thumbnail of the item at remotePath into w, size is
+// a standard size ("large") or a custom one ("c300x300_crop"). Encrypted
+// files have no thumbnails, the OneDrive can't render their content.
+func (u *ThumbnailsUseCase) Download(ctx context.Context, accName, remotePath, size string, w io.Writer) (*types.Thumbnail, error) {
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	p := "/" + cleanRemotePath(remotePath)
+	sets, err := f.c.GetThumbnails(ctx, f.driveID, f.item.ID, size)
+	if err != nil {
+		return nil, fmt.Errorf("get thumbnails of %s: %w", p, err)
+	}
+	if len(sets.Value) == 0 {
+		return nil, fmt.Errorf("%s has no thumbnails", p)
+	}
+	set := sets.Value[0]
+	t := set.Get(size)
+	if t == nil {
+		return nil, fmt.Errorf("%s has no %s thumbnail", p, size)
+	}
+	if _, err := f.c.DownloadThumbnail(ctx, f.driveID, f.item.ID, set.ID, size, w); err != nil {
+		return nil, fmt.Errorf("download thumbnail of %s: %w", p, err)
+	}
+	return t, nil
+}
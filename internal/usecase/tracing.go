@@ -0,0 +1,34 @@
+package usecase
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/eldius/onedrive-client/internal/usecase")
+
+var (
+	accountKey   = attribute.Key("onedrive.account")
+	pathKey      = attribute.Key("onedrive.path")
+	localPathKey = attribute.Key("onedrive.local_path")
+	sizeKey      = attribute.Key("onedrive.size")
+	jobKey       = attribute.Key("onedrive.job")
+)
+
+// startSpan starts the span of a usecase, the requests
+// sent with the returned context are its children
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err (when set) and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,162 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/bandwidth"
+	"github.com/eldius/onedrive-client/internal/configs"
+	"log/slog"
+	"sync"
+)
+
+// TransferOptions configures how files are transferred
+type TransferOptions struct {
+	// Transfers is how many files are transferred at the same time
+	Transfers int
+	// ChunkConcurrency is how many chunks of the same upload
+	// session are read at the same time, they're sent in order
+	ChunkConcurrency int
+	// BandwidthLimit is a bandwidth schedule
+	// (like "08:00,512k 19:00,off")
+	BandwidthLimit string
+	// Observer receives the transfers progress (optional)
+	Observer TransferObserver
+}
+
+// withDefaults fills the unset options with the configured values
+func (o TransferOptions) withDefaults() TransferOptions {
+	if o.Transfers <= 0 {
+		o.Transfers = max(configs.GetTransferWorkers(), 1)
+	}
+	if o.ChunkConcurrency <= 0 {
+		o.ChunkConcurrency = max(configs.GetTransferChunkConcurrency(), 1)
+	}
+	if o.BandwidthLimit == "" {
+		o.BandwidthLimit = configs.GetTransferBandwidthLimit()
+	}
+	return o
+}
+
+// clientOptions returns the client options
+// shared by all the transfers of a run
+func (o TransferOptions) clientOptions() ([]client.Option, error) {
+	sched, err := bandwidth.ParseSchedule(o.BandwidthLimit)
+	if err != nil {
+		return nil, fmt.Errorf("parse bandwidth limit: %w", err)
+	}
+	if len(sched) == 0 {
+		return nil, nil
+	}
+	return []client.Option{client.WithBandwidthLimiter(bandwidth.NewLimiter(sched))}, nil
+}
+
+func (o TransferOptions) transferOptions() []client.TransferOption {
+	return []client.TransferOption{
+		client.WithChunkConcurrency(o.ChunkConcurrency),
+	}
+}
+
+// Transfer is a single unit of work for the scheduler
+type Transfer struct {
+	Name string
+	Size int64
+	Run  func(ctx context.Context, progress client.ProgressFunc) error
+}
+
+// TransferObserver is notified about the
+// scheduled transfers lifecycle and progress
+type TransferObserver interface {
+	TransfersQueued(count int, size int64)
+	TransferStarted(name string, size int64)
+	TransferProgress(name string, p client.Progress)
+	TransferFinished(name string, err error)
+}
+
+// TransferScheduler runs transfers on a bounded pool of workers
+type TransferScheduler struct {
+	workers  int
+	observer TransferObserver
+}
+
+func NewTransferScheduler(workers int, observer TransferObserver) *TransferScheduler {
+	if observer == nil {
+		observer = noopObserver{}
+	}
+	return &TransferScheduler{
+		workers:  max(workers, 1),
+		observer: observer,
+	}
+}
+
+// Run executes all the transfers and waits for them to finish.
+// A failed transfer doesn't stop the others, all the errors
+// are returned together.
+func (s *TransferScheduler) Run(ctx context.Context, transfers []Transfer) error {
+	queue := make(chan Transfer)
+	go func() {
+		defer close(queue)
+		for _, t := range transfers {
+			select {
+			case queue <- t:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s.observer.TransfersQueued(len(transfers), transfersSize(transfers))
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for i := 0; i < min(s.workers, len(transfers)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				log := slog.With("transfer", t.Name)
+				log.DebugContext(ctx, "transfer started")
+				s.observer.TransferStarted(t.Name, t.Size)
+				tCtx, span := startSpan(ctx, "Transfer", pathKey.String(t.Name), sizeKey.Int64(t.Size))
+				err := t.Run(tCtx, func(p client.Progress) {
+					s.observer.TransferProgress(t.Name, p)
+				})
+				endSpan(span, err)
+				s.observer.TransferFinished(t.Name, err)
+				if err != nil {
+					log.With("error", err).ErrorContext(ctx, "transfer failed")
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+					mu.Unlock()
+					continue
+				}
+				log.DebugContext(ctx, "transfer finished")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func transfersSize(transfers []Transfer) int64 {
+	var size int64
+	for _, t := range transfers {
+		size += t.Size
+	}
+	return size
+}
+
+type noopObserver struct{}
+
+func (noopObserver) TransfersQueued(int, int64)               {}
+func (noopObserver) TransferStarted(string, int64)            {}
+func (noopObserver) TransferProgress(string, client.Progress) {}
+func (noopObserver) TransferFinished(string, error)           {}
@@ -0,0 +1,116 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"path"
+	"sort"
+)
+
+// drivePersonal is the type of the OneDrive Personal drives
+const drivePersonal = "personal"
+
+type TrashUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+}
+
+func newTrashUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *TrashUseCase {
+	return &TrashUseCase{
+		r:  r,
+		er: er,
+	}
+}
+
+// List lists the items deleted from the account root folder that are
+// still in the recycle bin. Their original folder isn't known, so the
+// entries Path is only the (decrypted) name. Only personal drives
+// support it, the others can't list the changes of a folder.
+func (u *TrashUseCase) List(ctx context.Context, accName string) ([]FileEntry, error) {
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.requireDrive(ctx, true, "listing the deleted items"); err != nil {
+		return nil, err
+	}
+	res, err := f.c.ListDeletedItems(ctx, f.driveID, f.item.ID)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]FileEntry, 0, len(res.Value))
+	for _, v := range res.Value {
+		v.Name = decryptName(f.kr, v.Name)
+		entries = append(entries, newFileEntry(v.Name, v))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+// Restore restores the deleted items with the given IDs from the recycle
+// bin, into the folder at to (relative to the account root folder) or,
+// when it's empty, where they were deleted from. It returns the restored
+// items, along with the errors of the others. Only personal drives
+// support it.
+func (u *TrashUseCase) Restore(ctx context.Context, accName string, ids []string, to string) ([]FileEntry, error) {
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, to)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.requireDrive(ctx, true, "restoring the deleted items"); err != nil {
+		return nil, err
+	}
+	parentID, dir := "", ""
+	if to != "" {
+		if !f.item.IsFolder() {
+			return nil, fmt.Errorf("/%s isn't a folder", cleanRemotePath(to))
+		}
+		parentID, dir = f.item.ID, cleanRemotePath(to)
+	}
+
+	items := make([]types.Item, len(ids))
+	reqs := make([]client.BatchRequest, len(ids))
+	for i, id := range ids {
+		reqs[i] = client.RestoreItemRequest(f.driveID, id, parentID, "", &items[i])
+	}
+	responses, err := f.c.Batch(ctx, reqs)
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+
+	var restored []FileEntry
+	var errs []error
+	for i, id := range ids {
+		if err := responses[i].Err; err != nil {
+			errs = append(errs, fmt.Errorf("restore item %q: %w", id, err))
+			continue
+		}
+		v := items[i].Value
+		v.Name = decryptName(f.kr, v.Name)
+		restored = append(restored, newFileEntry(path.Join(dir, v.Name), v))
+	}
+	return restored, errors.Join(errs...)
+}
+
+// requireDrive fails when the drive of f isn't a personal drive or, with
+// personal false, when it is, what describes the unsupported operation
+func (f *remoteItem) requireDrive(ctx context.Context, personal bool, what string) error {
+	drive, err := f.c.GetDrive(ctx, f.driveID)
+	if err != nil {
+		return fmt.Errorf("get drive: %w", err)
+	}
+	switch {
+	case (drive.DriveType == drivePersonal) == personal:
+		return nil
+	case personal:
+		return fmt.Errorf("%s is only supported by personal drives, the account drive is a %s drive", what, drive.DriveType)
+	default:
+		return fmt.Errorf("%s isn't supported by personal drives", what)
+	}
+}
@@ -2,10 +2,22 @@ package usecase
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/client/quickxorhash"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/encryption"
 	"github.com/eldius/onedrive-client/internal/model"
 	"github.com/eldius/onedrive-client/internal/persistence"
+	"io"
 	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 func loadSession(ctx context.Context, r *persistence.AuthRepository, accName string) (*model.OnedriveAccount, error) {
@@ -13,6 +25,300 @@ func loadSession(ctx context.Context, r *persistence.AuthRepository, accName str
 	if err != nil {
 		return nil, fmt.Errorf("could not find account %q: %w", accName, err)
 	}
-	slog.With("account_name", accName, "account", acc).Info("found account")
+	slog.With("account_name", accName, "account_id", acc.ID).Debug("found account")
 	return acc, err
 }
+
+// newAccountClient creates a client authenticated with the account
+// stored token, the token is stored again every time it's refreshed
+func newAccountClient(r *persistence.AuthRepository, acc *model.OnedriveAccount, opts ...client.Option) client.Client {
+	token := &types.TokenData{
+		TokenType:    acc.AuthData.TokenType,
+		Scope:        acc.AuthData.Scope,
+		ExpiresIn:    acc.AuthData.ExpiresIn,
+		ExtExpiresIn: acc.AuthData.ExtExpiresIn,
+		AccessToken:  acc.AuthData.AccessToken,
+		RefreshToken: acc.AuthData.RefreshToken,
+		IDToken:      acc.AuthData.IDToken,
+	}
+	return client.New(append([]client.Option{
+		client.WithScopes(acc.AuthData.Scope),
+		client.WithAuthenticationTokenData(token),
+		client.WithTokenRefreshed(func(token *types.TokenData) {
+			storeToken(r, acc, token)
+		}),
+	}, opts...)...)
+}
+
+// storeToken persists a refreshed token of the account
+func storeToken(r *persistence.AuthRepository, acc *model.OnedriveAccount, token *types.TokenData) {
+	td := &model.TokenData{
+		TokenType:    token.TokenType,
+		Scope:        token.Scope,
+		ExpiresIn:    token.ExpiresIn,
+		ExtExpiresIn: token.ExtExpiresIn,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		IDToken:      token.IDToken,
+		UpdatedAt:    time.Now(),
+	}
+	// the refresh is shared by the requests waiting for it,
+	// so it's stored without the context of any of them
+	if err := r.UpdateToken(context.Background(), acc.ID, td); err != nil {
+		slog.With("account_id", acc.ID, "error", err).Warn("could not store the refreshed token")
+	}
+}
+
+// remoteFolders resolves (and creates when missing) folders
+// relative to a remote root, caching the resolved IDs
+type remoteFolders struct {
+	c       client.Client
+	driveID string
+	mu      sync.Mutex
+	ids     map[string]string
+}
+
+func newRemoteFolders(c client.Client, driveID, rootID string) *remoteFolders {
+	return &remoteFolders{
+		c:       c,
+		driveID: driveID,
+		ids:     map[string]string{"": rootID},
+	}
+}
+
+// ensure returns the ID of the folder at dir,
+// creating it (and its parents) when needed
+func (f *remoteFolders) ensure(ctx context.Context, dir string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ensureLocked(ctx, cleanRemotePath(dir))
+}
+
+func (f *remoteFolders) ensureLocked(ctx context.Context, dir string) (string, error) {
+	if id, ok := f.ids[dir]; ok {
+		return id, nil
+	}
+	parentID, err := f.ensureLocked(ctx, cleanRemotePath(path.Dir(dir)))
+	if err != nil {
+		return "", err
+	}
+
+	name := path.Base(dir)
+	item, err := f.c.GetItemByPath(ctx, f.driveID, parentID, name)
+	switch {
+	case err == nil:
+		f.ids[dir] = item.ID
+	case client.IsNotFound(err):
+		created, err := f.c.CreateFolder(ctx, name, parentID, f.driveID)
+		if err != nil {
+			return "", fmt.Errorf("create folder %q: %w", dir, err)
+		}
+		f.ids[dir] = created.ID
+	default:
+		return "", fmt.Errorf("get folder %q: %w", dir, err)
+	}
+	return f.ids[dir], nil
+}
+
+// itemFields are the item properties the use cases read, the
+// listings select them instead of the whole item payload
+var itemFields = []string{
+	"id",
+	"name",
+	"size",
+	"eTag",
+	"createdDateTime",
+	"lastModifiedDateTime",
+	"fileSystemInfo",
+	"file",
+	"folder",
+	"shared",
+	"webUrl",
+}
+
+// cleanRemotePath normalizes a remote path relative
+// to the account root folder ("" is the root itself)
+func cleanRemotePath(p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// accountRoot returns the account root folder item
+func accountRoot(ctx context.Context, c client.Client, acc *model.OnedriveAccount) (*types.Item, error) {
+	root, err := c.GetItemByPath(ctx, acc.Drive.DriveID, acc.Drive.ItemID, acc.Drive.RootFolder)
+	if err != nil {
+		return nil, fmt.Errorf("get account root folder %q: %w", acc.Drive.RootFolder, err)
+	}
+	return root, nil
+}
+
+// decryptedChildren maps the items by their decrypted names,
+// names that can't be decrypted (plain ones) are kept as they are
+func decryptedChildren(kr *encryption.Keyring, values []types.Value) map[string]types.Value {
+	m := make(map[string]types.Value, len(values))
+	for _, v := range values {
+		name := v.Name
+		if kr != nil && kr.EncryptNames() {
+			if decrypted, err := kr.DecryptName(v.Name); err == nil {
+				name = decrypted
+			}
+		}
+		m[name] = v
+	}
+	return m
+}
+
+// resolveRemote returns the item at p, a path relative to the root folder,
+// the names are matched decrypted when the account encrypts them
+func resolveRemote(ctx context.Context, c client.Client, kr *encryption.Keyring, driveID, rootID, p string) (*types.Value, error) {
+	item := &types.Value{ID: rootID, Folder: &types.Folder{}}
+	p = cleanRemotePath(p)
+	if p == "" {
+		return item, nil
+	}
+	for _, name := range strings.Split(p, "/") {
+		if !item.IsFolder() {
+			return nil, fmt.Errorf("remote item %q not found", p)
+		}
+		res, err := c.ListFiles(ctx, driveID, item.ID, client.WithSelect(itemFields...))
+		if err != nil {
+			return nil, fmt.Errorf("list remote folder: %w", err)
+		}
+		child, ok := foldNames(decryptedChildren(kr, res.Value))[nameKey(name)]
+		if !ok {
+			return nil, fmt.Errorf("remote item %q not found", p)
+		}
+		item = &child
+	}
+	return item, nil
+}
+
+// remoteItem is a resolved remote item and the
+// client (and keyring) used to reach it
+type remoteItem struct {
+	c  client.Client
+	kr *encryption.Keyring
+	// encrypted tells if the new uploads are encrypted,
+	// kr is loaded anyway to read the encrypted items
+	encrypted bool
+	driveID   string
+	item      *types.Value
+}
+
+// resolveAccountItem resolves remotePath, relative to the account
+// root folder, with a client created with opts
+func resolveAccountItem(ctx context.Context, r *persistence.AuthRepository, er *persistence.EncryptionRepository, accName, remotePath string, opts ...client.Option) (*remoteItem, error) {
+	acc, err := loadSession(ctx, r, accName)
+	if err != nil {
+		return nil, fmt.Errorf("loadSession: %w", err)
+	}
+	c := newAccountClient(r, acc, opts...)
+	kr, enabled, err := loadKeyring(ctx, er, acc)
+	if err != nil {
+		return nil, fmt.Errorf("load encryption keys: %w", err)
+	}
+	root, err := accountRoot(ctx, c, acc)
+	if err != nil {
+		return nil, err
+	}
+	item := &root.Value
+	if cleanRemotePath(remotePath) != "" {
+		item, err = resolveRemote(ctx, c, kr, acc.Drive.DriveID, root.ID, remotePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &remoteItem{
+		c:         c,
+		kr:        kr,
+		encrypted: enabled,
+		driveID:   acc.Drive.DriveID,
+		item:      item,
+	}, nil
+}
+
+// uploadKeyring is the keyring encrypting the new uploads,
+// nil when the account has the encryption disabled
+func (f *remoteItem) uploadKeyring() *encryption.Keyring {
+	if !f.encrypted {
+		return nil
+	}
+	return f.kr
+}
+
+// children lists the folder with the given ID, dir is the folder path
+// (relative to the root folder) and the entries are sorted by name. The
+// entries have the itemFields properties unless opts select others.
+func (f *remoteItem) children(ctx context.Context, id, dir string, opts ...client.QueryOption) ([]FileEntry, error) {
+	if len(opts) == 0 {
+		opts = []client.QueryOption{client.WithSelect(itemFields...)}
+	}
+	res, err := f.c.ListFiles(ctx, f.driveID, id, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("list remote folder %q: %w", dir, err)
+	}
+	entries := make([]FileEntry, 0, len(res.Value))
+	for name, v := range decryptedChildren(f.kr, res.Value) {
+		v.Name = name
+		entries = append(entries, newFileEntry(path.Join(dir, name), v))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// downloadItem writes the item content (or the content of one of its
+// versions) into w, decrypting it when it's an encrypted file. It returns
+// the size and the quickXorHash of the content as stored remotely.
+// errMarkerRead stops the download of the content once its marker is read
+var errMarkerRead = errors.New("encryption marker read")
+
+// isEncryptedItem reads the first bytes of the item content
+// and tells if it's stored as an encrypted file
+func isEncryptedItem(ctx context.Context, c client.Client, driveID, itemID string) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := &markerWriter{}
+	if _, err := c.Download(ctx, driveID, itemID, w); err != nil && !errors.Is(err, errMarkerRead) {
+		return false, fmt.Errorf("download: %w", err)
+	}
+	return encryption.IsEncrypted(w.head), nil
+}
+
+// markerWriter keeps the first encryption.MarkerSize bytes written
+type markerWriter struct {
+	head []byte
+}
+
+func (w *markerWriter) Write(p []byte) (int, error) {
+	w.head = append(w.head, p[:min(len(p), encryption.MarkerSize-len(w.head))]...)
+	if len(w.head) == encryption.MarkerSize {
+		return 0, errMarkerRead
+	}
+	return len(p), nil
+}
+
+func downloadItem(ctx context.Context, c client.Client, kr *encryption.Keyring, driveID, itemID, versionID string, w io.Writer, opts ...client.TransferOption) (int64, string, error) {
+	dec := encryption.NewAutoDecrypter(kr, w)
+	h := quickxorhash.New()
+	out := io.MultiWriter(h, dec)
+
+	var err error
+	var n int64
+	if versionID == "" {
+		n, err = c.Download(ctx, driveID, itemID, out, opts...)
+	} else {
+		n, err = c.DownloadVersion(ctx, driveID, itemID, versionID, out, opts...)
+	}
+	if err != nil {
+		return n, "", fmt.Errorf("download: %w", err)
+	}
+	if err := dec.Close(); err != nil {
+		return n, "", fmt.Errorf("decrypt: %w", err)
+	}
+	return n, base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
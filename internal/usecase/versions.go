@@ -0,0 +1,127 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client/types"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"io"
+	"time"
+)
+
+type VersionsUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+}
+
+func newVersionsUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *VersionsUseCase {
+	return &VersionsUseCase{
+		r:  r,
+		er: er,
+	}
+}
+
+// VersionSelector picks a file version by its ID or, when
+// the ID is empty, the version current at AsOf
+type VersionSelector struct {
+	ID   string
+	AsOf time.Time
+}
+
+// List lists the versions of the file at remotePath, newest first
+func (u *VersionsUseCase) List(ctx context.Context, accName, remotePath string) ([]types.DriveItemVersion, error) {
+	f, err := u.file(ctx, accName, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := f.c.ListVersions(ctx, f.driveID, f.item.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list versions: %w", err)
+	}
+	return versions.Value, nil
+}
+
+// Download writes the selected version content into w,
+// decrypting it when it's an encrypted file
+func (u *VersionsUseCase) Download(ctx context.Context, accName, remotePath string, sel VersionSelector, w io.Writer) (*types.DriveItemVersion, error) {
+	f, err := u.file(ctx, accName, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	v, err := f.version(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+	n, _, err := downloadItem(ctx, f.c, f.kr, f.driveID, f.item.ID, v.ID, w)
+	if err != nil {
+		return nil, err
+	}
+	if n != int64(v.Size) {
+		return nil, fmt.Errorf("downloaded %d bytes, expected %d", n, v.Size)
+	}
+	return v, nil
+}
+
+// Restore makes the selected version the current version of the file,
+// the restored content becomes a new version and nothing is lost
+func (u *VersionsUseCase) Restore(ctx context.Context, accName, remotePath string, sel VersionSelector) (*types.DriveItemVersion, error) {
+	f, err := u.file(ctx, accName, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	v, err := f.version(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.c.RestoreVersion(ctx, f.driveID, f.item.ID, v.ID); err != nil {
+		return nil, fmt.Errorf("restore version %q: %w", v.ID, err)
+	}
+	return v, nil
+}
+
+func (u *VersionsUseCase) file(ctx context.Context, accName, remotePath string) (*remoteItem, error) {
+	f, err := resolveAccountItem(ctx, u.r, u.er, accName, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if f.item.IsFolder() {
+		return nil, fmt.Errorf("%q is a folder, only files have versions", remotePath)
+	}
+	return f, nil
+}
+
+// version returns the version picked by sel
+func (f *remoteItem) version(ctx context.Context, sel VersionSelector) (*types.DriveItemVersion, error) {
+	if sel.ID == "" && sel.AsOf.IsZero() {
+		return nil, errors.New("a version ID or time is required")
+	}
+	versions, err := f.c.ListVersions(ctx, f.driveID, f.item.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list versions: %w", err)
+	}
+	if sel.ID == "" {
+		v, ok := versionAsOf(versions.Value, sel.AsOf)
+		if !ok {
+			return nil, fmt.Errorf("the file has no version as of %s", sel.AsOf.Format(time.RFC3339))
+		}
+		return &v, nil
+	}
+	for _, v := range versions.Value {
+		if v.ID == sel.ID {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("version %q not found", sel.ID)
+}
+
+// versionAsOf returns the version that was current at asOf,
+// versions are listed newest first
+func versionAsOf(versions []types.DriveItemVersion, asOf time.Time) (types.DriveItemVersion, bool) {
+	for _, v := range versions {
+		if !v.LastModifiedDateTime.After(asOf) {
+			return v, true
+		}
+	}
+	return types.DriveItemVersion{}, false
+}
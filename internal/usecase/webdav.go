@@ -0,0 +1,470 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eldius/onedrive-client/client"
+	"github.com/eldius/onedrive-client/internal/persistence"
+	"golang.org/x/net/webdav"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"time"
+)
+
+type WebDAVUseCase struct {
+	r  *persistence.AuthRepository
+	er *persistence.EncryptionRepository
+}
+
+func newWebDAVUseCase(r *persistence.AuthRepository, er *persistence.EncryptionRepository) *WebDAVUseCase {
+	return &WebDAVUseCase{
+		r:  r,
+		er: er,
+	}
+}
+
+// WebDAVOptions configures the served file system
+type WebDAVOptions struct {
+	// CacheTTL is how long the folder listings are cached
+	CacheTTL time.Duration
+	Transfer TransferOptions
+}
+
+// FileSystem returns the account root folder as a WebDAV file system.
+// Files are streamed from the drive when read and spooled into a
+// temporary file when written, they're uploaded once closed.
+func (u *WebDAVUseCase) FileSystem(ctx context.Context, accName string, opts WebDAVOptions) (webdav.FileSystem, error) {
+	tOpts := opts.Transfer.withDefaults()
+	cOpts, err := tOpts.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	root, err := resolveAccountItem(ctx, u.r, u.er, accName, "", cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &davFS{
+		root:  root,
+		opts:  tOpts,
+		cache: newFolderCache(root, opts.CacheTTL),
+	}, nil
+}
+
+var (
+	errDavFolder   = errors.New("is a folder")
+	errDavReadOnly = errors.New("file opened for reading")
+	errDavRoot     = errors.New("can't change the root folder")
+)
+
+type davFS struct {
+	root  *remoteItem
+	opts  TransferOptions
+	cache *folderCache
+}
+
+func (d *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	e, err := d.cache.stat(ctx, name)
+	if err != nil {
+		return nil, davError("stat", name, err)
+	}
+	info, err := d.info(ctx, e)
+	if err != nil {
+		return nil, davError("stat", name, err)
+	}
+	return info, nil
+}
+
+func (d *davFS) Mkdir(ctx context.Context, name string, _ os.FileMode) error {
+	abs := cleanRemotePath(name)
+	if _, err := d.cache.stat(ctx, abs); err == nil {
+		return davError("mkdir", name, fs.ErrExist)
+	}
+	parent, err := d.cache.dir(ctx, path.Dir(abs))
+	if err != nil {
+		return davError("mkdir", name, err)
+	}
+	stored, err := d.cache.storedName(parent, path.Base(abs))
+	if err != nil {
+		return err
+	}
+	if _, err := d.root.c.CreateFolder(ctx, stored, parent.id, d.root.driveID); err != nil {
+		return fmt.Errorf("create folder /%s: %w", abs, err)
+	}
+	d.cache.invalidate(path.Dir(abs))
+	return nil
+}
+
+func (d *davFS) RemoveAll(ctx context.Context, name string) error {
+	e, err := d.cache.stat(ctx, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if e.Path == "" {
+		return davError("remove", name, errDavRoot)
+	}
+	if err := d.root.c.DeleteItem(ctx, d.root.driveID, e.ID); err != nil {
+		return fmt.Errorf("remove /%s: %w", e.Path, err)
+	}
+	d.cache.invalidate(path.Dir(e.Path))
+	return nil
+}
+
+func (d *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	e, err := d.cache.stat(ctx, oldName)
+	if err != nil {
+		return davError("rename", oldName, err)
+	}
+	abs := cleanRemotePath(newName)
+	if e.Path == "" || abs == "" {
+		return davError("rename", oldName, errDavRoot)
+	}
+	if within(abs, e.Path) {
+		return fmt.Errorf("can't move /%s into itself", e.Path)
+	}
+	if _, err := d.cache.stat(ctx, abs); err == nil {
+		return davError("rename", newName, fs.ErrExist)
+	}
+	parent, err := d.cache.dir(ctx, path.Dir(abs))
+	if err != nil {
+		return davError("rename", newName, err)
+	}
+	stored, err := d.cache.storedName(parent, path.Base(abs))
+	if err != nil {
+		return err
+	}
+	if _, err := d.root.c.MoveItem(ctx, d.root.driveID, e.ID, parent.id, stored); err != nil {
+		return fmt.Errorf("move /%s: %w", e.Path, err)
+	}
+	d.cache.invalidate(path.Dir(e.Path))
+	d.cache.invalidate(path.Dir(abs))
+	return nil
+}
+
+func (d *davFS) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return d.create(ctx, name, flag)
+	}
+	e, err := d.cache.stat(ctx, name)
+	if err != nil {
+		return nil, davError("open", name, err)
+	}
+	info, err := d.info(ctx, e)
+	if err != nil {
+		return nil, davError("open", name, err)
+	}
+	return &davFile{
+		fs:    d,
+		ctx:   ctx,
+		entry: e,
+		info:  info,
+	}, nil
+}
+
+// create opens a file for writing, the content is spooled into
+// a temporary file and uploaded (replacing the remote one) on close
+func (d *davFS) create(ctx context.Context, name string, flag int) (webdav.File, error) {
+	abs := cleanRemotePath(name)
+	if abs == "" {
+		return nil, davError("open", name, errDavRoot)
+	}
+	if _, err := d.cache.dir(ctx, path.Dir(abs)); err != nil {
+		return nil, davError("open", name, err)
+	}
+	e, err := d.cache.stat(ctx, abs)
+	switch {
+	case err == nil && e.IsFolder():
+		return nil, davError("open", name, errDavFolder)
+	case err == nil && flag&os.O_EXCL != 0:
+		return nil, davError("open", name, fs.ErrExist)
+	case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE == 0:
+		return nil, davError("open", name, err)
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "onedrive-webdav-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temporary file: %w", err)
+	}
+	e.Path, e.Name = abs, path.Base(abs)
+	return &davFile{
+		fs:    d,
+		ctx:   ctx,
+		entry: e,
+		tmp:   tmp,
+	}, nil
+}
+
+func (d *davFS) info(ctx context.Context, e FileEntry) (*davInfo, error) {
+	size, encrypted, err := d.cache.plainSize(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	return &davInfo{
+		entry: e,
+		size:  size,
+		plain: !encrypted,
+	}, nil
+}
+
+// davError wraps err into a *fs.PathError, flattening the missing and
+// existing item errors: the WebDAV handler tells them apart with
+// os.IsNotExist and os.IsExist, which don't unwrap error chains
+func davError(op, name string, err error) error {
+	for _, target := range []error{fs.ErrNotExist, fs.ErrExist} {
+		if errors.Is(err, target) {
+			return &fs.PathError{Op: op, Path: name, Err: target}
+		}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// davInfo describes a drive item, it provides the content type and
+// the eTag so the WebDAV handler doesn't read the content for them
+type davInfo struct {
+	entry FileEntry
+	size  int64
+	// plain tells if the content isn't encrypted, so the
+	// remote mime type describes it
+	plain bool
+}
+
+func (i *davInfo) Name() string {
+	return path.Base("/" + i.entry.Path)
+}
+
+func (i *davInfo) Size() int64 {
+	return i.size
+}
+
+func (i *davInfo) Mode() fs.FileMode {
+	if i.IsDir() {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+func (i *davInfo) ModTime() time.Time {
+	return i.entry.Modified
+}
+
+func (i *davInfo) IsDir() bool {
+	return i.entry.IsFolder()
+}
+
+func (i *davInfo) Sys() any {
+	return i.entry
+}
+
+func (i *davInfo) ContentType(context.Context) (string, error) {
+	if t := mime.TypeByExtension(path.Ext(i.entry.Name)); t != "" {
+		return t, nil
+	}
+	if i.plain && i.entry.File.MimeType != "" {
+		return i.entry.File.MimeType, nil
+	}
+	return "application/octet-stream", nil
+}
+
+func (i *davInfo) ETag(context.Context) (string, error) {
+	switch {
+	case i.entry.ETag == "":
+		return "", webdav.ErrNotImplemented
+	case i.entry.ETag[0] == '"':
+		return i.entry.ETag, nil
+	}
+	return `"` + i.entry.ETag + `"`, nil
+}
+
+// davFile is an open item, a folder to list, a remote file read
+// through a streamed download or a new content spooled into tmp
+type davFile struct {
+	fs    *davFS
+	ctx   context.Context
+	entry FileEntry
+	info  *davInfo
+
+	// pos is the read offset, the body (when open) is at bodyPos
+	pos     int64
+	body    io.ReadCloser
+	bodyPos int64
+	cancel  context.CancelFunc
+
+	// listed is how many folder entries Readdir returned
+	listed int
+
+	tmp *os.File
+}
+
+func (f *davFile) Stat() (fs.FileInfo, error) {
+	if f.tmp == nil {
+		return f.info, nil
+	}
+	info, err := f.tmp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	e := f.entry
+	e.Size, e.Modified = int(info.Size()), info.ModTime()
+	return &davInfo{entry: e, size: info.Size(), plain: true}, nil
+}
+
+func (f *davFile) Readdir(count int) ([]fs.FileInfo, error) {
+	if !f.entry.IsFolder() || f.tmp != nil {
+		return nil, davError("readdir", f.entry.Path, errors.New("not a folder"))
+	}
+	d, err := f.fs.cache.dir(f.ctx, f.entry.Path)
+	if err != nil {
+		return nil, err
+	}
+	entries := d.entries[min(f.listed, len(d.entries)):]
+	if count > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		entries = entries[:min(count, len(entries))]
+	}
+	f.listed += len(entries)
+
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := f.fs.info(f.ctx, e)
+		if err != nil {
+			return nil, davError("readdir", e.Path, err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if f.tmp != nil {
+		return f.tmp.Read(p)
+	}
+	if f.entry.IsFolder() {
+		return 0, davError("read", f.entry.Path, errDavFolder)
+	}
+	if f.pos >= f.info.size {
+		return 0, io.EOF
+	}
+	if f.body == nil || f.bodyPos != f.pos {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.body.Read(p)
+	f.pos += int64(n)
+	f.bodyPos += int64(n)
+	return n, err
+}
+
+// open starts streaming the content from pos, encrypted content
+// is decrypted from its start so the skipped part is discarded
+func (f *davFile) open() error {
+	f.closeBody()
+	ctx, cancel := context.WithCancel(f.ctx)
+	pr, pw := io.Pipe()
+	root := f.fs.root
+
+	offset, skip := f.pos, int64(0)
+	var opts []client.TransferOption
+	if f.info.plain {
+		opts = append(opts, client.WithOffset(offset))
+	} else {
+		skip = offset
+	}
+	go func() {
+		_, _, err := downloadItem(ctx, root.c, root.kr, root.driveID, f.entry.ID, "", pw, opts...)
+		_ = pw.CloseWithError(err)
+	}()
+	f.body, f.bodyPos, f.cancel = pr, offset, cancel
+
+	if _, err := io.CopyN(io.Discard, pr, skip); err != nil {
+		f.closeBody()
+		return fmt.Errorf("skip to offset %d: %w", offset, err)
+	}
+	return nil
+}
+
+func (f *davFile) closeBody() {
+	if f.body == nil {
+		return
+	}
+	f.cancel()
+	_ = f.body.Close()
+	f.body, f.cancel = nil, nil
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	if f.tmp != nil {
+		return f.tmp.Seek(offset, whence)
+	}
+	pos := offset
+	switch whence {
+	case io.SeekCurrent:
+		pos += f.pos
+	case io.SeekEnd:
+		pos += f.info.size
+	}
+	if pos < 0 {
+		return 0, davError("seek", f.entry.Path, fs.ErrInvalid)
+	}
+	f.pos = pos
+	return pos, nil
+}
+
+func (f *davFile) Write(p []byte) (int, error) {
+	if f.tmp == nil {
+		return 0, davError("write", f.entry.Path, errDavReadOnly)
+	}
+	return f.tmp.Write(p)
+}
+
+// Close stops the download or, for written files, uploads the content
+func (f *davFile) Close() error {
+	if f.tmp == nil {
+		f.closeBody()
+		return nil
+	}
+	defer func() {
+		_ = f.tmp.Close()
+		_ = os.Remove(f.tmp.Name())
+	}()
+	return f.upload()
+}
+
+func (f *davFile) upload() error {
+	info, err := f.tmp.Stat()
+	if err != nil {
+		return fmt.Errorf("stat temporary file: %w", err)
+	}
+	abs := f.entry.Path
+	parent, err := f.fs.cache.dir(f.ctx, path.Dir(abs))
+	if err != nil {
+		return err
+	}
+	stored, err := f.fs.cache.storedName(parent, path.Base(abs))
+	if err != nil {
+		return err
+	}
+	up := fileUpload{
+		file:     localFile{path: f.tmp.Name(), remote: abs, size: info.Size()},
+		name:     stored,
+		parentID: parent.id,
+		behavior: client.ConflictBehaviorReplace,
+		kr:       f.fs.root.uploadKeyring(),
+	}
+	err = uploadLocalFile(f.ctx, f.fs.root.c, f.fs.root.driveID, up, f.fs.opts, nil)
+	f.fs.cache.invalidate(path.Dir(abs))
+	if err != nil {
+		return fmt.Errorf("upload /%s: %w", abs, err)
+	}
+	return nil
+}
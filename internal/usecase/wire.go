@@ -9,12 +9,12 @@ import (
 )
 
 func NewFileUpload(_ client.Client) *FileUploadUseCase {
-	wire.Build(persistence.NewAuthRepository, persistence.NewDB, newFileUploadUseCase)
+	wire.Build(persistence.NewAuthRepository, persistence.NewEncryptionRepository, persistence.NewDB, newFileUploadUseCase)
 	return nil
 }
 
 func NewListFilesUseCase(_ client.Client) *ListFilesUseCase {
-	wire.Build(persistence.NewAuthRepository, persistence.NewDB, newListFilesUseCase)
+	wire.Build(persistence.NewAuthRepository, persistence.NewEncryptionRepository, persistence.NewDB, newListFilesUseCase)
 	return nil
 }
 
@@ -22,3 +22,121 @@ func NewDriveAddUseUseCase(_ client.Client) *DriveAddUseUseCase {
 	wire.Build(persistence.NewAuthRepository, persistence.NewDB, newDriveAddUseCase)
 	return nil
 }
+
+func NewEncryptionUseCase(_ client.Client) *EncryptionUseCase {
+	wire.Build(persistence.NewAuthRepository, persistence.NewEncryptionRepository, persistence.NewDB, newEncryptionUseCase)
+	return nil
+}
+
+func NewFileRestoreUseCase(_ client.Client) *FileRestoreUseCase {
+	wire.Build(persistence.NewAuthRepository, persistence.NewEncryptionRepository, persistence.NewDB, newFileRestoreUseCase)
+	return nil
+}
+
+func NewVersionsUseCase(_ client.Client) *VersionsUseCase {
+	wire.Build(persistence.NewAuthRepository, persistence.NewEncryptionRepository, persistence.NewDB, newVersionsUseCase)
+	return nil
+}
+
+func NewSharingUseCase(_ client.Client) *SharingUseCase {
+	wire.Build(persistence.NewAuthRepository, persistence.NewEncryptionRepository, persistence.NewDB, newSharingUseCase)
+	return nil
+}
+
+func NewFindUseCase(_ client.Client) *FindUseCase {
+	wire.Build(persistence.NewAuthRepository, persistence.NewEncryptionRepository, persistence.NewDB, newFindUseCase)
+	return nil
+}
+
+func NewTreeUseCase(_ client.Client) *TreeUseCase {
+	wire.Build(persistence.NewAuthRepository, persistence.NewEncryptionRepository, persistence.NewDB, newTreeUseCase)
+	return nil
+}
+
+func NewShellUseCase(_ client.Client) *ShellUseCase {
+	wire.Build(persistence.NewAuthRepository, persistence.NewEncryptionRepository, persistence.NewDB, newShellUseCase)
+	return nil
+}
+
+func NewWebDAVUseCase(_ client.Client) *WebDAVUseCase {
+	wire.Build(
+		persistence.NewAuthRepository,
+		persistence.NewEncryptionRepository,
+		persistence.NewDB,
+		newWebDAVUseCase,
+	)
+	return nil
+}
+
+func NewS3UseCase(_ client.Client) *S3UseCase {
+	wire.Build(
+		persistence.NewAuthRepository,
+		persistence.NewEncryptionRepository,
+		persistence.NewDB,
+		newS3UseCase,
+	)
+	return nil
+}
+
+func NewThumbnailsUseCase(_ client.Client) *ThumbnailsUseCase {
+	wire.Build(
+		persistence.NewAuthRepository,
+		persistence.NewEncryptionRepository,
+		persistence.NewDB,
+		newThumbnailsUseCase,
+	)
+	return nil
+}
+
+func NewTrashUseCase(_ client.Client) *TrashUseCase {
+	wire.Build(
+		persistence.NewAuthRepository,
+		persistence.NewEncryptionRepository,
+		persistence.NewDB,
+		newTrashUseCase,
+	)
+	return nil
+}
+
+func NewNotificationsUseCase(_ client.Client) *NotificationsUseCase {
+	wire.Build(
+		persistence.NewAuthRepository,
+		persistence.NewEncryptionRepository,
+		persistence.NewSubscriptionRepository,
+		persistence.NewDB,
+		newNotificationsUseCase,
+	)
+	return nil
+}
+
+func NewDaemonUseCase(_ client.Client) *DaemonUseCase {
+	wire.Build(
+		persistence.NewAuthRepository,
+		persistence.NewEncryptionRepository,
+		persistence.NewJobRunRepository,
+		persistence.NewDB,
+		newFileUploadUseCase,
+		newDaemonUseCase,
+	)
+	return nil
+}
+
+func NewDashboardUseCase(_ client.Client) *DashboardUseCase {
+	wire.Build(
+		persistence.NewAuthRepository,
+		persistence.NewEncryptionRepository,
+		persistence.NewJobRunRepository,
+		persistence.NewDB,
+		newDashboardUseCase,
+	)
+	return nil
+}
+
+func NewMetricsUseCase(_ client.Client) *MetricsUseCase {
+	wire.Build(
+		persistence.NewAuthRepository,
+		persistence.NewDB,
+		newMetricsUseCase,
+	)
+	return nil
+}
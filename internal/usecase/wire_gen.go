@@ -16,14 +16,16 @@ import (
 func NewFileUpload(clientClient client.Client) *FileUploadUseCase {
 	db := persistence.NewDB()
 	authRepository := persistence.NewAuthRepository(db)
-	fileUploadUseCase := newFileUploadUseCase(clientClient, authRepository)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	fileUploadUseCase := newFileUploadUseCase(authRepository, encryptionRepository)
 	return fileUploadUseCase
 }
 
 func NewListFilesUseCase(clientClient client.Client) *ListFilesUseCase {
 	db := persistence.NewDB()
 	authRepository := persistence.NewAuthRepository(db)
-	listFilesUseCase := newListFilesUseCase(authRepository)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	listFilesUseCase := newListFilesUseCase(authRepository, encryptionRepository)
 	return listFilesUseCase
 }
 
@@ -33,3 +35,126 @@ func NewDriveAddUseUseCase(clientClient client.Client) *DriveAddUseUseCase {
 	driveAddUseUseCase := newDriveAddUseCase(clientClient, authRepository)
 	return driveAddUseUseCase
 }
+
+func NewEncryptionUseCase(clientClient client.Client) *EncryptionUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	encryptionUseCase := newEncryptionUseCase(authRepository, encryptionRepository)
+	return encryptionUseCase
+}
+
+func NewFileRestoreUseCase(clientClient client.Client) *FileRestoreUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	fileRestoreUseCase := newFileRestoreUseCase(authRepository, encryptionRepository)
+	return fileRestoreUseCase
+}
+
+func NewVersionsUseCase(clientClient client.Client) *VersionsUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	versionsUseCase := newVersionsUseCase(authRepository, encryptionRepository)
+	return versionsUseCase
+}
+
+func NewSharingUseCase(clientClient client.Client) *SharingUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	sharingUseCase := newSharingUseCase(authRepository, encryptionRepository)
+	return sharingUseCase
+}
+
+func NewFindUseCase(clientClient client.Client) *FindUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	findUseCase := newFindUseCase(authRepository, encryptionRepository)
+	return findUseCase
+}
+
+func NewTreeUseCase(clientClient client.Client) *TreeUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	treeUseCase := newTreeUseCase(authRepository, encryptionRepository)
+	return treeUseCase
+}
+
+func NewShellUseCase(clientClient client.Client) *ShellUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	shellUseCase := newShellUseCase(authRepository, encryptionRepository)
+	return shellUseCase
+}
+
+func NewWebDAVUseCase(clientClient client.Client) *WebDAVUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	webDAVUseCase := newWebDAVUseCase(authRepository, encryptionRepository)
+	return webDAVUseCase
+}
+
+func NewS3UseCase(clientClient client.Client) *S3UseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	s3UseCase := newS3UseCase(authRepository, encryptionRepository)
+	return s3UseCase
+}
+
+func NewThumbnailsUseCase(clientClient client.Client) *ThumbnailsUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	thumbnailsUseCase := newThumbnailsUseCase(authRepository, encryptionRepository)
+	return thumbnailsUseCase
+}
+
+func NewTrashUseCase(clientClient client.Client) *TrashUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	trashUseCase := newTrashUseCase(authRepository, encryptionRepository)
+	return trashUseCase
+}
+
+func NewNotificationsUseCase(clientClient client.Client) *NotificationsUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	subscriptionRepository := persistence.NewSubscriptionRepository(db)
+	notificationsUseCase := newNotificationsUseCase(authRepository, encryptionRepository, subscriptionRepository)
+	return notificationsUseCase
+}
+
+func NewDaemonUseCase(clientClient client.Client) *DaemonUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	fileUploadUseCase := newFileUploadUseCase(authRepository, encryptionRepository)
+	jobRunRepository := persistence.NewJobRunRepository(db)
+	daemonUseCase := newDaemonUseCase(fileUploadUseCase, jobRunRepository)
+	return daemonUseCase
+}
+
+func NewDashboardUseCase(clientClient client.Client) *DashboardUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	encryptionRepository := persistence.NewEncryptionRepository(db)
+	jobRunRepository := persistence.NewJobRunRepository(db)
+	dashboardUseCase := newDashboardUseCase(authRepository, encryptionRepository, jobRunRepository)
+	return dashboardUseCase
+}
+
+func NewMetricsUseCase(clientClient client.Client) *MetricsUseCase {
+	db := persistence.NewDB()
+	authRepository := persistence.NewAuthRepository(db)
+	metricsUseCase := newMetricsUseCase(authRepository)
+	return metricsUseCase
+}